@@ -0,0 +1,445 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+// A cluster runs all of its nodes in the test process. Nodes are connected over an in-memory network
+// by default, or over the RPC transport on loopback addresses. Either way faults are injected into
+// the messages between the nodes by their fault transports.
+
+// Operations of the helpers are given up after TIMEOUT, enough for several elections
+const TIMEOUT = 10 * kv.MAX_ELECTION_TIMEOUT
+
+// Interval in which the helpers check the state of the nodes
+const POLL_INTERVAL = 10 * time.Millisecond
+
+var ErrTimeout = errors.New("cluster: timed out")
+var ErrNotFound = errors.New("cluster: key not found")
+var ErrCompareFailed = errors.New("cluster: compare failed")
+
+// Loopback clusters get addresses of their own, nodes are addressed by their IP on the fixed ports
+var loopbackCluster = 0
+var loopbackMutex sync.Mutex
+
+type Cluster struct {
+	t testing.TB
+
+	// Nil for loopback clusters
+	network *kv.MemoryNetwork
+	// Sends the requests of the helpers, it is never partitioned
+	client kv.Transport
+
+	addresses []net.IP
+	// Killed nodes are nil
+	nodes []*kv.KeyValueStore
+	// Nodes keep their ID across restarts, like they would in their data directory
+	ids    []string
+	faults []*kv.FaultTransport
+	// Faults of the links between nodes, which are kept when nodes restart
+	links map[link]kv.LinkFaults
+	mutex sync.Mutex
+}
+
+// link connects the sending node to the receiving node
+type link struct {
+	from int
+	to   int
+}
+
+type Option func(c *Cluster)
+
+// Loopback connects the nodes over the RPC transport on 127.x.y.z addresses instead of the in-memory network
+func Loopback() Option {
+	return func(c *Cluster) {
+		c.network = nil
+		c.client = kv.NewHTTPTransport(kv.DefaultConfig())
+
+		loopbackMutex.Lock()
+		loopbackCluster++
+		cluster := loopbackCluster
+		loopbackMutex.Unlock()
+		for index := range c.addresses {
+			c.addresses[index] = net.IPv4(127, 1, byte(cluster), byte(index+1))
+		}
+	}
+}
+
+// New starts a cluster of size nodes, node 0 is the initial leader. The cluster is stopped once the test finished.
+func New(t testing.TB, size int, options ...Option) *Cluster {
+	t.Helper()
+
+	network := kv.NewMemoryNetwork()
+	c := &Cluster{
+		t:         t,
+		network:   network,
+		client:    network.NewTransport(net.IPv4(10, 0, 255, 254)),
+		addresses: make([]net.IP, size),
+		nodes:     make([]*kv.KeyValueStore, size),
+		ids:       make([]string, size),
+		faults:    make([]*kv.FaultTransport, size),
+		links:     make(map[link]kv.LinkFaults),
+	}
+	for index := range c.addresses {
+		c.addresses[index] = net.IPv4(10, 0, 0, byte(index+1))
+	}
+	for _, option := range options {
+		option(c)
+	}
+	t.Cleanup(c.Stop)
+
+	for index := range c.nodes {
+		if err := c.start(index, index == 0, c.addresses[0]); err != nil {
+			t.Fatalf("could not start node %d: %v", index, err)
+		}
+	}
+	// Followers only elect a new leader among the followers they heard of with the heart beat
+	if err := c.waitFor(func() bool {
+		for index := range c.nodes {
+			if node := c.Node(index); len(node.Followers) != size-1 {
+				return false
+			}
+		}
+		return true
+	}); err != nil {
+		t.Fatal("followers did not learn about each other")
+	}
+	return c
+}
+
+// start runs the node at index, followers join the cluster at entryAddress
+func (c *Cluster) start(index int, leader bool, entryAddress net.IP) error {
+	address := c.addresses[index]
+	config := kv.DefaultConfig()
+	config.NodeID = c.ids[index]
+	var transport kv.Transport
+	if c.network != nil {
+		transport = c.network.NewTransport(address)
+	} else {
+		rpcTransport := kv.NewRPCTransport(config)
+		rpcTransport.Host = address.String()
+		transport = rpcTransport
+	}
+	faults := kv.NewFaultTransport(transport)
+	c.mutex.Lock()
+	for link, linkFaults := range c.links {
+		if link.from == index {
+			faults.SetLinkFaults(c.addresses[link.to], linkFaults)
+		}
+	}
+	c.faults[index] = faults
+	c.mutex.Unlock()
+
+	node := kv.InitKeyValueStoreWithConfig(config, leader, entryAddress, address, faults)
+	c.ids[index] = node.ID
+	if err := node.Join(entryAddress); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.nodes[index] = node
+	c.mutex.Unlock()
+
+	return c.waitFor(func() bool {
+		resp, err := c.client.Get(kv.Member{Address: address}, "/status")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	})
+}
+
+// Stop kills all nodes
+func (c *Cluster) Stop() {
+	for index := range c.nodes {
+		c.Kill(index)
+	}
+}
+
+func (c *Cluster) Size() int {
+	return len(c.nodes)
+}
+
+func (c *Cluster) Address(index int) net.IP {
+	return c.addresses[index]
+}
+
+// Node returns the node at index, or nil if it was killed
+func (c *Cluster) Node(index int) *kv.KeyValueStore {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.nodes[index]
+}
+
+//
+// Faults
+//
+
+// Kill stops the node at index without notifying the other nodes
+func (c *Cluster) Kill(index int) {
+	c.mutex.Lock()
+	node := c.nodes[index]
+	c.nodes[index] = nil
+	c.mutex.Unlock()
+
+	if node != nil {
+		node.Stop()
+	}
+}
+
+// Restart replaces the node at index by a new node with an empty state, which joins the cluster over any running node
+func (c *Cluster) Restart(index int) {
+	c.t.Helper()
+
+	c.Kill(index)
+	var err error = ErrTimeout
+	for other := range c.nodes {
+		if other == index || c.Node(other) == nil {
+			continue
+		}
+		if err = c.start(index, false, c.addresses[other]); err == nil {
+			return
+		}
+	}
+	c.t.Fatalf("could not restart node %d: %v", index, err)
+}
+
+// SetLinkFaults replaces the faults of the messages the node at from sends to the node at to
+func (c *Cluster) SetLinkFaults(from int, to int, faults kv.LinkFaults) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if faults == (kv.LinkFaults{}) {
+		delete(c.links, link{from, to})
+	} else {
+		c.links[link{from, to}] = faults
+	}
+	c.faults[from].SetLinkFaults(c.addresses[to], faults)
+}
+
+// Block drops all messages the node at from sends to the nodes at to, but not their replies or the messages in the other direction
+func (c *Cluster) Block(from int, to ...int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, index := range to {
+		faults := c.links[link{from, index}]
+		faults.Blocked = true
+		c.links[link{from, index}] = faults
+		c.faults[from].Block(c.addresses[index])
+	}
+}
+
+// Partition splits the cluster into the given groups of node indices, nodes without a group reach every node
+func (c *Cluster) Partition(groups ...[]int) {
+	for group, indices := range groups {
+		for other, otherIndices := range groups {
+			if group == other {
+				continue
+			}
+			for _, index := range indices {
+				c.Block(index, otherIndices...)
+			}
+		}
+	}
+}
+
+// Heal removes all faults between the nodes
+func (c *Cluster) Heal() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.links = make(map[link]kv.LinkFaults)
+	for _, faults := range c.faults {
+		if faults != nil {
+			faults.Heal()
+		}
+	}
+}
+
+//
+// Leader
+//
+
+// Leader returns the index of the leader that a majority of all nodes follows, or -1 if there is none
+func (c *Cluster) Leader() int {
+	leader := -1
+	var leaderTerm uint64
+	for index := range c.nodes {
+		if node := c.Node(index); node != nil && node.IsLeader() && (leader == -1 || node.Term > leaderTerm) {
+			leader, leaderTerm = index, node.Term
+		}
+	}
+	if leader == -1 {
+		return -1
+	}
+
+	followers := 0
+	for index := range c.nodes {
+		if node := c.Node(index); node != nil && node.LeaderAddress.Equal(c.addresses[leader]) {
+			followers++
+		}
+	}
+	if followers <= len(c.nodes)/2 {
+		return -1
+	}
+	return leader
+}
+
+// WaitForLeader returns the index of the leader once a majority of all nodes follows it
+func (c *Cluster) WaitForLeader() int {
+	c.t.Helper()
+
+	leader := -1
+	if err := c.waitFor(func() bool { leader = c.Leader(); return leader != -1 }); err != nil {
+		c.t.Fatal("no leader was elected")
+	}
+	return leader
+}
+
+// WaitForNewLeader waits for a leader other than the node at previous
+func (c *Cluster) WaitForNewLeader(previous int) int {
+	c.t.Helper()
+
+	leader := -1
+	if err := c.waitFor(func() bool { leader = c.Leader(); return leader != -1 && leader != previous }); err != nil {
+		c.t.Fatalf("no leader other than node %d was elected", previous)
+	}
+	return leader
+}
+
+//
+// Client Requests
+//
+
+// Write sets key to value over the node at index, followers forward the write to their leader
+func (c *Cluster) Write(index int, key string, value string) error {
+	return c.request(func() (*http.Response, error) {
+		return c.client.Post(kv.Member{Address: c.addresses[index]}, "/write/"+url.PathEscape(key), "text/plain", strings.NewReader(value))
+	}, nil)
+}
+
+// CompareAndSwap sets key to value if its value is expected, or if it does not exist for a nil expected value.
+// Otherwise ErrCompareFailed is returned.
+func (c *Cluster) CompareAndSwap(index int, key string, expected *string, value string) error {
+	body, _ := json.Marshal(kv.CompareAndSwapMessage{Expected: expected, Value: value})
+	return c.request(func() (*http.Response, error) {
+		return c.client.Post(kv.Member{Address: c.addresses[index]}, "/cas/"+url.PathEscape(key), "application/json", bytes.NewBuffer(body))
+	}, nil)
+}
+
+// Read returns the value of key read over the node at index, or ErrNotFound
+func (c *Cluster) Read(index int, key string) (string, error) {
+	var value []byte
+	err := c.request(func() (*http.Response, error) {
+		return c.client.Get(kv.Member{Address: c.addresses[index]}, "/raw/"+url.PathEscape(key))
+	}, &value)
+	return string(value), err
+}
+
+// request gives up on requests that do not complete within TIMEOUT, like writes without a reachable majority
+func (c *Cluster) request(send func() (*http.Response, error), body *[]byte) error {
+	done := make(chan error, 1)
+	go func() {
+		resp, err := send()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer resp.Body.Close()
+
+		responseBytes, _ := ioutil.ReadAll(resp.Body)
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			done <- ErrNotFound
+			return
+		case http.StatusConflict:
+			done <- ErrCompareFailed
+			return
+		default:
+			done <- fmt.Errorf("cluster: request failed with %d: %s", resp.StatusCode, responseBytes)
+			return
+		}
+		if body != nil {
+			*body = responseBytes
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(TIMEOUT):
+		return ErrTimeout
+	}
+}
+
+// WaitForValue waits until key is set to value on all running nodes
+func (c *Cluster) WaitForValue(key string, value string) {
+	c.t.Helper()
+
+	if err := c.waitFor(func() bool {
+		for index := range c.nodes {
+			node := c.Node(index)
+			if node == nil {
+				continue
+			}
+			if nodeValue, ok := node.LocalDatabase()[key]; !ok || string(nodeValue) != value {
+				return false
+			}
+		}
+		return true
+	}); err != nil {
+		c.t.Fatalf("key %q was not set to %q on all nodes", key, value)
+	}
+}
+
+// WaitForConvergence waits until all running nodes have the same database
+func (c *Cluster) WaitForConvergence() {
+	c.t.Helper()
+
+	if err := c.waitFor(func() bool {
+		var database map[string][]byte
+		for index := range c.nodes {
+			node := c.Node(index)
+			if node == nil {
+				continue
+			}
+			if database == nil {
+				database = node.LocalDatabase()
+			} else if !reflect.DeepEqual(database, node.LocalDatabase()) {
+				return false
+			}
+		}
+		return true
+	}); err != nil {
+		c.t.Fatal("databases of the nodes did not converge")
+	}
+}
+
+func (c *Cluster) waitFor(condition func() bool) error {
+	deadline := time.Now().Add(TIMEOUT)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(POLL_INTERVAL)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+func TestReplication(t *testing.T) {
+	for name, options := range map[string][]Option{"memory": nil, "loopback": {Loopback()}} {
+		t.Run(name, func(t *testing.T) {
+			c := New(t, 3, options...)
+			if leader := c.WaitForLeader(); leader != 0 {
+				t.Fatalf("node %d leads instead of the initial leader", leader)
+			}
+
+			for index := 0; index < c.Size(); index++ {
+				key := "replicated-" + strconv.Itoa(index)
+				if err := c.Write(index, key, "value"); err != nil {
+					t.Fatalf("write over node %d failed: %v", index, err)
+				}
+				c.WaitForValue(key, "value")
+				if value, err := c.Read((index+1)%c.Size(), key); err != nil || value != "value" {
+					t.Fatalf("read %q (%v) over node %d", value, err, (index+1)%c.Size())
+				}
+			}
+			c.WaitForConvergence()
+		})
+	}
+}
+
+func TestLeaderFailover(t *testing.T) {
+	c := New(t, 3)
+	leader := c.WaitForLeader()
+	if err := c.Write(leader, "before", "failover"); err != nil {
+		t.Fatal(err)
+	}
+	c.WaitForValue("before", "failover")
+
+	c.Kill(leader)
+	newLeader := c.WaitForNewLeader(leader)
+	if err := c.Write(newLeader, "after", "failover"); err != nil {
+		t.Fatal(err)
+	}
+	c.WaitForValue("after", "failover")
+
+	// The old leader comes back as follower and catches up
+	c.Restart(leader)
+	c.WaitForValue("before", "failover")
+	c.WaitForValue("after", "failover")
+	if c.Node(leader).Leader {
+		t.Fatal("restarted node became leader while another node leads")
+	}
+}
+
+func TestFollowerRestart(t *testing.T) {
+	// Writes need a majority of the followers, with four followers one of them may be down
+	c := New(t, 5)
+	c.WaitForLeader()
+	c.Kill(4)
+
+	for index := 0; index < 10; index++ {
+		if err := c.Write(0, "missed-"+strconv.Itoa(index), strconv.Itoa(index)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Restart(4)
+	c.WaitForValue("missed-9", "9")
+	c.WaitForConvergence()
+}
+
+func TestPartitionedLeader(t *testing.T) {
+	c := New(t, 5)
+	leader := c.WaitForLeader()
+
+	majority := make([]int, 0, c.Size()-1)
+	for index := 0; index < c.Size(); index++ {
+		if index != leader {
+			majority = append(majority, index)
+		}
+	}
+	c.Partition([]int{leader}, majority)
+
+	newLeader := c.WaitForNewLeader(leader)
+	if err := c.Write(majority[0], "partitioned", "majority"); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range majority {
+		if value, ok := c.Node(index).LocalDatabase()["partitioned"]; index == newLeader && (!ok || string(value) != "majority") {
+			t.Fatalf("new leader did not apply the write, got %q", value)
+		}
+	}
+
+	c.Heal()
+	c.Restart(leader)
+	c.WaitForValue("partitioned", "majority")
+}
+
+func TestAsymmetricPartition(t *testing.T) {
+	c := New(t, 3)
+	leader := c.WaitForLeader()
+
+	// The followers still reach the leader, but no longer receive its heart beats
+	followers := make([]int, 0, c.Size()-1)
+	for index := 0; index < c.Size(); index++ {
+		if index != leader {
+			followers = append(followers, index)
+		}
+	}
+	c.Block(leader, followers...)
+
+	newLeader := c.WaitForNewLeader(leader)
+	if err := c.Write(newLeader, "asymmetric", "partition"); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range followers {
+		if value, err := c.Read(index, "asymmetric"); err != nil || value != "partition" {
+			t.Fatalf("read %q (%v) over node %d", value, err, index)
+		}
+	}
+	c.Heal()
+}
+
+func TestUnreliableLinks(t *testing.T) {
+	c := New(t, 5)
+	leader := c.WaitForLeader()
+
+	// Messages between all nodes are delayed, duplicated and reordered
+	unreliable := kv.LinkFaults{Duplicate: 0.3, Reorder: 0.3, Delay: time.Millisecond, Jitter: 5 * time.Millisecond}
+	for from := 0; from < c.Size(); from++ {
+		for to := 0; to < c.Size(); to++ {
+			if from != to {
+				c.SetLinkFaults(from, to, unreliable)
+			}
+		}
+	}
+	// Writes only need a majority of the followers, so the messages to one of them may get lost
+	lossy := (leader + 1) % c.Size()
+	lossyFaults := unreliable
+	lossyFaults.Drop = 0.5
+	c.SetLinkFaults(leader, lossy, lossyFaults)
+
+	for index := 0; index < 20; index++ {
+		if err := c.Write(leader, "unreliable-"+strconv.Itoa(index), strconv.Itoa(index)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for index := 0; index < c.Size(); index++ {
+		if index == lossy {
+			continue
+		}
+		for key := 0; key < 20; key++ {
+			if value, err := c.Read(index, "unreliable-"+strconv.Itoa(key)); err != nil || value != strconv.Itoa(key) {
+				t.Fatalf("read %q (%v) of key %d over node %d", value, err, key, index)
+			}
+		}
+	}
+}
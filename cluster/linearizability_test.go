@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/linearizability"
+)
+
+const LINEARIZABILITY_CLIENTS = 5
+const LINEARIZABILITY_OPERATIONS = 40
+const LINEARIZABILITY_KEYS = 3
+
+// linearizabilityClient runs random reads, writes and compare and swaps over random nodes. Operations
+// that fail without a definite response are left pending, they might have taken effect anyway.
+func linearizabilityClient(c *Cluster, recorder *linearizability.Recorder, client int, seed int64) {
+	random := rand.New(rand.NewSource(seed))
+	observed := make(map[string]*string)
+
+	for operation := 0; operation < LINEARIZABILITY_OPERATIONS; operation++ {
+		node := random.Intn(c.Size())
+		key := "linearizable/" + strconv.Itoa(random.Intn(LINEARIZABILITY_KEYS))
+		value := strconv.Itoa(client) + "-" + strconv.Itoa(operation)
+
+		switch random.Intn(4) {
+		case 0:
+			id := recorder.Invoke(client, linearizability.KVInput{Operation: linearizability.KVWrite, Key: key, Value: value})
+			if err := c.Write(node, key, value); err == nil {
+				recorder.Return(id, linearizability.KVOutput{})
+			}
+		case 1:
+			expected := observed[key]
+			id := recorder.Invoke(client, linearizability.KVInput{Operation: linearizability.KVCompareAndSwap, Key: key, Value: value, Expected: expected})
+			switch err := c.CompareAndSwap(node, key, expected, value); err {
+			case nil:
+				recorder.Return(id, linearizability.KVOutput{Swapped: true})
+			case ErrCompareFailed:
+				recorder.Return(id, linearizability.KVOutput{Swapped: false})
+			}
+		default:
+			id := recorder.Invoke(client, linearizability.KVInput{Operation: linearizability.KVRead, Key: key})
+			switch read, err := c.Read(node, key); err {
+			case nil:
+				observed[key] = &read
+				recorder.Return(id, linearizability.KVOutput{Value: read, Found: true})
+			case ErrNotFound:
+				observed[key] = nil
+				recorder.Return(id, linearizability.KVOutput{Found: false})
+			}
+		}
+	}
+}
+
+func TestLinearizability(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+
+	c := New(t, 5)
+	leader := c.WaitForLeader()
+	unreliable := kv.LinkFaults{Duplicate: 0.2, Reorder: 0.2, Delay: time.Millisecond, Jitter: 5 * time.Millisecond}
+	for from := 0; from < c.Size(); from++ {
+		for to := 0; to < c.Size(); to++ {
+			if from != to {
+				c.SetLinkFaults(from, to, unreliable)
+			}
+		}
+	}
+
+	recorder := linearizability.NewRecorder()
+	var clients sync.WaitGroup
+	for client := 0; client < LINEARIZABILITY_CLIENTS; client++ {
+		clients.Add(1)
+		go func(client int) {
+			defer clients.Done()
+			linearizabilityClient(c, recorder, client, seed+int64(client))
+		}(client)
+	}
+
+	// A follower is partitioned from the other nodes for a while, requests over it fail meanwhile
+	isolated := (leader + 1) % c.Size()
+	others := make([]int, 0, c.Size()-1)
+	for index := 0; index < c.Size(); index++ {
+		if index != isolated {
+			others = append(others, index)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.Partition([]int{isolated}, others)
+	time.Sleep(300 * time.Millisecond)
+	c.Heal()
+	clients.Wait()
+
+	history := recorder.History()
+	completed := 0
+	for _, operation := range history {
+		if operation.Return != linearizability.PENDING {
+			completed++
+		}
+	}
+	if completed < len(history)/2 {
+		t.Fatalf("only %d of %d operations completed", completed, len(history))
+	}
+	if result := linearizability.Check(linearizability.KVModel, history); !result.Linearizable {
+		t.Fatal(result.Describe(linearizability.KVModel))
+	}
+}
@@ -0,0 +1,380 @@
+package cluster
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The model test runs random sequences of client operations and cluster events against a cluster and
+// compares every result with a sequential model of the database. Failing sequences are shrunk to the
+// shortest sequence found that still fails, which is reported along with the seed.
+
+const MODEL_SEQUENCES = 3
+const MODEL_OPERATIONS = 30
+const MODEL_KEYS = 3
+const MODEL_SIZE = 5
+
+// At most MODEL_UNAVAILABLE nodes are killed or partitioned at the same time, so that a majority remains
+const MODEL_UNAVAILABLE = 2
+
+// Client operations are attempted MODEL_ATTEMPTS times, since they fail while a new leader is elected
+const MODEL_ATTEMPTS = 3
+
+// A failing sequence is run at most MODEL_SHRINK_RUNS more times while it is shrunk
+const MODEL_SHRINK_RUNS = 20
+
+type modelOperationType int
+
+const (
+	modelWrite modelOperationType = iota
+	modelRead
+	modelKillLeader
+	modelRestart
+	modelPartition
+	modelHeal
+)
+
+// modelOperation picks its node by Choice when it runs, so that operations stay valid once others are removed
+type modelOperation struct {
+	Type   modelOperationType
+	Choice int
+	Key    string
+	Value  string
+}
+
+func (o modelOperation) String() string {
+	switch o.Type {
+	case modelWrite:
+		return fmt.Sprintf("write %s = %s (choice %d)", o.Key, o.Value, o.Choice)
+	case modelRead:
+		return fmt.Sprintf("read %s (choice %d)", o.Key, o.Choice)
+	case modelKillLeader:
+		return "kill leader"
+	case modelRestart:
+		return fmt.Sprintf("restart (choice %d)", o.Choice)
+	case modelPartition:
+		return fmt.Sprintf("partition (choice %d)", o.Choice)
+	default:
+		return "heal"
+	}
+}
+
+// generateModelSequence returns mostly client operations, every fifth operation is a cluster event on average
+func generateModelSequence(random *rand.Rand, length int) []modelOperation {
+	sequence := make([]modelOperation, length)
+	for index := range sequence {
+		operation := modelOperation{
+			Choice: random.Intn(MODEL_SIZE),
+			Key:    "model/" + strconv.Itoa(random.Intn(MODEL_KEYS)),
+			Value:  strconv.Itoa(index),
+		}
+		switch weight := random.Intn(20); {
+		case weight < 8:
+			operation.Type = modelWrite
+		case weight < 16:
+			operation.Type = modelRead
+		default:
+			operation.Type = modelKillLeader + modelOperationType(weight-16)
+		}
+		sequence[index] = operation
+	}
+	return sequence
+}
+
+func formatModelSequence(sequence []modelOperation) string {
+	lines := make([]string, len(sequence))
+	for index, operation := range sequence {
+		lines[index] = fmt.Sprintf("\t%2d: %s", index, operation)
+	}
+	return strings.Join(lines, "\n")
+}
+
+//
+// Model
+//
+
+// modelRun tracks the sequential model of the database next to the cluster
+type modelRun struct {
+	tb testing.TB
+	c  *Cluster
+
+	database map[string]string
+	killed   map[int]bool
+	// The follower that is partitioned from all other nodes, or -1
+	isolated int
+}
+
+// runModelSequence runs the sequence on a new cluster and fails tb at the first result that differs from the model.
+// Nodes that missed logs do not catch up and may keep the cluster from electing a leader, the sequence ends
+// early in that case, since an unavailable cluster does not contradict the model.
+func runModelSequence(tb testing.TB, sequence []modelOperation) {
+	tb.Helper()
+
+	r := &modelRun{
+		tb:       tb,
+		c:        New(tb, MODEL_SIZE),
+		database: map[string]string{"initial": "value"},
+		killed:   make(map[int]bool),
+		isolated: -1,
+	}
+
+	for index, operation := range sequence {
+		if !r.run(index, operation) {
+			tb.Logf("cluster became unavailable at operation %d (%s)", index, operation)
+			return
+		}
+	}
+
+	// Followers that missed logs lag behind, only the leader has to hold the model
+	r.c.Heal()
+	leader, ok := r.waitForLeader(-1)
+	if !ok {
+		tb.Logf("cluster became unavailable after healing")
+		return
+	}
+	if database := r.c.Node(leader).LocalDatabase(); !r.matches(database) {
+		tb.Fatalf("leader %d ended with %s, expected %v", leader, formatDatabase(database), r.database)
+	}
+}
+
+// run applies the operation to the cluster and the model, it returns false if the cluster became unavailable
+func (r *modelRun) run(index int, operation modelOperation) bool {
+	r.tb.Helper()
+
+	switch operation.Type {
+	case modelWrite:
+		if !r.attempt(operation, func(node int) error { return r.c.Write(node, operation.Key, operation.Value) }) {
+			return false
+		}
+		r.database[operation.Key] = operation.Value
+	case modelRead:
+		return r.attempt(operation, func(node int) error {
+			value, err := r.c.Read(node, operation.Key)
+			expected, ok := r.database[operation.Key]
+			switch {
+			case err == ErrNotFound && ok:
+				r.tb.Fatalf("operation %d (%s) found no value over node %d, expected %q", index, operation, node, expected)
+			case err == nil && (!ok || value != expected):
+				r.tb.Fatalf("operation %d (%s) read %q over node %d, expected %q (found %t)", index, operation, value, node, expected, ok)
+			case err == ErrNotFound:
+				return nil
+			}
+			return err
+		})
+	case modelKillLeader:
+		if r.unavailable() >= MODEL_UNAVAILABLE {
+			return true
+		}
+		leader, ok := r.waitForLeader(-1)
+		if !ok {
+			return false
+		}
+		r.c.Kill(leader)
+		r.killed[leader] = true
+		_, ok = r.waitForLeader(leader)
+		return ok
+	case modelRestart:
+		leader, ok := r.waitForLeader(-1)
+		if !ok {
+			return false
+		}
+		// Killed nodes come back first, running followers lose their state otherwise
+		candidates := r.killedNodes()
+		if len(candidates) == 0 {
+			for _, node := range r.available() {
+				if node != leader {
+					candidates = append(candidates, node)
+				}
+			}
+		}
+		node := candidates[operation.Choice%len(candidates)]
+		r.c.Kill(node)
+		r.killed[node] = true
+		if err := r.c.start(node, false, r.c.Address(leader)); err != nil {
+			return false
+		}
+		delete(r.killed, node)
+	case modelPartition:
+		if r.isolated != -1 || r.unavailable() >= MODEL_UNAVAILABLE {
+			return true
+		}
+		leader, ok := r.waitForLeader(-1)
+		if !ok {
+			return false
+		}
+		followers := make([]int, 0, MODEL_SIZE)
+		for _, node := range r.available() {
+			if node != leader {
+				followers = append(followers, node)
+			}
+		}
+		r.isolated = followers[operation.Choice%len(followers)]
+		others := make([]int, 0, MODEL_SIZE-1)
+		for node := 0; node < MODEL_SIZE; node++ {
+			if node != r.isolated {
+				others = append(others, node)
+			}
+		}
+		r.c.Partition([]int{r.isolated}, others)
+	case modelHeal:
+		r.c.Heal()
+		r.isolated = -1
+	}
+	return true
+}
+
+// attempt sends a client operation over one of the available nodes until it succeeds, it returns false if
+// it never did. Writes set a key to a fixed value, so the model is the same no matter how often a failed
+// write was applied.
+func (r *modelRun) attempt(operation modelOperation, send func(node int) error) bool {
+	r.tb.Helper()
+
+	for attempt := 0; attempt < MODEL_ATTEMPTS; attempt++ {
+		nodes := r.available()
+		if send(nodes[(operation.Choice+attempt)%len(nodes)]) == nil {
+			return true
+		}
+		if _, ok := r.waitForLeader(-1); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+// waitForLeader waits for a leader other than the node at previous, like WaitForNewLeader without failing the test
+func (r *modelRun) waitForLeader(previous int) (int, bool) {
+	leader := -1
+	err := r.c.waitFor(func() bool { leader = r.c.Leader(); return leader != -1 && leader != previous })
+	return leader, err == nil
+}
+
+// available returns the nodes that are neither killed nor partitioned
+func (r *modelRun) available() []int {
+	nodes := make([]int, 0, MODEL_SIZE)
+	for node := 0; node < MODEL_SIZE; node++ {
+		if !r.killed[node] && node != r.isolated {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func (r *modelRun) killedNodes() []int {
+	nodes := make([]int, 0, len(r.killed))
+	for node := 0; node < MODEL_SIZE; node++ {
+		if r.killed[node] {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func (r *modelRun) unavailable() int {
+	return MODEL_SIZE - len(r.available())
+}
+
+func (r *modelRun) matches(database map[string][]byte) bool {
+	if len(database) != len(r.database) {
+		return false
+	}
+	for key, value := range database {
+		if expected, ok := r.database[key]; !ok || string(value) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+func formatDatabase(database map[string][]byte) string {
+	values := make(map[string]string, len(database))
+	for key, value := range database {
+		values[key] = string(value)
+	}
+	return fmt.Sprint(values)
+}
+
+//
+// Shrinking
+//
+
+// modelProbe records the failure of a sequence instead of failing the test, so that the sequence can be run
+// again while it is shrunk. Clusters only fail tests with Fatal and Fatalf.
+type modelProbe struct {
+	testing.TB
+
+	failure  string
+	cleanups []func()
+}
+
+func (p *modelProbe) Helper() {}
+
+func (p *modelProbe) Fatal(args ...interface{}) {
+	p.failure = fmt.Sprint(args...)
+	runtime.Goexit()
+}
+
+func (p *modelProbe) Fatalf(format string, args ...interface{}) {
+	p.failure = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func (p *modelProbe) Cleanup(cleanup func()) {
+	p.cleanups = append(p.cleanups, cleanup)
+}
+
+// probeModelSequence runs the sequence and returns its failure, or an empty string if it passed
+func probeModelSequence(t *testing.T, sequence []modelOperation) string {
+	probe := &modelProbe{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runModelSequence(probe, sequence)
+	}()
+	<-done
+
+	for index := len(probe.cleanups) - 1; index >= 0; index-- {
+		probe.cleanups[index]()
+	}
+	return probe.failure
+}
+
+// shrinkModelSequence removes ever smaller blocks of operations from the failing sequence,
+// as long as the sequence keeps failing without them
+func shrinkModelSequence(t *testing.T, sequence []modelOperation, failure string) ([]modelOperation, string) {
+	runs := 0
+	for size := len(sequence) / 2; size >= 1 && runs < MODEL_SHRINK_RUNS; size /= 2 {
+		for start := 0; start < len(sequence) && runs < MODEL_SHRINK_RUNS; runs++ {
+			end := start + size
+			if end > len(sequence) {
+				end = len(sequence)
+			}
+			candidate := append(append([]modelOperation{}, sequence[:start]...), sequence[end:]...)
+			if candidateFailure := probeModelSequence(t, candidate); candidateFailure != "" {
+				sequence, failure = candidate, candidateFailure
+			} else {
+				start = end
+			}
+		}
+	}
+	return sequence, failure
+}
+
+func TestModel(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	random := rand.New(rand.NewSource(seed))
+
+	for run := 0; run < MODEL_SEQUENCES; run++ {
+		sequence := generateModelSequence(random, MODEL_OPERATIONS)
+		if failure := probeModelSequence(t, sequence); failure != "" {
+			shrunk, shrunkFailure := shrinkModelSequence(t, sequence, failure)
+			t.Fatalf("sequence failed: %s\n%s\n\nshrunk to %d operations, which fail with: %s\n%s",
+				failure, formatModelSequence(sequence), len(shrunk), shrunkFailure, formatModelSequence(shrunk))
+		}
+	}
+}
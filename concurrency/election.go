@@ -0,0 +1,36 @@
+package concurrency
+
+import (
+	"context"
+	"net/url"
+)
+
+// Election elects at most one session as leader at a time, the leader stays
+// in office until it resigns or its session ends
+type Election struct {
+	resource
+}
+
+func NewElection(session *Session, name string) *Election {
+	return &Election{resource{
+		session:     session,
+		name:        name,
+		acquirePath: "/election/" + url.PathEscape(name) + "/campaign",
+		releasePath: "/election/" + url.PathEscape(name) + "/resign",
+		holderPath:  "/election/" + url.PathEscape(name),
+	}}
+}
+
+// Campaign blocks until the session is elected or the context is done
+func (e *Election) Campaign(ctx context.Context) error {
+	return e.wait(ctx)
+}
+
+func (e *Election) Resign() error {
+	return e.release()
+}
+
+// Leader returns the owner of the session that is currently elected, it is empty if there is none
+func (e *Election) Leader() (string, error) {
+	return e.holder()
+}
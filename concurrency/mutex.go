@@ -0,0 +1,135 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+// Interval in which Lock and Campaign retry to acquire a held lock or leadership
+const RETRY_INTERVAL = 50 * time.Millisecond
+
+var ErrLocked = errors.New("concurrency: held by another session")
+var ErrNotHeld = errors.New("concurrency: not held by this session")
+
+// Mutex is a distributed lock, which is held by at most one session at a time
+type Mutex struct {
+	resource
+}
+
+func NewMutex(session *Session, name string) *Mutex {
+	return &Mutex{resource{
+		session:     session,
+		name:        name,
+		acquirePath: "/lock/" + url.PathEscape(name),
+		releasePath: "/unlock/" + url.PathEscape(name),
+		holderPath:  "/lock/" + url.PathEscape(name),
+	}}
+}
+
+// TryLock acquires the lock if it is free and fails with ErrLocked otherwise
+func (m *Mutex) TryLock() error {
+	return m.acquire()
+}
+
+// Lock blocks until the lock is acquired or the context is done
+func (m *Mutex) Lock(ctx context.Context) error {
+	return m.wait(ctx)
+}
+
+func (m *Mutex) Unlock() error {
+	return m.release()
+}
+
+// Holder returns the owner of the session holding the lock, it is empty if the lock is free
+func (m *Mutex) Holder() (string, error) {
+	return m.holder()
+}
+
+// resource is the key that is shared by mutexes and elections
+type resource struct {
+	session *Session
+	name    string
+
+	acquirePath string
+	releasePath string
+	holderPath  string
+}
+
+func (r *resource) acquire() error {
+	var lockMessage kv.LockMessage
+	statusCode, err := r.session.request(http.MethodPost, r.acquirePath, kv.LockRequestMessage{
+		Owner: r.session.owner,
+		Lease: r.session.lease,
+	}, &lockMessage)
+	if err != nil {
+		return err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return ErrLocked
+	default:
+		return fmt.Errorf("concurrency: could not acquire `%s`: %s", r.name, lockMessage.InfoMessage.Message)
+	}
+}
+
+func (r *resource) wait(ctx context.Context) error {
+	for {
+		err := r.acquire()
+		if err != ErrLocked {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.session.Done():
+			return fmt.Errorf("concurrency: session %s ended while waiting for `%s`", r.session.owner, r.name)
+		case <-time.After(RETRY_INTERVAL):
+		}
+	}
+}
+
+func (r *resource) release() error {
+	var lockMessage kv.LockMessage
+	statusCode, err := r.session.request(http.MethodPost, r.releasePath, kv.LockRequestMessage{
+		Owner: r.session.owner,
+	}, &lockMessage)
+	if err != nil {
+		return err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return ErrNotHeld
+	default:
+		return fmt.Errorf("concurrency: could not release `%s`: %s", r.name, lockMessage.InfoMessage.Message)
+	}
+}
+
+func (r *resource) holder() (string, error) {
+	var lockMessage kv.LockMessage
+	statusCode, err := r.session.request(http.MethodGet, r.holderPath, "", &lockMessage)
+	if err != nil {
+		return "", err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+		return lockMessage.Owner, nil
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("concurrency: could not get holder of `%s`: %s", r.name, lockMessage.InfoMessage.Message)
+	}
+}
@@ -0,0 +1,156 @@
+// Package concurrency provides distributed mutexes and elections on top of the key value store.
+// Ownership is tied to the lease of a session, so whatever a crashed session held is released
+// as soon as its lease expires.
+package concurrency
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+// Session is a lease that is kept alive in the background until the session is closed
+type Session struct {
+	// Base URL of the HTTP API of the node the session was opened through, and the client it is reached with
+	baseURL string
+	client  *http.Client
+	owner   string
+	lease   int64
+	ttl     int64
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewSession grants a lease with a time to live of ttl seconds through the node whose HTTP API is served at
+// clientURL, the host:port the node advertises as its client URL
+func NewSession(clientURL string, ttl int64) (*Session, error) {
+	return NewTLSSession(clientURL, ttl, nil)
+}
+
+// NewTLSSession is NewSession for nodes that serve their HTTP API over HTTPS, whose certificate is verified with
+// config. Sessions without config use plain HTTP.
+func NewTLSSession(clientURL string, ttl int64, config *tls.Config) (*Session, error) {
+	ownerBytes := make([]byte, 16)
+	if _, err := rand.Read(ownerBytes); err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		baseURL: "http://" + clientURL,
+		client:  http.DefaultClient,
+		owner:   hex.EncodeToString(ownerBytes),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if config != nil {
+		session.baseURL = "https://" + clientURL
+		session.client = &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+
+	var leaseMessage kv.LeaseMessage
+	statusCode, err := session.request(http.MethodPost, "/lease/grant", strconv.FormatInt(ttl, 10), &leaseMessage)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not grant lease: %s", leaseMessage.InfoMessage.Message)
+	}
+	session.lease, session.ttl = leaseMessage.ID, leaseMessage.TTL
+	go session.keepAlive()
+
+	return session, nil
+}
+
+// Owner is the unique name of the session, which is stored as holder of locks and elections
+func (s *Session) Owner() string {
+	return s.owner
+}
+
+func (s *Session) Lease() int64 {
+	return s.lease
+}
+
+// Done is closed once the lease of the session ended, either by Close or because it expired
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops keeping the lease alive and revokes it, which releases everything the session holds
+func (s *Session) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+
+	var leaseMessage kv.LeaseMessage
+	_, err := s.request(http.MethodPost, "/lease/revoke/"+strconv.FormatInt(s.lease, 10), "", &leaseMessage)
+	return err
+}
+
+func (s *Session) keepAlive() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(time.Duration(s.ttl) * time.Second / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			var leaseMessage kv.LeaseMessage
+			statusCode, err := s.request(http.MethodPost, "/lease/keep-alive/"+strconv.FormatInt(s.lease, 10), "", &leaseMessage)
+			if err != nil {
+				// Retry on the next tick, the lease might still be alive
+				kv.ErrorLogger.Println(err)
+				continue
+			}
+			if statusCode == http.StatusNotFound {
+				kv.ErrorLogger.Printf("Lease %d of session %s expired\n", s.lease, s.owner)
+				return
+			}
+		}
+	}
+}
+
+// request sends body (JSON encoded unless it is a string) to path on the node of the session and decodes the
+// response into response
+func (s *Session) request(method string, path string, body interface{}, response interface{}) (int, error) {
+	var bodyBytes []byte
+	if rawBody, ok := body.(string); ok {
+		bodyBytes = []byte(rawBody)
+	} else {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, s.baseURL+path, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	responseBytes, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(responseBytes, response); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
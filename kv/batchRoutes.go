@@ -0,0 +1,107 @@
+package kv
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+//
+// Batch Read
+//
+
+func (kv *KeyValueStore) handleBatchRead(w http.ResponseWriter, r *http.Request) {
+	keysBytes, _ := ioutil.ReadAll(r.Body)
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying batch read request to leader")
+		kv.proxyRequest(w, "/batch/read", keysBytes)
+		return
+	}
+
+	var keys []string
+	if err := json.Unmarshal(keysBytes, &keys); err != nil {
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
+		return
+	}
+
+	results := make([]BatchReadResult, len(keys))
+	kv.databaseMutex.RLock()
+	for index, key := range keys {
+		if value, ok := kv.Database[key]; ok {
+			results[index] = BatchReadResult{
+				Key:         key,
+				InfoMessage: StatusOKMessage,
+				Value:       value,
+			}
+		} else {
+			results[index] = BatchReadResult{
+				Key:         key,
+				InfoMessage: StatusValueNotFoundMessage,
+			}
+		}
+	}
+	kv.databaseMutex.RUnlock()
+
+	RespondJSON(w, http.StatusOK, BatchReadResponseMessage{
+		InfoMessage: StatusOKMessage,
+		Results:     results,
+	})
+}
+
+//
+// Batch Write
+//
+
+func (kv *KeyValueStore) handleBatchWrite(w http.ResponseWriter, r *http.Request) {
+	entriesBytes, _ := ioutil.ReadAll(r.Body)
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying batch write request to leader")
+		kv.proxyRequest(w, "/batch/write", entriesBytes)
+		return
+	}
+
+	var entries []BatchWriteEntry
+	if err := json.Unmarshal(entriesBytes, &entries); err != nil {
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
+		return
+	}
+
+	for _, entry := range entries {
+		if int64(len(entry.Value)) > kv.config.MaxValueSize {
+			RespondJSON(w, http.StatusRequestEntityTooLarge, BatchWriteResponseMessage{InfoMessage: StatusValueTooLargeMessage})
+			return
+		}
+	}
+
+	// Invalid entries are reported individually, all others are written as one block of logs
+	results := make([]BatchWriteResult, len(entries))
+	logEntries := make([]*KeyValueLog, 0, len(entries))
+	logIndices := make([]int, 0, len(entries))
+	for index, entry := range entries {
+		results[index].Key = entry.Key
+		if entry.Key == "" {
+			results[index].InfoMessage = StatusEmptyKeyMessage
+			continue
+		}
+		logEntries = append(logEntries, CreateKeyValueLog(entry.Key, entry.Value, true, false))
+		logIndices = append(logIndices, index)
+	}
+
+	// The batch fails like a single write, if any of its logs was not committed
+	statusCode, infoMessage := http.StatusOK, StatusOKMessage
+	if len(logEntries) > 0 {
+		for logIndex, result := range kv.queueWrite(logEntries) {
+			results[logIndices[logIndex]].InfoMessage = result.InfoMessage
+			if result.InfoMessage != StatusOKMessage {
+				statusCode, infoMessage = writeStatusCode(result.InfoMessage, http.StatusInternalServerError), result.InfoMessage
+			}
+		}
+	}
+
+	RespondJSON(w, statusCode, BatchWriteResponseMessage{
+		InfoMessage: infoMessage,
+		Results:     results,
+	})
+}
@@ -0,0 +1,193 @@
+package kv
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startBootstrapMembers runs the initial members of a new cluster on a memory network, with short election timeouts
+func startBootstrapMembers(t *testing.T, count int) []*KeyValueStore {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.MaxElectionTimeout = 200 * time.Millisecond
+	config.ElectionTimeoutSpread = 100 * time.Millisecond
+	config.HeartBeatInterval = 20 * time.Millisecond
+
+	members := make([]Follower, count)
+	for index := range members {
+		members[index].Address = net.IPv4(10, 0, 0, byte(index+1))
+	}
+
+	network := NewMemoryNetwork()
+	nodes := make([]*KeyValueStore, count)
+	for index, member := range members {
+		transport := network.NewTransport(member.Address)
+		node := InitKeyValueStoreWithConfig(config, false, nil, member.Address, transport)
+		nodes[index] = node
+		go transport.Serve(node, node.newRouter(true))
+		t.Cleanup(node.Stop)
+	}
+	for index, node := range nodes {
+		node.bootstrap(members, index)
+		node.startLoops()
+	}
+	return nodes
+}
+
+func TestBootstrap(t *testing.T) {
+	nodes := startBootstrapMembers(t, 3)
+
+	// All members follow the single leader they elected
+	var leader *KeyValueStore
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		leaders := 0
+		for _, node := range nodes {
+			if node.IsLeader() {
+				leaders++
+				leader = node
+			}
+		}
+		following := 0
+		for _, node := range nodes {
+			if leaders == 1 && node.leaderMember().Address.Equal(leader.LocalAddress) {
+				following++
+			}
+		}
+		if following == len(nodes) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("members did not elect a single leader (%d leaders)", leaders)
+		}
+	}
+
+	// The leader learned the IDs of the other members from their votes
+	for _, node := range nodes {
+		if node.LeaderID != leader.ID {
+			t.Fatalf("member %s follows leader %q, expected %q", node.LocalAddress, node.LeaderID, leader.ID)
+		}
+	}
+	leader.followerMutex.RLock()
+	for _, follower := range leader.Followers {
+		for _, node := range nodes {
+			if node.LocalAddress.Equal(follower.Address) && node.ID != follower.ID {
+				t.Errorf("leader knows member %s as %q, expected %q", follower.Address, follower.ID, node.ID)
+			}
+		}
+	}
+	leader.followerMutex.RUnlock()
+
+	if result := leader.replicate(CreateSetLog("bootstrap", []byte("1"), "", 0, true, false)); result.InfoMessage != StatusOKMessage {
+		t.Fatalf("write failed with %v", result.InfoMessage)
+	}
+	for _, node := range nodes {
+		node.databaseMutex.RLock()
+		value := node.Database["bootstrap"]
+		node.databaseMutex.RUnlock()
+		if string(value) != "1" {
+			t.Fatalf("member %s holds %q after the write", node.LocalAddress, value)
+		}
+	}
+}
+
+func TestBootstrapSingleMember(t *testing.T) {
+	nodes := startBootstrapMembers(t, 1)
+	if !nodes[0].IsLeader() || !nodes[0].leaderMember().Address.Equal(nodes[0].LocalAddress) {
+		t.Fatal("single member does not lead its cluster")
+	}
+}
+
+func TestInitialMembers(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialCluster = "10.0.0.2, 10.0.0.1,10.0.0.2, 10.0.0.1:9082, node=127.0.0.1:9083"
+	members, err := config.InitialMembers()
+	expected := []Follower{
+		{Member: Member{Address: net.IPv4(10, 0, 0, 1).To4()}},
+		{Member: Member{Address: net.IPv4(10, 0, 0, 1).To4(), PeerURL: "10.0.0.1:9082"}},
+		{Member: Member{Address: net.IPv4(10, 0, 0, 2).To4()}},
+		{ID: "node", Member: Member{Address: net.IPv4(127, 0, 0, 1).To4(), PeerURL: "127.0.0.1:9083"}},
+	}
+	if err != nil || !reflect.DeepEqual(members, expected) {
+		t.Fatalf("initial members %v (%v), expected sorted members without duplicates", members, err)
+	}
+
+	config = DefaultConfig()
+	config.DiscoveryDNS = "localhost"
+	members, err = config.InitialMembers()
+	if err != nil {
+		t.Skip(err)
+	}
+	if _, err := config.localMember(members); err != nil {
+		t.Fatalf("none of the addresses of localhost %v is local: %v", members, err)
+	}
+}
+
+func TestLocalMember(t *testing.T) {
+	// Members that share a host are told apart by their peer port
+	members := []Follower{
+		{Member: Member{Address: net.IPv4(127, 0, 0, 1), PeerURL: "127.0.0.1:9082"}},
+		{Member: Member{Address: net.IPv4(127, 0, 0, 1), PeerURL: "127.0.0.1:9083"}},
+		{ID: "node", Member: Member{Address: net.IPv4(127, 0, 0, 1), PeerURL: "127.0.0.1:9084"}},
+	}
+	for _, test := range []struct {
+		name   string
+		change func(config *Config)
+		local  int
+	}{
+		{"listen on all interfaces", func(c *Config) { c.PeerPort = ":9083" }, 1},
+		{"listen on a host", func(c *Config) { c.ListenPeerAddress = "127.0.0.1:9082" }, 0},
+		{"advertised", func(c *Config) { c.AdvertisePeerURL = "127.0.0.1:9083" }, 1},
+		{"node ID", func(c *Config) { c.NodeID = "node" }, 2},
+		{"http transport", func(c *Config) { c.PeerTransport, c.Port = HTTP_PEER_TRANSPORT, ":9082" }, 0},
+		{"no member", func(c *Config) { c.PeerPort = ":9085" }, -1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			test.change(&config)
+			if local, _ := config.localMember(members); local != test.local {
+				t.Fatalf("local member %d, expected %d", local, test.local)
+			}
+		})
+	}
+}
+
+func TestClusterMismatch(t *testing.T) {
+	for _, transport := range []string{RPC_PEER_TRANSPORT, HTTP_PEER_TRANSPORT} {
+		t.Run(transport, func(t *testing.T) {
+			follower, leader := startPeerTestFollower(t, transport)
+			switch peerTransport := leader.transport.(type) {
+			case *RPCTransport:
+				peerTransport.ClusterID = "other"
+			case *HTTPTransport:
+				peerTransport.ClusterID = "other"
+			}
+
+			if infoMessage, err := leader.transport.LeaderUpdate(follower.member(), LeaderUpdateMessage{Leader: leader.LocalAddress, Term: 5}); err != nil || infoMessage != StatusClusterMismatchMessage {
+				t.Fatalf("leader update of another cluster replied %v (%v)", infoMessage, err)
+			}
+			lastCommitIndex, _ := follower.findLastCommitedLog()
+			lastLogHash := follower.DatabaseLog[lastCommitIndex].Hash
+			if pollResponse, err := leader.transport.Poll(follower.member(), PollRequestMessage{Term: 5, NewLeaderAddress: leader.LocalAddress, LastLogHash: lastLogHash}); err != nil || pollResponse.Yes {
+				t.Fatalf("poll of another cluster replied %v (%v)", pollResponse, err)
+			}
+			if follower.Term == 5 || follower.nextVoteTerm != 0 {
+				t.Fatal("follower accepted messages of another cluster")
+			}
+
+			// Registrations are forwarded over HTTP by both transports
+			resp, err := leader.transport.Post(follower.member(), "/register", "application/x-www-form-urlencoded", bytes.NewBufferString("ip=127.0.0.1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusConflict || resp.Header.Get(CLUSTER_HEADER) != DEFAULT_CLUSTER_ID {
+				t.Fatalf("registration with another cluster responded %d (cluster %q)", resp.StatusCode, resp.Header.Get(CLUSTER_HEADER))
+			}
+		})
+	}
+}
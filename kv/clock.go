@@ -0,0 +1,250 @@
+package kv
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The consensus code takes its time, timers, goroutines and random numbers from CLOCK. Nodes run on
+// the system clock, simulations replace it by a simulated clock that runs a single goroutine at a
+// time in the order of virtual time, so a run only depends on its seed.
+
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	// After sends the time on the returned channel once d passed
+	After(d time.Duration) <-chan time.Time
+	// Go runs fn in a new goroutine
+	Go(fn func())
+	// Wait blocks until done is closed
+	Wait(done <-chan struct{})
+	// WaitUntil blocks until condition holds, which is checked once per POLL_INTERVAL or less often
+	WaitUntil(condition func() bool)
+
+	Intn(n int) int
+	Int63n(n int64) int64
+	Float64() float64
+}
+
+// since returns the time passed since t on CLOCK
+func since(t time.Time) time.Duration {
+	return CLOCK.Now().Sub(t)
+}
+
+//
+// System Clock
+//
+
+// SystemClock runs on the wall clock, random numbers are drawn from the global source
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (SystemClock) Go(fn func()) {
+	go fn()
+}
+
+func (SystemClock) Wait(done <-chan struct{}) {
+	<-done
+}
+
+func (SystemClock) WaitUntil(condition func() bool) {
+	for !condition() {
+		time.Sleep(POLL_INTERVAL)
+	}
+}
+
+func (SystemClock) Intn(n int) int {
+	return rand.Intn(n)
+}
+
+func (SystemClock) Int63n(n int64) int64 {
+	return rand.Int63n(n)
+}
+
+func (SystemClock) Float64() float64 {
+	return rand.Float64()
+}
+
+//
+// Simulated Clock
+//
+
+// SimulatedClock only lets a single goroutine started with Go run at a time. Once it sleeps or ends,
+// Run wakes up the goroutine with the earliest wake up time, goroutines with the same wake up time
+// are woken up in the order in which they went to sleep. Time only passes between wake ups.
+//
+// Goroutines of the simulation must not block on anything but the clock, e.g. they must not sleep
+// while they hold a lock another goroutine of the simulation waits for.
+type SimulatedClock struct {
+	now    time.Time
+	random *rand.Rand
+	events simulatedEvents
+	// Number of events scheduled so far, which orders events with the same time
+	scheduled uint64
+
+	// The running goroutine hands control back to Run once it sleeps or ends
+	yield chan struct{}
+	mutex sync.Mutex
+}
+
+// simulatedEvent wakes up a sleeping goroutine at time at
+type simulatedEvent struct {
+	at    time.Time
+	order uint64
+	wake  chan struct{}
+}
+
+type simulatedEvents []*simulatedEvent
+
+func (e simulatedEvents) Len() int { return len(e) }
+func (e simulatedEvents) Less(i, j int) bool {
+	return e[i].at.Before(e[j].at) || e[i].at.Equal(e[j].at) && e[i].order < e[j].order
+}
+func (e simulatedEvents) Swap(i, j int)       { e[i], e[j] = e[j], e[i] }
+func (e *simulatedEvents) Push(x interface{}) { *e = append(*e, x.(*simulatedEvent)) }
+func (e *simulatedEvents) Pop() interface{} {
+	old := *e
+	event := old[len(old)-1]
+	*e = old[:len(old)-1]
+	return event
+}
+
+// NewSimulatedClock starts at SIMULATION_EPOCH, all random numbers follow from seed
+func NewSimulatedClock(seed int64) *SimulatedClock {
+	return &SimulatedClock{
+		now:    SIMULATION_EPOCH,
+		random: rand.New(rand.NewSource(seed)),
+		yield:  make(chan struct{}),
+	}
+}
+
+// schedule returns the channel that is closed once the goroutine scheduled at time at may run
+func (c *SimulatedClock) schedule(at time.Time) chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	event := &simulatedEvent{at: at, order: c.scheduled, wake: make(chan struct{})}
+	c.scheduled++
+	heap.Push(&c.events, event)
+	return event.wake
+}
+
+func (c *SimulatedClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// Sleep may only be called by goroutines started with Go
+func (c *SimulatedClock) Sleep(d time.Duration) {
+	wake := c.schedule(c.Now().Add(d))
+	c.yield <- struct{}{}
+	<-wake
+}
+
+// After sleeps in a goroutine of its own, the channel is buffered so that it never blocks once nobody receives.
+// Like any other channel, goroutines of the simulation must not block on it.
+func (c *SimulatedClock) After(d time.Duration) <-chan time.Time {
+	timer := make(chan time.Time, 1)
+	c.Go(func() {
+		c.Sleep(d)
+		timer <- c.Now()
+	})
+	return timer
+}
+
+// Go runs fn once all goroutines that are due at the current time ran
+func (c *SimulatedClock) Go(fn func()) {
+	wake := c.schedule(c.Now())
+	go func() {
+		<-wake
+		fn()
+		c.yield <- struct{}{}
+	}()
+}
+
+func (c *SimulatedClock) Wait(done <-chan struct{}) {
+	c.WaitUntil(func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// WaitUntil checks the condition after POLL_INTERVAL first and backs off up to SIMULATED_MAX_WAIT_INTERVAL,
+// so goroutines that wait for a long time do not slow down the simulation
+func (c *SimulatedClock) WaitUntil(condition func() bool) {
+	for interval := POLL_INTERVAL; !condition(); {
+		c.Sleep(interval)
+		if interval *= 2; interval > SIMULATED_MAX_WAIT_INTERVAL {
+			interval = SIMULATED_MAX_WAIT_INTERVAL
+		}
+	}
+}
+
+func (c *SimulatedClock) Intn(n int) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.random.Intn(n)
+}
+
+func (c *SimulatedClock) Int63n(n int64) int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.random.Int63n(n)
+}
+
+func (c *SimulatedClock) Float64() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.random.Float64()
+}
+
+// Run runs the goroutines of the simulation until d passed on the clock. It must not be called by
+// a goroutine of the simulation, goroutines that block on anything but the clock stall the
+// simulation, which panics after SIMULATION_STALL_TIMEOUT.
+func (c *SimulatedClock) Run(d time.Duration) {
+	stall := time.NewTimer(SIMULATION_STALL_TIMEOUT)
+	defer stall.Stop()
+
+	end := c.Now().Add(d)
+	for {
+		c.mutex.Lock()
+		if len(c.events) == 0 || c.events[0].at.After(end) {
+			c.now = end
+			c.mutex.Unlock()
+			return
+		}
+		event := heap.Pop(&c.events).(*simulatedEvent)
+		c.now = event.at
+		c.mutex.Unlock()
+
+		stall.Reset(SIMULATION_STALL_TIMEOUT)
+		close(event.wake)
+		select {
+		case <-c.yield:
+		case <-stall.C:
+			panic("simulation stalled, a goroutine blocks on something other than the simulated clock")
+		}
+	}
+}
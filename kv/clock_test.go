@@ -0,0 +1,38 @@
+package kv
+
+import (
+	"testing"
+	"time"
+)
+
+// Expiration times and timeouts follow CLOCK, so simulated runs do not depend on the wall clock
+func TestSimulatedClock(t *testing.T) {
+	clock := NewSimulatedClock(1)
+	CLOCK = clock
+	defer func() { CLOCK = SystemClock{} }()
+
+	if ttl := memcachedTTL(SIMULATION_EPOCH.Unix() + MEMCACHED_MAX_RELATIVE_EXPIRATION + 60); ttl != MEMCACHED_MAX_RELATIVE_EXPIRATION+60 {
+		t.Fatalf("absolute expiration resulted in a time to live of %d seconds", ttl)
+	}
+
+	timer := clock.After(time.Second)
+	clock.Run(time.Second / 2)
+	select {
+	case <-timer:
+		t.Fatal("timer fired early")
+	default:
+	}
+	clock.Run(time.Second)
+	select {
+	case fired := <-timer:
+		if !fired.Equal(SIMULATION_EPOCH.Add(time.Second)) {
+			t.Fatalf("timer fired at %v", fired)
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if first, second := CreateKeyValueLog("key", []byte("value"), true, false), CreateKeyValueLog("key", []byte("value"), true, false); first.Hash == second.Hash {
+		t.Fatal("identical logs created at the same simulated time share a hash")
+	}
+}
@@ -4,38 +4,126 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"reflect"
+	"time"
 
 	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var leader bool
 var networkEntryAddress string
+var configFile string
+
+// Flags of the config are only applied if they were set, on top of the file and the environment
+var flagConfig = kv.DefaultConfig()
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.PersistentFlags().BoolVarP(&leader, "leader", "l", false, "leader")
-	runCmd.PersistentFlags().StringVarP(&networkEntryAddress, "networkEntryAddress", "a", "", "IP address of network member node, which will be used as an entry point")
+	runCmd.PersistentFlags().StringVarP(&networkEntryAddress, "networkEntryAddress", "a", "", "IP address or host:port of the HTTP API of a network member node, which will be used as an entry point")
+	runCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "YAML file with the configuration of the node, see config.example.yaml")
+	for _, parameter := range flagConfig.Parameters() {
+		runCmd.PersistentFlags().Var(parameterFlag{parameter}, parameter.Flag, parameter.Usage+" (env "+parameter.Environment()+")")
+	}
 }
 
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the kv store",
-	Long:  `Run the kv store`,
+	Long: `Run the kv store.
+Its configuration is read from the defaults, the --config file, the KV_* environment variables and the flags,
+each of which overrides the ones before it. The peer transport has to be the same on all nodes, which reach
+each other at the URLs of their members and at the configured ports on the address of the entry node.
+
+Clusters either start with a --leader that the other nodes register with, or are bootstrapped by their initial
+members, which are given with --initial-cluster or --discovery-dns and elect a leader among themselves.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var nodeAddress net.IP
+		config, err := loadConfig(cmd.Flags())
+		if err != nil {
+			kv.ErrorLogger.Println(err)
+			os.Exit(1)
+		}
+
+		// Initial members of a cluster elect their leader among themselves
+		if config.Bootstrapping() {
+			if leader || networkEntryAddress != "" {
+				kv.ErrorLogger.Println(fmt.Errorf("initial members of a cluster neither lead nor register with a network member"))
+				os.Exit(1)
+			}
+			keyValueStore, err := kv.BootstrapKeyValueStore(config)
+			if err != nil {
+				kv.ErrorLogger.Println(err)
+				os.Exit(1)
+			}
+			keyValueStore.Start(release)
+			return
+		}
+
+		var entry kv.Member
 		if release {
-			nodeAddress = net.ParseIP(networkEntryAddress)
-			if nodeAddress == nil {
-				kv.ErrorLogger.Println(fmt.Errorf("an initial network member ip address has to be provided in release mode"))
+			entry, err = kv.ParseEntry(networkEntryAddress)
+			if err != nil {
+				kv.ErrorLogger.Println(fmt.Errorf("an initial network member ip address or host:port has to be provided in release mode: %v", err))
 				os.Exit(1)
 			}
-		} else {
-			// Ignore leader ip address, should be commanded by test
-			nodeAddress = nil
 		}
+		// Outside of release mode the entry is ignored, nodes are registered by the tests
 
-		keyValueStore := kv.InitKeyValueStore(leader, nodeAddress)
+		keyValueStore := kv.InitKeyValueStore(config, leader, entry)
 		keyValueStore.Start(release)
 	},
 }
+
+// loadConfig applies the config file, the environment and the flags that were set to the defaults, and validates the result
+func loadConfig(flags *pflag.FlagSet) (kv.Config, error) {
+	config := kv.DefaultConfig()
+	if configFile != "" {
+		if err := config.LoadFile(configFile); err != nil {
+			return config, err
+		}
+	}
+	if err := config.LoadEnvironment(); err != nil {
+		return config, err
+	}
+
+	parameters := make(map[string]kv.Parameter)
+	for _, parameter := range config.Parameters() {
+		parameters[parameter.Flag] = parameter
+	}
+	var err error
+	flags.Visit(func(flag *pflag.Flag) {
+		if parameter, ok := parameters[flag.Name]; ok && err == nil {
+			err = parameter.Set(flag.Value.String())
+		}
+	})
+	if err != nil {
+		return config, err
+	}
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+	return config, config.LoadNodeID()
+}
+
+// parameterFlag sets a parameter of flagConfig on the command line
+type parameterFlag struct {
+	kv.Parameter
+}
+
+func (f parameterFlag) String() string {
+	return fmt.Sprint(reflect.ValueOf(f.Value()).Elem().Interface())
+}
+
+func (f parameterFlag) Type() string {
+	switch f.Value().(type) {
+	case *time.Duration:
+		return "duration"
+	case *net.IP:
+		return "ip"
+	case *int, *int64:
+		return "int"
+	}
+	return "string"
+}
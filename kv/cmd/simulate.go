@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/simulation"
+	"github.com/spf13/cobra"
+)
+
+var simulationSeed int64
+var simulationNodes int
+var simulationDuration time.Duration
+var simulationVerbose bool
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+	simulateCmd.PersistentFlags().Int64Var(&simulationSeed, "seed", 1, "seed of the simulation, the same seed replays the same run")
+	simulateCmd.PersistentFlags().IntVar(&simulationNodes, "nodes", 5, "number of nodes")
+	simulateCmd.PersistentFlags().DurationVar(&simulationDuration, "duration", 20*time.Second, "simulated duration of the random scenario")
+	simulateCmd.PersistentFlags().BoolVarP(&simulationVerbose, "verbose", "v", false, "print the logs of the nodes")
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulate a cluster deterministically",
+	Long: `Simulate a cluster on a simulated clock and network with random client requests, crashes and partitions.
+Everything that happens follows from the seed, so a run that violates an invariant can be replayed exactly.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !simulationVerbose {
+			kv.InfoLogger.SetOutput(ioutil.Discard)
+			kv.ErrorLogger.SetOutput(ioutil.Discard)
+		}
+
+		s, err := simulation.New(simulationSeed, simulationNodes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		s.RunRandom(simulationDuration)
+		s.Heal()
+		s.Run(5 * time.Second)
+
+		for _, event := range s.Trace() {
+			fmt.Println(event)
+		}
+		fmt.Println()
+		for _, database := range s.Databases() {
+			fmt.Println(database)
+		}
+
+		if violations := s.Violations(); len(violations) > 0 {
+			fmt.Printf("\nseed %d violated invariants:\n", simulationSeed)
+			for _, violation := range violations {
+				fmt.Println(violation)
+			}
+			s.Close()
+			os.Exit(1)
+		}
+	},
+}
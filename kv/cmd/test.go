@@ -2,52 +2,37 @@ package cmd
 
 import (
 	"flag"
+	"regexp"
+	"runtime"
+	"strconv"
 	"testing"
-	"time"
 
 	kvtest "github.com/Jonas-Heinrich/toy-distributed-key-value/test"
 	"github.com/spf13/cobra"
 )
 
+var testRun string
+var testParallel int
+
 func init() {
 	rootCmd.AddCommand(testCmd)
+	testCmd.PersistentFlags().StringVar(&testRun, "run", "", "only run the tests whose name matches this regular expression")
+	testCmd.PersistentFlags().IntVar(&testParallel, "parallel", runtime.GOMAXPROCS(0), "number of tests that run at the same time")
+	testCmd.PersistentFlags().StringVar(&kvtest.PeerTransport, "peer-transport", kvtest.PeerTransport, "transport of the messages between the nodes under test, either rpc or the legacy http")
 }
 
 var testCmd = &cobra.Command{
 	Use:   "test",
-	Short: "Run the test container",
-	Long:  `Run the code specified in "/test/"`,
+	Short: "Run the integration tests",
+	Long: `Run the code specified in "/test/".
+Every test starts nodes of its own in this process, which listen on loopback addresses.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Wait for other containers to boot
-		time.Sleep(1 * time.Second)
-
+		// Testing flags are only registered by testing.Init
+		testing.Init()
 		flag.Set("test.v", "true")
-		testing.Main(func(pat, str string) (bool, error) { return true, nil },
-			[]testing.InternalTest{
-				// Essential tests: cannot be left out
-				{"TestTesting", kvtest.TestTesting},
-				{"TestStatus", kvtest.TestStatus},
-				{"TestInitialState", kvtest.TestInitialState},
-
-				// Essential tests: cannot be left out
-				{"TestDirectNetworkEntry", kvtest.TestDirectNetworkEntry},
-				{"TestIndirectNetworkEntry", kvtest.TestIndirectNetworkEntry},
-				{"TestNetworkEntryLogReplication", kvtest.TestNetworkEntryLogReplication},
-				{"TestRemainingNetworkEntry", kvtest.TestRemainingNetworkEntry},
-
-				// Leader Election
-				{"TestLeaderElection", kvtest.TestLeaderElection},
-
-				// Read
-				{"TestInitialDirectRead", kvtest.TestInitialDirectRead},
-				{"TestInitialIndirectRead", kvtest.TestInitialIndirectRead},
-				{"TestInitialDirectReadNotFound", kvtest.TestInitialDirectReadNotFound},
-				{"TestInitialIndirectReadNotFound", kvtest.TestInitialIndirectReadNotFound},
-
-				// Write
-				{"TestDirectWrite", kvtest.TestDirectWrite},
-				{"TestIndirectWrite", kvtest.TestIndirectWrite},
-			},
+		flag.Set("test.run", testRun)
+		flag.Set("test.parallel", strconv.Itoa(testParallel))
+		testing.Main(regexp.MatchString, kvtest.Tests,
 			[]testing.InternalBenchmark{},
 			[]testing.InternalExample{})
 	},
@@ -0,0 +1,166 @@
+package kv
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// Locks and elections are both a key holding the name of its owner, which is created by compare and swap
+// and attached to the lease of the owner. Once the owner stops keeping its lease alive, the key is deleted
+// and the lock or leadership becomes available again.
+
+//
+// Lock
+//
+
+func (kv *KeyValueStore) handleLock(w http.ResponseWriter, r *http.Request) {
+	kv.handleAcquire(w, r, LOCK_KEY_PREFIX)
+}
+
+func (kv *KeyValueStore) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	kv.handleRelease(w, r, LOCK_KEY_PREFIX)
+}
+
+func (kv *KeyValueStore) handleLockHolder(w http.ResponseWriter, r *http.Request) {
+	kv.handleHolder(w, r, LOCK_KEY_PREFIX)
+}
+
+//
+// Election
+//
+
+func (kv *KeyValueStore) handleCampaign(w http.ResponseWriter, r *http.Request) {
+	kv.handleAcquire(w, r, ELECTION_KEY_PREFIX)
+}
+
+func (kv *KeyValueStore) handleResign(w http.ResponseWriter, r *http.Request) {
+	kv.handleRelease(w, r, ELECTION_KEY_PREFIX)
+}
+
+func (kv *KeyValueStore) handleElectionLeader(w http.ResponseWriter, r *http.Request) {
+	kv.handleHolder(w, r, ELECTION_KEY_PREFIX)
+}
+
+//
+// Utils
+//
+
+// handleAcquire tries to acquire the key once, acquiring an already held key again succeeds
+func (kv *KeyValueStore) handleAcquire(w http.ResponseWriter, r *http.Request, keyPrefix string) {
+	name, ok := pathVariable(r, "name")
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, LockMessage{InfoMessage: StatusBadURLParameterMessage})
+		return
+	}
+	lockRequestBytes, _ := ioutil.ReadAll(r.Body)
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying acquire request to leader")
+		kv.proxyRequest(w, r.URL.RequestURI(), lockRequestBytes)
+		return
+	}
+
+	var lockRequest LockRequestMessage
+	if err := json.Unmarshal(lockRequestBytes, &lockRequest); err != nil {
+		RespondJSON(w, http.StatusBadRequest, LockMessage{InfoMessage: StatusBadBodyMessage, Name: name})
+		return
+	}
+	if lockRequest.Owner == "" {
+		RespondJSON(w, http.StatusBadRequest, LockMessage{InfoMessage: StatusEmptyOwnerMessage, Name: name})
+		return
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateCompareAndSwapLog(keyPrefix+name, nil, []byte(lockRequest.Owner), lockRequest.Lease, true, false)})[0]
+	switch {
+	case result.InfoMessage == StatusOKMessage || string(result.Value) == lockRequest.Owner:
+		RespondJSON(w, http.StatusOK, kv.holder(name, keyPrefix, StatusOKMessage))
+	case result.InfoMessage == StatusCompareFailedMessage:
+		RespondJSON(w, http.StatusConflict, kv.holder(name, keyPrefix, StatusLockHeldMessage))
+	default:
+		RespondJSON(w, writeStatusCode(result.InfoMessage, http.StatusNotFound), LockMessage{InfoMessage: result.InfoMessage, Name: name})
+	}
+}
+
+// handleRelease deletes the key if it is held by the requesting owner
+func (kv *KeyValueStore) handleRelease(w http.ResponseWriter, r *http.Request, keyPrefix string) {
+	name, ok := pathVariable(r, "name")
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, LockMessage{InfoMessage: StatusBadURLParameterMessage})
+		return
+	}
+	lockRequestBytes, _ := ioutil.ReadAll(r.Body)
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying release request to leader")
+		kv.proxyRequest(w, r.URL.RequestURI(), lockRequestBytes)
+		return
+	}
+
+	var lockRequest LockRequestMessage
+	if err := json.Unmarshal(lockRequestBytes, &lockRequest); err != nil {
+		RespondJSON(w, http.StatusBadRequest, LockMessage{InfoMessage: StatusBadBodyMessage, Name: name})
+		return
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateCompareAndDeleteLog(keyPrefix+name, []byte(lockRequest.Owner), true, false)})[0]
+	if result.InfoMessage == StatusLeaderUnavailableMessage {
+		RespondJSON(w, http.StatusServiceUnavailable, LockMessage{InfoMessage: result.InfoMessage, Name: name})
+		return
+	}
+	if result.InfoMessage != StatusOKMessage {
+		RespondJSON(w, http.StatusConflict, LockMessage{InfoMessage: StatusLockNotHeldMessage, Name: name})
+		return
+	}
+	RespondJSON(w, http.StatusOK, LockMessage{InfoMessage: StatusOKMessage, Name: name})
+}
+
+func (kv *KeyValueStore) handleHolder(w http.ResponseWriter, r *http.Request, keyPrefix string) {
+	name, ok := pathVariable(r, "name")
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, LockMessage{InfoMessage: StatusBadURLParameterMessage})
+		return
+	}
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying holder request to leader")
+		proxyResp, err := kv.transport.Get(kv.leaderMember(), r.URL.RequestURI())
+		if err != nil {
+			ErrorLogger.Println(err)
+			RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+			return
+		}
+		defer proxyResp.Body.Close()
+
+		lockMessageBytes, _ := ioutil.ReadAll(proxyResp.Body)
+		var lockMessage LockMessage
+		if err := json.Unmarshal(lockMessageBytes, &lockMessage); err != nil {
+			ErrorLogger.Println("Unspecified lock message format")
+			RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+			return
+		}
+
+		RespondJSON(w, proxyResp.StatusCode, lockMessage)
+		return
+	}
+
+	lockMessage := kv.holder(name, keyPrefix, StatusOKMessage)
+	if lockMessage.Owner == "" {
+		RespondJSON(w, http.StatusNotFound, LockMessage{InfoMessage: StatusValueNotFoundMessage, Name: name})
+		return
+	}
+	RespondJSON(w, http.StatusOK, lockMessage)
+}
+
+// holder returns the current owner of the key, the owner is empty if the key is not held
+func (kv *KeyValueStore) holder(name string, keyPrefix string, infoMessage InfoMessage) LockMessage {
+	kv.databaseMutex.RLock()
+	defer kv.databaseMutex.RUnlock()
+
+	return LockMessage{
+		InfoMessage: infoMessage,
+		Name:        name,
+		Owner:       string(kv.Database[keyPrefix+name]),
+		Lease:       kv.KeyLeases[keyPrefix+name],
+	}
+}
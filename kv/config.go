@@ -0,0 +1,640 @@
+package kv
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the network and timing parameters of a node. Every parameter is read from a YAML file,
+// the environment and the flags of `kv run`, which take precedence in this order over the defaults of DefaultConfig.
+type Config struct {
+	// Ports the node serves its endpoints on, other nodes reach them at the URLs the node advertises
+	Port          string
+	GRPCPort      string
+	PeerPort      string
+	PeerTransport string
+	// The client protocols are only served if their port is set
+	RedisPort     string
+	MemcachedPort string
+
+	// Host and port the HTTP API and the peer service listen on, Port and PeerPort on all interfaces if empty.
+	// Nodes that share a host listen on ports of their own.
+	ListenClientAddress string
+	ListenPeerAddress   string
+
+	BaseIPAddress   net.IP
+	LeaderIPAddress net.IP
+	// Outside of release mode, the address of a node is the one it reaches OutboundTarget from
+	OutboundTarget string
+
+	// Nodes refuse the messages of nodes with another cluster ID
+	ClusterID string
+	// The ID of a node is kept in DataDir, nodes without one draw a new ID on every start
+	DataDir string
+	// ID of the node, which LoadNodeID reads from DataDir. Nodes draw a new ID if it is empty.
+	NodeID string
+	// Host and port other nodes and clients reach the node at, derived from its address and ports if empty
+	AdvertisePeerURL   string
+	AdvertiseClientURL string
+	// Clusters are bootstrapped without a designated leader from the comma separated peer URLs of InitialCluster,
+	// or the members DiscoveryDNS resolves to
+	InitialCluster string
+	DiscoveryDNS   string
+
+	// The HTTP API, the gRPC API and the Redis and memcached protocols are served over TLS with CertFile if it is
+	// set. Nodes verify the APIs of other nodes against CAFile, or the system CAs if it is empty.
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// Nodes present PeerCertFile to each other and only accept peer messages of nodes with a certificate of PeerCAFile,
+	// which matches the member they claim to be. The HTTP API is served with it unless CertFile is set.
+	PeerCertFile string
+	PeerKeyFile  string
+	PeerCAFile   string
+
+	// Every node draws its election timeout between MaxElectionTimeout - ElectionTimeoutSpread and MaxElectionTimeout
+	MaxElectionTimeout    time.Duration
+	ElectionTimeoutSpread time.Duration
+	HeartBeatInterval     time.Duration
+	PeerTimeout           time.Duration
+
+	RegisterRetries  int
+	BroadcastRetries int
+	RetryInterval    time.Duration
+
+	WriteBatchInterval time.Duration
+	WriteQueueSize     int
+	LeaseCheckInterval time.Duration
+
+	MaxValueSize   int64
+	MaxRequestSize int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Port:          ":8080",
+		GRPCPort:      ":8081",
+		PeerPort:      ":8082",
+		PeerTransport: DEFAULT_PEER_TRANSPORT,
+
+		BaseIPAddress:   net.IPv4(172, 23, 0, 0),
+		LeaderIPAddress: net.IPv4(172, 23, 0, 2),
+		OutboundTarget:  OUTBOUND_TARGET,
+
+		ClusterID: DEFAULT_CLUSTER_ID,
+
+		MaxElectionTimeout:    MAX_ELECTION_TIMEOUT,
+		ElectionTimeoutSpread: ELECTION_TIMEOUT_SPREAD,
+		HeartBeatInterval:     MAX_ELECTION_TIMEOUT / 4,
+		PeerTimeout:           5 * time.Second,
+
+		RegisterRetries:  MAX_REGISTER_RETRIES,
+		BroadcastRetries: BROADCAST_RETRIES,
+		RetryInterval:    10 * time.Millisecond,
+
+		WriteBatchInterval: WRITE_BATCH_INTERVAL,
+		WriteQueueSize:     WRITE_QUEUE_SIZE,
+		LeaseCheckInterval: LEASE_CHECK_INTERVAL,
+
+		MaxValueSize:   MAX_VALUE_SIZE,
+		MaxRequestSize: MAX_REQUEST_SIZE,
+	}
+}
+
+// electionTimeout draws the election timeout of a node
+func (config Config) electionTimeout() time.Duration {
+	if config.ElectionTimeoutSpread < time.Millisecond {
+		return config.MaxElectionTimeout
+	}
+	return config.MaxElectionTimeout - time.Duration(CLOCK.Intn(int(config.ElectionTimeoutSpread/time.Millisecond)))*time.Millisecond
+}
+
+// IPAddress returns the address of the node with the last byte s in the network of BaseIPAddress
+func (config Config) IPAddress(s byte) net.IP {
+	ipAddress := make(net.IP, len(config.BaseIPAddress))
+	copy(ipAddress, config.BaseIPAddress)
+	ipAddress[len(ipAddress)-1] = s
+	return ipAddress
+}
+
+// Validate returns the first parameter that is out of range, or that does not fit the others
+func (config Config) Validate() error {
+	ports := map[string]string{}
+	for _, parameter := range config.Parameters() {
+		if err := parameter.validate(); err != nil {
+			return fmt.Errorf("%s: %v", parameter.Key, err)
+		}
+		if port, ok := parameter.value.(*string); ok && parameter.isPort() && *port != "" {
+			if other, ok := ports[*port]; ok {
+				return fmt.Errorf("%s: port %s is already used by %s", parameter.Key, *port, other)
+			}
+			ports[*port] = parameter.Key
+		}
+	}
+
+	switch minElectionTimeout := config.MaxElectionTimeout - config.ElectionTimeoutSpread; {
+	case config.PeerTransport != RPC_PEER_TRANSPORT && config.PeerTransport != HTTP_PEER_TRANSPORT:
+		return fmt.Errorf("peerTransport: unknown transport %q, expected %q or %q", config.PeerTransport, RPC_PEER_TRANSPORT, HTTP_PEER_TRANSPORT)
+	case config.ElectionTimeoutSpread >= config.MaxElectionTimeout:
+		return fmt.Errorf("electionTimeoutSpread: %v has to be below maxElectionTimeout (%v)", config.ElectionTimeoutSpread, config.MaxElectionTimeout)
+	// Followers have to hear at least two heart beats before the first of them starts an election,
+	// so that a single late heart beat does not depose the leader
+	case config.HeartBeatInterval*2 > minElectionTimeout:
+		return fmt.Errorf("heartBeatInterval: %v has to be at most half of the smallest election timeout (%v)", config.HeartBeatInterval, minElectionTimeout)
+	case config.MaxValueSize > config.MaxRequestSize:
+		return fmt.Errorf("maxValueSize: %d does not fit into a request of maxRequestSize (%d)", config.MaxValueSize, config.MaxRequestSize)
+	case config.InitialCluster != "" && config.DiscoveryDNS != "":
+		return fmt.Errorf("discoveryDNS: the initial members are already given by initialCluster")
+	case (config.CertFile == "") != (config.KeyFile == ""):
+		return fmt.Errorf("keyFile: certFile and keyFile have to be set together")
+	case config.CAFile != "" && config.CertFile == "":
+		return fmt.Errorf("caFile: the APIs are only verified against it if certFile is set")
+	case (config.PeerCertFile == "") != (config.PeerKeyFile == ""):
+		return fmt.Errorf("peerKeyFile: peerCertFile and peerKeyFile have to be set together")
+	// Peers verify each other, so every node needs both its certificate and the CA
+	case (config.PeerCertFile == "") != (config.PeerCAFile == ""):
+		return fmt.Errorf("peerCAFile: peerCertFile and peerCAFile have to be set together")
+	}
+	if files := config.clientTLS(); files != nil {
+		if err := files.Load(); err != nil {
+			return fmt.Errorf("certFile: %v", err)
+		}
+	}
+	if files := config.peerTLS(); files != nil {
+		if err := files.Load(); err != nil {
+			return fmt.Errorf("peerCertFile: %v", err)
+		}
+	}
+	if config.InitialCluster != "" {
+		if _, err := config.InitialMembers(); err != nil {
+			return fmt.Errorf("initialCluster: %v", err)
+		}
+	}
+	return nil
+}
+
+//
+// Bootstrap
+//
+
+// Bootstrapping returns whether the node is one of the initial members of a new cluster
+func (config Config) Bootstrapping() bool {
+	return config.InitialCluster != "" || config.DiscoveryDNS != ""
+}
+
+// InitialMembers returns the sorted initial members. InitialCluster lists their peer URLs, or their addresses if
+// they use the peer port of this node, each optionally prefixed with the ID of the member as in id=host:port.
+// DiscoveryDNS is looked up as SRV record if it starts with an underscore, e.g. _kv._tcp.example.com, whose
+// targets and ports are the peer URLs, and as A or AAAA record of the addresses otherwise.
+func (config Config) InitialMembers() ([]Follower, error) {
+	var members []Follower
+	if config.InitialCluster != "" {
+		for _, rawMember := range strings.Split(config.InitialCluster, ",") {
+			id, url, ok := strings.Cut(strings.TrimSpace(rawMember), "=")
+			if !ok {
+				id, url = "", id
+			}
+			member, err := config.initialMember(url)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, Follower{ID: id, Member: member})
+		}
+	} else if strings.HasPrefix(config.DiscoveryDNS, "_") {
+		_, records, err := net.LookupSRV("", "", config.DiscoveryDNS)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			member, err := config.initialMember(net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, Follower{Member: member})
+		}
+	} else if config.DiscoveryDNS != "" {
+		addresses, err := net.LookupIP(config.DiscoveryDNS)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			members = append(members, Follower{Member: Member{Address: address}})
+		}
+	}
+
+	// Every member has to end up with the same list
+	for index := range members {
+		if ipv4 := members[index].Address.To4(); ipv4 != nil {
+			members[index].Address = ipv4
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if order := bytes.Compare(members[i].Address, members[j].Address); order != 0 {
+			return order < 0
+		}
+		return members[i].PeerURL < members[j].PeerURL
+	})
+	unique := members[:0]
+	for _, member := range members {
+		if len(unique) == 0 || !reflect.DeepEqual(unique[len(unique)-1], member) {
+			unique = append(unique, member)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no initial members found")
+	}
+	return unique, nil
+}
+
+// initialMember parses an initial member, which is given by its address or by its peer URL. The peer URL is
+// its client URL as well if peer messages are sent over HTTP.
+func (config Config) initialMember(url string) (Member, error) {
+	if address := net.ParseIP(url); address != nil {
+		return Member{Address: address}, nil
+	}
+	host, _, err := net.SplitHostPort(url)
+	if err != nil {
+		return Member{}, err
+	}
+	address := net.ParseIP(host)
+	if address == nil {
+		addresses, err := net.LookupIP(host)
+		if err != nil {
+			return Member{}, err
+		}
+		address = addresses[0]
+		for _, candidate := range addresses {
+			if candidate.To4() != nil {
+				address = candidate
+				break
+			}
+		}
+	}
+
+	member := Member{Address: address, PeerURL: url}
+	if config.PeerTransport == HTTP_PEER_TRANSPORT {
+		member.ClientURL = url
+	}
+	return member, nil
+}
+
+// localMember returns the index of the initial member that is this node. It is either listed with the ID of the
+// node, or at the peer URL the node advertises or listens on, where a listen address without host stands for any
+// address of this machine. Members without peer URL are reached on the peer port of this node.
+func (config Config) localMember(members []Follower) (int, error) {
+	advertiseURL, listenAddress, port := config.AdvertisePeerURL, config.ListenPeerAddress, config.PeerPort
+	if config.PeerTransport == HTTP_PEER_TRANSPORT {
+		advertiseURL, listenAddress, port = config.AdvertiseClientURL, config.ListenClientAddress, config.Port
+	}
+	listenHost, listenPort, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		listenHost, listenPort = "", strings.TrimPrefix(port, ":")
+	}
+	listenIP := net.ParseIP(listenHost)
+
+	local := -1
+	for index, member := range members {
+		url := member.PeerURL
+		if url == "" {
+			url = net.JoinHostPort(member.Address.String(), strings.TrimPrefix(port, ":"))
+		}
+		host, memberPort, _ := net.SplitHostPort(url)
+
+		var isLocal bool
+		switch {
+		case member.ID != "":
+			isLocal = member.ID == config.NodeID
+		case advertiseURL != "":
+			isLocal = url == advertiseURL
+		case memberPort != listenPort:
+			isLocal = false
+		case listenHost == "" || (listenIP != nil && listenIP.IsUnspecified()):
+			isLocal = isLocalAddress(member.Address)
+		default:
+			isLocal = host == listenHost || member.Address.Equal(listenIP)
+		}
+		if !isLocal {
+			continue
+		}
+		if local != -1 {
+			return -1, fmt.Errorf("initial members %s and %s both match this node", members[local].PeerURL, url)
+		}
+		local = index
+	}
+	if local == -1 {
+		return -1, fmt.Errorf("none of the initial members is this node")
+	}
+	return local, nil
+}
+
+//
+// Identity
+//
+
+// LoadNodeID sets NodeID to the ID kept in DataDir, a new ID is stored there on the first start
+func (config *Config) LoadNodeID() error {
+	if config.DataDir == "" {
+		return nil
+	}
+
+	path := filepath.Join(config.DataDir, NODE_ID_FILE)
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		config.NodeID = strings.TrimSpace(string(content))
+		if config.NodeID == "" {
+			return fmt.Errorf("%s: empty node ID", path)
+		}
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		return err
+	}
+	config.NodeID = newNodeID()
+	return ioutil.WriteFile(path, []byte(config.NodeID+"\n"), 0644)
+}
+
+// newNodeID draws a new node ID from CLOCK, so that simulated clusters remain reproducible
+func newNodeID() string {
+	return fmt.Sprintf("%016x", CLOCK.Int63n(math.MaxInt64))
+}
+
+// advertisedMember returns where a node at localAddress is reached, unless its URLs are configured. The peer and
+// client URL are derived from the listen addresses, which are taken as they are if they name a host. The client
+// protocols are reached on their ports at the host of the client URL, if they are served.
+func (config Config) advertisedMember(localAddress net.IP) Member {
+	member := Member{Address: localAddress, PeerURL: config.AdvertisePeerURL, ClientURL: config.AdvertiseClientURL}
+	if member.ClientURL == "" {
+		member.ClientURL = listenURL(config.ListenClientAddress, localAddress, config.Port)
+	}
+	if member.PeerURL == "" && config.PeerTransport == RPC_PEER_TRANSPORT {
+		member.PeerURL = listenURL(config.ListenPeerAddress, localAddress, config.PeerPort)
+	} else if member.PeerURL == "" {
+		member.PeerURL = member.ClientURL
+	}
+
+	if host, _, err := net.SplitHostPort(member.ClientURL); err == nil {
+		member.GRPCURL = portURL(host, config.GRPCPort)
+		member.RedisURL = portURL(host, config.RedisPort)
+		member.MemcachedURL = portURL(host, config.MemcachedPort)
+	}
+	return member
+}
+
+// portURL returns the URL of port on host, or an empty URL if the port is not set
+func portURL(host string, port string) string {
+	if port == "" {
+		return ""
+	}
+	return net.JoinHostPort(host, strings.TrimPrefix(port, ":"))
+}
+
+// listenURL returns the URL a node at localAddress is reached at if it listens on listenAddress, or port if it is empty
+func listenURL(listenAddress string, localAddress net.IP, port string) string {
+	host, listenPort, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		host, listenPort = "", strings.TrimPrefix(port, ":")
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return listenAddress
+	}
+	if localAddress == nil {
+		return ""
+	}
+	return net.JoinHostPort(localAddress.String(), listenPort)
+}
+
+//
+// TLS
+//
+
+// clientTLS returns the files of the client endpoints, nil if they are served without TLS
+func (config Config) clientTLS() *TLSFiles {
+	if config.CertFile == "" {
+		return nil
+	}
+	return NewTLSFiles(config.CertFile, config.KeyFile, config.CAFile)
+}
+
+// peerTLS returns the files of the peer endpoints, nil if they are served without TLS
+func (config Config) peerTLS() *TLSFiles {
+	if config.PeerCertFile == "" {
+		return nil
+	}
+	return NewTLSFiles(config.PeerCertFile, config.PeerKeyFile, config.PeerCAFile)
+}
+
+//
+// Parameters
+//
+
+// Parameter is a single parameter of a Config. Its key is used in configuration files, its flag on the
+// command line and its environment variable is the flag in upper case, e.g. KV_HEART_BEAT_INTERVAL.
+type Parameter struct {
+	Key   string
+	Flag  string
+	Usage string
+
+	// Pointer to the field of the config
+	value interface{}
+	// Lower bound of numbers and durations, strings may not be empty unless it is negative
+	min int64
+}
+
+const ENVIRONMENT_PREFIX = "KV_"
+
+func (parameter Parameter) Environment() string {
+	return ENVIRONMENT_PREFIX + strings.ToUpper(strings.ReplaceAll(parameter.Flag, "-", "_"))
+}
+
+// Parameters returns all parameters, whose values point to the fields of the config
+func (config *Config) Parameters() []Parameter {
+	return []Parameter{
+		{"port", "port", "port of the HTTP API", &config.Port, 0},
+		{"grpcPort", "grpc-port", "port of the gRPC and etcd API", &config.GRPCPort, 0},
+		{"peerPort", "peer-port", "port of the messages between nodes over the rpc transport", &config.PeerPort, 0},
+		{"peerTransport", "peer-transport", "transport of the messages between nodes, either rpc or the legacy http", &config.PeerTransport, 0},
+		{"redisPort", "redis-port", "port of the Redis protocol listener, e.g. :6379 (disabled if empty)", &config.RedisPort, -1},
+		{"memcachedPort", "memcached-port", "port of the memcached protocol listener, e.g. :11211 (disabled if empty)", &config.MemcachedPort, -1},
+		{"listenClientAddress", "listen-client-address", "host:port the HTTP API listens on instead of port on all interfaces", &config.ListenClientAddress, -1},
+		{"listenPeerAddress", "listen-peer-address", "host:port the peer service listens on instead of peer-port on all interfaces", &config.ListenPeerAddress, -1},
+		{"baseIPAddress", "base-ip-address", "address of the network of the nodes", &config.BaseIPAddress, 0},
+		{"leaderIPAddress", "leader-ip-address", "address of the initial leader", &config.LeaderIPAddress, 0},
+		{"outboundTarget", "outbound-target", "host and port the address of a node is determined with outside of release mode", &config.OutboundTarget, 0},
+		{"clusterID", "cluster-id", "ID of the cluster, messages of nodes with another ID are refused", &config.ClusterID, 0},
+		{"dataDir", "data-dir", "directory the ID of the node is kept in, the node gets a new ID on every start if empty", &config.DataDir, -1},
+		{"advertisePeerURL", "advertise-peer-url", "host:port other nodes reach the peer endpoint of this node at (derived from its address if empty)", &config.AdvertisePeerURL, -1},
+		{"advertiseClientURL", "advertise-client-url", "host:port clients reach the HTTP API of this node at (derived from its address if empty)", &config.AdvertiseClientURL, -1},
+		{"initialCluster", "initial-cluster", "comma separated [id=]host:port peer URLs or addresses of the initial members, which bootstrap the cluster without a designated leader", &config.InitialCluster, -1},
+		{"discoveryDNS", "discovery-dns", "DNS name of the initial members instead of initial-cluster, SRV records of their peer URLs if it starts with an underscore", &config.DiscoveryDNS, -1},
+		{"certFile", "cert-file", "certificate of the HTTP, gRPC, Redis and memcached endpoints, which are served over TLS if it is set", &config.CertFile, -1},
+		{"keyFile", "key-file", "key of cert-file", &config.KeyFile, -1},
+		{"caFile", "ca-file", "CA the APIs of other nodes are verified against (system CAs if empty)", &config.CAFile, -1},
+		{"peerCertFile", "peer-cert-file", "certificate nodes present to each other, peer messages are sent over mutual TLS if it is set", &config.PeerCertFile, -1},
+		{"peerKeyFile", "peer-key-file", "key of peer-cert-file", &config.PeerKeyFile, -1},
+		{"peerCAFile", "peer-ca-file", "CA the certificates of other nodes are verified against", &config.PeerCAFile, -1},
+		{"maxElectionTimeout", "max-election-timeout", "longest time a follower waits for a heart beat before it starts an election", &config.MaxElectionTimeout, 1},
+		{"electionTimeoutSpread", "election-timeout-spread", "range below the longest election timeout the election timeouts of the nodes are drawn from", &config.ElectionTimeoutSpread, 0},
+		{"heartBeatInterval", "heart-beat-interval", "interval of the heart beats of the leader", &config.HeartBeatInterval, 1},
+		{"peerTimeout", "peer-timeout", "time after which messages to other nodes are given up", &config.PeerTimeout, 1},
+		{"registerRetries", "register-retries", "number of attempts to register with the leader", &config.RegisterRetries, 1},
+		{"broadcastRetries", "broadcast-retries", "number of attempts to deliver a refused message to a follower", &config.BroadcastRetries, 1},
+		{"retryInterval", "retry-interval", "time between two attempts", &config.RetryInterval, 0},
+		{"writeBatchInterval", "write-batch-interval", "interval in which the leader replicates the queued writes", &config.WriteBatchInterval, 1},
+		{"writeQueueSize", "write-queue-size", "number of writes that are queued before clients block", &config.WriteQueueSize, 1},
+		{"leaseCheckInterval", "lease-check-interval", "interval in which the leader checks for expired leases", &config.LeaseCheckInterval, 1},
+		{"maxValueSize", "max-value-size", "maximum size of a single value in bytes", &config.MaxValueSize, 1},
+		{"maxRequestSize", "max-request-size", "maximum size of a client request body in bytes", &config.MaxRequestSize, 1},
+	}
+}
+
+// Value returns the pointer to the field of the parameter, which is a *string, *net.IP, *time.Duration, *int or *int64
+func (parameter Parameter) Value() interface{} {
+	return parameter.value
+}
+
+// Set parses value like it is written in configuration files and the environment
+func (parameter Parameter) Set(value string) error {
+	value = strings.TrimSpace(value)
+	switch field := parameter.value.(type) {
+	case *string:
+		*field = value
+	case *net.IP:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("%q is no IP address", value)
+		}
+		*field = ip
+	case *time.Duration:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field = duration
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field = number
+	case *int64:
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field = number
+	}
+	return nil
+}
+
+func (parameter Parameter) isPort() bool {
+	return parameter.Key == "port" || strings.HasSuffix(parameter.Key, "Port")
+}
+
+func (parameter Parameter) isHostPort() bool {
+	return parameter.Key == "outboundTarget" || strings.HasPrefix(parameter.Key, "listen") || strings.HasSuffix(parameter.Key, "URL")
+}
+
+func (parameter Parameter) validate() error {
+	switch field := parameter.value.(type) {
+	case *string:
+		if *field == "" {
+			if parameter.min < 0 {
+				return nil
+			}
+			return fmt.Errorf("must not be empty")
+		}
+		if parameter.isPort() {
+			if port, err := strconv.Atoi(strings.TrimPrefix(*field, ":")); !strings.HasPrefix(*field, ":") || err != nil || port < 1 || port > 65535 {
+				return fmt.Errorf("%q is no port, e.g. :8080", *field)
+			}
+		}
+		if parameter.isHostPort() {
+			if _, _, err := net.SplitHostPort(*field); err != nil {
+				return err
+			}
+		}
+	case *net.IP:
+		if field.To4() == nil {
+			return fmt.Errorf("%v is no IPv4 address", *field)
+		}
+	case *time.Duration:
+		if int64(*field) < parameter.min {
+			return fmt.Errorf("%v has to be positive", *field)
+		}
+	case *int:
+		if int64(*field) < parameter.min {
+			return fmt.Errorf("%d has to be at least %d", *field, parameter.min)
+		}
+	case *int64:
+		if *field < parameter.min {
+			return fmt.Errorf("%d has to be at least %d", *field, parameter.min)
+		}
+	}
+	return nil
+}
+
+//
+// Sources
+//
+
+// LoadFile sets the parameters given in the YAML file at path, e.g. `heartBeatInterval: 300ms`
+func (config *Config) LoadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]string
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	parameters := make(map[string]Parameter)
+	for _, parameter := range config.Parameters() {
+		parameters[parameter.Key] = parameter
+	}
+
+	// Keys are set in order, so that the first error is always the same
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parameter, ok := parameters[key]
+		if !ok {
+			return fmt.Errorf("%s: unknown parameter %s", path, key)
+		}
+		if err := parameter.Set(values[key]); err != nil {
+			return fmt.Errorf("%s: %s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+// LoadEnvironment sets the parameters given in the environment
+func (config *Config) LoadEnvironment() error {
+	for _, parameter := range config.Parameters() {
+		if value, ok := os.LookupEnv(parameter.Environment()); ok {
+			if err := parameter.Set(value); err != nil {
+				return fmt.Errorf("%s: %v", parameter.Environment(), err)
+			}
+		}
+	}
+	return nil
+}
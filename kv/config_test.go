@@ -0,0 +1,158 @@
+package kv
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+
+	// The example lists all parameters with their defaults
+	example := DefaultConfig()
+	example.PeerTransport = ""
+	if err := example.LoadFile("../config.example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(example, config) {
+		t.Fatalf("example config differs from the defaults:\n%+v\n%+v", example, config)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(config *Config)
+		error  string
+	}{
+		{"port without colon", func(c *Config) { c.Port = "8080" }, "port:"},
+		{"port out of range", func(c *Config) { c.GRPCPort = ":70000" }, "grpcPort:"},
+		{"port used twice", func(c *Config) { c.RedisPort = c.PeerPort }, "redisPort: port :8082 is already used by peerPort"},
+		{"unknown transport", func(c *Config) { c.PeerTransport = "udp" }, "peerTransport:"},
+		{"invalid outbound target", func(c *Config) { c.OutboundTarget = "leader" }, "outboundTarget:"},
+		{"listen address without port", func(c *Config) { c.ListenClientAddress = "127.0.0.1" }, "listenClientAddress:"},
+		{"advertised URL without port", func(c *Config) { c.AdvertisePeerURL = "node" }, "advertisePeerURL:"},
+		{"IPv6 address", func(c *Config) { c.BaseIPAddress = net.IPv6loopback }, "baseIPAddress:"},
+		{"no election timeout", func(c *Config) { c.MaxElectionTimeout = 0 }, "maxElectionTimeout:"},
+		{"spread above election timeout", func(c *Config) { c.ElectionTimeoutSpread = c.MaxElectionTimeout }, "electionTimeoutSpread:"},
+		{"heart beat above election timeout", func(c *Config) { c.HeartBeatInterval = 600 * time.Millisecond }, "heartBeatInterval:"},
+		{"heart beat above half of election timeout", func(c *Config) { c.HeartBeatInterval = 250*time.Millisecond + 1 }, "heartBeatInterval:"},
+		{"no retries", func(c *Config) { c.RegisterRetries = 0 }, "registerRetries:"},
+		{"no write queue", func(c *Config) { c.WriteQueueSize = 0 }, "writeQueueSize:"},
+		{"value above request size", func(c *Config) { c.MaxValueSize = c.MaxRequestSize + 1 }, "maxValueSize:"},
+		{"no cluster ID", func(c *Config) { c.ClusterID = "" }, "clusterID:"},
+		{"invalid initial member", func(c *Config) { c.InitialCluster = "10.0.0.1,leader" }, "initialCluster:"},
+		{"initial members twice", func(c *Config) { c.InitialCluster, c.DiscoveryDNS = "10.0.0.1", "kv" }, "discoveryDNS:"},
+		{"key without certificate", func(c *Config) { c.KeyFile = "node-key.pem" }, "keyFile:"},
+		{"CA without certificate", func(c *Config) { c.CAFile = "ca.pem" }, "caFile:"},
+		{"peer certificate without CA", func(c *Config) { c.PeerCertFile, c.PeerKeyFile = "peer.pem", "peer-key.pem" }, "peerCAFile:"},
+		{"missing certificate", func(c *Config) { c.CertFile, c.KeyFile = "missing.pem", "missing-key.pem" }, "certFile:"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			test.change(&config)
+			if err := config.Validate(); err == nil || !strings.HasPrefix(err.Error(), test.error) {
+				t.Fatalf("expected error %q, got %v", test.error, err)
+			}
+		})
+	}
+
+	config := DefaultConfig()
+	config.HeartBeatInterval = (config.MaxElectionTimeout - config.ElectionTimeoutSpread) / 2
+	if err := config.Validate(); err != nil {
+		t.Fatalf("heart beat interval of half the smallest election timeout was refused: %v", err)
+	}
+}
+
+func TestAdvertisedURLs(t *testing.T) {
+	address := net.IPv4(10, 0, 0, 1)
+	for _, test := range []struct {
+		name      string
+		change    func(config *Config)
+		peerURL   string
+		clientURL string
+		redisURL  string
+	}{
+		{"default ports", func(c *Config) {}, "10.0.0.1:8082", "10.0.0.1:8080", ""},
+		{"listen on all interfaces", func(c *Config) { c.ListenClientAddress, c.ListenPeerAddress = ":9080", "0.0.0.0:9082" }, "10.0.0.1:9082", "10.0.0.1:9080", ""},
+		{"listen on a host", func(c *Config) { c.ListenClientAddress, c.ListenPeerAddress = "127.0.0.1:9080", "127.0.0.1:9082" }, "127.0.0.1:9082", "127.0.0.1:9080", ""},
+		{"http transport", func(c *Config) { c.PeerTransport, c.ListenClientAddress = HTTP_PEER_TRANSPORT, ":9080" }, "10.0.0.1:9080", "10.0.0.1:9080", ""},
+		{"advertised", func(c *Config) { c.AdvertisePeerURL, c.AdvertiseClientURL = "node:1", "node:2" }, "node:1", "node:2", ""},
+		{"redis", func(c *Config) { c.AdvertiseClientURL, c.RedisPort = "node:2", ":9379" }, "10.0.0.1:8082", "node:2", "node:9379"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			test.change(&config)
+			member := config.advertisedMember(address)
+			if member.PeerURL != test.peerURL || member.ClientURL != test.clientURL || member.RedisURL != test.redisURL {
+				t.Fatalf("advertised %+v, expected %s, %s and %q", member, test.peerURL, test.clientURL, test.redisURL)
+			}
+			if host, _, _ := net.SplitHostPort(member.ClientURL); member.GRPCURL != net.JoinHostPort(host, "8081") {
+				t.Fatalf("advertised gRPC URL %s along with client URL %s", member.GRPCURL, member.ClientURL)
+			}
+		})
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("heartBeatInterval: 100ms\nwriteQueueSize: 16\nredisPort: \":6379\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KV_HEART_BEAT_INTERVAL", "200ms")
+
+	config := DefaultConfig()
+	if err := config.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadEnvironment(); err != nil {
+		t.Fatal(err)
+	}
+	if config.HeartBeatInterval != 200*time.Millisecond || config.WriteQueueSize != 16 || config.RedisPort != ":6379" {
+		t.Fatalf("environment has to override the file: %+v", config)
+	}
+
+	if err := os.WriteFile(path, []byte("heartBeat: 100ms\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadFile(path); err == nil || !strings.Contains(err.Error(), "unknown parameter heartBeat") {
+		t.Fatalf("expected unknown parameter, got %v", err)
+	}
+
+	t.Setenv("KV_WRITE_QUEUE_SIZE", "many")
+	if err := config.LoadEnvironment(); err == nil || !strings.HasPrefix(err.Error(), "KV_WRITE_QUEUE_SIZE:") {
+		t.Fatalf("expected invalid KV_WRITE_QUEUE_SIZE, got %v", err)
+	}
+}
+
+func TestLoadNodeID(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.LoadNodeID(); err != nil || config.NodeID != "" {
+		t.Fatalf("node without data directory got ID %q (%v)", config.NodeID, err)
+	}
+
+	config.DataDir = filepath.Join(t.TempDir(), "data")
+	if err := config.LoadNodeID(); err != nil || config.NodeID == "" {
+		t.Fatalf("no ID was stored in the data directory (%v)", err)
+	}
+	restarted := DefaultConfig()
+	restarted.DataDir = config.DataDir
+	if err := restarted.LoadNodeID(); err != nil || restarted.NodeID != config.NodeID {
+		t.Fatalf("restarted node got ID %q, expected %q (%v)", restarted.NodeID, config.NodeID, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(config.DataDir, NODE_ID_FILE), []byte("\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.LoadNodeID(); err == nil {
+		t.Fatal("empty node ID was accepted")
+	}
+}
@@ -2,36 +2,126 @@ package kv
 
 import (
 	"log"
-	"math/rand"
-	"net"
 	"os"
 	"time"
 )
 
-var BASE_IP_ADDRESS = net.IPv4(172, 23, 0, 0)
-var LEADER_IP_ADDRESS = net.IPv4(172, 23, 0, 2)
+// The defaults below are used unless a node is configured otherwise on start, see Config
 
-const PORT string = ":8080"
+//
+// Network
+//
+
+// Outside of release mode, nodes take the address they reach OUTBOUND_TARGET from
+const OUTBOUND_TARGET = "leader:8080"
+
+// Nodes only exchange peer messages with nodes of the same cluster, whose ID they send along in CLUSTER_HEADER
+// or the CLUSTER_METADATA of the RPC transport
+const DEFAULT_CLUSTER_ID = "kv"
+const CLUSTER_HEADER = "X-Kv-Cluster"
+const CLUSTER_METADATA = "x-kv-cluster"
+
+// Nodes keep their ID in NODE_ID_FILE in their data directory, it remains the same across restarts and address changes
+const NODE_ID_FILE = "node-id"
+
+// Nodes exchange heart beats, polls and logs over the peer port, unless the legacy JSON transport is configured on start
+const RPC_PEER_TRANSPORT = "rpc"
+const HTTP_PEER_TRANSPORT = "http"
+
+const DEFAULT_PEER_TRANSPORT = RPC_PEER_TRANSPORT
+
+// Messages reordered by the fault transport are held back by up to FAULT_REORDER_DELAY
+const FAULT_REORDER_DELAY = 50 * time.Millisecond
+
+//
+// Replication
+//
+
+// Registrations with the leader and messages broadcast to the followers are retried this many times
 const MAX_REGISTER_RETRIES = 5
 const BROADCAST_RETRIES = 5
-const RETRY_INTERVAL = 10 * time.Millisecond
 
-const max_election_timeout_ms = 1000
-const max_election_timeout_diff = 500
+// Client writes queued on the leader are flushed to the followers once per WRITE_BATCH_INTERVAL,
+// at most WRITE_QUEUE_SIZE of them wait in the queue
+const WRITE_BATCH_INTERVAL = 2 * time.Millisecond
+const WRITE_QUEUE_SIZE = 1024
+
+// The actual election timeout is randomized between MAX_ELECTION_TIMEOUT - ELECTION_TIMEOUT_SPREAD and
+// MAX_ELECTION_TIMEOUT to reduce the chances of split votes
+const MAX_ELECTION_TIMEOUT = 1000 * time.Millisecond
+const ELECTION_TIMEOUT_SPREAD = 500 * time.Millisecond
+
+var INITIAL_LOG = CreateKeyValueLog("initial", []byte("value"), false, true)
+
+//
+// Clock
+//
+
+// Simulations replace CLOCK by a simulated clock before they create any node
+var CLOCK Clock = SystemClock{}
+
+// Goroutines that wait for a condition check it once per POLL_INTERVAL
+const POLL_INTERVAL = 100 * time.Microsecond
+
+// Simulated clocks start at SIMULATION_EPOCH, waiting goroutines back off up to SIMULATED_MAX_WAIT_INTERVAL
+var SIMULATION_EPOCH = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const SIMULATED_MAX_WAIT_INTERVAL = 10 * time.Millisecond
+
+// A simulation panics if its running goroutine does not return control within SIMULATION_STALL_TIMEOUT of real time
+const SIMULATION_STALL_TIMEOUT = 10 * time.Second
+
+// Simulated messages take SIMULATED_LATENCY plus up to SIMULATED_JITTER in each direction
+const SIMULATED_LATENCY = time.Millisecond
+const SIMULATED_JITTER = time.Millisecond
+
+//
+// Values
+//
+
+// Larger values and client requests are rejected with 413
+const MAX_VALUE_SIZE int64 = 4 << 20
+const MAX_REQUEST_SIZE int64 = 16 << 20
+
+// Content type of raw reads for values that were written without one
+const DEFAULT_CONTENT_TYPE = "application/octet-stream"
+
+// The leader checks for expired leases once per LEASE_CHECK_INTERVAL
+const LEASE_CHECK_INTERVAL = 100 * time.Millisecond
+
+// Keys of locks and elections are stored with these prefixes
+const LOCK_KEY_PREFIX = "lock/"
+const ELECTION_KEY_PREFIX = "election/"
+
+//
+// Client Protocols
+//
+
+// Every v2 response carries the state of the cluster in these headers, as well as in its body
+const REVISION_HEADER = "X-Kv-Revision"
+const TERM_HEADER = "X-Kv-Term"
+const LEADER_HEADER = "X-Kv-Leader"
+
+// Watchers that fall behind by more than WATCH_BUFFER_SIZE events are cancelled
+const WATCH_BUFFER_SIZE = 256
+
+// Watchers may start from past revisions, as long as their events are among the last WATCH_HISTORY_SIZE events
+const WATCH_HISTORY_SIZE = WATCH_BUFFER_SIZE
 
-// The actual election timeout is randomized between [0.5, 1.0] * MAX_ELECTION_TIMEOUT to reduce the chances of split votes
-const MAX_ELECTION_TIMEOUT = max_election_timeout_ms * time.Millisecond
+// Lines of the Redis and memcached protocols, including inline commands, are limited to PROTOCOL_LINE_SIZE bytes
+const PROTOCOL_LINE_SIZE = 64 << 10
 
-var randomSource = rand.NewSource(time.Now().UnixNano())
-var randomNumberGenerator = rand.New(randomSource)
+// SCAN returns REDIS_SCAN_COUNT keys per call, unless the client asks for a different COUNT
+const REDIS_SCAN_COUNT = 10
 
-// INDIVIDUAL_ELECTION_TIMEOUT is between 50% and 100% of MAX_ELECTION_TIMEOUT
-var INDIVIDUAL_ELECTION_TIMEOUT = MAX_ELECTION_TIMEOUT -
-	time.Duration(randomNumberGenerator.Intn(max_election_timeout_diff))*time.Millisecond
+const MEMCACHED_VERSION = "1.6.0"
+const MEMCACHED_MAX_KEY_LENGTH = 250
 
-var LEADER_HEART_BEAT_TIMEOUT = MAX_ELECTION_TIMEOUT / 3
+// Expiration times of memcached items up to 30 days are relative, larger ones are unix timestamps
+const MEMCACHED_MAX_RELATIVE_EXPIRATION = 60 * 60 * 24 * 30
 
-var INITIAL_LOG = CreateKeyValueLog("initial", "value", false, true)
+// Content type of keys holding memcached items with flags, the flags are stored as its parameter
+const MEMCACHED_CONTENT_TYPE = "application/x-memcached"
 
 //
 // Logging
@@ -1,27 +1,30 @@
 package kv
 
 import (
+	"encoding/json"
 	"net"
 	"net/http"
-	"os"
 )
 
-func handleDevKill(w http.ResponseWriter, r *http.Request) {
+// handleDevKill stops the node like a crash, `kv run` exits once the node stopped serving
+func (kv *KeyValueStore) handleDevKill(w http.ResponseWriter, r *http.Request) {
 	RespondJSON(w, http.StatusOK, StatusOKMessage)
-	os.Exit(0)
+	kv.Stop()
 }
 
 func (kv *KeyValueStore) handleDevState(w http.ResponseWriter, r *http.Request) {
 	kv.databaseMutex.RLock()
 	kv.logMutex.RLock()
 	kv.followerMutex.RLock()
+	kv.leaderMutex.RLock()
 	RespondJSON(w, http.StatusOK, StateMessage{
 		StatusOKMessage,
-		*kv,
+		kv,
 	})
 	kv.databaseMutex.RUnlock()
 	kv.logMutex.RUnlock()
 	kv.followerMutex.RUnlock()
+	kv.leaderMutex.RUnlock()
 }
 
 func (kv *KeyValueStore) handleDevRegister(w http.ResponseWriter, r *http.Request) {
@@ -43,9 +46,8 @@ func (kv *KeyValueStore) handleDevRegister(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	newLeaderAddress := kv.register(address)
-	if newLeaderAddress != nil {
-		kv.LeaderAddress = newLeaderAddress
+	// Entry nodes that share their address with others are given by the URL of their HTTP API
+	if kv.register(Member{Address: address, ClientURL: r.FormValue("url")}) {
 		RespondJSON(w, http.StatusOK, StatusOKMessage)
 	} else {
 		ErrorLogger.Println("Registration unsuccessful")
@@ -54,3 +56,63 @@ func (kv *KeyValueStore) handleDevRegister(w http.ResponseWriter, r *http.Reques
 			Message: "Unknown internal server error"})
 	}
 }
+
+//
+// Fault Injection
+//
+
+// faultTransport responds with an error if faults cannot be injected on this node
+func (kv *KeyValueStore) faultTransport(w http.ResponseWriter) (*FaultTransport, bool) {
+	transport, ok := kv.transport.(*FaultTransport)
+	if !ok {
+		RespondJSON(w, http.StatusNotImplemented, StatusNoFaultTransportMessage)
+	}
+	return transport, ok
+}
+
+func (kv *KeyValueStore) handleDevFaults(w http.ResponseWriter, r *http.Request) {
+	if transport, ok := kv.faultTransport(w); ok {
+		RespondJSON(w, http.StatusOK, LinkFaultsMessage{StatusOKMessage, transport.LinkFaults()})
+	}
+}
+
+func (kv *KeyValueStore) handleDevSetFaults(w http.ResponseWriter, r *http.Request) {
+	transport, ok := kv.faultTransport(w)
+	if !ok {
+		return
+	}
+
+	var request LinkFaultsRequestMessage
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Address == nil {
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
+		return
+	}
+	InfoLogger.Printf("Injecting faults into messages to %s: %+v\n", request.Address, request.Faults)
+	transport.SetLinkFaults(request.Address, request.Faults)
+	RespondJSON(w, http.StatusOK, StatusOKMessage)
+}
+
+// handleDevPartition blocks the messages to the given nodes, the partition is only symmetric if they block this node as well
+func (kv *KeyValueStore) handleDevPartition(w http.ResponseWriter, r *http.Request) {
+	transport, ok := kv.faultTransport(w)
+	if !ok {
+		return
+	}
+
+	var request PartitionRequestMessage
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
+		return
+	}
+	InfoLogger.Printf("Blocking messages to %v\n", request.Addresses)
+	transport.Block(request.Addresses...)
+	RespondJSON(w, http.StatusOK, StatusOKMessage)
+}
+
+func (kv *KeyValueStore) handleDevHeal(w http.ResponseWriter, r *http.Request) {
+	if transport, ok := kv.faultTransport(w); ok {
+		InfoLogger.Println("Removing all injected faults")
+		transport.Heal()
+		RespondJSON(w, http.StatusOK, StatusOKMessage)
+	}
+}
@@ -0,0 +1,485 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// The etcd compatibility layer implements the KV, Watch and Lease services of the etcd v3 API,
+// so etcd clients and tools can be pointed at the gRPC port. Writes are applied as a single
+// transaction log, followers forward everything but watches to the leader like the gRPC API.
+// Features that are not supported, like historical reads, compaction and nested transactions,
+// return Unimplemented.
+
+var etcdErrors = map[InfoMessage]error{
+	StatusEmptyKeyMessage:      rpctypes.ErrGRPCEmptyKey,
+	StatusValueNotFoundMessage: rpctypes.ErrGRPCKeyNotFound,
+	StatusValueTooLargeMessage: rpctypes.ErrGRPCRequestTooLarge,
+	StatusLeaseNotFoundMessage: rpctypes.ErrGRPCLeaseNotFound,
+	StatusLeaseExistsMessage:   rpctypes.ErrGRPCLeaseExist,
+}
+
+// Watchers fall behind whenever their buffer is full, which etcd clients cannot resume from
+const etcdWatchLaggingReason = "watcher fell behind"
+
+func (kv *KeyValueStore) registerEtcdServers(server *grpc.Server) {
+	etcdserverpb.RegisterKVServer(server, &etcdKVServer{kv: kv})
+	etcdserverpb.RegisterWatchServer(server, &etcdWatchServer{kv: kv})
+	etcdserverpb.RegisterLeaseServer(server, &etcdLeaseServer{kv: kv})
+}
+
+//
+// KV
+//
+
+type etcdKVServer struct {
+	etcdserverpb.UnimplementedKVServer
+
+	kv *KeyValueStore
+}
+
+func (s *etcdKVServer) Range(ctx context.Context, request *etcdserverpb.RangeRequest) (*etcdserverpb.RangeResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return etcdserverpb.NewKVClient(connection).Range(ctx, request)
+	}
+
+	if err := s.kv.validateEtcdRange(request); err != nil {
+		return nil, err
+	}
+
+	s.kv.databaseMutex.RLock()
+	response := s.kv.etcdRange(request)
+	s.kv.databaseMutex.RUnlock()
+
+	response.Header = s.kv.etcdHeader()
+	return response, nil
+}
+
+func (s *etcdKVServer) Put(ctx context.Context, request *etcdserverpb.PutRequest) (*etcdserverpb.PutResponse, error) {
+	response, err := s.Txn(ctx, &etcdserverpb.TxnRequest{
+		Success: []*etcdserverpb.RequestOp{{Request: &etcdserverpb.RequestOp_RequestPut{RequestPut: request}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Responses[0].GetResponsePut(), nil
+}
+
+func (s *etcdKVServer) DeleteRange(ctx context.Context, request *etcdserverpb.DeleteRangeRequest) (*etcdserverpb.DeleteRangeResponse, error) {
+	response, err := s.Txn(ctx, &etcdserverpb.TxnRequest{
+		Success: []*etcdserverpb.RequestOp{{Request: &etcdserverpb.RequestOp_RequestDeleteRange{RequestDeleteRange: request}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Responses[0].GetResponseDeleteRange(), nil
+}
+
+// Txn replicates the transaction as a single log, its comparisons are evaluated once the log is applied
+func (s *etcdKVServer) Txn(ctx context.Context, request *etcdserverpb.TxnRequest) (*etcdserverpb.TxnResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return etcdserverpb.NewKVClient(connection).Txn(ctx, request)
+	}
+
+	if err := s.kv.validateEtcdTxn(request); err != nil {
+		return nil, err
+	}
+
+	encodedRequest, err := proto.Marshal(request)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	result := s.kv.queueWrite([]*KeyValueLog{CreateTxnLog(encodedRequest, true, false)})[0]
+	if result.InfoMessage != StatusOKMessage {
+		return nil, etcdError(result.InfoMessage)
+	}
+
+	response := result.Txn
+	header := s.kv.etcdHeader()
+	header.Revision = response.Header.Revision
+	response.Header = header
+	for _, operation := range response.Responses {
+		switch operationResponse := operation.Response.(type) {
+		case *etcdserverpb.ResponseOp_ResponseRange:
+			operationResponse.ResponseRange.Header = header
+		case *etcdserverpb.ResponseOp_ResponsePut:
+			operationResponse.ResponsePut.Header = header
+		case *etcdserverpb.ResponseOp_ResponseDeleteRange:
+			operationResponse.ResponseDeleteRange.Header = header
+		}
+	}
+	return response, nil
+}
+
+func (s *etcdKVServer) Compact(ctx context.Context, request *etcdserverpb.CompactionRequest) (*etcdserverpb.CompactionResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "compaction is not supported, the database log is never compacted")
+}
+
+func (kv *KeyValueStore) validateEtcdRange(request *etcdserverpb.RangeRequest) error {
+	if len(request.Key) == 0 {
+		return rpctypes.ErrGRPCEmptyKey
+	}
+	if request.SortOrder < etcdserverpb.RangeRequest_NONE || request.SortOrder > etcdserverpb.RangeRequest_DESCEND ||
+		request.SortTarget < etcdserverpb.RangeRequest_KEY || request.SortTarget > etcdserverpb.RangeRequest_VALUE {
+		return rpctypes.ErrGRPCInvalidSortOption
+	}
+
+	if request.Revision != 0 {
+		revision := kv.etcdHeader().Revision
+		if request.Revision > revision {
+			return rpctypes.ErrGRPCFutureRev
+		}
+		if request.Revision < revision {
+			return status.Error(codes.Unimplemented, "historical reads are not supported")
+		}
+	}
+	return nil
+}
+
+// validateEtcdTxn rejects transactions that could never be applied before they are logged
+func (kv *KeyValueStore) validateEtcdTxn(request *etcdserverpb.TxnRequest) error {
+	for _, compare := range request.Compare {
+		if len(compare.Key) == 0 {
+			return rpctypes.ErrGRPCEmptyKey
+		}
+	}
+
+	for _, operations := range [][]*etcdserverpb.RequestOp{request.Success, request.Failure} {
+		putKeys := make(map[string]bool)
+		for _, operation := range operations {
+			switch request := operation.Request.(type) {
+			case *etcdserverpb.RequestOp_RequestRange:
+				if err := kv.validateEtcdRange(request.RequestRange); err != nil {
+					return err
+				}
+			case *etcdserverpb.RequestOp_RequestPut:
+				put := request.RequestPut
+				switch {
+				case len(put.Key) == 0:
+					return rpctypes.ErrGRPCEmptyKey
+				case int64(len(put.Value)) > kv.config.MaxValueSize:
+					return rpctypes.ErrGRPCRequestTooLarge
+				case put.IgnoreValue && len(put.Value) != 0:
+					return rpctypes.ErrGRPCValueProvided
+				case put.IgnoreLease && put.Lease != 0:
+					return rpctypes.ErrGRPCLeaseProvided
+				case putKeys[string(put.Key)]:
+					return rpctypes.ErrGRPCDuplicateKey
+				}
+				putKeys[string(put.Key)] = true
+			case *etcdserverpb.RequestOp_RequestDeleteRange:
+				if len(request.RequestDeleteRange.Key) == 0 {
+					return rpctypes.ErrGRPCEmptyKey
+				}
+			case *etcdserverpb.RequestOp_RequestTxn:
+				return status.Error(codes.Unimplemented, "nested transactions are not supported")
+			default:
+				return status.Error(codes.InvalidArgument, "unknown transaction operation")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// Watch
+//
+
+type etcdWatchServer struct {
+	etcdserverpb.UnimplementedWatchServer
+
+	kv *KeyValueStore
+}
+
+// Watch serves the watchers of one stream from the events committed on this node.
+// Every watcher passes its events to the stream on its own, sending is serialized.
+func (s *etcdWatchServer) Watch(stream etcdserverpb.Watch_WatchServer) error {
+	var sendMutex sync.Mutex
+	send := func(response *etcdserverpb.WatchResponse) {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		if err := stream.Send(response); err != nil {
+			ErrorLogger.Println(err)
+		}
+	}
+
+	var watchersMutex sync.Mutex
+	watchers := make(map[int64]*watcher)
+	var nextWatchID int64 = 0
+	defer func() {
+		watchersMutex.Lock()
+		for watchID, w := range watchers {
+			delete(watchers, watchID)
+			s.kv.unwatch(w)
+		}
+		watchersMutex.Unlock()
+	}()
+
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch request := request.RequestUnion.(type) {
+		case *etcdserverpb.WatchRequest_CreateRequest:
+			create := request.CreateRequest
+
+			watchersMutex.Lock()
+			watchID := create.WatchId
+			if watchID == 0 {
+				for ; watchers[nextWatchID] != nil; nextWatchID++ {
+				}
+				watchID = nextWatchID
+			}
+			reason := unsupportedEtcdWatch(create)
+			if watchers[watchID] != nil {
+				reason = "watch id is already in use"
+			}
+			if reason != "" {
+				watchersMutex.Unlock()
+				send(&etcdserverpb.WatchResponse{Header: s.kv.etcdHeader(), WatchId: watchID, Created: true, Canceled: true, CancelReason: reason})
+				continue
+			}
+
+			match := func(key string) bool { return inEtcdRange(key, create.Key, create.RangeEnd) }
+			var w *watcher
+			if create.StartRevision == 0 {
+				w = s.kv.watchKeys(match)
+			} else if historyWatcher, historyRevision, ok := s.kv.watchKeysFrom(match, create.StartRevision-1); ok {
+				w = historyWatcher
+			} else {
+				// Like compacted revisions in etcd
+				watchersMutex.Unlock()
+				send(&etcdserverpb.WatchResponse{
+					Header:          s.kv.etcdHeader(),
+					WatchId:         watchID,
+					Created:         true,
+					Canceled:        true,
+					CompactRevision: etcdRevision(historyRevision),
+					CancelReason:    rpctypes.ErrGRPCCompacted.Error(),
+				})
+				continue
+			}
+			watchers[watchID] = w
+			watchersMutex.Unlock()
+
+			send(&etcdserverpb.WatchResponse{Header: s.kv.etcdHeader(), WatchId: watchID, Created: true})
+			go func(watchID int64, w *watcher, filters []etcdserverpb.WatchCreateRequest_FilterType) {
+				for event := range w.events {
+					if etcdEvent := toEtcdEvent(event, filters); etcdEvent != nil {
+						send(&etcdserverpb.WatchResponse{Header: s.kv.etcdHeader(), WatchId: watchID, Events: []*mvccpb.Event{etcdEvent}})
+					}
+				}
+
+				// Canceled watchers were already removed, the remaining ones fell behind
+				watchersMutex.Lock()
+				lagging := watchers[watchID] == w
+				if lagging {
+					delete(watchers, watchID)
+				}
+				watchersMutex.Unlock()
+				if lagging {
+					send(&etcdserverpb.WatchResponse{Header: s.kv.etcdHeader(), WatchId: watchID, Canceled: true, CancelReason: etcdWatchLaggingReason})
+				}
+			}(watchID, w, create.Filters)
+		case *etcdserverpb.WatchRequest_CancelRequest:
+			watchID := request.CancelRequest.WatchId
+
+			watchersMutex.Lock()
+			w, ok := watchers[watchID]
+			delete(watchers, watchID)
+			watchersMutex.Unlock()
+			if ok {
+				s.kv.unwatch(w)
+				send(&etcdserverpb.WatchResponse{Header: s.kv.etcdHeader(), WatchId: watchID, Canceled: true})
+			}
+		case *etcdserverpb.WatchRequest_ProgressRequest:
+			// Progress notifications are not bound to a watcher
+			send(&etcdserverpb.WatchResponse{Header: s.kv.etcdHeader(), WatchId: -1})
+		}
+	}
+}
+
+// unsupportedEtcdWatch returns why a watch cannot be created, or an empty string if it can
+func unsupportedEtcdWatch(create *etcdserverpb.WatchCreateRequest) string {
+	switch {
+	case len(create.Key) == 0:
+		return "key is not provided"
+	case create.PrevKv:
+		return "previous key values are not supported"
+	default:
+		return ""
+	}
+}
+
+func toEtcdEvent(event WatchEvent, filters []etcdserverpb.WatchCreateRequest_FilterType) *mvccpb.Event {
+	eventType := mvccpb.Event_PUT
+	if event.Type == EventDelete {
+		eventType = mvccpb.Event_DELETE
+	}
+	for _, filter := range filters {
+		if (filter == etcdserverpb.WatchCreateRequest_NOPUT && eventType == mvccpb.Event_PUT) ||
+			(filter == etcdserverpb.WatchCreateRequest_NODELETE && eventType == mvccpb.Event_DELETE) {
+			return nil
+		}
+	}
+
+	keyValue := &mvccpb.KeyValue{Key: []byte(event.Key), ModRevision: etcdRevision(event.Revision)}
+	if eventType == mvccpb.Event_PUT {
+		keyValue.Value = event.Value
+		keyValue.Lease = event.Lease
+		keyValue.CreateRevision = etcdRevision(event.CreateRevision)
+		keyValue.Version = event.Version
+	}
+	return &mvccpb.Event{Type: eventType, Kv: keyValue}
+}
+
+//
+// Lease
+//
+
+type etcdLeaseServer struct {
+	etcdserverpb.UnimplementedLeaseServer
+
+	kv *KeyValueStore
+}
+
+func (s *etcdLeaseServer) LeaseGrant(ctx context.Context, request *etcdserverpb.LeaseGrantRequest) (*etcdserverpb.LeaseGrantResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return etcdserverpb.NewLeaseClient(connection).LeaseGrant(ctx, request)
+	}
+
+	if request.TTL <= 0 || request.ID < 0 {
+		return nil, etcdError(StatusBadTTLMessage)
+	}
+
+	id, infoMessage := s.kv.grantLease(request.ID, request.TTL)
+	if infoMessage != StatusOKMessage {
+		return nil, etcdError(infoMessage)
+	}
+	return &etcdserverpb.LeaseGrantResponse{Header: s.kv.etcdHeader(), ID: id, TTL: request.TTL}, nil
+}
+
+func (s *etcdLeaseServer) LeaseRevoke(ctx context.Context, request *etcdserverpb.LeaseRevokeRequest) (*etcdserverpb.LeaseRevokeResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return etcdserverpb.NewLeaseClient(connection).LeaseRevoke(ctx, request)
+	}
+
+	if infoMessage := s.kv.revokeLease(request.ID); infoMessage != StatusOKMessage {
+		return nil, etcdError(infoMessage)
+	}
+	return &etcdserverpb.LeaseRevokeResponse{Header: s.kv.etcdHeader()}, nil
+}
+
+// LeaseKeepAlive refreshes leases on the leader, followers relay the stream to the leader.
+// Leases that do not exist are answered with a time to live of zero.
+func (s *etcdLeaseServer) LeaseKeepAlive(stream etcdserverpb.Lease_LeaseKeepAliveServer) error {
+	connection, err := s.kv.leaderGRPCConnection()
+	if err != nil {
+		return err
+	}
+	if connection != nil {
+		return relayEtcdKeepAlive(stream, connection)
+	}
+
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ttl, _ := s.kv.refreshLease(request.ID)
+		if err := stream.Send(&etcdserverpb.LeaseKeepAliveResponse{Header: s.kv.etcdHeader(), ID: request.ID, TTL: ttl}); err != nil {
+			return err
+		}
+	}
+}
+
+func relayEtcdKeepAlive(stream etcdserverpb.Lease_LeaseKeepAliveServer, connection *grpc.ClientConn) error {
+	leaderStream, err := etcdserverpb.NewLeaseClient(connection).LeaseKeepAlive(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			request, err := stream.Recv()
+			if err != nil {
+				leaderStream.CloseSend()
+				return
+			}
+			if err := leaderStream.Send(request); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		response, err := leaderStream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+//
+// Utils
+//
+
+func etcdError(infoMessage InfoMessage) error {
+	if err, ok := etcdErrors[infoMessage]; ok {
+		return err
+	}
+	return grpcError(infoMessage)
+}
+
+// etcdHeader describes this node, its member id is derived from its address
+func (kv *KeyValueStore) etcdHeader() *etcdserverpb.ResponseHeader {
+	header := kv.responseHeader()
+
+	var memberID uint64 = 0
+	if address := kv.LocalAddress.To4(); address != nil {
+		memberID = uint64(binary.BigEndian.Uint32(address))
+	}
+	return &etcdserverpb.ResponseHeader{
+		MemberId: memberID,
+		Revision: etcdRevision(header.Revision),
+		RaftTerm: header.Term,
+	}
+}
@@ -0,0 +1,282 @@
+package kv
+
+import (
+	"bytes"
+	"sort"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// etcd revisions start at one, while the first log of the database log has the revision zero.
+// A revision of zero therefore still means that a key does not exist.
+func etcdRevision(revision int64) int64 {
+	return revision + 1
+}
+
+//
+// Key Ranges
+//
+
+// inEtcdRange reports whether key lies in the etcd key range [start, end). An empty end only
+// matches start itself and the end "\x00" matches every key starting from start.
+func inEtcdRange(key string, start []byte, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return key == string(start)
+	case len(end) == 1 && end[0] == 0:
+		return key >= string(start)
+	default:
+		return key >= string(start) && key < string(end)
+	}
+}
+
+// etcdKeys returns all keys in the etcd key range [start, end) sorted ascending.
+// The caller has to hold the database mutex.
+func (kv *KeyValueStore) etcdKeys(start []byte, end []byte) []string {
+	keys := make([]string, 0)
+	if len(end) == 0 {
+		if _, ok := kv.Database[string(start)]; ok {
+			keys = append(keys, string(start))
+		}
+		return keys
+	}
+
+	for key := range kv.Database {
+		if inEtcdRange(key, start, end) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// etcdKeyValue describes key in etcd terms, the caller has to hold the database mutex
+func (kv *KeyValueStore) etcdKeyValue(key string) *mvccpb.KeyValue {
+	keyRevision := kv.keyRevisions[key]
+	return &mvccpb.KeyValue{
+		Key:            []byte(key),
+		Value:          kv.Database[key],
+		Lease:          kv.KeyLeases[key],
+		CreateRevision: etcdRevision(keyRevision.create),
+		ModRevision:    etcdRevision(keyRevision.mod),
+		Version:        keyRevision.version,
+	}
+}
+
+// etcdRange evaluates a range request on the current database, the caller has to hold the database mutex
+func (kv *KeyValueStore) etcdRange(request *etcdserverpb.RangeRequest) *etcdserverpb.RangeResponse {
+	keyValues := make([]*mvccpb.KeyValue, 0)
+	for _, key := range kv.etcdKeys(request.Key, request.RangeEnd) {
+		keyValue := kv.etcdKeyValue(key)
+		if (request.MinModRevision > 0 && keyValue.ModRevision < request.MinModRevision) ||
+			(request.MaxModRevision > 0 && keyValue.ModRevision > request.MaxModRevision) ||
+			(request.MinCreateRevision > 0 && keyValue.CreateRevision < request.MinCreateRevision) ||
+			(request.MaxCreateRevision > 0 && keyValue.CreateRevision > request.MaxCreateRevision) {
+			continue
+		}
+		keyValues = append(keyValues, keyValue)
+	}
+
+	// Keys are already sorted ascending
+	sortOrder := request.SortOrder
+	if sortOrder == etcdserverpb.RangeRequest_NONE && request.SortTarget != etcdserverpb.RangeRequest_KEY {
+		sortOrder = etcdserverpb.RangeRequest_ASCEND
+	}
+	if sortOrder != etcdserverpb.RangeRequest_NONE {
+		less := etcdSortLess(request.SortTarget)
+		if sortOrder == etcdserverpb.RangeRequest_DESCEND {
+			sort.SliceStable(keyValues, func(i, j int) bool { return less(keyValues[j], keyValues[i]) })
+		} else {
+			sort.SliceStable(keyValues, func(i, j int) bool { return less(keyValues[i], keyValues[j]) })
+		}
+	}
+
+	response := &etcdserverpb.RangeResponse{Count: int64(len(keyValues))}
+	if request.CountOnly {
+		return response
+	}
+	if request.Limit > 0 && int64(len(keyValues)) > request.Limit {
+		keyValues = keyValues[:request.Limit]
+		response.More = true
+	}
+	if request.KeysOnly {
+		for _, keyValue := range keyValues {
+			keyValue.Value = nil
+		}
+	}
+	response.Kvs = keyValues
+	return response
+}
+
+func etcdSortLess(target etcdserverpb.RangeRequest_SortTarget) func(a *mvccpb.KeyValue, b *mvccpb.KeyValue) bool {
+	switch target {
+	case etcdserverpb.RangeRequest_VERSION:
+		return func(a *mvccpb.KeyValue, b *mvccpb.KeyValue) bool { return a.Version < b.Version }
+	case etcdserverpb.RangeRequest_CREATE:
+		return func(a *mvccpb.KeyValue, b *mvccpb.KeyValue) bool { return a.CreateRevision < b.CreateRevision }
+	case etcdserverpb.RangeRequest_MOD:
+		return func(a *mvccpb.KeyValue, b *mvccpb.KeyValue) bool { return a.ModRevision < b.ModRevision }
+	case etcdserverpb.RangeRequest_VALUE:
+		return func(a *mvccpb.KeyValue, b *mvccpb.KeyValue) bool { return bytes.Compare(a.Value, b.Value) < 0 }
+	default:
+		return func(a *mvccpb.KeyValue, b *mvccpb.KeyValue) bool { return bytes.Compare(a.Key, b.Key) < 0 }
+	}
+}
+
+//
+// Transactions
+//
+
+// applyTxn applies the etcd transaction encoded in the value of logEntry. All of its writes
+// share the revision of the log, and either all of them or none are applied.
+func (kv *KeyValueStore) applyTxn(logEntry *KeyValueLog, revision int64) ApplyResult {
+	var request etcdserverpb.TxnRequest
+	if err := proto.Unmarshal(logEntry.Value, &request); err != nil {
+		return ApplyResult{InfoMessage: StatusBadBodyMessage}
+	}
+
+	succeeded := true
+	for _, compare := range request.Compare {
+		if !kv.etcdCompare(compare) {
+			succeeded = false
+			break
+		}
+	}
+	operations := request.Success
+	if !succeeded {
+		operations = request.Failure
+	}
+
+	// Writes that cannot be applied fail the whole transaction before anything changed
+	for _, operation := range operations {
+		put := operation.GetRequestPut()
+		if put == nil {
+			continue
+		}
+		if _, ok := kv.Database[string(put.Key)]; !ok && (put.IgnoreValue || put.IgnoreLease) {
+			return ApplyResult{InfoMessage: StatusValueNotFoundMessage}
+		}
+		if _, ok := kv.Leases[put.Lease]; put.Lease != 0 && !put.IgnoreLease && !ok {
+			return ApplyResult{InfoMessage: StatusLeaseNotFoundMessage}
+		}
+	}
+
+	// The header carries the revision of the transaction, later logs may be committed before it is responded
+	response := &etcdserverpb.TxnResponse{
+		Header:    &etcdserverpb.ResponseHeader{Revision: etcdRevision(revision)},
+		Succeeded: succeeded,
+		Responses: make([]*etcdserverpb.ResponseOp, 0, len(operations)),
+	}
+	var events []WatchEvent
+	for _, operation := range operations {
+		switch request := operation.Request.(type) {
+		case *etcdserverpb.RequestOp_RequestRange:
+			response.Responses = append(response.Responses, &etcdserverpb.ResponseOp{
+				Response: &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: kv.etcdRange(request.RequestRange)},
+			})
+		case *etcdserverpb.RequestOp_RequestPut:
+			putResponse, event := kv.applyEtcdPut(request.RequestPut, revision)
+			events = append(events, event)
+			response.Responses = append(response.Responses, &etcdserverpb.ResponseOp{
+				Response: &etcdserverpb.ResponseOp_ResponsePut{ResponsePut: putResponse},
+			})
+		case *etcdserverpb.RequestOp_RequestDeleteRange:
+			deleteResponse := &etcdserverpb.DeleteRangeResponse{}
+			for _, key := range kv.etcdKeys(request.RequestDeleteRange.Key, request.RequestDeleteRange.RangeEnd) {
+				if request.RequestDeleteRange.PrevKv {
+					deleteResponse.PrevKvs = append(deleteResponse.PrevKvs, kv.etcdKeyValue(key))
+				}
+				events = append(events, kv.applyDelete(key, revision).Events...)
+				deleteResponse.Deleted++
+			}
+			response.Responses = append(response.Responses, &etcdserverpb.ResponseOp{
+				Response: &etcdserverpb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: deleteResponse},
+			})
+		}
+	}
+
+	return ApplyResult{InfoMessage: StatusOKMessage, Events: events, Txn: response}
+}
+
+// applyEtcdPut sets the key of a put request, which was already validated
+func (kv *KeyValueStore) applyEtcdPut(request *etcdserverpb.PutRequest, revision int64) (*etcdserverpb.PutResponse, WatchEvent) {
+	key := string(request.Key)
+	response := &etcdserverpb.PutResponse{}
+	if _, ok := kv.Database[key]; ok && request.PrevKv {
+		response.PrevKv = kv.etcdKeyValue(key)
+	}
+
+	logEntry := &KeyValueLog{Operation: OperationSet, Key: key, Value: request.Value, Lease: request.Lease}
+	if request.IgnoreValue {
+		logEntry.Value = kv.Database[key]
+	}
+	if request.IgnoreLease {
+		logEntry.Lease = kv.KeyLeases[key]
+	}
+	return response, kv.applySet(logEntry, revision).Events[0]
+}
+
+// etcdCompare evaluates a comparison of a transaction, all keys of its range have to satisfy it.
+// Missing keys have no value, and a version, revisions and lease of zero.
+func (kv *KeyValueStore) etcdCompare(compare *etcdserverpb.Compare) bool {
+	keys := kv.etcdKeys(compare.Key, compare.RangeEnd)
+	keyValues := make([]*mvccpb.KeyValue, len(keys))
+	for index, key := range keys {
+		keyValues[index] = kv.etcdKeyValue(key)
+	}
+	if len(keyValues) == 0 {
+		if compare.Target == etcdserverpb.Compare_VALUE {
+			return false
+		}
+		keyValues = append(keyValues, &mvccpb.KeyValue{})
+	}
+
+	for _, keyValue := range keyValues {
+		var result int
+		switch compare.Target {
+		case etcdserverpb.Compare_VALUE:
+			result = bytes.Compare(keyValue.Value, compare.GetValue())
+		case etcdserverpb.Compare_VERSION:
+			result = compareInt64(keyValue.Version, compare.GetVersion())
+		case etcdserverpb.Compare_CREATE:
+			result = compareInt64(keyValue.CreateRevision, compare.GetCreateRevision())
+		case etcdserverpb.Compare_MOD:
+			result = compareInt64(keyValue.ModRevision, compare.GetModRevision())
+		case etcdserverpb.Compare_LEASE:
+			result = compareInt64(keyValue.Lease, compare.GetLease())
+		}
+
+		switch compare.Result {
+		case etcdserverpb.Compare_EQUAL:
+			if result != 0 {
+				return false
+			}
+		case etcdserverpb.Compare_NOT_EQUAL:
+			if result == 0 {
+				return false
+			}
+		case etcdserverpb.Compare_GREATER:
+			if result <= 0 {
+				return false
+			}
+		case etcdserverpb.Compare_LESS:
+			if result >= 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func compareInt64(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,304 @@
+package kv
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startEtcdTestNode runs a leader without followers in this process and connects an etcd client to it
+func startEtcdTestNode(t *testing.T) (*KeyValueStore, *clientv3.Client) {
+	t.Helper()
+
+	kv := initKeyValueStore(DefaultConfig(), true, nil, net.IPv4(127, 0, 0, 1))
+	go kv.writePipeline()
+	go kv.expireLeases()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := kv.newGRPCServer()
+	go server.Serve(listener)
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{listener.Addr().String()},
+		DialTimeout: 5 * time.Second,
+		Logger:      zap.NewNop(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Stop()
+		kv.setLeader("", Member{})
+	})
+	return kv, client
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestEtcdPutGet(t *testing.T) {
+	_, client := startEtcdTestNode(t)
+	ctx := testContext(t)
+
+	first, err := client.Put(ctx, "etcd/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "etcd/b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Put(ctx, "etcd/a", "3", clientv3.WithPrevKV())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.PrevKv == nil || string(second.PrevKv.Value) != "1" {
+		t.Fatalf("unexpected previous key value %v", second.PrevKv)
+	}
+
+	response, err := client.Get(ctx, "etcd/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Kvs) != 1 || string(response.Kvs[0].Value) != "3" {
+		t.Fatalf("unexpected key values %v", response.Kvs)
+	}
+	kv := response.Kvs[0]
+	if kv.CreateRevision != first.Header.Revision || kv.ModRevision != second.Header.Revision || kv.Version != 2 {
+		t.Fatalf("unexpected revisions %v, created at %d and modified at %d", kv, first.Header.Revision, second.Header.Revision)
+	}
+
+	response, err = client.Get(ctx, "etcd/", clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend), clientv3.WithLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Kvs) != 1 || string(response.Kvs[0].Key) != "etcd/b" || !response.More || response.Count != 2 {
+		t.Fatalf("unexpected range response %v", response)
+	}
+
+	response, err = client.Get(ctx, "etcd/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Count != 2 || len(response.Kvs) != 0 {
+		t.Fatalf("unexpected count response %v", response)
+	}
+
+	response, err = client.Get(ctx, "etcd/missing")
+	if err != nil || len(response.Kvs) != 0 {
+		t.Fatalf("unexpected response for a missing key %v (%v)", response, err)
+	}
+}
+
+func TestEtcdDelete(t *testing.T) {
+	_, client := startEtcdTestNode(t)
+	ctx := testContext(t)
+
+	for _, key := range []string{"etcd/a", "etcd/b", "other"} {
+		if _, err := client.Put(ctx, key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	response, err := client.Delete(ctx, "etcd/", clientv3.WithPrefix(), clientv3.WithPrevKV())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Deleted != 2 || len(response.PrevKvs) != 2 || string(response.PrevKvs[1].Value) != "etcd/b" {
+		t.Fatalf("unexpected delete response %v", response)
+	}
+
+	getResponse, err := client.Get(ctx, "", clientv3.WithFromKey(), clientv3.WithKeysOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(getResponse.Kvs) != 2 || string(getResponse.Kvs[0].Key) != "initial" || string(getResponse.Kvs[1].Key) != "other" {
+		t.Fatalf("unexpected remaining keys %v", getResponse.Kvs)
+	}
+}
+
+func TestEtcdTxn(t *testing.T) {
+	_, client := startEtcdTestNode(t)
+	ctx := testContext(t)
+
+	// Create the key only if it does not exist yet
+	create := func() (*clientv3.TxnResponse, error) {
+		return client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision("etcd/txn"), "=", 0)).
+			Then(clientv3.OpPut("etcd/txn", "created"), clientv3.OpGet("etcd/txn")).
+			Else(clientv3.OpGet("etcd/txn")).
+			Commit()
+	}
+
+	response, err := create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Succeeded || len(response.Responses) != 2 || string(response.Responses[1].GetResponseRange().Kvs[0].Value) != "created" {
+		t.Fatalf("unexpected transaction response %v", response)
+	}
+
+	response, err = create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Succeeded || len(response.Responses) != 1 || response.Responses[0].GetResponseRange().Kvs[0].Version != 1 {
+		t.Fatalf("unexpected transaction response %v", response)
+	}
+
+	// Transactions fail as a whole
+	_, err = client.Txn(ctx).Then(clientv3.OpPut("etcd/first", "value"), clientv3.OpPut("etcd/second", "value", clientv3.WithLease(42))).Commit()
+	if err == nil || err.Error() != rpctypes.ErrLeaseNotFound.Error() {
+		t.Fatalf("unexpected error %v", err)
+	}
+	getResponse, err := client.Get(ctx, "etcd/first")
+	if err != nil || len(getResponse.Kvs) != 0 {
+		t.Fatalf("failed transaction was applied partially (%v)", err)
+	}
+
+	_, err = client.Txn(ctx).Then(clientv3.OpPut("etcd/a", "1"), clientv3.OpPut("etcd/a", "2")).Commit()
+	if err == nil || err.Error() != rpctypes.ErrDuplicateKey.Error() {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEtcdLease(t *testing.T) {
+	_, client := startEtcdTestNode(t)
+	ctx := testContext(t)
+
+	lease, err := client.Grant(ctx, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "etcd/leased", "value", clientv3.WithLease(lease.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	keepAlive, err := client.KeepAliveOnce(ctx, lease.ID)
+	if err != nil || keepAlive.TTL != 60 {
+		t.Fatalf("unexpected keep alive response %v (%v)", keepAlive, err)
+	}
+
+	response, err := client.Get(ctx, "etcd/leased")
+	if err != nil || len(response.Kvs) != 1 || response.Kvs[0].Lease != int64(lease.ID) {
+		t.Fatalf("unexpected key values %v (%v)", response, err)
+	}
+
+	if _, err := client.Revoke(ctx, lease.ID); err != nil {
+		t.Fatal(err)
+	}
+	response, err = client.Get(ctx, "etcd/leased")
+	if err != nil || len(response.Kvs) != 0 {
+		t.Fatalf("key of revoked lease still exists (%v)", err)
+	}
+
+	if _, err := client.Revoke(ctx, lease.ID); err == nil || err.Error() != rpctypes.ErrLeaseNotFound.Error() {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEtcdWatch(t *testing.T) {
+	_, client := startEtcdTestNode(t)
+	ctx := testContext(t)
+
+	put, err := client.Put(ctx, "etcd/watch/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Starting at the past put replays it
+	watch := client.Watch(ctx, "etcd/watch/", clientv3.WithPrefix(), clientv3.WithRev(put.Header.Revision))
+	if _, err := client.Put(ctx, "etcd/other", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Delete(ctx, "etcd/watch/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make([]*clientv3.Event, 0)
+	for len(events) < 2 {
+		response, ok := <-watch
+		if !ok || response.Err() != nil {
+			t.Fatalf("watch ended after %d events (%v)", len(events), response.Err())
+		}
+		events = append(events, response.Events...)
+	}
+
+	if events[0].Type != mvccpb.Event_PUT || string(events[0].Kv.Value) != "1" || events[0].Kv.ModRevision != put.Header.Revision ||
+		events[1].Type != mvccpb.Event_DELETE || string(events[1].Kv.Key) != "etcd/watch/a" {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
+
+func TestEtcdMutex(t *testing.T) {
+	_, client := startEtcdTestNode(t)
+	ctx := testContext(t)
+
+	session, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	otherSession, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherSession.Close()
+
+	mutex := concurrency.NewMutex(session, "etcd/lock")
+	otherMutex := concurrency.NewMutex(otherSession, "etcd/lock")
+	if err := mutex.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := otherMutex.TryLock(ctx); err != concurrency.ErrLocked {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	locked := make(chan error)
+	go func() { locked <- otherMutex.Lock(ctx) }()
+	if err := mutex.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEtcdUnimplemented(t *testing.T) {
+	_, client := startEtcdTestNode(t)
+	ctx := testContext(t)
+
+	put, err := client.Put(ctx, "etcd/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "etcd/a", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Get(ctx, "etcd/a", clientv3.WithRev(put.Header.Revision)); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("historical read returned %v", err)
+	}
+	if _, err := client.Compact(ctx, put.Header.Revision); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("compaction returned %v", err)
+	}
+	if _, err := client.MemberList(ctx); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("member list returned %v", err)
+	}
+}
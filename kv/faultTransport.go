@@ -0,0 +1,189 @@
+package kv
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The fault transport sits between a node and its actual transport and injects faults into the
+// messages the node sends. Faults are configured per link, i.e. per receiving node, so a partition
+// is symmetric only if the nodes on both sides block each other.
+
+var errMessageDropped = errors.New("message was dropped by fault injection")
+
+// LinkFaults describe the faults of the messages to a single node. Probabilities are between 0 and 1,
+// durations are given in nanoseconds.
+type LinkFaults struct {
+	// Messages over blocked links are always dropped
+	Blocked bool    `json:"blocked"`
+	Drop    float64 `json:"drop"`
+	// Duplicates are sent again in the background, client requests are never duplicated
+	Duplicate float64 `json:"duplicate"`
+	// Reordered messages are held back by up to FAULT_REORDER_DELAY, so later messages overtake them
+	Reorder float64 `json:"reorder"`
+	// Every message is delayed by Delay plus a random duration up to Jitter
+	Delay  time.Duration `json:"delay"`
+	Jitter time.Duration `json:"jitter"`
+}
+
+// FaultTransport injects the faults of its links into the messages sent over transport
+type FaultTransport struct {
+	Transport
+
+	links map[string]LinkFaults
+	mutex sync.RWMutex
+}
+
+func NewFaultTransport(transport Transport) *FaultTransport {
+	return &FaultTransport{Transport: transport, links: make(map[string]LinkFaults)}
+}
+
+// SetLinkFaults replaces the faults of the messages to address, the zero value removes them
+func (t *FaultTransport) SetLinkFaults(address net.IP, faults LinkFaults) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if faults == (LinkFaults{}) {
+		delete(t.links, address.String())
+	} else {
+		t.links[address.String()] = faults
+	}
+}
+
+// LinkFaults returns the faults of all links by the address of the receiving node
+func (t *FaultTransport) LinkFaults() map[string]LinkFaults {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	links := make(map[string]LinkFaults, len(t.links))
+	for address, faults := range t.links {
+		links[address] = faults
+	}
+	return links
+}
+
+// Block drops all messages to the given addresses, the other faults of their links are kept
+func (t *FaultTransport) Block(addresses ...net.IP) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, address := range addresses {
+		faults := t.links[address.String()]
+		faults.Blocked = true
+		t.links[address.String()] = faults
+	}
+}
+
+// Heal removes the faults of all links
+func (t *FaultTransport) Heal() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.links = make(map[string]LinkFaults)
+}
+
+// deliver applies the faults of the link to address and calls send, unless the message is dropped
+func (t *FaultTransport) deliver(address net.IP, duplicate bool, send func() (interface{}, error)) (interface{}, error) {
+	t.mutex.RLock()
+	faults, ok := t.links[address.String()]
+	t.mutex.RUnlock()
+	if !ok {
+		return send()
+	}
+
+	if faults.Blocked || CLOCK.Float64() < faults.Drop {
+		return nil, errMessageDropped
+	}
+	delay := faults.Delay
+	if faults.Jitter > 0 {
+		delay += time.Duration(CLOCK.Int63n(int64(faults.Jitter)))
+	}
+	if CLOCK.Float64() < faults.Reorder {
+		delay += time.Duration(CLOCK.Int63n(int64(FAULT_REORDER_DELAY)))
+	}
+	CLOCK.Sleep(delay)
+
+	if duplicate && CLOCK.Float64() < faults.Duplicate {
+		CLOCK.Go(func() { send() })
+	}
+	return send()
+}
+
+//
+// Network Administration
+//
+
+func (t *FaultTransport) HeartBeat(member Member, heartBeatMessage HeartBeatMessage) error {
+	_, err := t.deliver(member.Address, true, func() (interface{}, error) {
+		return nil, t.Transport.HeartBeat(member, heartBeatMessage)
+	})
+	return err
+}
+
+func (t *FaultTransport) Poll(member Member, pollRequest PollRequestMessage) (PollResponseMessage, error) {
+	reply, err := t.deliver(member.Address, true, func() (interface{}, error) {
+		return t.Transport.Poll(member, pollRequest)
+	})
+	if reply == nil {
+		return PollResponseNo, err
+	}
+	return reply.(PollResponseMessage), err
+}
+
+func (t *FaultTransport) LeaderUpdate(member Member, leaderMessage LeaderUpdateMessage) (InfoMessage, error) {
+	return t.deliverInfoMessage(member.Address, func() (interface{}, error) {
+		return t.Transport.LeaderUpdate(member, leaderMessage)
+	})
+}
+
+//
+// Replication
+//
+
+func (t *FaultTransport) AppendEntries(member Member, appendData *AppendEntriesMessage) (InfoMessage, error) {
+	return t.deliverInfoMessage(member.Address, func() (interface{}, error) {
+		return t.Transport.AppendEntries(member, appendData)
+	})
+}
+
+func (t *FaultTransport) Commit(member Member, commitData *CommitLogMessage) (InfoMessage, error) {
+	return t.deliverInfoMessage(member.Address, func() (interface{}, error) {
+		return t.Transport.Commit(member, commitData)
+	})
+}
+
+func (t *FaultTransport) deliverInfoMessage(address net.IP, send func() (interface{}, error)) (InfoMessage, error) {
+	reply, err := t.deliver(address, true, send)
+	if reply == nil {
+		return StatusInternalServerErrorMessage, err
+	}
+	return reply.(InfoMessage), err
+}
+
+//
+// HTTP
+//
+
+func (t *FaultTransport) Get(member Member, path string) (*http.Response, error) {
+	return t.deliverHTTP(member.Address, func() (interface{}, error) {
+		return t.Transport.Get(member, path)
+	})
+}
+
+func (t *FaultTransport) Post(member Member, path string, contentType string, body io.Reader) (*http.Response, error) {
+	return t.deliverHTTP(member.Address, func() (interface{}, error) {
+		return t.Transport.Post(member, path, contentType, body)
+	})
+}
+
+func (t *FaultTransport) deliverHTTP(address net.IP, send func() (interface{}, error)) (*http.Response, error) {
+	reply, err := t.deliver(address, false, send)
+	if reply == nil {
+		return nil, err
+	}
+	return reply.(*http.Response), err
+}
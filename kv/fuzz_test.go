@@ -0,0 +1,344 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/peerpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// The fuzz targets send arbitrary messages to the handlers of peer and client messages. Every message
+// has to be answered, malformed ones with an error response, and the database log has to stay intact.
+// Without -fuzz only the seeds run, e.g. `go test ./kv -run '^$' -fuzz FuzzLogAppendCommit` fuzzes one target.
+
+var fuzzLeaderAddress = net.IPv4(10, 0, 0, 1)
+var fuzzFollowerAddress = net.IPv4(10, 0, 0, 2)
+
+// newFuzzNode returns a node without peers, leaders run the write pipeline so that client writes complete
+func newFuzzNode(tb testing.TB, leader bool) *KeyValueStore {
+	tb.Helper()
+
+	address := fuzzFollowerAddress
+	if leader {
+		address = fuzzLeaderAddress
+	}
+	kv := InitKeyValueStoreWithTransport(leader, fuzzLeaderAddress, address, NewFaultTransport(NewMemoryNetwork().NewTransport(address)))
+	if leader {
+		go kv.writePipeline()
+	}
+	tb.Cleanup(kv.Stop)
+	return kv
+}
+
+// fuzzRequest sends body to the router and fails unless the response is JSON
+func fuzzRequest(t *testing.T, router http.Handler, method string, target string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(method, target, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if !json.Valid(recorder.Body.Bytes()) {
+		t.Fatalf("%s %s responded %d with %q", method, target, recorder.Code, recorder.Body.Bytes())
+	}
+	return recorder
+}
+
+// expectBadRequest fails if a body that is no JSON at all was not refused as a bad request
+func expectBadRequest(t *testing.T, recorder *httptest.ResponseRecorder, body []byte) {
+	t.Helper()
+
+	if !json.Valid(body) && recorder.Code != http.StatusBadRequest {
+		t.Fatalf("malformed message %q responded %d", body, recorder.Code)
+	}
+}
+
+//
+// Log Invariants
+//
+
+// logState is the part of a log that never changes once it is in the database log
+type logState struct {
+	hash      string
+	committed bool
+}
+
+func snapshotLog(t *testing.T, kv *KeyValueStore) []logState {
+	t.Helper()
+
+	kv.logMutex.RLock()
+	defer kv.logMutex.RUnlock()
+	states := make([]logState, len(kv.DatabaseLog))
+	for index, logEntry := range kv.DatabaseLog {
+		if logEntry == nil {
+			t.Fatalf("database log holds no log at %d", index)
+		}
+		states[index] = logState{hash: logEntry.Hash, committed: logEntry.Committed}
+	}
+	return states
+}
+
+// checkLogInvariants fails if the database log lost one of the logs of previous or uncommitted one of them,
+// or if it holds a committed log after an uncommitted one. It returns the current state of the log.
+func checkLogInvariants(t *testing.T, kv *KeyValueStore, previous []logState) []logState {
+	t.Helper()
+
+	current := snapshotLog(t, kv)
+	if len(current) < len(previous) {
+		t.Fatalf("database log shrank from %d to %d logs", len(previous), len(current))
+	}
+	if current[0].hash != INITIAL_LOG.Hash || !current[0].committed {
+		t.Fatalf("database log starts with %v instead of the initial log", current[0])
+	}
+	for index, state := range previous {
+		if current[index].hash != state.hash || (state.committed && !current[index].committed) {
+			t.Fatalf("log %d changed from %v to %v", index, state, current[index])
+		}
+	}
+	for index := 1; index < len(current); index++ {
+		if current[index].committed && !current[index-1].committed {
+			t.Fatalf("log %d is committed, but log %d is not", index, index-1)
+		}
+	}
+	return current
+}
+
+// checkDatabase fails unless the database is the result of applying the committed logs in order
+func checkDatabase(t *testing.T, kv *KeyValueStore) {
+	t.Helper()
+
+	replay := InitKeyValueStoreWithTransport(false, nil, kv.LocalAddress, nil)
+	kv.logMutex.RLock()
+	defer kv.logMutex.RUnlock()
+	kv.databaseMutex.RLock()
+	defer kv.databaseMutex.RUnlock()
+	for index := 1; index < len(kv.DatabaseLog) && kv.DatabaseLog[index].Committed; index++ {
+		replay.applyLog(kv.DatabaseLog[index], int64(index))
+	}
+	if !reflect.DeepEqual(replay.Database, kv.Database) {
+		t.Fatalf("database %v differs from the committed logs %v", kv.Database, replay.Database)
+	}
+}
+
+//
+// Network Administration
+//
+
+func FuzzHeartBeat(f *testing.F) {
+	f.Add([]byte(`{"term":3,"followers":[{"address":"10.0.0.2","lastLogHash":"","lastCommitedLogHash":""}]}`))
+	f.Add([]byte(`{"followers":[null]}`))
+	f.Add([]byte(`{"term":-1}`))
+	f.Add([]byte(`{`))
+
+	kv := newFuzzNode(f, false)
+	router := kv.newRouter(false)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		expectBadRequest(t, fuzzRequest(t, router, "POST", "/heart-beat", body), body)
+	})
+}
+
+func FuzzPoll(f *testing.F) {
+	f.Add(`{"term":1,"newLeaderAddress":"10.0.0.3","lastLogHash":"` + INITIAL_LOG.Hash + `"}`)
+	f.Add(`{"newLeaderAddress":"not an address"}`)
+	f.Add(`[]`)
+
+	kv := newFuzzNode(f, false)
+	router := kv.newRouter(false)
+	f.Fuzz(func(t *testing.T, pollParameters string) {
+		recorder := fuzzRequest(t, router, "GET", "/poll?poll_parameters="+url.QueryEscape(pollParameters), nil)
+		expectBadRequest(t, recorder, []byte(pollParameters))
+	})
+}
+
+func FuzzLeaderUpdate(f *testing.F) {
+	f.Add([]byte(`{"leader":"10.0.0.3","term":2}`))
+	f.Add([]byte(`{"term":2}`))
+	f.Add([]byte(`{"leader":""}`))
+	f.Add([]byte(`null`))
+
+	kv := newFuzzNode(f, false)
+	router := kv.newRouter(false)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		recorder := fuzzRequest(t, router, "POST", "/leader", body)
+		expectBadRequest(t, recorder, body)
+		if recorder.Code == http.StatusOK && kv.LeaderAddress == nil {
+			t.Fatalf("leader update %q left the node without leader", body)
+		}
+	})
+}
+
+func FuzzRegister(f *testing.F) {
+	f.Add("10.0.0.2")
+	f.Add("::1")
+	f.Add("")
+	f.Add("10.0.0")
+
+	kv := newFuzzNode(f, true)
+	router := kv.newRouter(false)
+	f.Fuzz(func(t *testing.T, ip string) {
+		recorder := fuzzRequest(t, router, "POST", "/register?ip="+url.QueryEscape(ip), nil)
+		if recorder.Code == http.StatusOK && net.ParseIP(ip) == nil {
+			t.Fatalf("registered follower with address %q", ip)
+		}
+	})
+}
+
+//
+// Replication
+//
+
+// The fuzzed logs are appended and then committed on the same follower, so that later inputs
+// build on the logs earlier inputs left behind
+func FuzzLogAppendCommit(f *testing.F) {
+	first := CreateSetLog("fuzz/a", []byte("1"), "text/plain", 0, false, false)
+	second := CreateIncrementLog("fuzz/a", 2, false, false)
+	appendFirst, _ := json.Marshal(AppendEntriesMessage{KeyValueLog: []*KeyValueLog{INITIAL_LOG, first}})
+	appendBoth, _ := json.Marshal(AppendEntriesMessage{KeyValueLog: []*KeyValueLog{INITIAL_LOG, first, second}})
+	f.Add(appendFirst, first.Hash)
+	f.Add(appendBoth, second.Hash)
+	f.Add(appendBoth, INITIAL_LOG.Hash)
+	f.Add([]byte(`{"logs":[null,null]}`), "")
+	f.Add([]byte(`{"logs":[{"hash":"`+INITIAL_LOG.Hash+`","committed":true},{}]}`), "")
+	f.Add([]byte(`{"logs":[{"hash":"`+INITIAL_LOG.Hash+`","committed":true},{"hash":"a","operation":"txn","value":"CgA="}]}`), "a")
+	f.Add([]byte(`{"logs":[]}`), "unknown")
+
+	kv := newFuzzNode(f, false)
+	router := kv.newRouter(false)
+	f.Fuzz(func(t *testing.T, appendBody []byte, commitHash string) {
+		state := snapshotLog(t, kv)
+		expectBadRequest(t, fuzzRequest(t, router, "POST", "/log/append", appendBody), appendBody)
+		state = checkLogInvariants(t, kv, state)
+
+		commitBody, _ := json.Marshal(CommitLogMessage{LogHash: commitHash})
+		fuzzRequest(t, router, "POST", "/log/commit", commitBody)
+		checkLogInvariants(t, kv, state)
+		checkDatabase(t, kv)
+	})
+}
+
+// FuzzPeerServer decodes the fuzzed bytes as the request of one of the calls of the RPC transport
+func FuzzPeerServer(f *testing.F) {
+	appendRequest, _ := proto.Marshal(&peerpb.AppendEntriesRequest{Entries: []*peerpb.LogEntry{
+		toPeerLogEntry(INITIAL_LOG),
+		toPeerLogEntry(CreateSetLog("fuzz/a", []byte("1"), "", 0, false, false)),
+	}})
+	heartBeatRequest, _ := proto.Marshal(&peerpb.HeartBeatRequest{Term: 1, Followers: toPeerFollowers([]Follower{{Member: Member{Address: fuzzFollowerAddress}}})})
+	pollRequest, _ := proto.Marshal(&peerpb.PollRequest{Term: 1, NewLeaderAddress: fuzzLeaderAddress, LastLogHash: INITIAL_LOG.Hash})
+	leaderUpdateRequest, _ := proto.Marshal(&peerpb.LeaderUpdateRequest{Leader: []byte{1, 2, 3}, Term: 1})
+	commitRequest, _ := proto.Marshal(&peerpb.CommitRequest{LogHash: INITIAL_LOG.Hash})
+	f.Add(uint8(0), heartBeatRequest)
+	f.Add(uint8(1), pollRequest)
+	f.Add(uint8(2), leaderUpdateRequest)
+	f.Add(uint8(3), appendRequest)
+	f.Add(uint8(4), commitRequest)
+
+	kv := newFuzzNode(f, false)
+	server := &peerServer{kv: kv}
+	ctx := context.Background()
+	f.Fuzz(func(t *testing.T, call uint8, body []byte) {
+		state := snapshotLog(t, kv)
+		switch call % 5 {
+		case 0:
+			var request peerpb.HeartBeatRequest
+			if proto.Unmarshal(body, &request) == nil {
+				server.HeartBeat(ctx, &request)
+			}
+		case 1:
+			var request peerpb.PollRequest
+			if proto.Unmarshal(body, &request) == nil {
+				server.Poll(ctx, &request)
+			}
+		case 2:
+			var request peerpb.LeaderUpdateRequest
+			if proto.Unmarshal(body, &request) == nil {
+				if _, err := server.LeaderUpdate(ctx, &request); err == nil && kv.LeaderAddress == nil {
+					t.Fatalf("leader update %v left the node without leader", &request)
+				}
+			}
+		case 3:
+			var request peerpb.AppendEntriesRequest
+			if proto.Unmarshal(body, &request) == nil {
+				server.AppendEntries(ctx, &request)
+			}
+		case 4:
+			var request peerpb.CommitRequest
+			if proto.Unmarshal(body, &request) == nil {
+				server.Commit(ctx, &request)
+			}
+		}
+		checkLogInvariants(t, kv, state)
+		checkDatabase(t, kv)
+	})
+}
+
+//
+// Client Messages
+//
+
+// Routes of the client messages, the fuzzed route is picked by its index
+var fuzzClientRoutes = []string{
+	"/cas/fuzz",
+	"/increment/fuzz",
+	"/decrement/fuzz",
+	"/batch/read",
+	"/batch/write",
+	"/lease/grant",
+	"/lock/fuzz",
+	"/unlock/fuzz",
+	"/election/fuzz/campaign",
+	"/election/fuzz/resign",
+	"/v2/kv/get",
+	"/v2/kv/range",
+	"/v2/kv/put",
+	"/v2/kv/delete",
+	"/v2/kv/cas",
+	"/v2/kv/increment",
+	"/dev/faults",
+	"/dev/partition",
+}
+
+func FuzzClientMessages(f *testing.F) {
+	seeds := [][]byte{
+		[]byte(`{"expected":null,"value":"1","lease":0}`),
+		[]byte(`7`),
+		[]byte(`-9223372036854775808`),
+		[]byte(`["fuzz","initial"]`),
+		[]byte(`[{"key":"fuzz","value":"1"},{"key":"","value":""}]`),
+		[]byte(`10`),
+		[]byte(`{"owner":"a","lease":5}`),
+		[]byte(`{"owner":"a"}`),
+		[]byte(`{"owner":"b","lease":0}`),
+		[]byte(`{"owner":"b"}`),
+		[]byte(`{"key":"fuzz"}`),
+		[]byte(`{"prefix":"","limit":-1}`),
+		[]byte(`{"key":"fuzz","value":"AA==","lease":3}`),
+		[]byte(`{"key":"initial"}`),
+		[]byte(`{"key":"fuzz","expectAbsent":true,"value":"Ag=="}`),
+		[]byte(`{"key":"fuzz","delta":9223372036854775807}`),
+		[]byte(`{"address":"10.0.0.3","faults":{"drop":1}}`),
+		[]byte(`{"addresses":["10.0.0.3",null]}`),
+	}
+	for route, body := range seeds {
+		f.Add(uint8(route), body)
+	}
+
+	kv := newFuzzNode(f, true)
+	router := kv.newRouter(false)
+	f.Fuzz(func(t *testing.T, route uint8, body []byte) {
+		state := snapshotLog(t, kv)
+		path := fuzzClientRoutes[int(route)%len(fuzzClientRoutes)]
+		if recorder := fuzzRequest(t, router, "POST", path, body); recorder.Code >= http.StatusInternalServerError {
+			t.Fatalf("POST %s %q responded %d", path, body, recorder.Code)
+		}
+		checkLogInvariants(t, kv, state)
+		checkDatabase(t, kv)
+	})
+}
@@ -0,0 +1,278 @@
+package kv
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kvpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// The gRPC client API shares the operations of the v2 HTTP API. Followers forward requests to
+// the leader, except for Watch and Status, which describe the node that serves them.
+
+var grpcCodes = map[InfoMessage]codes.Code{
+	StatusBadBodyMessage:           codes.InvalidArgument,
+	StatusBadTTLMessage:            codes.InvalidArgument,
+	StatusEmptyKeyMessage:          codes.InvalidArgument,
+	StatusValueTooLargeMessage:     codes.InvalidArgument,
+	StatusValueNotFoundMessage:     codes.NotFound,
+	StatusLeaseNotFoundMessage:     codes.NotFound,
+	StatusCompareFailedMessage:     codes.FailedPrecondition,
+	StatusNotANumberMessage:        codes.FailedPrecondition,
+	StatusNumberOverflowMessage:    codes.OutOfRange,
+	StatusLeaderUnavailableMessage: codes.Unavailable,
+}
+
+type grpcServer struct {
+	kvpb.UnimplementedKVServer
+
+	kv *KeyValueStore
+}
+
+// serveGRPC serves the gRPC APIs on listener until the node is stopped
+func (kv *KeyValueStore) serveGRPC(listener net.Listener) {
+	server := kv.newGRPCServer()
+	go func() {
+		<-kv.stop
+		server.Stop()
+	}()
+
+	if err := server.Serve(listener); err != nil && !kv.stopped() {
+		ErrorLogger.Fatal(err)
+	}
+}
+
+// newGRPCServer serves both the gRPC client API and the etcd compatible API
+func (kv *KeyValueStore) newGRPCServer() *grpc.Server {
+	options := []grpc.ServerOption{grpc.MaxRecvMsgSize(int(kv.config.MaxRequestSize))}
+	if kv.clientTLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(serverTLSConfig(kv.clientTLS, nil, tls.NoClientCert))))
+	}
+	server := grpc.NewServer(options...)
+	kvpb.RegisterKVServer(server, &grpcServer{kv: kv})
+	kv.registerEtcdServers(server)
+	return server
+}
+
+//
+// Read
+//
+
+func (s *grpcServer) Get(ctx context.Context, request *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return kvpb.NewKVClient(connection).Get(ctx, request)
+	}
+
+	keyValue, infoMessage := s.kv.get(request.Key)
+	if infoMessage != StatusOKMessage {
+		return nil, grpcError(infoMessage)
+	}
+	return &kvpb.GetResponse{Header: s.kv.grpcHeader(), Kv: toProtoKeyValue(keyValue)}, nil
+}
+
+func (s *grpcServer) Range(ctx context.Context, request *kvpb.RangeRequest) (*kvpb.RangeResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return kvpb.NewKVClient(connection).Range(ctx, request)
+	}
+
+	if request.Limit < 0 {
+		return nil, grpcError(StatusBadBodyMessage)
+	}
+
+	keyValues := s.kv.rangeKeyValues(request.Prefix, int(request.Limit))
+	response := &kvpb.RangeResponse{Header: s.kv.grpcHeader(), Kvs: make([]*kvpb.KeyValue, len(keyValues))}
+	for index := range keyValues {
+		response.Kvs[index] = toProtoKeyValue(&keyValues[index])
+	}
+	return response, nil
+}
+
+//
+// Write
+//
+
+func (s *grpcServer) Put(ctx context.Context, request *kvpb.PutRequest) (*kvpb.PutResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return kvpb.NewKVClient(connection).Put(ctx, request)
+	}
+
+	keyValue, infoMessage := s.kv.put(request.Key, request.Value, request.Lease)
+	if infoMessage != StatusOKMessage {
+		return nil, grpcError(infoMessage)
+	}
+	return &kvpb.PutResponse{Header: s.kv.grpcHeader(), Kv: toProtoKeyValue(keyValue)}, nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, request *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	if connection, err := s.kv.leaderGRPCConnection(); connection != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return kvpb.NewKVClient(connection).Delete(ctx, request)
+	}
+
+	keyValue, infoMessage := s.kv.remove(request.Key)
+	if infoMessage != StatusOKMessage {
+		return nil, grpcError(infoMessage)
+	}
+	return &kvpb.DeleteResponse{Header: s.kv.grpcHeader(), PrevKv: toProtoKeyValue(keyValue)}, nil
+}
+
+//
+// Watch
+//
+
+// Watch passes the events committed on this node to the stream, until the client
+// cancels it or falls behind
+func (s *grpcServer) Watch(request *kvpb.WatchRequest, stream kvpb.KV_WatchServer) error {
+	w := s.kv.watch(request.Prefix)
+	defer s.kv.unwatch(w)
+
+	if err := stream.Send(&kvpb.WatchResponse{Header: s.kv.grpcHeader()}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case event, ok := <-w.events:
+			if !ok {
+				return status.Error(codes.Aborted, "watcher fell behind")
+			}
+
+			// Events that are already buffered are sent together
+			response := &kvpb.WatchResponse{Events: []*kvpb.Event{toProtoEvent(event)}}
+			for drained := false; !drained; {
+				select {
+				case event, ok := <-w.events:
+					if !ok {
+						return status.Error(codes.Aborted, "watcher fell behind")
+					}
+					response.Events = append(response.Events, toProtoEvent(event))
+				default:
+					drained = true
+				}
+			}
+
+			response.Header = s.kv.grpcHeader()
+			if err := stream.Send(response); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+//
+// Status
+//
+
+func (s *grpcServer) Status(ctx context.Context, request *kvpb.StatusRequest) (*kvpb.StatusResponse, error) {
+	response := &kvpb.StatusResponse{
+		Header:  s.kv.grpcHeader(),
+		Address: s.kv.LocalAddress.String(),
+		Leader:  s.kv.IsLeader(),
+	}
+
+	s.kv.followerMutex.RLock()
+	for _, follower := range s.kv.Followers {
+		response.Followers = append(response.Followers, follower.Address.String())
+	}
+	s.kv.followerMutex.RUnlock()
+	return response, nil
+}
+
+//
+// Utils
+//
+
+// leaderGRPCConnection returns a connection to the leader on followers and nil on the leader.
+// The connection is reused until the leader changes.
+func (kv *KeyValueStore) leaderGRPCConnection() (*grpc.ClientConn, error) {
+	if kv.IsLeader() {
+		return nil, nil
+	}
+
+	kv.grpcMutex.Lock()
+	defer kv.grpcMutex.Unlock()
+
+	target := kv.leaderMember().GRPCURL
+	if target == "" {
+		return nil, grpcError(StatusLeaderUnavailableMessage)
+	}
+	if kv.leaderConnection != nil && kv.leaderConnection.Target() != target {
+		kv.leaderConnection.Close()
+		kv.leaderConnection = nil
+	}
+	if kv.leaderConnection == nil {
+		connection, err := grpc.NewClient(target,
+			grpc.WithTransportCredentials(kv.leaderCredentials()),
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(int(kv.config.MaxRequestSize))))
+		if err != nil {
+			ErrorLogger.Println(err)
+			return nil, grpcError(StatusLeaderUnavailableMessage)
+		}
+		kv.leaderConnection = connection
+	}
+
+	InfoLogger.Println("Forwarding gRPC request to leader")
+	return kv.leaderConnection, nil
+}
+
+// leaderCredentials verify the gRPC API of the leader against the CA of the client endpoints, if it is served over TLS
+func (kv *KeyValueStore) leaderCredentials() credentials.TransportCredentials {
+	if kv.clientTLS == nil {
+		return insecure.NewCredentials()
+	}
+	return newReloadingCredentials(func() *tls.Config {
+		return clientTLSConfig("", nil, kv.clientTLS)
+	})
+}
+
+func grpcError(infoMessage InfoMessage) error {
+	code, ok := grpcCodes[infoMessage]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Error(code, infoMessage.Message)
+}
+
+func (kv *KeyValueStore) grpcHeader() *kvpb.ResponseHeader {
+	header := kv.responseHeader()
+	return &kvpb.ResponseHeader{
+		Revision: header.Revision,
+		Term:     header.Term,
+		Leader:   header.Leader.String(),
+	}
+}
+
+func toProtoKeyValue(keyValue *KeyValue) *kvpb.KeyValue {
+	return &kvpb.KeyValue{Key: keyValue.Key, Value: keyValue.Value, Lease: keyValue.Lease}
+}
+
+func toProtoEvent(event WatchEvent) *kvpb.Event {
+	eventType := kvpb.Event_PUT
+	if event.Type == EventDelete {
+		eventType = kvpb.Event_DELETE
+	}
+	return &kvpb.Event{
+		Type:     eventType,
+		Kv:       &kvpb.KeyValue{Key: event.Key, Value: event.Value, Lease: event.Lease},
+		Revision: event.Revision,
+	}
+}
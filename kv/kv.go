@@ -2,23 +2,41 @@ package kv
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 )
 
+// Member is where a node is reached. Network transports send peer messages to its peer URL and HTTP
+// requests to its client URL, the default ports of its address are used if they are empty.
+type Member struct {
+	Address   net.IP `json:"address"`
+	PeerURL   string `json:"peerURL"`
+	ClientURL string `json:"clientURL"`
+	// Followers relay the client protocols to these URLs of the leader, they are empty if a protocol is not served
+	GRPCURL      string `json:"grpcURL,omitempty"`
+	RedisURL     string `json:"redisURL,omitempty"`
+	MemcachedURL string `json:"memcachedURL,omitempty"`
+}
+
+// Follower is a member of the cluster, which is identified by its ID. Initial members are only known by
+// their address until they voted in the first election.
 type Follower struct {
-	Address net.IP `json:"address"`
+	ID string `json:"id"`
+	Member
 
 	LastLogHash         string `json:"lastLogHash"`
 	LastCommitedLogHash string `json:"lastCommitedLogHash"`
@@ -27,50 +45,216 @@ type Follower struct {
 type KeyValueStore struct {
 	// "Shared" Network Properties
 
+	ID            string     `json:"id"`
 	Term          uint64     `json:"term"`
 	Leader        bool       `json:"leader"`
+	LeaderID      string     `json:"leaderID"`
 	LeaderAddress net.IP     `json:"leaderAddress"`
 	Followers     []Follower `json:"followers"`
 	LocalAddress  net.IP     `json:"localAddress"`
+	PeerURL       string     `json:"peerURL"`
+	ClientURL     string     `json:"clientURL"`
+	GRPCURL       string     `json:"grpcURL,omitempty"`
+	RedisURL      string     `json:"redisURL,omitempty"`
+	MemcachedURL  string     `json:"memcachedURL,omitempty"`
 
 	// Private Network Properties
 
+	// Where the leader is reached, which is learned along with its address
+	leader Member
+	// The initial member this node is listed as, if it bootstrapped the cluster
+	bootstrapMember Member
+
 	lastLeaderHeartBeat time.Time
 	nextVoteTerm        uint64
+	electionTimeout     time.Duration
+
+	// Closed once the node is stopped, which ends all of its loops
+	stop     chan struct{}
+	stopOnce sync.Once
 
 	// Database Properties
 
-	Initialized bool              `json:"initialized"`
-	Database    map[string]string `json:"database"`
-	DatabaseLog []*KeyValueLog    `json:"databaseLog"`
+	Initialized  bool              `json:"initialized"`
+	Database     map[string][]byte `json:"database"`
+	DatabaseLog  []*KeyValueLog    `json:"databaseLog"`
+	ContentTypes map[string]string `json:"contentTypes,omitempty"`
+	Leases       map[int64]*Lease  `json:"leases,omitempty"`
+	KeyLeases    map[string]int64  `json:"keyLeases,omitempty"`
+
+	// Revisions follow from the database log and are not part of the state
+	keyRevisions map[string]keyRevision
+
+	writeQueue chan *pendingWrite
+
+	// Lease deadlines are only tracked by the leader
+	leaseDeadlines map[int64]time.Time
+
+	watchers map[*watcher]bool
+	// All events since eventHistoryRevision, which were committed on this node
+	eventHistory         []WatchEvent
+	eventHistoryRevision int64
+
+	// Followers forward gRPC requests over a connection to the leader
+	leaderConnection *grpc.ClientConn
+	// The gRPC API is served over TLS with these files if they are set
+	clientTLS *TLSFiles
+
+	// Network and timing parameters the node was started with
+	config Config
+
+	// All messages to other nodes are sent over the transport
+	transport Transport
+	// Listeners of the client protocols, which are closed once the node is stopped
+	listeners []net.Listener
 
 	// Mutex
 
+	// Guards Leader and the leader the node follows
+	leaderMutex   sync.RWMutex
 	followerMutex sync.RWMutex
 	databaseMutex sync.RWMutex
 	logMutex      sync.RWMutex
+	leaseMutex    sync.Mutex
+	watchMutex    sync.Mutex
+	grpcMutex     sync.Mutex
+	listenerMutex sync.Mutex
 }
 
-func InitKeyValueStore(leader bool, leaderAddress net.IP) KeyValueStore {
-	localAddress := GetOutboundIP()
+// InitKeyValueStore creates a node that registers with entry on start, unless it is the leader
+func InitKeyValueStore(config Config, leader bool, entry Member) *KeyValueStore {
+	kv := initKeyValueStore(config, leader, entry.Address, GetOutboundIP(config.OutboundTarget))
+	if !leader {
+		kv.leader = entry
+	}
+	return kv
+}
+
+// Faults are only injected over the development routes
+func initKeyValueStore(config Config, leader bool, leaderAddress net.IP, localAddress net.IP) *KeyValueStore {
+	return InitKeyValueStoreWithConfig(config, leader, leaderAddress, localAddress, NewFaultTransport(newPeerTransport(config)))
+}
+
+// InitKeyValueStoreWithTransport creates a node with the default config that communicates with the other nodes over transport
+func InitKeyValueStoreWithTransport(leader bool, leaderAddress net.IP, localAddress net.IP, transport Transport) *KeyValueStore {
+	return InitKeyValueStoreWithConfig(DefaultConfig(), leader, leaderAddress, localAddress, transport)
+}
+
+// InitKeyValueStoreWithConfig creates a node with config that communicates with the other nodes over transport.
+// The node is identified by config.NodeID, or a new ID if it is empty.
+func InitKeyValueStoreWithConfig(config Config, leader bool, leaderAddress net.IP, localAddress net.IP, transport Transport) *KeyValueStore {
+	id := config.NodeID
+	if id == "" {
+		id = newNodeID()
+	}
+	leaderID := ""
 	if leader {
+		leaderID = id
 		leaderAddress = localAddress
 	}
+	member := config.advertisedMember(localAddress)
+	leaderMember := Member{Address: leaderAddress}
+	if leader {
+		leaderMember = member
+	}
 
-	return KeyValueStore{
+	return &KeyValueStore{
+		ID:            id,
 		Term:          0,
 		Leader:        leader,
+		LeaderID:      leaderID,
 		LeaderAddress: leaderAddress,
 		Followers:     make([]Follower, 0),
 		LocalAddress:  localAddress,
+		PeerURL:       member.PeerURL,
+		ClientURL:     member.ClientURL,
+		GRPCURL:       member.GRPCURL,
+		RedisURL:      member.RedisURL,
+		MemcachedURL:  member.MemcachedURL,
 
-		lastLeaderHeartBeat: time.Now(),
+		leader: leaderMember,
+
+		lastLeaderHeartBeat: CLOCK.Now(),
 		nextVoteTerm:        0,
+		electionTimeout:     config.electionTimeout(),
+
+		stop: make(chan struct{}),
+
+		Initialized:  leader,
+		Database:     map[string][]byte{"initial": []byte("value")},
+		DatabaseLog:  []*KeyValueLog{INITIAL_LOG},
+		ContentTypes: make(map[string]string),
+		Leases:       make(map[int64]*Lease),
+		KeyLeases:    make(map[string]int64),
+
+		keyRevisions: initialKeyRevisions(leader),
+
+		writeQueue: make(chan *pendingWrite, config.WriteQueueSize),
+
+		leaseDeadlines: make(map[int64]time.Time),
 
-		Initialized: leader,
-		Database:    map[string]string{"initial": "value"},
-		DatabaseLog: []*KeyValueLog{INITIAL_LOG},
+		watchers: make(map[*watcher]bool),
+
+		config:    config,
+		transport: transport,
+		clientTLS: config.clientTLS(),
+	}
+}
+
+// BootstrapKeyValueStore creates a node that is one of the initial members of config, it takes the address of
+// the member that is this node
+func BootstrapKeyValueStore(config Config) (*KeyValueStore, error) {
+	members, err := config.InitialMembers()
+	if err != nil {
+		return nil, err
+	}
+	local, err := config.localMember(members)
+	if err != nil {
+		return nil, err
 	}
+
+	kv := initKeyValueStore(config, false, nil, members[local].Address)
+	kv.bootstrap(members, local)
+	return kv, nil
+}
+
+// bootstrap makes the node the local member of the initial members of a new cluster. None of them is the leader,
+// they elect one among themselves once their election timeout passed. A single member leads right away.
+func (kv *KeyValueStore) bootstrap(members []Follower, local int) {
+	kv.Initialized = true
+	kv.keyRevisions = initialKeyRevisions(true)
+	kv.bootstrapMember = members[local].Member
+	if len(members) == 1 {
+		kv.setLeader(kv.ID, kv.member())
+		return
+	}
+
+	kv.followerMutex.Lock()
+	kv.Followers = make([]Follower, len(members))
+	for index, member := range members {
+		kv.Followers[index] = Follower{
+			ID:                  member.ID,
+			Member:              member.Member,
+			LastLogHash:         INITIAL_LOG.Hash,
+			LastCommitedLogHash: INITIAL_LOG.Hash,
+		}
+		if index == local {
+			kv.Followers[index] = kv.follower()
+		}
+	}
+	kv.followerMutex.Unlock()
+
+	kv.lastLeaderHeartBeat = CLOCK.Now()
+	CLOCK.Go(kv.checkLeader)
+}
+
+// initialKeyRevisions describes the initial log, which followers apply once they registered
+func initialKeyRevisions(leader bool) map[string]keyRevision {
+	keyRevisions := make(map[string]keyRevision)
+	if leader {
+		keyRevisions[INITIAL_LOG.Key] = keyRevision{create: 0, mod: 0, version: 1}
+	}
+	return keyRevisions
 }
 
 //
@@ -78,46 +262,260 @@ func InitKeyValueStore(leader bool, leaderAddress net.IP) KeyValueStore {
 //
 
 func (kv *KeyValueStore) Start(release bool) {
-	if release {
-		if leaderAddress := kv.register(kv.LeaderAddress); leaderAddress != nil {
-			kv.LeaderAddress = leaderAddress
-		} else {
+	// Initial members of a cluster and leaders do not register with another node
+	if release && !kv.Initialized {
+		if !kv.register(kv.leaderMember()) {
 			ErrorLogger.Println("Could not register with leader")
 			os.Exit(1)
 		}
 	}
 
-	go kv.heartBeat()
+	kv.startLoops()
 
-	r := mux.NewRouter()
+	if err := kv.serveClientProtocols(""); err != nil {
+		ErrorLogger.Fatal(err)
+	}
+
+	InfoLogger.Println("Start serving..")
+	if err := kv.transport.Serve(kv, kv.newRouter(release)); err != nil && err != http.ErrServerClosed {
+		ErrorLogger.Println(err)
+	}
+}
+
+// Serve starts a node outside of release mode like Start, but only listens on host and returns once the
+// client protocols are served. The node is registered over the development routes, if at all.
+func (kv *KeyValueStore) Serve(host string) error {
+	if err := kv.serveClientProtocols(host); err != nil {
+		kv.Stop()
+		return err
+	}
+	kv.startLoops()
+
+	CLOCK.Go(func() {
+		if err := kv.transport.Serve(kv, kv.newRouter(false)); err != nil && err != http.ErrServerClosed {
+			ErrorLogger.Println(err)
+		}
+	})
+	return nil
+}
+
+// serveClientProtocols serves gRPC as well as the configured Redis and memcached protocols on host, all interfaces if empty.
+// All of them are served over TLS with the certificate of the client endpoints, if it is set.
+func (kv *KeyValueStore) serveClientProtocols(host string) error {
+	listener, err := kv.listen(host + kv.config.GRPCPort)
+	if err != nil {
+		return err
+	}
+	go kv.serveGRPC(listener)
+
+	if kv.config.RedisPort != "" {
+		listener, err := kv.listenClientTLS(host + kv.config.RedisPort)
+		if err != nil {
+			return err
+		}
+		go kv.serveRedis(listener)
+	}
+	if kv.config.MemcachedPort != "" {
+		listener, err := kv.listenClientTLS(host + kv.config.MemcachedPort)
+		if err != nil {
+			return err
+		}
+		go kv.serveMemcached(listener)
+	}
+	return nil
+}
+
+// listen opens a listener that is closed once the node is stopped
+func (kv *KeyValueStore) listen(address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	kv.listenerMutex.Lock()
+	defer kv.listenerMutex.Unlock()
+	kv.listeners = append(kv.listeners, listener)
+	return listener, nil
+}
+
+// listenClientTLS opens a listener like listen, whose connections are served over TLS if the client endpoints are
+func (kv *KeyValueStore) listenClientTLS(address string) (net.Listener, error) {
+	listener, err := kv.listen(address)
+	if err != nil || kv.clientTLS == nil {
+		return listener, err
+	}
+	return tls.NewListener(listener, serverTLSConfig(kv.clientTLS, nil, tls.NoClientCert)), nil
+}
+
+// dialLeader connects to a client protocol of the leader at target, over TLS if the client endpoints are served over it
+func (kv *KeyValueStore) dialLeader(target string) (net.Conn, error) {
+	if kv.clientTLS == nil {
+		return net.Dial("tcp", target)
+	}
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Dial("tcp", target, clientTLSConfig(host, nil, kv.clientTLS))
+}
+
+// Join starts a node that is only reachable over its transport, without any of the client protocol listeners.
+// Followers register with the network at entryAddress first.
+func (kv *KeyValueStore) Join(entryAddress net.IP) error {
+	CLOCK.Go(func() {
+		if err := kv.transport.Serve(kv, kv.newRouter(true)); err != nil && err != http.ErrServerClosed {
+			ErrorLogger.Println(err)
+		}
+	})
+
+	if !kv.IsLeader() && !kv.register(Member{Address: entryAddress}) {
+		kv.Stop()
+		return errors.New("could not register with " + entryAddress.String())
+	}
+	kv.startLoops()
+	return nil
+}
+
+// startLoops starts the loops of the leader, followers start checking the leader once they registered
+func (kv *KeyValueStore) startLoops() {
+	CLOCK.Go(kv.heartBeat)
+	CLOCK.Go(kv.writePipeline)
+	CLOCK.Go(kv.expireLeases)
+}
+
+// Stop ends all loops of the node and closes its transport. Like a crashed node, it does not notify the other nodes.
+func (kv *KeyValueStore) Stop() {
+	kv.stopOnce.Do(func() {
+		close(kv.stop)
+		kv.transport.Close()
+
+		kv.listenerMutex.Lock()
+		for _, listener := range kv.listeners {
+			listener.Close()
+		}
+		kv.listenerMutex.Unlock()
+	})
+}
+
+func (kv *KeyValueStore) stopped() bool {
+	select {
+	case <-kv.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// LocalDatabase returns a copy of the database of this node, followers do not ask the leader
+func (kv *KeyValueStore) LocalDatabase() map[string][]byte {
+	kv.databaseMutex.RLock()
+	defer kv.databaseMutex.RUnlock()
+
+	database := make(map[string][]byte, len(kv.Database))
+	for key, value := range kv.Database {
+		database[key] = value
+	}
+	return database
+}
+
+// newRouter registers all HTTP routes, the development routes are only available outside of release mode
+func (kv *KeyValueStore) newRouter(release bool) *mux.Router {
+	// Paths are matched escaped and uncleaned, so keys may contain any escaped byte including slashes
+	r := mux.NewRouter().SkipClean(true).UseEncodedPath()
 
 	if !release {
 		s := r.PathPrefix("/dev").Subrouter()
-		s.HandleFunc("/kill", handleDevKill).Methods("POST")
+		s.HandleFunc("/kill", kv.handleDevKill).Methods("POST")
 		s.HandleFunc("/state", kv.handleDevState).Methods("GET")
 		s.HandleFunc("/register", kv.handleDevRegister).Methods("POST")
+		s.HandleFunc("/faults", kv.handleDevFaults).Methods("GET")
+		s.HandleFunc("/faults", kv.handleDevSetFaults).Methods("POST")
+		s.HandleFunc("/partition", kv.handleDevPartition).Methods("POST")
+		s.HandleFunc("/heal", kv.handleDevHeal).Methods("POST")
 	}
 
 	r.HandleFunc("/status", handleStatus).Methods("GET")
 
-	r.HandleFunc("/register", kv.handleRegister).Methods("POST")
-	r.HandleFunc("/heart-beat", kv.handleHeartBeat).Methods("POST")
+	r.HandleFunc("/leader", kv.handleLeaderRequest).Methods("GET")
+
+	// Peer messages are only accepted from nodes of the same cluster
+	p := r.NewRoute().Subrouter()
+	p.Use(kv.checkClusterHeader)
+
+	p.HandleFunc("/register", kv.handleRegister).Methods("POST")
+	p.HandleFunc("/heart-beat", kv.handleHeartBeat).Methods("POST")
 
 	// Election
-	r.HandleFunc("/poll", kv.handlePoll).Methods("GET")
-	r.HandleFunc("/leader", kv.handleLeaderUpdate).Methods("POST")
-	r.HandleFunc("/leader", kv.handleLeaderRequest).Methods("GET")
+	p.HandleFunc("/poll", kv.handlePoll).Methods("GET")
+	p.HandleFunc("/leader", kv.handleLeaderUpdate).Methods("POST")
+
+	// Replication
+	p.HandleFunc("/log/append", kv.handleLogAppend).Methods("POST")
+	p.HandleFunc("/log/commit", kv.handleCommit).Methods("POST")
+
+	// Client requests are limited in size
+	c := r.NewRoute().Subrouter()
+	c.Use(limitRequestSize(kv.config.MaxRequestSize, respondInfoMessage))
 
 	// Read
-	r.HandleFunc("/read/{key}", kv.handleRead).Methods("GET")
+	// Keys are either given as the remainder of the path or as the `key` URL parameter
+	c.HandleFunc("/read/{key:.+}", kv.handleRead).Methods("GET")
+	c.HandleFunc("/read", kv.handleRead).Methods("GET")
+	c.HandleFunc("/raw/{key:.+}", kv.handleRawRead).Methods("GET")
+	c.HandleFunc("/raw", kv.handleRawRead).Methods("GET")
+	c.HandleFunc("/scan", kv.handleScan).Methods("GET")
 
 	// Write
-	r.HandleFunc("/write/{key}", kv.handleWrite).Methods("POST")
-	r.HandleFunc("/log/append", kv.handleLogAppend).Methods("POST")
-	r.HandleFunc("/log/commit", kv.handleCommit).Methods("POST")
-
-	InfoLogger.Println("Start serving..")
-	http.ListenAndServe(":8080", r)
+	c.HandleFunc("/write/{key:.+}", kv.handleWrite).Methods("POST")
+	c.HandleFunc("/write", kv.handleWrite).Methods("POST")
+	c.HandleFunc("/delete/{key:.+}", kv.handleDelete).Methods("POST")
+	c.HandleFunc("/delete", kv.handleDelete).Methods("POST")
+	c.HandleFunc("/cas/{key:.+}", kv.handleCompareAndSwap).Methods("POST")
+	c.HandleFunc("/cas", kv.handleCompareAndSwap).Methods("POST")
+
+	// Increment
+	c.HandleFunc("/increment/{key:.+}", kv.handleIncrement).Methods("POST")
+	c.HandleFunc("/increment", kv.handleIncrement).Methods("POST")
+	c.HandleFunc("/decrement/{key:.+}", kv.handleDecrement).Methods("POST")
+	c.HandleFunc("/decrement", kv.handleDecrement).Methods("POST")
+
+	// Batch
+	c.HandleFunc("/batch/read", kv.handleBatchRead).Methods("POST")
+	c.HandleFunc("/batch/write", kv.handleBatchWrite).Methods("POST")
+
+	// Lease
+	c.HandleFunc("/lease/grant", kv.handleLeaseGrant).Methods("POST")
+	c.HandleFunc("/lease/keep-alive/{id}", kv.handleLeaseKeepAlive).Methods("POST")
+	c.HandleFunc("/lease/revoke/{id}", kv.handleLeaseRevoke).Methods("POST")
+
+	// Concurrency
+	c.HandleFunc("/lock/{name}", kv.handleLockHolder).Methods("GET")
+	c.HandleFunc("/lock/{name}", kv.handleLock).Methods("POST")
+	c.HandleFunc("/unlock/{name}", kv.handleUnlock).Methods("POST")
+	c.HandleFunc("/election/{name}", kv.handleElectionLeader).Methods("GET")
+	c.HandleFunc("/election/{name}/campaign", kv.handleCampaign).Methods("POST")
+	c.HandleFunc("/election/{name}/resign", kv.handleResign).Methods("POST")
+
+	// Version 2 of the client API, which only speaks JSON
+	v := r.PathPrefix("/v2").Subrouter()
+	v.Use(limitRequestSize(kv.config.MaxRequestSize, func(w http.ResponseWriter, statusCode int, infoMessage InfoMessage) {
+		kv.respondV2Error(w, infoMessage)
+	}))
+	v.HandleFunc("/status", kv.handleV2Status).Methods("GET")
+	v.HandleFunc("/kv/get", kv.handleV2Get).Methods("POST")
+	v.HandleFunc("/kv/range", kv.handleV2Range).Methods("POST")
+	v.HandleFunc("/kv/put", kv.handleV2Put).Methods("POST")
+	v.HandleFunc("/kv/delete", kv.handleV2Delete).Methods("POST")
+	v.HandleFunc("/kv/cas", kv.handleV2CompareAndSwap).Methods("POST")
+	v.HandleFunc("/kv/increment", kv.handleV2Increment).Methods("POST")
+	v.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kv.respondV2Error(w, StatusRouteNotFoundMessage)
+	})
+	v.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kv.respondV2Error(w, StatusMethodNotAllowedMessage)
+	})
+
+	return r
 }
 
 //
@@ -125,31 +523,31 @@ func (kv *KeyValueStore) Start(release bool) {
 //
 
 func (kv *KeyValueStore) heartBeat() {
-	if !kv.Leader {
+	if !kv.IsLeader() {
 		return
 	}
 
 	// As long as the leader lives
-	for {
+	for kv.IsLeader() && !kv.stopped() {
 		// Send HeartBeat to current followers
 		kv.followerMutex.RLock()
+		heartBeatMessage := HeartBeatMessage{
+			InfoMessage: StatusOKMessage,
+			LeaderID:    kv.ID,
+			Leader:      kv.member(),
+			Term:        atomic.LoadUint64(&kv.Term),
+			Followers:   kv.Followers,
+		}
 		for _, follower := range kv.Followers {
-			go func(follower Follower) {
-				jsonValue, _ := json.Marshal(HeartBeatMessage{
-					InfoMessage: StatusOKMessage,
-					Term:        kv.Term,
-					Followers:   kv.Followers,
-				})
-				resp, err := http.Post(GetURL(follower.Address, "/heart-beat"), "application/json", bytes.NewBuffer(jsonValue))
+			CLOCK.Go(func() {
+				err := kv.transport.HeartBeat(follower.Member, heartBeatMessage)
 				if err != nil {
 					ErrorLogger.Println(err)
-					return
 				}
-				defer resp.Body.Close()
-			}(follower)
+			})
 		}
 		kv.followerMutex.RUnlock()
-		time.Sleep(LEADER_HEART_BEAT_TIMEOUT)
+		CLOCK.Sleep(kv.config.HeartBeatInterval)
 	}
 }
 
@@ -163,56 +561,47 @@ func (kv *KeyValueStore) runPoll() {
 
 	kv.followerMutex.RLock()
 	kv.logMutex.RLock()
+	lastCommitIndex, err := kv.findLastCommitedLog()
+	if err != nil {
+		kv.logMutex.RUnlock()
+		kv.followerMutex.RUnlock()
+		ErrorLogger.Println(err)
+		return
+	}
+	term, lastLogHash := kv.Term, kv.DatabaseLog[lastCommitIndex].Hash
+	// IDs of the voters by their address and peer URL
+	voterIDs := make(map[string]string)
+	var voterMutex sync.Mutex
 	for index, follower := range kv.Followers {
 		// Do not send poll to oneself
-		if net.IP.Equal(follower.Address, kv.LocalAddress) {
+		if kv.isSelf(follower) {
 			localAddressIndex = index
 			continue
 		}
 		// Send poll requests to others
-		go func(term uint64, lastLogHash string, follower Follower, yesVotes *int, noVotes *int) {
-			jsonValue, _ := json.Marshal(PollRequestMessage{
+		CLOCK.Go(func() {
+			pollResponse, err := kv.transport.Poll(follower.Member, PollRequestMessage{
 				Term:             term,
+				CandidateID:      kv.ID,
 				NewLeaderAddress: kv.LocalAddress,
 				LastLogHash:      lastLogHash,
 			})
-
-			req, err := http.NewRequest("GET", GetURL(follower.Address, "/poll"), nil)
+			// Unreachable nodes do not vote for the candidate
 			if err != nil {
-				log.Print(err)
-				os.Exit(1)
-			}
-			q := req.URL.Query()
-			q.Add("poll_parameters", string(jsonValue))
-			req.URL.RawQuery = q.Encode()
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				kv.logMutex.RUnlock()
-				kv.followerMutex.RUnlock()
 				ErrorLogger.Println(err)
-				return
+			} else {
+				voterMutex.Lock()
+				voterIDs[follower.Address.String()+" "+follower.PeerURL] = pollResponse.ID
+				voterMutex.Unlock()
 			}
-			defer resp.Body.Close()
 
 			// Evaluate poll
-			bodyBytes, _ := ioutil.ReadAll(resp.Body)
-			var pollResponse PollResponseMessage
-			err = json.Unmarshal(bodyBytes, &pollResponse)
-			if err != nil {
-				kv.logMutex.RUnlock()
-				kv.followerMutex.RUnlock()
-				ErrorLogger.Println(err)
-				return
-			}
-
-			if pollResponse.Yes {
-				*yesVotes += 1
+			if err == nil && pollResponse.Yes {
+				yesVotes += 1
 			} else {
-				*noVotes += 1
+				noVotes += 1
 			}
-		}(kv.Term, kv.DatabaseLog[kv.findLastCommitedLog()].Hash, follower, &yesVotes, &noVotes)
+		})
 	}
 	kv.logMutex.RUnlock()
 	maxVotes := len(kv.Followers) - 1
@@ -220,45 +609,60 @@ func (kv *KeyValueStore) runPoll() {
 
 	majorityVote := int(float32(maxVotes)*0.5) + 1 // Half plus one
 	won := false
-	for {
+	for !kv.stopped() {
 		if yesVotes >= majorityVote ||
 			noVotes >= majorityVote ||
-			yesVotes+noVotes == maxVotes {
+			yesVotes+noVotes >= maxVotes {
 			won = yesVotes > noVotes
 			break
 		}
-		time.Sleep(100 * time.Microsecond)
+		CLOCK.Sleep(POLL_INTERVAL)
 	}
 
 	// Check if current election is still the newest, else invalidate
 	won = won && (kv.nextVoteTerm <= kv.Term)
 
 	if won {
-		kv.Leader = true
 		kv.Initialized = true
-		kv.LeaderAddress = kv.LocalAddress
+		kv.setLeader(kv.ID, kv.member())
 
-		// Delete oneself from follower addresses
 		kv.followerMutex.Lock()
+		// Initial members are identified by their vote
+		voterMutex.Lock()
+		for index := range kv.Followers {
+			if kv.Followers[index].ID == "" {
+				kv.Followers[index].ID = voterIDs[kv.Followers[index].Address.String()+" "+kv.Followers[index].PeerURL]
+			}
+		}
+		voterMutex.Unlock()
+		// Delete oneself from followers
 		kv.Followers[len(kv.Followers)-1], kv.Followers[localAddressIndex] = kv.Followers[localAddressIndex], kv.Followers[len(kv.Followers)-1]
 		kv.Followers = kv.Followers[:len(kv.Followers)-1]
 		kv.followerMutex.Unlock()
 
 		// Broadcast leader update
 		leaderData := LeaderUpdateMessage{
-			Leader: kv.LeaderAddress,
-			Term:   kv.Term,
+			LeaderID:     kv.ID,
+			Leader:       kv.LocalAddress,
+			PeerURL:      kv.PeerURL,
+			ClientURL:    kv.ClientURL,
+			GRPCURL:      kv.GRPCURL,
+			RedisURL:     kv.RedisURL,
+			MemcachedURL: kv.MemcachedURL,
+			Term:         kv.Term,
 		}
 		var leaderAcceptedCounter uint64 = 0
 		_ = kv.Broadcast(
-			"/leader",
-			leaderData,
+			func(member Member) (InfoMessage, error) { return kv.transport.LeaderUpdate(member, leaderData) },
 			&leaderAcceptedCounter,
+			nil,
 		)
-		go kv.heartBeat()
+		kv.startLoops()
 
 		InfoLogger.Printf("Won election (Term: %d, Yes: %d, No: %d)\n", kv.Term, yesVotes, noVotes)
 	} else {
+		// Candidates whose timeouts are close would otherwise keep splitting the votes in every term
+		kv.electionTimeout = kv.config.electionTimeout()
 		InfoLogger.Printf("Lost election (Term: %d, Yes: %d, No: %d)\n", kv.Term, yesVotes, noVotes)
 	}
 
@@ -267,29 +671,66 @@ func (kv *KeyValueStore) runPoll() {
 
 func (kv *KeyValueStore) checkLeader() {
 	// Check if leader remains alive
-	for {
-		if kv.Leader {
+	for !kv.stopped() {
+		if kv.IsLeader() {
 			return
 		}
-		if time.Since(kv.lastLeaderHeartBeat) > INDIVIDUAL_ELECTION_TIMEOUT {
-			go kv.runPoll()
+		if since(kv.lastLeaderHeartBeat) > kv.electionTimeout {
+			CLOCK.Go(kv.runPoll)
 		}
-		time.Sleep(INDIVIDUAL_ELECTION_TIMEOUT)
+		CLOCK.Sleep(kv.electionTimeout)
+	}
+}
+
+// stepDown makes the leader a follower without leader, which takes part in the next election once its election
+// timeout passed
+func (kv *KeyValueStore) stepDown() {
+	kv.leaderMutex.Lock()
+	leader := kv.Leader
+	kv.Leader = false
+	kv.LeaderID = ""
+	kv.LeaderAddress = nil
+	kv.leader = Member{}
+	kv.leaderMutex.Unlock()
+	if !leader {
+		return
 	}
+
+	ErrorLogger.Printf("Lost the majority of followers, stepping down (%d)\n", kv.Term)
+	// Candidates find themselves among the followers
+	kv.followerMutex.Lock()
+	kv.Followers = append(kv.Followers, kv.follower())
+	kv.followerMutex.Unlock()
+	kv.lastLeaderHeartBeat = CLOCK.Now()
+	CLOCK.Go(kv.checkLeader)
 }
 
-func (kv *KeyValueStore) register(entryAddress net.IP) net.IP {
+// register registers the node with the leader, entry redirects it to the leader if it does not lead itself.
+// The node follows the leader it registered with.
+func (kv *KeyValueStore) register(entry Member) bool {
 	success := false
-	for retries := 0; retries < MAX_REGISTER_RETRIES; retries++ {
+	for retries := 0; retries < kv.config.RegisterRetries; retries++ {
 		form := url.Values{}
+		form.Add("id", kv.ID)
 		form.Add("ip", kv.LocalAddress.String())
-		resp, err := http.PostForm(GetURL(entryAddress, "/register"), form)
+		form.Add("peerURL", kv.PeerURL)
+		form.Add("clientURL", kv.ClientURL)
+		form.Add("grpcURL", kv.GRPCURL)
+		form.Add("redisURL", kv.RedisURL)
+		form.Add("memcachedURL", kv.MemcachedURL)
+		resp, err := kv.transport.Post(entry, "/register", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
 		if err != nil {
 			ErrorLogger.Println(err)
-			return nil
+			return false
 		}
 		defer resp.Body.Close()
 
+		// Nodes never join a cluster with another ID, even if it accepted them
+		if clusterID := resp.Header.Get(CLUSTER_HEADER); resp.StatusCode == http.StatusConflict || (clusterID != "" && clusterID != kv.config.ClusterID) {
+			ErrorLogger.Printf("Refusing to join cluster %q as member of cluster %q\n", clusterID, kv.config.ClusterID)
+			return false
+		}
+
 		if resp.StatusCode == http.StatusOK {
 			registrationResponseBytes, _ := ioutil.ReadAll(resp.Body)
 			var registrationResponse RegistrationResponseMessage
@@ -297,7 +738,7 @@ func (kv *KeyValueStore) register(entryAddress net.IP) net.IP {
 			if err != nil {
 				ErrorLogger.Println(err)
 				ErrorLogger.Printf("Could not parse response body\n")
-				return nil
+				return false
 			}
 
 			if registrationResponse.InfoMessage == StatusOKMessage {
@@ -305,85 +746,191 @@ func (kv *KeyValueStore) register(entryAddress net.IP) net.IP {
 				jsonContent, _ := json.Marshal(registrationResponse.DatabaseLog)
 				InfoLogger.Printf("Got registration response with database log %s\n", jsonContent)
 				kv.DatabaseLog = registrationResponse.DatabaseLog
-
 				kv.logMutex.Unlock()
+
+				kv.setLeader(registrationResponse.LeaderID, registrationResponse.Leader)
 				success = true
 				break
 			} else {
 				ErrorLogger.Println("Unknown registration response not parse response body")
-				return nil
+				return false
 			}
 		} else if resp.StatusCode == http.StatusServiceUnavailable {
 			var response IPMessage
 			bodyBytes, _ := ioutil.ReadAll(resp.Body)
 			err := json.Unmarshal(bodyBytes, &response)
 			if err != nil {
-				return nil
+				return false
 			}
 
 			if reflect.DeepEqual(response.InfoMessage, StatusMovedMessage) {
-				entryAddress = response.IP
+				entry = Member{Address: response.IP, ClientURL: response.ClientURL}
 			} else {
-				return nil
+				return false
 			}
 		} else {
-			return nil
+			return false
 		}
 
-		time.Sleep(RETRY_INTERVAL)
+		CLOCK.Sleep(kv.config.RetryInterval)
 	}
 
 	if !success {
-		return nil
+		return false
 	}
 
 	// Apply database log
 	kv.logMutex.RLock()
-	for _, logEntry := range kv.DatabaseLog {
+	kv.databaseMutex.Lock()
+	for index, logEntry := range kv.DatabaseLog {
 		if logEntry.Committed {
-			kv.Database[logEntry.Key] = logEntry.Value
+			// There are no watchers yet, the events only end up in the event history
+			kv.publishEvents(kv.applyLog(logEntry, int64(index)).Events)
 		} else {
 			break
 		}
 	}
+	kv.databaseMutex.Unlock()
 	kv.logMutex.RUnlock()
 
 	// Reset last leader heart beat to avoid instant election
-	kv.lastLeaderHeartBeat = time.Now()
-	go kv.checkLeader()
+	kv.lastLeaderHeartBeat = CLOCK.Now()
+	CLOCK.Go(kv.checkLeader)
 
-	return entryAddress
+	return true
 }
 
 //
 // Utils
 //
 
-func (kv *KeyValueStore) Broadcast(path string, data interface{}, confirmedCounter *uint64) uint64 {
+// member returns where this node is reached
+func (kv *KeyValueStore) member() Member {
+	return Member{
+		Address:      kv.LocalAddress,
+		PeerURL:      kv.PeerURL,
+		ClientURL:    kv.ClientURL,
+		GRPCURL:      kv.GRPCURL,
+		RedisURL:     kv.RedisURL,
+		MemcachedURL: kv.MemcachedURL,
+	}
+}
+
+// IsLeader returns whether the node currently leads the cluster
+func (kv *KeyValueStore) IsLeader() bool {
+	kv.leaderMutex.RLock()
+	defer kv.leaderMutex.RUnlock()
+	return kv.Leader
+}
+
+// leaderMember returns where the leader is reached
+func (kv *KeyValueStore) leaderMember() Member {
+	kv.leaderMutex.RLock()
+	defer kv.leaderMutex.RUnlock()
+	return kv.leader
+}
+
+// setLeader follows the leader with id at leader, the node leads itself if id is its own
+func (kv *KeyValueStore) setLeader(id string, leader Member) {
+	kv.leaderMutex.Lock()
+	defer kv.leaderMutex.Unlock()
+	kv.Leader = id == kv.ID
+	kv.LeaderID = id
+	kv.LeaderAddress = leader.Address
+	kv.leader = leader
+}
+
+// follower describes this node as member of the cluster
+func (kv *KeyValueStore) follower() Follower {
+	return Follower{
+		ID:                  kv.ID,
+		Member:              kv.member(),
+		LastLogHash:         INITIAL_LOG.Hash,
+		LastCommitedLogHash: INITIAL_LOG.Hash,
+	}
+}
+
+// isSelf returns whether follower is this node, initial members whose ID is not known yet are compared with the
+// initial member this node bootstrapped as
+func (kv *KeyValueStore) isSelf(follower Follower) bool {
+	if follower.ID == "" {
+		return follower.Address.Equal(kv.bootstrapMember.Address) && follower.PeerURL == kv.bootstrapMember.PeerURL
+	}
+	return follower.ID == kv.ID
+}
+
+// Broadcast sends a message to all followers and counts the followers which accepted it, as well as the
+// followers that could not be reached in failedCounter if it is set. Messages that were refused are retried
+// up to BroadcastRetries times.
+func (kv *KeyValueStore) Broadcast(send func(member Member) (InfoMessage, error), confirmedCounter *uint64, failedCounter *uint64) uint64 {
 	kv.followerMutex.RLock()
 	followerCount := uint64(len(kv.Followers))
 	for _, follower := range kv.Followers {
 		// Follower is deliberately copied here
-		go func(follower Follower, path string, data interface{}, followerCommittedCount *uint64) {
-			jsonValue, _ := json.Marshal(data)
-			url := GetURL(follower.Address, path)
-			for retries := 0; retries < BROADCAST_RETRIES; retries++ {
-				resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonValue))
+		CLOCK.Go(func() {
+			for retries := 0; retries < kv.config.BroadcastRetries; retries++ {
+				infoMessage, err := send(follower.Member)
 				if err != nil {
 					ErrorLogger.Println(err)
+					if failedCounter != nil {
+						atomic.AddUint64(failedCounter, 1)
+					}
 					return
 				}
-				defer resp.Body.Close()
-				if resp.StatusCode == http.StatusOK {
+				if infoMessage == StatusOKMessage {
 					break
 				}
-				time.Sleep(RETRY_INTERVAL)
+				CLOCK.Sleep(kv.config.RetryInterval)
 			}
 
 			atomic.AddUint64(confirmedCounter, 1)
-		}(follower, path, data, confirmedCounter)
+		})
 	}
 	kv.followerMutex.RUnlock()
 
 	return followerCount
 }
+
+// proxyRequest forwards a JSON request to the leader and relays its response
+func (kv *KeyValueStore) proxyRequest(w http.ResponseWriter, path string, body []byte) {
+	proxyResp, err := kv.transport.Post(kv.leaderMember(), path, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		ErrorLogger.Println(err)
+		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		return
+	}
+	defer proxyResp.Body.Close()
+
+	responseBytes, _ := ioutil.ReadAll(proxyResp.Body)
+	var response json.RawMessage
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		ErrorLogger.Println("Unspecified proxy response message format")
+		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		return
+	}
+
+	RespondJSON(w, proxyResp.StatusCode, response)
+	InfoLogger.Println("Proxy request finished and successful")
+}
+
+// proxyGetRequest forwards a read request to the leader and relays its JSON response
+func (kv *KeyValueStore) proxyGetRequest(w http.ResponseWriter, path string) {
+	proxyResp, err := kv.transport.Get(kv.leaderMember(), path)
+	if err != nil {
+		ErrorLogger.Println(err)
+		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		return
+	}
+	defer proxyResp.Body.Close()
+
+	responseBytes, _ := ioutil.ReadAll(proxyResp.Body)
+	var response json.RawMessage
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		ErrorLogger.Println("Unspecified proxy response message format")
+		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		return
+	}
+
+	RespondJSON(w, proxyResp.StatusCode, response)
+	InfoLogger.Println("Proxy request finished and successful")
+}
@@ -3,38 +3,118 @@ package kv
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
+// Operations are evaluated when a log is applied to the database
+const (
+	OperationSet              = "set"
+	OperationIncrement        = "increment"
+	OperationDelete           = "delete"
+	OperationCompareAndSwap   = "compareAndSwap"
+	OperationCompareAndDelete = "compareAndDelete"
+	OperationLeaseGrant       = "leaseGrant"
+	OperationLeaseRevoke      = "leaseRevoke"
+	OperationTxn              = "txn"
+)
+
 type KeyValueLog struct {
 	Hash      string    `json:"hash"`
 	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
 	Key       string    `json:"key"`
-	Value     string    `json:"value"`
+	Value     []byte    `json:"value"`
 	Committed bool      `json:"committed"`
+
+	// ContentType is the media type the value was written with
+	ContentType string `json:"contentType,omitempty"`
+	// Expected is compared against the current value by compare operations, unless the key is expected to be absent
+	Expected     []byte `json:"expected,omitempty"`
+	ExpectAbsent bool   `json:"expectAbsent,omitempty"`
+	// ExpectedRevision is compared against the etcd modification revision of the key instead of its value, unless it is zero
+	ExpectedRevision int64 `json:"expectedRevision,omitempty"`
+	// Lease is the lease a key is attached to, or the subject of lease operations
+	Lease int64 `json:"lease,omitempty"`
+}
+
+func CreateKeyValueLog(key string, value []byte, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationSet, Key: key, Value: value}, creationTimeNow, commited)
+}
+
+// CreateSetLog creates a log that sets key and attaches it to lease, the key is deleted once the lease ends.
+// Empty content types and zero leases are not stored.
+func CreateSetLog(key string, value []byte, contentType string, lease int64, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationSet, Key: key, Value: value, ContentType: contentType, Lease: lease}, creationTimeNow, commited)
+}
+
+// CreateIncrementLog creates a log that adds delta to the integer value of key, the value field holds delta
+func CreateIncrementLog(key string, delta int64, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationIncrement, Key: key, Value: []byte(strconv.FormatInt(delta, 10))}, creationTimeNow, commited)
+}
+
+func CreateDeleteLog(key string, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationDelete, Key: key}, creationTimeNow, commited)
+}
+
+// CreateCompareAndSwapLog creates a log that sets key only if its current value equals expected,
+// or if the key is absent when expected is nil
+func CreateCompareAndSwapLog(key string, expected []byte, value []byte, lease int64, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationCompareAndSwap, Key: key, Value: value, Expected: expected, ExpectAbsent: expected == nil, Lease: lease}, creationTimeNow, commited)
+}
+
+// CreateCompareRevisionAndSwapLog creates a log that sets key only if it was last modified at the etcd revision,
+// or if the key is absent when revision is zero
+func CreateCompareRevisionAndSwapLog(key string, revision int64, value []byte, contentType string, lease int64, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationCompareAndSwap, Key: key, Value: value, ContentType: contentType, ExpectedRevision: revision, ExpectAbsent: revision == 0, Lease: lease}, creationTimeNow, commited)
 }
 
-func CreateKeyValueLog(key string, value string, creationTimeNow bool, commited bool) *KeyValueLog {
+// CreateCompareAndDeleteLog creates a log that deletes key only if its current value equals expected
+func CreateCompareAndDeleteLog(key string, expected []byte, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationCompareAndDelete, Key: key, Expected: expected}, creationTimeNow, commited)
+}
+
+// CreateLeaseGrantLog creates a log that grants the lease id, the value field holds its time to live in seconds
+func CreateLeaseGrantLog(id int64, ttl int64, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationLeaseGrant, Value: []byte(strconv.FormatInt(ttl, 10)), Lease: id}, creationTimeNow, commited)
+}
+
+// CreateLeaseRevokeLog creates a log that ends the lease id and deletes all keys attached to it
+func CreateLeaseRevokeLog(id int64, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationLeaseRevoke, Lease: id}, creationTimeNow, commited)
+}
+
+// CreateTxnLog creates a log that applies an etcd transaction atomically, the value field holds the encoded request
+func CreateTxnLog(request []byte, creationTimeNow bool, commited bool) *KeyValueLog {
+	return createLog(KeyValueLog{Operation: OperationTxn, Value: request}, creationTimeNow, commited)
+}
+
+// logSequence is part of the hash of logs created now, so identical logs created at the same (simulated) time differ
+var logSequence uint64
+
+func createLog(logEntry KeyValueLog, creationTimeNow bool, commited bool) *KeyValueLog {
+	entryHash := sha256.New()
 	var creationTime time.Time
 	if creationTimeNow {
-		creationTime = time.Now()
+		creationTime = CLOCK.Now()
+		entryHash.Write([]byte(strconv.FormatUint(atomic.AddUint64(&logSequence, 1), 10)))
 	} else {
 		creationTime = time.Unix(0, 0)
 	}
-
-	entryHash := sha256.New()
 	entryHash.Write([]byte(creationTime.String()))
-	entryHash.Write([]byte(key))
-	entryHash.Write([]byte(value))
-
-	logEntry := new(KeyValueLog)
-	*logEntry = KeyValueLog{
-		Hash:      hex.EncodeToString(entryHash.Sum(nil)),
-		Time:      creationTime,
-		Key:       key,
-		Value:     string(value),
-		Committed: commited,
-	}
+	entryHash.Write([]byte(logEntry.Operation))
+	entryHash.Write([]byte(logEntry.Key))
+	entryHash.Write(logEntry.Value)
+	entryHash.Write([]byte(logEntry.ContentType))
+	entryHash.Write(logEntry.Expected)
+	entryHash.Write([]byte(strconv.FormatBool(logEntry.ExpectAbsent)))
+	entryHash.Write([]byte(strconv.FormatInt(logEntry.ExpectedRevision, 10)))
+	entryHash.Write([]byte(strconv.FormatInt(logEntry.Lease, 10)))
+
+	logEntry.Hash = hex.EncodeToString(entryHash.Sum(nil))
+	logEntry.Time = creationTime
+	logEntry.Committed = commited
 
-	return logEntry
+	return &logEntry
 }
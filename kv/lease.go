@@ -0,0 +1,182 @@
+package kv
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Lease is a replicated time to live, all keys attached to it are deleted once it is revoked.
+// Only the leader keeps track of the deadlines and revokes expired leases through the log.
+type Lease struct {
+	ID  int64 `json:"id"`
+	TTL int64 `json:"ttl"`
+}
+
+// expireLeases revokes every lease that was not kept alive within its time to live
+func (kv *KeyValueStore) expireLeases() {
+	if !kv.IsLeader() {
+		return
+	}
+
+	// As long as the leader lives
+	for kv.IsLeader() && !kv.stopped() {
+		now := CLOCK.Now()
+		expired := make([]int64, 0)
+
+		kv.databaseMutex.RLock()
+		kv.leaseMutex.Lock()
+		for id, lease := range kv.Leases {
+			deadline, ok := kv.leaseDeadlines[id]
+			if !ok {
+				// Newly granted or inherited from the previous leader
+				kv.leaseDeadlines[id] = now.Add(time.Duration(lease.TTL) * time.Second)
+			} else if !deadline.IsZero() && now.After(deadline) {
+				// A zero deadline marks a revoke that is already in progress
+				kv.leaseDeadlines[id] = time.Time{}
+				expired = append(expired, id)
+			}
+		}
+		for id := range kv.leaseDeadlines {
+			if _, ok := kv.Leases[id]; !ok {
+				delete(kv.leaseDeadlines, id)
+			}
+		}
+		kv.leaseMutex.Unlock()
+		kv.databaseMutex.RUnlock()
+
+		for _, id := range expired {
+			InfoLogger.Printf("Lease %d expired\n", id)
+			CLOCK.Go(func() { kv.queueWrite([]*KeyValueLog{CreateLeaseRevokeLog(id, true, false)}) })
+		}
+
+		CLOCK.Sleep(kv.config.LeaseCheckInterval)
+	}
+}
+
+func (kv *KeyValueStore) handleLeaseGrant(w http.ResponseWriter, r *http.Request) {
+	ttlBytes, _ := ioutil.ReadAll(r.Body)
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying lease grant request to leader")
+		kv.proxyRequest(w, "/lease/grant", ttlBytes)
+		return
+	}
+
+	ttl, err := strconv.ParseInt(strings.TrimSpace(string(ttlBytes)), 10, 64)
+	if err != nil || ttl <= 0 {
+		RespondJSON(w, http.StatusBadRequest, LeaseMessage{InfoMessage: StatusBadTTLMessage})
+		return
+	}
+
+	id, infoMessage := kv.grantLease(0, ttl)
+	if infoMessage != StatusOKMessage {
+		RespondJSON(w, writeStatusCode(infoMessage, http.StatusConflict), LeaseMessage{InfoMessage: infoMessage})
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, LeaseMessage{
+		InfoMessage: StatusOKMessage,
+		ID:          id,
+		TTL:         ttl,
+	})
+}
+
+func (kv *KeyValueStore) handleLeaseKeepAlive(w http.ResponseWriter, r *http.Request) {
+	kv.handleLeaseRequest(w, r, "/lease/keep-alive/", func(id int64) {
+		ttl, ok := kv.refreshLease(id)
+		if !ok {
+			RespondJSON(w, http.StatusNotFound, LeaseMessage{InfoMessage: StatusLeaseNotFoundMessage, ID: id})
+			return
+		}
+
+		RespondJSON(w, http.StatusOK, LeaseMessage{
+			InfoMessage: StatusOKMessage,
+			ID:          id,
+			TTL:         ttl,
+		})
+	})
+}
+
+func (kv *KeyValueStore) handleLeaseRevoke(w http.ResponseWriter, r *http.Request) {
+	kv.handleLeaseRequest(w, r, "/lease/revoke/", func(id int64) {
+		if infoMessage := kv.revokeLease(id); infoMessage != StatusOKMessage {
+			RespondJSON(w, writeStatusCode(infoMessage, http.StatusNotFound), LeaseMessage{InfoMessage: infoMessage, ID: id})
+			return
+		}
+
+		RespondJSON(w, http.StatusOK, LeaseMessage{InfoMessage: StatusOKMessage, ID: id})
+	})
+}
+
+// handleLeaseRequest parses the lease id of the request and either proxies it to the leader or runs handle
+func (kv *KeyValueStore) handleLeaseRequest(w http.ResponseWriter, r *http.Request, path string, handle func(id int64)) {
+	vars := mux.Vars(r)
+	rawID := vars["id"]
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying lease request to leader")
+		kv.proxyRequest(w, path+rawID, nil)
+		return
+	}
+
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		RespondJSON(w, http.StatusBadRequest, StatusBadURLParameterMessage)
+		return
+	}
+
+	handle(id)
+}
+
+// grantLease grants a lease with the given time to live in seconds, a random id is chosen if id is zero
+func (kv *KeyValueStore) grantLease(id int64, ttl int64) (int64, InfoMessage) {
+	if id == 0 {
+		id = newLeaseID()
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateLeaseGrantLog(id, ttl, true, false)})[0]
+	if result.InfoMessage != StatusOKMessage {
+		return 0, result.InfoMessage
+	}
+
+	kv.keepLeaseAlive(id, ttl)
+	return id, StatusOKMessage
+}
+
+// newLeaseID returns a random lease id, zero is reserved for keys without lease
+func newLeaseID() int64 {
+	return CLOCK.Int63n(math.MaxInt64) + 1
+}
+
+// refreshLease keeps a lease alive for another time to live, which it returns
+func (kv *KeyValueStore) refreshLease(id int64) (int64, bool) {
+	kv.databaseMutex.RLock()
+	lease, ok := kv.Leases[id]
+	kv.databaseMutex.RUnlock()
+	if !ok || !kv.keepLeaseAlive(id, lease.TTL) {
+		return 0, false
+	}
+	return lease.TTL, true
+}
+
+func (kv *KeyValueStore) revokeLease(id int64) InfoMessage {
+	return kv.queueWrite([]*KeyValueLog{CreateLeaseRevokeLog(id, true, false)})[0].InfoMessage
+}
+
+// keepLeaseAlive resets the deadline of a lease, it fails if the lease is already being revoked
+func (kv *KeyValueStore) keepLeaseAlive(id int64, ttl int64) bool {
+	kv.leaseMutex.Lock()
+	defer kv.leaseMutex.Unlock()
+
+	if deadline, ok := kv.leaseDeadlines[id]; ok && deadline.IsZero() {
+		return false
+	}
+	kv.leaseDeadlines[id] = CLOCK.Now().Add(time.Duration(ttl) * time.Second)
+	return true
+}
@@ -0,0 +1,221 @@
+package kv
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// memcachedItem is the current state of a key in memcached terms
+type memcachedItem struct {
+	value       []byte
+	contentType string
+	lease       int64
+	revision    int64
+}
+
+// memcachedItem returns the item stored at key, if it exists
+func (kv *KeyValueStore) memcachedItem(key string) (*memcachedItem, bool) {
+	kv.databaseMutex.RLock()
+	defer kv.databaseMutex.RUnlock()
+
+	value, ok := kv.Database[key]
+	if !ok {
+		return nil, false
+	}
+	return &memcachedItem{
+		value:       value,
+		contentType: kv.ContentTypes[key],
+		lease:       kv.KeyLeases[key],
+		revision:    etcdRevision(kv.keyRevisions[key].mod),
+	}, true
+}
+
+//
+// Retrieval
+//
+
+// memcachedGet writes all items that exist among keys, gets includes their cas unique
+func (kv *KeyValueStore) memcachedGet(w *bufio.Writer, keys []string, gets bool) {
+	for _, key := range keys {
+		item, ok := kv.memcachedItem(key)
+		if !ok {
+			continue
+		}
+
+		w.WriteString("VALUE " + key + " " + strconv.FormatUint(uint64(memcachedFlags(item.contentType)), 10) + " " + strconv.Itoa(len(item.value)))
+		if gets {
+			w.WriteString(" " + strconv.FormatInt(item.revision, 10))
+		}
+		w.WriteString("\r\n")
+		w.Write(item.value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+//
+// Storage
+//
+
+// memcachedStore runs set, add, replace and cas. Items with an expiration time are attached to a lease of their own.
+func (kv *KeyValueStore) memcachedStore(command *memcachedCommand) string {
+	key := command.args[0]
+	flags, err := strconv.ParseUint(command.args[1], 10, 32)
+	if err != nil {
+		return string(memcachedBadFormat)
+	}
+	exptime, err := strconv.ParseInt(command.args[2], 10, 64)
+	if err != nil {
+		return string(memcachedBadFormat)
+	}
+	contentType := memcachedContentType(uint32(flags))
+
+	// Every attempt grants a new lease, leases of failed attempts expire unused
+	storeLogs := func(storeLog *KeyValueLog) []*KeyValueLog {
+		if exptime == 0 {
+			return []*KeyValueLog{storeLog}
+		}
+		return []*KeyValueLog{CreateLeaseGrantLog(storeLog.Lease, memcachedTTL(exptime), true, false), storeLog}
+	}
+	lease := int64(0)
+	if exptime != 0 {
+		lease = newLeaseID()
+	}
+
+	switch command.name {
+	case "set":
+		results := kv.queueWrite(storeLogs(CreateSetLog(key, command.data, contentType, lease, true, false)))
+		return memcachedStoreReply(results[len(results)-1].InfoMessage, "")
+	case "add":
+		results := kv.queueWrite(storeLogs(CreateCompareRevisionAndSwapLog(key, 0, command.data, contentType, lease, true, false)))
+		return memcachedStoreReply(results[len(results)-1].InfoMessage, "NOT_STORED")
+	case "cas":
+		revision, err := strconv.ParseInt(command.args[4], 10, 64)
+		if err != nil || revision <= 0 {
+			return string(memcachedBadFormat)
+		}
+		results := kv.queueWrite(storeLogs(CreateCompareRevisionAndSwapLog(key, revision, command.data, contentType, lease, true, false)))
+		return memcachedStoreReply(results[len(results)-1].InfoMessage, "EXISTS")
+	default:
+		// Replace the item at the revision it was read at, until it is not modified in between
+		for {
+			item, ok := kv.memcachedItem(key)
+			if !ok {
+				return "NOT_STORED"
+			}
+
+			results := kv.queueWrite(storeLogs(CreateCompareRevisionAndSwapLog(key, item.revision, command.data, contentType, lease, true, false)))
+			switch infoMessage := results[len(results)-1].InfoMessage; infoMessage {
+			case StatusCompareFailedMessage:
+				lease = newLeaseID()
+			case StatusValueNotFoundMessage:
+				return "NOT_STORED"
+			default:
+				return memcachedStoreReply(infoMessage, "")
+			}
+		}
+	}
+}
+
+// memcachedStoreReply replies to a storage command, failed compares are replied with compareFailed
+func memcachedStoreReply(infoMessage InfoMessage, compareFailed string) string {
+	switch infoMessage {
+	case StatusOKMessage:
+		return "STORED"
+	case StatusCompareFailedMessage:
+		return compareFailed
+	case StatusValueNotFoundMessage:
+		return "NOT_FOUND"
+	default:
+		return "SERVER_ERROR " + infoMessage.Message
+	}
+}
+
+func (kv *KeyValueStore) memcachedDelete(key string) string {
+	switch result := kv.queueWrite([]*KeyValueLog{CreateDeleteLog(key, true, false)})[0]; result.InfoMessage {
+	case StatusOKMessage:
+		return "DELETED"
+	case StatusValueNotFoundMessage:
+		return "NOT_FOUND"
+	default:
+		return "SERVER_ERROR " + result.InfoMessage.Message
+	}
+}
+
+// memcachedCounter runs incr and decr on unsigned 64 bit integers. Increments wrap around,
+// decrements stop at zero. Flags and expiration time of the item are kept.
+func (kv *KeyValueStore) memcachedCounter(key string, rawDelta string, increment bool) string {
+	delta, err := strconv.ParseUint(rawDelta, 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR invalid numeric delta argument"
+	}
+
+	for {
+		item, ok := kv.memcachedItem(key)
+		if !ok {
+			return "NOT_FOUND"
+		}
+		current, err := strconv.ParseUint(string(item.value), 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR cannot increment or decrement non-numeric value"
+		}
+
+		switch {
+		case increment:
+			current += delta
+		case delta > current:
+			current = 0
+		default:
+			current -= delta
+		}
+		value := []byte(strconv.FormatUint(current, 10))
+
+		result := kv.queueWrite([]*KeyValueLog{CreateCompareRevisionAndSwapLog(key, item.revision, value, item.contentType, item.lease, true, false)})[0]
+		switch result.InfoMessage {
+		case StatusOKMessage:
+			return string(value)
+		case StatusCompareFailedMessage:
+			continue
+		case StatusValueNotFoundMessage, StatusLeaseNotFoundMessage:
+			return "NOT_FOUND"
+		default:
+			return "SERVER_ERROR " + result.InfoMessage.Message
+		}
+	}
+}
+
+//
+// Utils
+//
+
+// memcachedTTL converts an expiration time into the time to live of a lease in seconds.
+// Expiration times in the past expire within a second.
+func memcachedTTL(exptime int64) int64 {
+	ttl := exptime
+	if exptime > MEMCACHED_MAX_RELATIVE_EXPIRATION {
+		ttl = exptime - CLOCK.Now().Unix()
+	}
+	if ttl <= 0 {
+		return 1
+	}
+	return ttl
+}
+
+// memcachedContentType stores flags as the content type of a key, keys without flags have no content type
+func memcachedContentType(flags uint32) string {
+	if flags == 0 {
+		return ""
+	}
+	return MEMCACHED_CONTENT_TYPE + "; flags=" + strconv.FormatUint(uint64(flags), 10)
+}
+
+// memcachedFlags returns the flags stored as content type, other content types have no flags
+func memcachedFlags(contentType string) uint32 {
+	rawFlags, ok := strings.CutPrefix(contentType, MEMCACHED_CONTENT_TYPE+"; flags=")
+	if !ok {
+		return 0
+	}
+	flags, _ := strconv.ParseUint(rawFlags, 10, 32)
+	return uint32(flags)
+}
@@ -0,0 +1,289 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The memcached text protocol frontend stores items in the replicated database. The flags of an item
+// are kept as the content type of its key and expiration times as leases of their own. The cas unique
+// of an item is the etcd modification revision of its key. Commands run on the leader, followers relay
+// them to the leader.
+
+// memcachedCommand is a parsed command line, storage commands carry their data block
+type memcachedCommand struct {
+	name    string
+	args    []string
+	data    []byte
+	noreply bool
+}
+
+// memcachedError is a complete error reply, the connection remains usable after it was sent
+type memcachedError string
+
+func (e memcachedError) Error() string {
+	return string(e)
+}
+
+const memcachedBadFormat = memcachedError("CLIENT_ERROR bad command line format")
+
+// Number of arguments after the name of each command, get and gets take at least one key
+var memcachedArities = map[string]int{
+	"get":     1,
+	"gets":    1,
+	"set":     4,
+	"add":     4,
+	"replace": 4,
+	"cas":     5,
+	"delete":  1,
+	"incr":    2,
+	"decr":    2,
+	"version": 0,
+	"quit":    0,
+}
+
+type memcachedConnection struct {
+	kv     *KeyValueStore
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	// Followers relay commands over a connection to the leader, which is reopened once the leader changes
+	leader       net.Conn
+	leaderTarget string
+	leaderReader *bufio.Reader
+	leaderWriter *bufio.Writer
+}
+
+// serveMemcached accepts connections on listener until the node is stopped
+func (kv *KeyValueStore) serveMemcached(listener net.Listener) {
+	InfoLogger.Printf("Serving memcached protocol on %s\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if kv.stopped() {
+				return
+			}
+			ErrorLogger.Println(err)
+			continue
+		}
+		go kv.handleMemcachedConnection(conn)
+	}
+}
+
+func (kv *KeyValueStore) handleMemcachedConnection(conn net.Conn) {
+	c := &memcachedConnection{
+		kv:     kv,
+		reader: bufio.NewReaderSize(conn, PROTOCOL_LINE_SIZE),
+		writer: bufio.NewWriter(conn),
+	}
+	defer conn.Close()
+	defer c.closeLeader()
+
+	for {
+		command, err := readMemcachedCommand(c.reader, c.kv.config.MaxValueSize)
+		if replyError, ok := err.(memcachedError); ok {
+			c.writer.WriteString(string(replyError) + "\r\n")
+		} else if err != nil {
+			return
+		} else if command.name == "quit" {
+			return
+		} else if c.kv.IsLeader() {
+			c.closeLeader()
+			c.handleCommand(command)
+		} else {
+			c.relayCommand(command)
+		}
+
+		// Replies of pipelined commands are sent together
+		if c.reader.Buffered() == 0 {
+			if err := c.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readMemcachedCommand reads the next command line and the data block of storage commands.
+// Malformed commands are reported as memcachedError, data blocks larger than maxValueSize are skipped.
+func readMemcachedCommand(reader *bufio.Reader, maxValueSize int64) (*memcachedCommand, error) {
+	line, err := readLine(reader)
+	if err == errProtocol {
+		return nil, memcachedError("CLIENT_ERROR line too long")
+	} else if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, memcachedError("ERROR")
+	}
+	command := &memcachedCommand{name: fields[0], args: fields[1:]}
+	arity, ok := memcachedArities[command.name]
+	if !ok {
+		return nil, memcachedError("ERROR")
+	}
+
+	if command.name != "get" && command.name != "gets" && len(command.args) == arity+1 && command.args[arity] == "noreply" {
+		command.noreply = true
+		command.args = command.args[:arity]
+	}
+	if len(command.args) < arity || (len(command.args) > arity && command.name != "get" && command.name != "gets") {
+		return nil, memcachedError("ERROR")
+	}
+	for _, key := range memcachedKeys(command) {
+		if len(key) > MEMCACHED_MAX_KEY_LENGTH {
+			return nil, memcachedBadFormat
+		}
+	}
+
+	switch command.name {
+	case "set", "add", "replace", "cas":
+		length, err := strconv.ParseInt(command.args[3], 10, 64)
+		if err != nil || length < 0 {
+			return nil, memcachedBadFormat
+		}
+		if length > maxValueSize {
+			if _, err := io.CopyN(io.Discard, reader, length+2); err != nil {
+				return nil, err
+			}
+			return nil, memcachedError("SERVER_ERROR object too large for cache")
+		}
+
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			return nil, memcachedError("CLIENT_ERROR bad data chunk")
+		}
+		command.data = data[:length]
+	}
+	return command, nil
+}
+
+// memcachedKeys returns the keys a command refers to
+func memcachedKeys(command *memcachedCommand) []string {
+	switch command.name {
+	case "get", "gets":
+		return command.args
+	case "version", "quit":
+		return nil
+	default:
+		return command.args[:1]
+	}
+}
+
+// handleCommand runs a command on the leader
+func (c *memcachedConnection) handleCommand(command *memcachedCommand) {
+	var reply string
+	switch command.name {
+	case "get", "gets":
+		c.kv.memcachedGet(c.writer, command.args, command.name == "gets")
+		return
+	case "set", "add", "replace", "cas":
+		reply = c.kv.memcachedStore(command)
+	case "delete":
+		reply = c.kv.memcachedDelete(command.args[0])
+	case "incr", "decr":
+		reply = c.kv.memcachedCounter(command.args[0], command.args[1], command.name == "incr")
+	case "version":
+		reply = "VERSION " + MEMCACHED_VERSION
+	}
+
+	if !command.noreply {
+		c.writer.WriteString(reply + "\r\n")
+	}
+}
+
+//
+// Relay
+//
+
+// relayCommand sends a command to the leader and passes its reply on to the client
+func (c *memcachedConnection) relayCommand(command *memcachedCommand) {
+	target := c.kv.leaderMember().MemcachedURL
+	if c.leader != nil && c.leaderTarget != target {
+		c.closeLeader()
+	}
+	if c.leader == nil {
+		conn, err := c.kv.dialLeader(target)
+		if err != nil {
+			ErrorLogger.Println(err)
+			c.writer.WriteString("SERVER_ERROR " + StatusLeaderUnavailableMessage.Message + "\r\n")
+			return
+		}
+		InfoLogger.Println("Relaying memcached connection to leader")
+		c.leader = conn
+		c.leaderTarget = target
+		c.leaderReader = bufio.NewReaderSize(conn, PROTOCOL_LINE_SIZE)
+		c.leaderWriter = bufio.NewWriter(conn)
+	}
+
+	line := append([]string{command.name}, command.args...)
+	if command.noreply {
+		line = append(line, "noreply")
+	}
+	c.leaderWriter.WriteString(strings.Join(line, " ") + "\r\n")
+	if command.data != nil {
+		c.leaderWriter.Write(command.data)
+		c.leaderWriter.WriteString("\r\n")
+	}
+	err := c.leaderWriter.Flush()
+	if err != nil || command.noreply {
+		if err != nil {
+			ErrorLogger.Println(err)
+			c.closeLeader()
+		}
+		return
+	}
+
+	// The reply is only passed on once it was read completely
+	var reply bytes.Buffer
+	err = copyMemcachedReply(&reply, c.leaderReader, command.name == "get" || command.name == "gets")
+	if err != nil {
+		ErrorLogger.Println(err)
+		c.closeLeader()
+		c.writer.WriteString("SERVER_ERROR " + StatusLeaderUnavailableMessage.Message + "\r\n")
+		return
+	}
+	c.writer.Write(reply.Bytes())
+}
+
+// copyMemcachedReply copies a single reply from reader to writer. Replies to retrievals consist of
+// several items and end with END, every other reply is a single line.
+func copyMemcachedReply(writer io.Writer, reader *bufio.Reader, retrieval bool) error {
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return err
+		}
+		io.WriteString(writer, line+"\r\n")
+
+		fields := strings.Fields(line)
+		if !retrieval || len(fields) == 0 || fields[0] != "VALUE" {
+			return nil
+		}
+		if len(fields) < 4 {
+			return errProtocol
+		}
+		length, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil || length < 0 {
+			return errProtocol
+		}
+		if _, err := io.CopyN(writer, reader, length+2); err != nil {
+			return err
+		}
+	}
+}
+
+// closeLeader closes the connection to the leader
+func (c *memcachedConnection) closeLeader() {
+	if c.leader != nil {
+		c.leader.Close()
+		c.leader = nil
+	}
+}
@@ -0,0 +1,256 @@
+package kv
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// The in-memory transport connects nodes of the same process. Peer messages are passed over the
+// inbox channel of the receiving node, HTTP requests are served by its router without a listener.
+
+var errUnreachable = errors.New("node is not reachable")
+
+// MemoryNetwork connects the nodes that serve a MemoryTransport, nodes are addressed by their local address
+type MemoryNetwork struct {
+	endpoints map[string]*memoryEndpoint
+	mutex     sync.RWMutex
+}
+
+// memoryEndpoint receives the messages of a single node until it is closed
+type memoryEndpoint struct {
+	kv      *KeyValueStore
+	handler http.Handler
+	inbox   chan *memoryMessage
+	closed  chan struct{}
+}
+
+// memoryMessage is handled on the receiving node, its reply is sent back to the sender
+type memoryMessage struct {
+	handle func(kv *KeyValueStore) interface{}
+	reply  chan interface{}
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{endpoints: make(map[string]*memoryEndpoint)}
+}
+
+// endpoint returns the endpoint of the node at address, unless it is not served
+func (n *MemoryNetwork) endpoint(address net.IP) (*memoryEndpoint, bool) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	endpoint, ok := n.endpoints[address.String()]
+	return endpoint, ok
+}
+
+// send passes handle to the node at address and waits for its reply, at most for timeout
+func (n *MemoryNetwork) send(address net.IP, timeout time.Duration, handle func(kv *KeyValueStore) interface{}) (interface{}, error) {
+	endpoint, ok := n.endpoint(address)
+	if !ok {
+		return nil, errUnreachable
+	}
+
+	message := &memoryMessage{handle: handle, reply: make(chan interface{}, 1)}
+	timedOut := CLOCK.After(timeout)
+
+	select {
+	case endpoint.inbox <- message:
+	case <-endpoint.closed:
+		return nil, errUnreachable
+	case <-timedOut:
+		return nil, errUnreachable
+	}
+
+	select {
+	case reply := <-message.reply:
+		return reply, nil
+	case <-endpoint.closed:
+		return nil, errUnreachable
+	case <-timedOut:
+		return nil, errUnreachable
+	}
+}
+
+// MemoryTransport is the transport of a single node on a MemoryNetwork. Messages time out after the peer timeout
+// of the default config, or of the node once it is served.
+type MemoryTransport struct {
+	network  *MemoryNetwork
+	address  net.IP
+	timeout  time.Duration
+	endpoint *memoryEndpoint
+	mutex    sync.Mutex
+}
+
+func (n *MemoryNetwork) NewTransport(address net.IP) *MemoryTransport {
+	return &MemoryTransport{network: n, address: address, timeout: DefaultConfig().PeerTimeout}
+}
+
+// Serve makes the node reachable on the network, until the transport is closed. Messages are handled concurrently.
+func (t *MemoryTransport) Serve(kv *KeyValueStore, router http.Handler) error {
+	endpoint := &memoryEndpoint{
+		kv:      kv,
+		handler: router,
+		inbox:   make(chan *memoryMessage),
+		closed:  make(chan struct{}),
+	}
+
+	t.mutex.Lock()
+	t.endpoint = endpoint
+	t.timeout = kv.config.PeerTimeout
+	t.mutex.Unlock()
+	t.network.mutex.Lock()
+	t.network.endpoints[t.address.String()] = endpoint
+	t.network.mutex.Unlock()
+
+	for {
+		select {
+		case message := <-endpoint.inbox:
+			go func(message *memoryMessage) {
+				message.reply <- message.handle(kv)
+			}(message)
+		case <-endpoint.closed:
+			return http.ErrServerClosed
+		}
+	}
+}
+
+// Close makes the node unreachable, messages on their way are lost
+func (t *MemoryTransport) Close() error {
+	t.mutex.Lock()
+	endpoint := t.endpoint
+	t.endpoint = nil
+	t.mutex.Unlock()
+	if endpoint == nil {
+		return nil
+	}
+
+	t.network.mutex.Lock()
+	if t.network.endpoints[t.address.String()] == endpoint {
+		delete(t.network.endpoints, t.address.String())
+	}
+	t.network.mutex.Unlock()
+	close(endpoint.closed)
+	return nil
+}
+
+//
+// Network Administration
+//
+
+func (t *MemoryTransport) HeartBeat(member Member, heartBeatMessage HeartBeatMessage) error {
+	_, err := t.send(member.Address, func(kv *KeyValueStore) interface{} {
+		kv.receiveHeartBeat(heartBeatMessage)
+		return StatusOKMessage
+	})
+	return err
+}
+
+func (t *MemoryTransport) Poll(member Member, pollRequest PollRequestMessage) (PollResponseMessage, error) {
+	reply, err := t.send(member.Address, func(kv *KeyValueStore) interface{} {
+		return kv.receivePoll(pollRequest)
+	})
+	if err != nil {
+		return PollResponseNo, err
+	}
+	return reply.(PollResponseMessage), nil
+}
+
+func (t *MemoryTransport) LeaderUpdate(member Member, leaderMessage LeaderUpdateMessage) (InfoMessage, error) {
+	return t.sendInfoMessage(member.Address, func(kv *KeyValueStore) interface{} {
+		return kv.receiveLeaderUpdate(leaderMessage)
+	})
+}
+
+//
+// Replication
+//
+
+// AppendEntries passes copies of the logs, like every other transport the receiving node does not share them with the leader
+func (t *MemoryTransport) AppendEntries(member Member, appendData *AppendEntriesMessage) (InfoMessage, error) {
+	logEntries := copyLogs(appendData.KeyValueLog)
+	return t.sendInfoMessage(member.Address, func(kv *KeyValueStore) interface{} {
+		return kv.receiveLogAppend(AppendEntriesMessage{KeyValueLog: logEntries})
+	})
+}
+
+func (t *MemoryTransport) Commit(member Member, commitData *CommitLogMessage) (InfoMessage, error) {
+	commitLogMessage := *commitData
+	return t.sendInfoMessage(member.Address, func(kv *KeyValueStore) interface{} {
+		return kv.receiveCommit(commitLogMessage)
+	})
+}
+
+// send passes handle to the node at address, within the peer timeout
+func (t *MemoryTransport) send(address net.IP, handle func(kv *KeyValueStore) interface{}) (interface{}, error) {
+	t.mutex.Lock()
+	timeout := t.timeout
+	t.mutex.Unlock()
+	return t.network.send(address, timeout, handle)
+}
+
+func (t *MemoryTransport) sendInfoMessage(address net.IP, handle func(kv *KeyValueStore) interface{}) (InfoMessage, error) {
+	reply, err := t.send(address, handle)
+	if err != nil {
+		return StatusInternalServerErrorMessage, err
+	}
+	return reply.(InfoMessage), nil
+}
+
+//
+// HTTP
+//
+
+func (t *MemoryTransport) Get(member Member, path string) (*http.Response, error) {
+	return t.do(member.Address, "GET", path, "", nil)
+}
+
+func (t *MemoryTransport) Post(member Member, path string, contentType string, body io.Reader) (*http.Response, error) {
+	return t.do(member.Address, "POST", path, contentType, body)
+}
+
+// do serves the request with the router of the node at address
+func (t *MemoryTransport) do(address net.IP, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	endpoint, ok := t.network.endpoint(address)
+	if !ok {
+		return nil, errUnreachable
+	}
+	return serveRequest(endpoint.handler, t.address, address, method, path, contentType, body)
+}
+
+// copyLogs copies the logs of a message, so the receiving node does not share them with the sender
+func copyLogs(logEntries []*KeyValueLog) []*KeyValueLog {
+	logCopies := make([]*KeyValueLog, len(logEntries))
+	for index, logEntry := range logEntries {
+		logCopy := *logEntry
+		logCopies[index] = &logCopy
+	}
+	return logCopies
+}
+
+// serveRequest serves a request of the node at from with handler, the response is recorded completely.
+// The request never leaves the process, so it is addressed to the node at address without a port and comes
+// from port 0 of from.
+func serveRequest(handler http.Handler, from net.IP, address net.IP, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequest(method, "http://"+address.String()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	// Like on a server, requests always have a body and their request URI is set
+	if request.Body == nil {
+		request.Body = http.NoBody
+	}
+	request.RequestURI = request.URL.RequestURI()
+	request.RemoteAddr = net.JoinHostPort(from.String(), "0")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder.Result(), nil
+}
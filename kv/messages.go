@@ -12,44 +12,105 @@ var StatusMovedMessage = InfoMessage{"not responsible", "Node is not responsible
 var StatusMissingURLParameterMessage = InfoMessage{"URL parameter missing", "A required URL parameter seems to be missing"}
 var StatusBadURLParameterMessage = InfoMessage{"URL parameter malformed", "A URL parameter does not match its specification (count, form, ..)"}
 var StatusInternalServerErrorMessage = InfoMessage{"error occurred", "An unknown internal server error appeared"}
+var StatusBadBodyMessage = InfoMessage{"body malformed", "The request body does not match its specification"}
+var StatusRequestTooLargeMessage = InfoMessage{"request too large", "The request body exceeds the maximum request size"}
+var StatusValueTooLargeMessage = InfoMessage{"value too large", "The value exceeds the maximum value size"}
 
+// RegistrationResponseMessage tells new followers where the leader is reached
 type RegistrationResponseMessage struct {
 	InfoMessage InfoMessage
+	LeaderID    string         `json:"leaderID"`
+	Leader      Member         `json:"leader"`
 	DatabaseLog []*KeyValueLog `json:"databaseLog"`
 }
 
 type StateMessage struct {
 	InfoMessage   InfoMessage
-	KeyValueStore KeyValueStore
+	KeyValueStore *KeyValueStore
 }
 
+// LinkFaultsMessage holds the faults of the messages to other nodes by their address
+type LinkFaultsMessage struct {
+	InfoMessage InfoMessage
+	Links       map[string]LinkFaults `json:"links"`
+}
+
+type LinkFaultsRequestMessage struct {
+	Address net.IP     `json:"address"`
+	Faults  LinkFaults `json:"faults"`
+}
+
+// PartitionRequestMessage lists the nodes that should no longer receive messages
+type PartitionRequestMessage struct {
+	Addresses []net.IP `json:"addresses"`
+}
+
+var StatusClusterMismatchMessage = InfoMessage{"cluster mismatch", "The message was sent by a node of a different cluster"}
+
+var StatusPeerIdentityMessage = InfoMessage{"peer identity mismatch", "The certificate of the sender does not match the member it claims to be"}
+
+var StatusNoFaultTransportMessage = InfoMessage{"no fault transport", "Faults cannot be injected into the transport of this node"}
+
+// IPMessage points to a node, whose HTTP API is served at ClientURL if it is set
 type IPMessage struct {
 	InfoMessage InfoMessage
 	IP          net.IP `json:"ip"`
+	ClientURL   string `json:"clientURL,omitempty"`
 }
 
 type HeartBeatMessage struct {
 	InfoMessage InfoMessage
+	LeaderID    string     `json:"leaderID"`
+	Leader      Member     `json:"leader"`
 	Term        uint64     `json:"term"`
 	Followers   []Follower `json:"followers"`
 }
 
+// leader returns the leader that sent the heart beat, or nil for heart beats of nodes that do not send it along
+func (heartBeatMessage HeartBeatMessage) leader() *Member {
+	if heartBeatMessage.Leader.Address == nil {
+		return nil
+	}
+	return &heartBeatMessage.Leader
+}
+
 type PollRequestMessage struct {
 	Term             uint64 `json:"term"`
+	CandidateID      string `json:"candidateID"`
 	NewLeaderAddress net.IP `json:"newLeaderAddress"`
 	LastLogHash      string `json:"lastLogHash"`
 }
 
+// PollResponseMessage carries the ID of the voter, which candidates learn the IDs of the initial members from
 type PollResponseMessage struct {
-	Yes bool `json:"vote"`
+	Yes bool   `json:"vote"`
+	ID  string `json:"id"`
 }
 
 var PollResponseYes = PollResponseMessage{Yes: true}
 var PollResponseNo = PollResponseMessage{Yes: false}
 
 type LeaderUpdateMessage struct {
-	Leader net.IP `json:"leader"`
-	Term   uint64 `json:"term"`
+	LeaderID     string `json:"leaderID"`
+	Leader       net.IP `json:"leader"`
+	PeerURL      string `json:"peerURL"`
+	ClientURL    string `json:"clientURL"`
+	GRPCURL      string `json:"grpcURL,omitempty"`
+	RedisURL     string `json:"redisURL,omitempty"`
+	MemcachedURL string `json:"memcachedURL,omitempty"`
+	Term         uint64 `json:"term"`
+}
+
+// member returns where the new leader is reached
+func (leaderMessage LeaderUpdateMessage) member() Member {
+	return Member{
+		Address:      leaderMessage.Leader,
+		PeerURL:      leaderMessage.PeerURL,
+		ClientURL:    leaderMessage.ClientURL,
+		GRPCURL:      leaderMessage.GRPCURL,
+		RedisURL:     leaderMessage.RedisURL,
+		MemcachedURL: leaderMessage.MemcachedURL,
+	}
 }
 
 //
@@ -63,6 +124,17 @@ type ReadMessage struct {
 
 var StatusValueNotFoundMessage = InfoMessage{"Value not found", "The requested key could not be found in the database"}
 
+type ScanEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ScanMessage holds the entries of a scan sorted by key
+type ScanMessage struct {
+	InfoMessage InfoMessage
+	Entries     []ScanEntry `json:"entries"`
+}
+
 //
 // Write
 //
@@ -76,3 +148,176 @@ type CommitLogMessage struct {
 }
 
 var StatusLogNotFoundMessage = InfoMessage{"Log not found", "The requested log could not be found in the database log, it remains uncommited."}
+
+//
+// Increment
+//
+
+var StatusNotANumberMessage = InfoMessage{"Value not a number", "The stored value is not an integer and cannot be incremented"}
+var StatusNumberOverflowMessage = InfoMessage{"Number overflow", "The increment would overflow the stored integer"}
+
+//
+// Compare And Swap
+//
+
+// CompareAndSwapMessage sets a key only if its value equals Expected, a missing Expected requires the key to be absent
+type CompareAndSwapMessage struct {
+	Expected *string `json:"expected"`
+	Value    string  `json:"value"`
+	Lease    int64   `json:"lease"`
+}
+
+var StatusCompareFailedMessage = InfoMessage{"Compare failed", "The stored value does not match the expected value"}
+
+//
+// Lease
+//
+
+type LeaseMessage struct {
+	InfoMessage InfoMessage
+	ID          int64 `json:"id"`
+	TTL         int64 `json:"ttl"`
+}
+
+var StatusLeaseNotFoundMessage = InfoMessage{"Lease not found", "The requested lease does not exist or has expired"}
+var StatusLeaseExistsMessage = InfoMessage{"Lease exists", "A lease with the requested id already exists"}
+var StatusBadTTLMessage = InfoMessage{"TTL malformed", "The time to live has to be a positive number of seconds"}
+
+//
+// Concurrency
+//
+
+type LockRequestMessage struct {
+	Owner string `json:"owner"`
+	Lease int64  `json:"lease"`
+}
+
+type LockMessage struct {
+	InfoMessage InfoMessage
+	Name        string `json:"name"`
+	Owner       string `json:"owner"`
+	Lease       int64  `json:"lease"`
+}
+
+var StatusLockHeldMessage = InfoMessage{"Lock held", "The lock is held by another owner"}
+var StatusLockNotHeldMessage = InfoMessage{"Lock not held", "The lock is not held by the requesting owner"}
+var StatusEmptyOwnerMessage = InfoMessage{"Owner empty", "The provided owner must not be empty"}
+
+//
+// Batch
+//
+
+// Values are binary and therefore base64 encoded in JSON
+type BatchWriteEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type BatchWriteResult struct {
+	Key         string `json:"key"`
+	InfoMessage InfoMessage
+}
+
+type BatchWriteResponseMessage struct {
+	InfoMessage InfoMessage
+	Results     []BatchWriteResult `json:"results"`
+}
+
+type BatchReadResult struct {
+	Key         string `json:"key"`
+	InfoMessage InfoMessage
+	Value       []byte `json:"value"`
+}
+
+type BatchReadResponseMessage struct {
+	InfoMessage InfoMessage
+	Results     []BatchReadResult `json:"results"`
+}
+
+var StatusEmptyKeyMessage = InfoMessage{"Key empty", "The provided key must not be empty"}
+
+//
+// V2
+//
+
+// Machine-readable error codes of the v2 API
+const (
+	ErrorCodeBadRequest           = "BAD_REQUEST"
+	ErrorCodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	ErrorCodeRouteNotFound        = "ROUTE_NOT_FOUND"
+	ErrorCodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	ErrorCodeRequestTooLarge      = "REQUEST_TOO_LARGE"
+	ErrorCodeValueTooLarge        = "VALUE_TOO_LARGE"
+	ErrorCodeEmptyKey             = "EMPTY_KEY"
+	ErrorCodeKeyNotFound          = "KEY_NOT_FOUND"
+	ErrorCodeCompareFailed        = "COMPARE_FAILED"
+	ErrorCodeNotANumber           = "NOT_A_NUMBER"
+	ErrorCodeNumberOverflow       = "NUMBER_OVERFLOW"
+	ErrorCodeLeaseNotFound        = "LEASE_NOT_FOUND"
+	ErrorCodeLeaderUnavailable    = "LEADER_UNAVAILABLE"
+	ErrorCodeInternal             = "INTERNAL"
+)
+
+var StatusUnsupportedMediaTypeMessage = InfoMessage{"Unsupported media type", "The request body has to be application/json"}
+var StatusRouteNotFoundMessage = InfoMessage{"Route not found", "The requested route does not exist"}
+var StatusMethodNotAllowedMessage = InfoMessage{"Method not allowed", "The requested route does not support this method"}
+var StatusLeaderUnavailableMessage = InfoMessage{"Leader unavailable", "The request could not be forwarded to the leader"}
+
+// ResponseHeader describes the cluster at the time of the response, the revision
+// is the number of logs committed before it
+type ResponseHeader struct {
+	Revision int64  `json:"revision"`
+	Term     uint64 `json:"term"`
+	Leader   net.IP `json:"leader"`
+}
+
+type ErrorMessage struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// KeyValue holds a key and its value, values are base64 encoded in JSON
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,omitempty"`
+}
+
+// V2Response is the envelope of every v2 response. KV holds the requested, written or deleted key,
+// or the current value of a key a compare failed on. KVs holds the result of a range.
+type V2Response struct {
+	Header ResponseHeader `json:"header"`
+	Error  *ErrorMessage  `json:"error,omitempty"`
+	KV     *KeyValue      `json:"kv,omitempty"`
+	KVs    []KeyValue     `json:"kvs,omitempty"`
+}
+
+type V2KeyRequest struct {
+	Key string `json:"key"`
+}
+
+type V2RangeRequest struct {
+	Prefix string `json:"prefix"`
+	Limit  int    `json:"limit"`
+}
+
+type V2PutRequest struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease"`
+}
+
+// V2CompareAndSwapRequest sets the key only if its value equals Expected, or if it is absent and ExpectAbsent is set
+type V2CompareAndSwapRequest struct {
+	Key          string `json:"key"`
+	Expected     []byte `json:"expected"`
+	ExpectAbsent bool   `json:"expectAbsent"`
+	Value        []byte `json:"value"`
+	Lease        int64  `json:"lease"`
+}
+
+// V2IncrementRequest adds Delta to the integer value of the key, a missing Delta counts as 1
+type V2IncrementRequest struct {
+	Key   string `json:"key"`
+	Delta *int64 `json:"delta"`
+}
@@ -0,0 +1,96 @@
+package kv
+
+// Client operations shared by the v2 HTTP API and the gRPC API, so both behave identically.
+// Operations run on the leader, failures are reported as the status message of the first version.
+
+func (kv *KeyValueStore) get(key string) (*KeyValue, InfoMessage) {
+	if key == "" {
+		return nil, StatusEmptyKeyMessage
+	}
+
+	kv.databaseMutex.RLock()
+	defer kv.databaseMutex.RUnlock()
+
+	value, ok := kv.Database[key]
+	if !ok {
+		return nil, StatusValueNotFoundMessage
+	}
+	return &KeyValue{Key: key, Value: value, Lease: kv.KeyLeases[key]}, StatusOKMessage
+}
+
+func (kv *KeyValueStore) put(key string, value []byte, lease int64) (*KeyValue, InfoMessage) {
+	if key == "" {
+		return nil, StatusEmptyKeyMessage
+	}
+	if int64(len(value)) > kv.config.MaxValueSize {
+		return nil, StatusValueTooLargeMessage
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateSetLog(key, value, "", lease, true, false)})[0]
+	if result.InfoMessage != StatusOKMessage {
+		return nil, result.InfoMessage
+	}
+	return &KeyValue{Key: key, Value: result.Value, Lease: lease}, StatusOKMessage
+}
+
+// remove deletes key and returns its last value
+func (kv *KeyValueStore) remove(key string) (*KeyValue, InfoMessage) {
+	if key == "" {
+		return nil, StatusEmptyKeyMessage
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateDeleteLog(key, true, false)})[0]
+	if result.InfoMessage != StatusOKMessage {
+		return nil, result.InfoMessage
+	}
+	return &KeyValue{Key: key, Value: result.Value}, StatusOKMessage
+}
+
+// compareAndSwap sets key if its value equals expected, or if it is absent and expected is nil.
+// If the comparison fails, the current value is returned unless the key is absent.
+func (kv *KeyValueStore) compareAndSwap(key string, expected []byte, value []byte, lease int64) (*KeyValue, InfoMessage) {
+	if key == "" {
+		return nil, StatusEmptyKeyMessage
+	}
+	if int64(len(value)) > kv.config.MaxValueSize {
+		return nil, StatusValueTooLargeMessage
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateCompareAndSwapLog(key, expected, value, lease, true, false)})[0]
+	switch {
+	case result.InfoMessage == StatusOKMessage:
+		return &KeyValue{Key: key, Value: result.Value, Lease: lease}, StatusOKMessage
+	case result.InfoMessage == StatusCompareFailedMessage && result.Value != nil:
+		return &KeyValue{Key: key, Value: result.Value}, result.InfoMessage
+	default:
+		return nil, result.InfoMessage
+	}
+}
+
+func (kv *KeyValueStore) increment(key string, delta int64) (*KeyValue, InfoMessage) {
+	if key == "" {
+		return nil, StatusEmptyKeyMessage
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateIncrementLog(key, delta, true, false)})[0]
+	if result.InfoMessage != StatusOKMessage {
+		return nil, result.InfoMessage
+	}
+	return &KeyValue{Key: key, Value: result.Value}, StatusOKMessage
+}
+
+// responseHeader describes the cluster as seen by this node
+func (kv *KeyValueStore) responseHeader() ResponseHeader {
+	kv.logMutex.RLock()
+	lastCommitIndex, err := kv.findLastCommitedLog()
+	kv.logMutex.RUnlock()
+	if err != nil {
+		ErrorLogger.Println(err)
+	}
+
+	return ResponseHeader{
+		Revision: int64(lastCommitIndex),
+		Term:     kv.Term,
+		Leader:   kv.leaderMember().Address,
+	}
+}
@@ -0,0 +1,227 @@
+package kv
+
+import (
+	"context"
+	"crypto/x509"
+	"math"
+	"net"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/peerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The peer service receives heart beats, polls, leader updates and the replication of the database
+// log of the RPC transport. The handlers share their logic with the JSON routes of the HTTP transport.
+
+type peerServer struct {
+	peerpb.UnimplementedPeerServer
+
+	kv *KeyValueStore
+}
+
+// newPeerServer does not limit the size of messages, log appends are bounded by the write queue instead
+func (kv *KeyValueStore) newPeerServer(options ...grpc.ServerOption) *grpc.Server {
+	options = append(options, grpc.MaxRecvMsgSize(math.MaxInt32), grpc.ChainUnaryInterceptor(kv.checkClusterMetadata, kv.checkPeerCertificate))
+	server := grpc.NewServer(options...)
+	peerpb.RegisterPeerServer(server, &peerServer{kv: kv})
+	return server
+}
+
+// checkClusterMetadata refuses calls of nodes of another cluster, like checkClusterHeader
+func (kv *KeyValueStore) checkClusterMetadata(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if clusterIDs := md.Get(CLUSTER_METADATA); len(clusterIDs) > 0 && clusterIDs[0] != kv.config.ClusterID {
+		ErrorLogger.Printf("Refused %s of cluster %q\n", info.FullMethod, clusterIDs[0])
+		return nil, status.Error(codes.PermissionDenied, StatusClusterMismatchMessage.Message)
+	}
+	return handler(ctx, request)
+}
+
+// checkPeerCertificate refuses calls of peers whose certificate does not match the member they claim to be,
+// like checkPeerIdentity
+func (kv *KeyValueStore) checkPeerCertificate(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var id string
+	var member *Member
+	switch request := request.(type) {
+	case *peerpb.HeartBeatRequest:
+		heartBeatMessage := HeartBeatMessage{LeaderID: request.LeaderId, Leader: fromPeerFollower(request.Leader).Member}
+		id, member = heartBeatMessage.LeaderID, heartBeatMessage.leader()
+	case *peerpb.PollRequest:
+		id, member = request.CandidateId, &Member{Address: net.IP(request.NewLeaderAddress)}
+	case *peerpb.LeaderUpdateRequest:
+		leaderMessage := fromPeerLeaderUpdate(request)
+		leader := leaderMessage.member()
+		id, member = leaderMessage.LeaderID, &leader
+	}
+
+	var certificate *x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			certificate = tlsInfo.State.VerifiedChains[0][0]
+		}
+	}
+	if err := kv.authorizePeer(certificate, id, member); err != nil {
+		ErrorLogger.Printf("Refused %s: %v\n", info.FullMethod, err)
+		return nil, status.Error(codes.PermissionDenied, StatusPeerIdentityMessage.Message)
+	}
+	return handler(ctx, request)
+}
+
+//
+// Network Administration
+//
+
+func (s *peerServer) HeartBeat(ctx context.Context, request *peerpb.HeartBeatRequest) (*peerpb.HeartBeatResponse, error) {
+	s.kv.receiveHeartBeat(HeartBeatMessage{
+		InfoMessage: StatusOKMessage,
+		LeaderID:    request.LeaderId,
+		Leader:      fromPeerFollower(request.Leader).Member,
+		Term:        request.Term,
+		Followers:   fromPeerFollowers(request.Followers),
+	})
+	return &peerpb.HeartBeatResponse{}, nil
+}
+
+func (s *peerServer) Poll(ctx context.Context, request *peerpb.PollRequest) (*peerpb.PollResponse, error) {
+	pollResponse := s.kv.receivePoll(PollRequestMessage{
+		Term:             request.Term,
+		CandidateID:      request.CandidateId,
+		NewLeaderAddress: net.IP(request.NewLeaderAddress),
+		LastLogHash:      request.LastLogHash,
+	})
+	return &peerpb.PollResponse{Vote: pollResponse.Yes, Id: pollResponse.ID}, nil
+}
+
+func (s *peerServer) LeaderUpdate(ctx context.Context, request *peerpb.LeaderUpdateRequest) (*peerpb.LeaderUpdateResponse, error) {
+	if infoMessage := s.kv.receiveLeaderUpdate(fromPeerLeaderUpdate(request)); infoMessage != StatusOKMessage {
+		return nil, status.Error(codes.InvalidArgument, infoMessage.Message)
+	}
+	return &peerpb.LeaderUpdateResponse{}, nil
+}
+
+//
+// Replication
+//
+
+func (s *peerServer) AppendEntries(ctx context.Context, request *peerpb.AppendEntriesRequest) (*peerpb.AppendEntriesResponse, error) {
+	logEntries := make([]*KeyValueLog, len(request.Entries))
+	for index, entry := range request.Entries {
+		logEntries[index] = fromPeerLogEntry(entry)
+	}
+
+	if infoMessage := s.kv.receiveLogAppend(AppendEntriesMessage{KeyValueLog: logEntries}); infoMessage == StatusBadBodyMessage {
+		return nil, status.Error(codes.InvalidArgument, infoMessage.Message)
+	} else if infoMessage != StatusOKMessage {
+		return nil, status.Error(codes.FailedPrecondition, infoMessage.Message)
+	}
+	return &peerpb.AppendEntriesResponse{}, nil
+}
+
+func (s *peerServer) Commit(ctx context.Context, request *peerpb.CommitRequest) (*peerpb.CommitResponse, error) {
+	if infoMessage := s.kv.receiveCommit(CommitLogMessage{LogHash: request.LogHash}); infoMessage != StatusOKMessage {
+		return nil, status.Error(codes.NotFound, infoMessage.Message)
+	}
+	return &peerpb.CommitResponse{}, nil
+}
+
+//
+// Utils
+//
+
+func toPeerFollower(follower Follower) *peerpb.Follower {
+	return &peerpb.Follower{
+		Id:                  follower.ID,
+		Address:             follower.Address,
+		PeerUrl:             follower.PeerURL,
+		ClientUrl:           follower.ClientURL,
+		GrpcUrl:             follower.GRPCURL,
+		RedisUrl:            follower.RedisURL,
+		MemcachedUrl:        follower.MemcachedURL,
+		LastLogHash:         follower.LastLogHash,
+		LastCommitedLogHash: follower.LastCommitedLogHash,
+	}
+}
+
+// fromPeerFollower returns the empty follower for nil, e.g. the leader of heart beats of older nodes
+func fromPeerFollower(follower *peerpb.Follower) Follower {
+	return Follower{
+		ID: follower.GetId(),
+		Member: Member{
+			Address:      net.IP(follower.GetAddress()),
+			PeerURL:      follower.GetPeerUrl(),
+			ClientURL:    follower.GetClientUrl(),
+			GRPCURL:      follower.GetGrpcUrl(),
+			RedisURL:     follower.GetRedisUrl(),
+			MemcachedURL: follower.GetMemcachedUrl(),
+		},
+		LastLogHash:         follower.GetLastLogHash(),
+		LastCommitedLogHash: follower.GetLastCommitedLogHash(),
+	}
+}
+
+func toPeerFollowers(followers []Follower) []*peerpb.Follower {
+	peerFollowers := make([]*peerpb.Follower, len(followers))
+	for index, follower := range followers {
+		peerFollowers[index] = toPeerFollower(follower)
+	}
+	return peerFollowers
+}
+
+func fromPeerFollowers(peerFollowers []*peerpb.Follower) []Follower {
+	followers := make([]Follower, len(peerFollowers))
+	for index, follower := range peerFollowers {
+		followers[index] = fromPeerFollower(follower)
+	}
+	return followers
+}
+
+func toPeerLogEntry(logEntry *KeyValueLog) *peerpb.LogEntry {
+	return &peerpb.LogEntry{
+		Hash:             logEntry.Hash,
+		Time:             timestamppb.New(logEntry.Time),
+		Operation:        logEntry.Operation,
+		Key:              logEntry.Key,
+		Value:            logEntry.Value,
+		Committed:        logEntry.Committed,
+		ContentType:      logEntry.ContentType,
+		Expected:         logEntry.Expected,
+		ExpectAbsent:     logEntry.ExpectAbsent,
+		Lease:            logEntry.Lease,
+		ExpectedRevision: logEntry.ExpectedRevision,
+	}
+}
+
+func fromPeerLogEntry(entry *peerpb.LogEntry) *KeyValueLog {
+	return &KeyValueLog{
+		Hash:             entry.Hash,
+		Time:             entry.Time.AsTime(),
+		Operation:        entry.Operation,
+		Key:              entry.Key,
+		Value:            entry.Value,
+		Committed:        entry.Committed,
+		ContentType:      entry.ContentType,
+		Expected:         entry.Expected,
+		ExpectAbsent:     entry.ExpectAbsent,
+		Lease:            entry.Lease,
+		ExpectedRevision: entry.ExpectedRevision,
+	}
+}
+
+func fromPeerLeaderUpdate(request *peerpb.LeaderUpdateRequest) LeaderUpdateMessage {
+	return LeaderUpdateMessage{
+		LeaderID:     request.LeaderId,
+		Leader:       net.IP(request.Leader),
+		PeerURL:      request.PeerUrl,
+		ClientURL:    request.ClientUrl,
+		GRPCURL:      request.GrpcUrl,
+		RedisURL:     request.RedisUrl,
+		MemcachedURL: request.MemcachedUrl,
+		Term:         request.Term,
+	}
+}
@@ -0,0 +1,426 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kvpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Every follower started by startPeerTestFollower listens on a loopback address of its own,
+// since peers are addressed by their IP on the ports of the default config
+var peerTestAddress uint32 = 1
+
+const MEMORY_PEER_TRANSPORT = "memory"
+
+// startPeerTestFollower runs a follower in this process, which receives the messages of all transports,
+// and a leader without listeners, which replicates to it over the given transport
+func startPeerTestFollower(tb testing.TB, transport string) (*KeyValueStore, *KeyValueStore) {
+	tb.Helper()
+
+	address := net.IPv4(127, 0, 0, byte(atomic.AddUint32(&peerTestAddress, 1)))
+	leaderAddress := net.IPv4(127, 0, 0, 1)
+
+	if transport == MEMORY_PEER_TRANSPORT {
+		network := NewMemoryNetwork()
+		followerTransport := network.NewTransport(address)
+		follower := InitKeyValueStoreWithTransport(false, leaderAddress, address, followerTransport)
+		leader := InitKeyValueStoreWithTransport(true, nil, leaderAddress, network.NewTransport(leaderAddress))
+		leader.Followers = []Follower{{Member: Member{Address: address}}}
+
+		go followerTransport.Serve(follower, follower.newRouter(true))
+		for _, ok := network.endpoint(address); !ok; _, ok = network.endpoint(address) {
+			time.Sleep(time.Millisecond)
+		}
+		tb.Cleanup(func() { followerTransport.Close() })
+		return follower, leader
+	}
+
+	config := DefaultConfig()
+	peerTransport := Transport(NewRPCTransport(config))
+	if transport == HTTP_PEER_TRANSPORT {
+		peerTransport = NewHTTPTransport(config)
+	}
+	follower := initKeyValueStore(config, false, leaderAddress, address)
+	leader := InitKeyValueStoreWithTransport(true, nil, leaderAddress, peerTransport)
+	leader.Followers = []Follower{{Member: Member{Address: address}}}
+
+	httpListener, err := net.Listen("tcp", address.String()+config.Port)
+	if err != nil {
+		tb.Skip(err)
+	}
+	peerListener, err := net.Listen("tcp", address.String()+config.PeerPort)
+	if err != nil {
+		httpListener.Close()
+		tb.Skip(err)
+	}
+	httpServer := &http.Server{Handler: follower.newRouter(true)}
+	peerServer := follower.newPeerServer()
+	go httpServer.Serve(httpListener)
+	go peerServer.Serve(peerListener)
+
+	tb.Cleanup(func() {
+		peerTransport.Close()
+		httpServer.Close()
+		peerServer.Stop()
+	})
+	return follower, leader
+}
+
+// replicate appends and commits a single write on the leader and all of its followers
+func (kv *KeyValueStore) replicate(logEntry *KeyValueLog) ApplyResult {
+	firstLogIndex, lastLogIndex := kv.appendLogs([]*KeyValueLog{logEntry})
+	kv.appendChange(lastLogIndex)
+	return kv.commitChange(firstLogIndex, lastLogIndex)[0]
+}
+
+func TestPeerTransports(t *testing.T) {
+	for _, transport := range []string{RPC_PEER_TRANSPORT, HTTP_PEER_TRANSPORT, MEMORY_PEER_TRANSPORT} {
+		t.Run(transport, func(t *testing.T) {
+			follower, leader := startPeerTestFollower(t, transport)
+
+			if result := leader.replicate(CreateSetLog("peer/a", []byte("1"), "text/plain", 0, true, false)); result.InfoMessage != StatusOKMessage {
+				t.Fatalf("set failed with %v", result.InfoMessage)
+			}
+			if result := leader.replicate(CreateSetLog("peer/empty", []byte{}, "", 0, true, false)); result.InfoMessage != StatusOKMessage {
+				t.Fatalf("set failed with %v", result.InfoMessage)
+			}
+
+			follower.databaseMutex.RLock()
+			value, ok := follower.Database["peer/a"]
+			empty, emptyOk := follower.Database["peer/empty"]
+			contentType := follower.ContentTypes["peer/a"]
+			follower.databaseMutex.RUnlock()
+			if !ok || string(value) != "1" || contentType != "text/plain" {
+				t.Fatalf("follower holds %q (%s), expected %q", value, contentType, "1")
+			}
+			if !emptyOk || empty == nil {
+				t.Fatalf("follower holds %v for an empty value", empty)
+			}
+			if len(follower.DatabaseLog) != len(leader.DatabaseLog) || !follower.DatabaseLog[len(follower.DatabaseLog)-1].Committed {
+				t.Fatalf("follower log has %d logs, leader log %d", len(follower.DatabaseLog), len(leader.DatabaseLog))
+			}
+
+			// Commits of logs that were not appended are refused
+			if infoMessage, err := leader.transport.Commit(follower.member(), &CommitLogMessage{LogHash: "unknown"}); err != nil || infoMessage != StatusLogNotFoundMessage {
+				t.Fatalf("commit of unknown log replied %v (%v)", infoMessage, err)
+			}
+
+			// Followers that missed the leader update learn the leader from its heart beats
+			leader.Term = 3
+			follower.setLeader("", Member{})
+			if err := leader.transport.HeartBeat(follower.member(), HeartBeatMessage{InfoMessage: StatusOKMessage, LeaderID: leader.ID, Leader: leader.member(), Term: leader.Term, Followers: leader.Followers}); err != nil {
+				t.Fatal(err)
+			}
+			if follower.Term != 3 || len(follower.Followers) != 1 || !follower.Followers[0].Address.Equal(follower.LocalAddress) {
+				t.Fatalf("follower did not adopt heart beat (term %d, followers %v)", follower.Term, follower.Followers)
+			}
+			if follower.LeaderID != leader.ID || !reflect.DeepEqual(follower.leaderMember(), leader.member()) {
+				t.Fatalf("follower did not adopt the leader of the heart beat (%s, %+v)", follower.LeaderID, follower.leaderMember())
+			}
+
+			lastCommitIndex, _ := follower.findLastCommitedLog()
+			lastLogHash := follower.DatabaseLog[lastCommitIndex].Hash
+			pollResponse, err := leader.transport.Poll(follower.member(), PollRequestMessage{Term: 4, NewLeaderAddress: leader.LocalAddress, LastLogHash: lastLogHash})
+			if err != nil || !pollResponse.Yes {
+				t.Fatalf("poll replied %v (%v), expected a vote", pollResponse, err)
+			}
+			pollResponse, err = leader.transport.Poll(follower.member(), PollRequestMessage{Term: 4, NewLeaderAddress: leader.LocalAddress, LastLogHash: lastLogHash})
+			if err != nil || pollResponse.Yes {
+				t.Fatalf("second poll of the same term replied %v (%v)", pollResponse, err)
+			}
+
+			if infoMessage, err := leader.transport.LeaderUpdate(follower.member(), LeaderUpdateMessage{Leader: leader.LocalAddress, Term: 4}); err != nil || infoMessage != StatusOKMessage {
+				t.Fatalf("leader update replied %v (%v)", infoMessage, err)
+			}
+			if follower.Term != 4 || !follower.LeaderAddress.Equal(leader.LocalAddress) {
+				t.Fatalf("follower did not accept leader update (term %d, leader %s)", follower.Term, follower.LeaderAddress)
+			}
+		})
+	}
+}
+
+func TestRegisterByID(t *testing.T) {
+	network := NewMemoryNetwork()
+	leaderAddress := net.IPv4(10, 0, 0, 1)
+	leaderTransport := network.NewTransport(leaderAddress)
+	leader := InitKeyValueStoreWithTransport(true, nil, leaderAddress, leaderTransport)
+	go leaderTransport.Serve(leader, leader.newRouter(true))
+	for _, ok := network.endpoint(leaderAddress); !ok; _, ok = network.endpoint(leaderAddress) {
+		time.Sleep(time.Millisecond)
+	}
+	t.Cleanup(leader.Stop)
+
+	// The follower restarts under another address, but with the ID from its data directory
+	config := DefaultConfig()
+	var follower *KeyValueStore
+	for _, address := range []net.IP{net.IPv4(10, 0, 0, 2), net.IPv4(10, 0, 0, 3)} {
+		follower = InitKeyValueStoreWithConfig(config, false, leaderAddress, address, network.NewTransport(address))
+		config.NodeID = follower.ID
+		if !follower.register(Member{Address: leaderAddress}) {
+			t.Fatalf("follower at %s could not register", address)
+		}
+		follower.Stop()
+	}
+
+	if len(leader.Followers) != 1 || leader.Followers[0].ID != follower.ID || !leader.Followers[0].Address.Equal(follower.LocalAddress) {
+		t.Fatalf("leader has followers %+v, expected %s at %s", leader.Followers, follower.ID, follower.LocalAddress)
+	}
+	if follower.LeaderID != leader.ID || leader.Followers[0].PeerURL != "10.0.0.3"+DefaultConfig().PeerPort {
+		t.Fatalf("follower learned leader %q, leader knows peer URL %q", follower.LeaderID, leader.Followers[0].PeerURL)
+	}
+}
+
+// Nodes that share a host listen on ports of their own and reach each other at the URLs of their members
+func TestSharedHost(t *testing.T) {
+	for offset, transport := range []string{RPC_PEER_TRANSPORT, HTTP_PEER_TRANSPORT} {
+		t.Run(transport, func(t *testing.T) {
+			nodes := make([]*KeyValueStore, 2)
+			for index := range nodes {
+				port := 18000 + 100*offset + 10*index
+				config := DefaultConfig()
+				config.PeerTransport = transport
+				config.ListenClientAddress = "127.0.0.1:" + strconv.Itoa(port)
+				config.ListenPeerAddress = "127.0.0.1:" + strconv.Itoa(port+2)
+				config.GRPCPort = ":" + strconv.Itoa(port+1)
+				config.RedisPort = ":" + strconv.Itoa(port+3)
+
+				node := InitKeyValueStoreWithConfig(config, index == 0, nil, net.IPv4(127, 0, 0, 1), newPeerTransport(config))
+				if err := node.Serve("127.0.0.1"); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(node.Stop)
+				nodes[index] = node
+
+				for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+					if resp, err := http.Get("http://" + node.ClientURL + "/status"); err == nil {
+						resp.Body.Close()
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("node did not start serving at %s", node.ClientURL)
+					}
+				}
+			}
+			leader, follower := nodes[0], nodes[1]
+
+			entry, err := ParseEntry(leader.ClientURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !follower.register(entry) || !reflect.DeepEqual(follower.leaderMember(), leader.member()) {
+				t.Fatalf("follower could not register with the leader at %s", leader.ClientURL)
+			}
+			if len(leader.Followers) != 1 || leader.Followers[0].PeerURL != follower.PeerURL {
+				t.Fatalf("leader has followers %+v, expected peer URL %s", leader.Followers, follower.PeerURL)
+			}
+
+			// The follower relays writes to the client URL of the leader, which replicates them to its peer URL
+			resp, err := http.Post("http://"+follower.ClientURL+"/write/shared", "text/plain", strings.NewReader("host"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("write on the follower responded %d", resp.StatusCode)
+			}
+			if value := follower.LocalDatabase()["shared"]; string(value) != "host" {
+				t.Fatalf("follower holds %q after the write", value)
+			}
+
+			// The client protocols are relayed to the URLs the leader advertises, not to the ports of the follower
+			connection, err := grpc.NewClient(follower.GRPCURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer connection.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := kvpb.NewKVClient(connection).Put(ctx, &kvpb.PutRequest{Key: "shared/grpc", Value: []byte("host")}); err != nil {
+				t.Fatalf("gRPC put on the follower failed: %v", err)
+			}
+
+			conn, err := net.Dial("tcp", follower.RedisURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write([]byte("SET shared/redis host\r\n")); err != nil {
+				t.Fatal(err)
+			}
+			if reply, err := bufio.NewReader(conn).ReadString('\n'); err != nil || reply != "+OK\r\n" {
+				t.Fatalf("Redis SET on the follower replied %q: %v", reply, err)
+			}
+
+			for _, key := range []string{"shared/grpc", "shared/redis"} {
+				if value := leader.LocalDatabase()[key]; string(value) != "host" {
+					t.Fatalf("leader holds %q for %s", value, key)
+				}
+			}
+		})
+	}
+}
+
+func TestPeerTransportUnreachable(t *testing.T) {
+	// Nothing listens on 127.0.0.1, the peer transport is only served by the followers of the other tests
+	for _, transport := range []Transport{NewRPCTransport(DefaultConfig()), NewHTTPTransport(DefaultConfig()), NewMemoryNetwork().NewTransport(net.IPv4(127, 0, 0, 1))} {
+		if _, err := transport.Commit(Member{Address: net.IPv4(127, 0, 0, 1)}, &CommitLogMessage{LogHash: "unknown"}); err == nil {
+			t.Fatalf("commit to an unreachable peer succeeded over %T", transport)
+		}
+		if _, err := transport.Get(Member{Address: net.IPv4(127, 0, 0, 1)}, "/status"); err == nil {
+			t.Fatalf("request to an unreachable peer succeeded over %T", transport)
+		}
+		transport.Close()
+	}
+}
+
+// Followers forward client requests to the leader over the transport of the follower
+func TestMemoryTransportProxy(t *testing.T) {
+	network := NewMemoryNetwork()
+	leaderAddress, followerAddress := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	leaderTransport, followerTransport := network.NewTransport(leaderAddress), network.NewTransport(followerAddress)
+	leader := InitKeyValueStoreWithTransport(true, nil, leaderAddress, leaderTransport)
+	follower := InitKeyValueStoreWithTransport(false, leaderAddress, followerAddress, followerTransport)
+	go leader.writePipeline()
+	go leaderTransport.Serve(leader, leader.newRouter(true))
+	go followerTransport.Serve(follower, follower.newRouter(true))
+	defer leader.Stop()
+	defer follower.Stop()
+	for _, address := range []net.IP{leaderAddress, followerAddress} {
+		for _, ok := network.endpoint(address); !ok; _, ok = network.endpoint(address) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The follower registers with the leader like any node joining the network
+	if !follower.register(Member{Address: leaderAddress}) || !follower.LeaderAddress.Equal(leaderAddress) {
+		t.Fatalf("follower registered with leader %v", follower.LeaderAddress)
+	}
+
+	resp, err := leaderTransport.Post(Member{Address: followerAddress}, "/write/proxied", "text/plain", strings.NewReader("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("proxied write responded %d", resp.StatusCode)
+	}
+
+	resp, err = followerTransport.Get(Member{Address: followerAddress}, "/raw/proxied")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	value, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(value) != "value" || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("proxied read responded %d %q (%s)", resp.StatusCode, value, resp.Header.Get("Content-Type"))
+	}
+
+	follower.databaseMutex.RLock()
+	defer follower.databaseMutex.RUnlock()
+	if string(follower.Database["proxied"]) != "value" {
+		t.Fatalf("follower holds %q", follower.Database["proxied"])
+	}
+}
+
+func TestFaultTransport(t *testing.T) {
+	follower, leader := startPeerTestFollower(t, MEMORY_PEER_TRANSPORT)
+	faults := NewFaultTransport(leader.transport)
+	leader.transport = faults
+
+	faults.Block(follower.LocalAddress)
+	if _, err := faults.Commit(follower.member(), &CommitLogMessage{LogHash: "unknown"}); err != errMessageDropped {
+		t.Fatalf("commit over a blocked link failed with %v", err)
+	}
+	if _, err := faults.Get(follower.member(), "/status"); err != errMessageDropped {
+		t.Fatalf("request over a blocked link failed with %v", err)
+	}
+
+	faults.SetLinkFaults(follower.LocalAddress, LinkFaults{Drop: 1})
+	if err := faults.HeartBeat(follower.member(), HeartBeatMessage{}); err != errMessageDropped {
+		t.Fatalf("heart beat that is always dropped failed with %v", err)
+	}
+
+	faults.SetLinkFaults(follower.LocalAddress, LinkFaults{Delay: 20 * time.Millisecond})
+	start := time.Now()
+	if infoMessage, err := faults.Commit(follower.member(), &CommitLogMessage{LogHash: "unknown"}); err != nil || infoMessage != StatusLogNotFoundMessage {
+		t.Fatalf("delayed commit replied %v (%v)", infoMessage, err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("commit was only delayed by %v", elapsed)
+	}
+
+	faults.Heal()
+	if links := faults.LinkFaults(); len(links) != 0 {
+		t.Fatalf("healed transport still has faults %v", links)
+	}
+	if infoMessage, err := faults.Commit(follower.member(), &CommitLogMessage{LogHash: "unknown"}); err != nil || infoMessage != StatusLogNotFoundMessage {
+		t.Fatalf("commit after healing replied %v (%v)", infoMessage, err)
+	}
+}
+
+//
+// Benchmarks
+//
+
+// benchmarkReplication appends and commits one log after another on a single follower. The logs are sent
+// directly, so that the time spent waiting for a majority is not part of the measurement.
+func benchmarkReplication(b *testing.B, transport string, valueSize int) {
+	follower, leader := startPeerTestFollower(b, transport)
+
+	value := bytes.Repeat([]byte("x"), valueSize)
+	b.SetBytes(int64(valueSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logEntry := CreateSetLog("peer/"+strconv.Itoa(i), value, "", 0, true, false)
+		_, lastLogIndex := leader.appendLogs([]*KeyValueLog{logEntry})
+		appendData := &AppendEntriesMessage{KeyValueLog: leader.DatabaseLog[lastLogIndex-1 : lastLogIndex+1]}
+		if infoMessage, err := leader.transport.AppendEntries(follower.member(), appendData); err != nil || infoMessage != StatusOKMessage {
+			b.Fatalf("append replied %v (%v)", infoMessage, err)
+		}
+		if infoMessage, err := leader.transport.Commit(follower.member(), &CommitLogMessage{LogHash: logEntry.Hash}); err != nil || infoMessage != StatusOKMessage {
+			b.Fatalf("commit replied %v (%v)", infoMessage, err)
+		}
+		logEntry.Committed = true
+	}
+}
+
+// Each write is appended and committed on the follower before the next one starts
+func BenchmarkReplicationRPC(b *testing.B)      { benchmarkReplication(b, RPC_PEER_TRANSPORT, 64) }
+func BenchmarkReplicationHTTP(b *testing.B)     { benchmarkReplication(b, HTTP_PEER_TRANSPORT, 64) }
+func BenchmarkReplicationLargeRPC(b *testing.B) { benchmarkReplication(b, RPC_PEER_TRANSPORT, 64<<10) }
+func BenchmarkReplicationLargeHTTP(b *testing.B) {
+	benchmarkReplication(b, HTTP_PEER_TRANSPORT, 64<<10)
+}
+
+func benchmarkHeartBeat(b *testing.B, transport string) {
+	follower, leader := startPeerTestFollower(b, transport)
+
+	heartBeatMessage := HeartBeatMessage{InfoMessage: StatusOKMessage, Followers: leader.Followers}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := leader.transport.HeartBeat(follower.member(), heartBeatMessage); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// Concurrent heart beats share a single connection with the RPC transport
+func BenchmarkHeartBeatRPC(b *testing.B)    { benchmarkHeartBeat(b, RPC_PEER_TRANSPORT) }
+func BenchmarkHeartBeatHTTP(b *testing.B)   { benchmarkHeartBeat(b, HTTP_PEER_TRANSPORT) }
+func BenchmarkHeartBeatMemory(b *testing.B) { benchmarkHeartBeat(b, MEMORY_PEER_TRANSPORT) }
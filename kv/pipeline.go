@@ -0,0 +1,241 @@
+package kv
+
+import (
+	"sync/atomic"
+)
+
+// pendingWrite is a client write waiting in the write queue of the leader.
+// done is closed as soon as all of its logs are committed and results is set.
+type pendingWrite struct {
+	logEntries []*KeyValueLog
+	results    []ApplyResult
+	done       chan struct{}
+}
+
+// queueWrite hands the logs to the write pipeline and blocks until they are committed.
+// All logs of one call end up as a contiguous block in the database log, the returned
+// results are in the same order as the logs. Nodes that are not the leader or stopped
+// refuse the write with StatusLeaderUnavailableMessage.
+func (kv *KeyValueStore) queueWrite(logEntries []*KeyValueLog) []ApplyResult {
+	write := &pendingWrite{
+		logEntries: logEntries,
+		done:       make(chan struct{}),
+	}
+	if !kv.IsLeader() || kv.stopped() {
+		write.fail(StatusLeaderUnavailableMessage)
+		return write.results
+	}
+
+	// The queue is not drained anymore once the pipeline returned, so a full queue is only waited for on the leader
+	for queued := false; !queued; {
+		select {
+		case kv.writeQueue <- write:
+			queued = true
+		default:
+			if !kv.IsLeader() || kv.stopped() {
+				write.fail(StatusLeaderUnavailableMessage)
+				return write.results
+			}
+			CLOCK.Sleep(POLL_INTERVAL)
+		}
+	}
+	// The pipeline may have returned in the meantime, nobody else would complete the write then
+	if !kv.IsLeader() || kv.stopped() {
+		kv.failQueuedWrites()
+	}
+	CLOCK.Wait(write.done)
+	return write.results
+}
+
+// fail completes the write without committing its logs, every log results in infoMessage
+func (write *pendingWrite) fail(infoMessage InfoMessage) {
+	write.results = make([]ApplyResult, len(write.logEntries))
+	for index := range write.results {
+		write.results[index].InfoMessage = infoMessage
+	}
+	close(write.done)
+}
+
+// failQueuedWrites completes all writes that are still queued once the node is no longer the leader
+func (kv *KeyValueStore) failQueuedWrites() {
+	for _, write := range kv.drainWriteQueue() {
+		write.fail(StatusLeaderUnavailableMessage)
+	}
+}
+
+// writePipeline collects the queued writes once per WriteBatchInterval and replicates
+// them as a single batch. A batch is appended without waiting for the previous batch,
+// commits however are applied strictly in log order. Writes that are still queued once
+// the leader steps down or stops are refused, and so are the batches in flight, which
+// did not reach a majority of the followers yet.
+func (kv *KeyValueStore) writePipeline() {
+	defer kv.failQueuedWrites()
+	if !kv.IsLeader() {
+		return
+	}
+
+	previousCommit := make(chan struct{})
+	close(previousCommit)
+
+	// As long as the leader lives
+	for {
+		CLOCK.Sleep(kv.config.WriteBatchInterval)
+		if !kv.IsLeader() || kv.stopped() {
+			return
+		}
+
+		writes := kv.drainWriteQueue()
+		if len(writes) == 0 {
+			continue
+		}
+
+		logEntries := make([]*KeyValueLog, 0, len(writes))
+		for _, write := range writes {
+			logEntries = append(logEntries, write.logEntries...)
+		}
+		firstLogIndex, lastLogIndex := kv.appendLogs(logEntries)
+
+		committed := make(chan struct{})
+		previousCommitted := previousCommit
+		CLOCK.Go(func() {
+			appended := kv.appendChange(lastLogIndex)
+			CLOCK.Wait(previousCommitted)
+			// Commits of later logs commit the logs before them, so nothing is committed once a batch failed
+			var results []ApplyResult
+			if appended && kv.IsLeader() && !kv.stopped() {
+				results = kv.commitChange(firstLogIndex, lastLogIndex)
+			}
+
+			close(committed)
+			if results == nil {
+				for _, write := range writes {
+					write.fail(StatusLeaderUnavailableMessage)
+				}
+				return
+			}
+			for _, write := range writes {
+				write.results = results[:len(write.logEntries)]
+				results = results[len(write.logEntries):]
+				close(write.done)
+			}
+		})
+		previousCommit = committed
+	}
+}
+
+// drainWriteQueue returns all writes that are currently queued without blocking
+func (kv *KeyValueStore) drainWriteQueue() []*pendingWrite {
+	writes := make([]*pendingWrite, 0)
+	for {
+		select {
+		case write := <-kv.writeQueue:
+			writes = append(writes, write)
+		default:
+			return writes
+		}
+	}
+}
+
+// appendLogs appends the given entries to the database log as one contiguous block
+// and returns the indices of the first and last appended entry
+func (kv *KeyValueStore) appendLogs(logEntries []*KeyValueLog) (int, int) {
+	kv.logMutex.Lock()
+	firstLogIndex := len(kv.DatabaseLog)
+	kv.DatabaseLog = append(kv.DatabaseLog, logEntries...)
+	lastLogIndex := len(kv.DatabaseLog) - 1
+	kv.logMutex.Unlock()
+
+	return firstLogIndex, lastLogIndex
+}
+
+// appendChange replicates all logs after the last committed log up to lastLogIndex
+// and waits until a majority of followers appended them, it returns false if they did not
+func (kv *KeyValueStore) appendChange(lastLogIndex int) bool {
+	kv.logMutex.RLock()
+	lastLogEntry := kv.DatabaseLog[lastLogIndex]
+	lastCommitIndex, err := kv.findLastCommitedLog()
+	appendData := &AppendEntriesMessage{KeyValueLog: kv.DatabaseLog[lastCommitIndex : lastLogIndex+1]}
+	kv.logMutex.RUnlock()
+	if err != nil {
+		ErrorLogger.Println(err)
+		return false
+	}
+
+	InfoLogger.Printf("Appending log %s", lastLogEntry.Hash)
+
+	var appendedCounter, failedCounter uint64 = 0, 0
+	followerCount := kv.Broadcast(
+		func(member Member) (InfoMessage, error) { return kv.transport.AppendEntries(member, appendData) },
+		&appendedCounter,
+		&failedCounter,
+	)
+
+	if !kv.waitForMajority(&appendedCounter, &failedCounter, followerCount) {
+		ErrorLogger.Printf("Log %s was not appended by a majority", lastLogEntry.Hash)
+		return false
+	}
+
+	InfoLogger.Printf("Log %s considered appended", lastLogEntry.Hash)
+	return true
+}
+
+// commitChange commits all logs between firstLogIndex and lastLogIndex (inclusive) and returns
+// the results of applying them, or nil if a majority of followers did not commit them. Since
+// committing a log on a follower commits every log before it, a contiguous block of logs only
+// needs a single commit round.
+func (kv *KeyValueStore) commitChange(firstLogIndex int, lastLogIndex int) []ApplyResult {
+	kv.logMutex.RLock()
+	logEntries := kv.DatabaseLog[firstLogIndex : lastLogIndex+1]
+	kv.logMutex.RUnlock()
+	lastLogEntry := logEntries[len(logEntries)-1]
+
+	InfoLogger.Printf("Commiting log %s", lastLogEntry.Hash)
+	commitData := &CommitLogMessage{LogHash: lastLogEntry.Hash}
+	var committedCounter, failedCounter uint64 = 0, 0
+	followerCount := kv.Broadcast(
+		func(member Member) (InfoMessage, error) { return kv.transport.Commit(member, commitData) },
+		&committedCounter,
+		&failedCounter,
+	)
+
+	if !kv.waitForMajority(&committedCounter, &failedCounter, followerCount) {
+		ErrorLogger.Printf("Log %s was not committed by a majority", lastLogEntry.Hash)
+		return nil
+	}
+
+	results := make([]ApplyResult, len(logEntries))
+	kv.databaseMutex.Lock()
+	for index, logEntry := range logEntries {
+		results[index] = kv.applyLog(logEntry, int64(firstLogIndex+index))
+		logEntry.Committed = true
+		kv.publishEvents(results[index].Events)
+	}
+	kv.databaseMutex.Unlock()
+	InfoLogger.Printf("Log %s is now considered committed", lastLogEntry.Hash)
+
+	return results
+}
+
+// waitForMajority blocks until a majority of followerCount followers confirmed a broadcast and returns true.
+// It returns false as soon as too many followers failed for a majority, or the node stopped leading. A leader
+// that lost its majority steps down, since the logs it could not replicate are never committed.
+// A leader without followers is the majority on its own.
+func (kv *KeyValueStore) waitForMajority(confirmedCounter *uint64, failedCounter *uint64, followerCount uint64) bool {
+	if followerCount == 0 {
+		return true
+	}
+
+	majorityCount := uint64(float32(followerCount)*0.5) + 1 // Half plus one
+	CLOCK.WaitUntil(func() bool {
+		return atomic.LoadUint64(confirmedCounter) >= majorityCount ||
+			atomic.LoadUint64(failedCounter) > followerCount-majorityCount ||
+			!kv.IsLeader() || kv.stopped()
+	})
+	if atomic.LoadUint64(confirmedCounter) >= majorityCount {
+		return true
+	}
+	if atomic.LoadUint64(failedCounter) > followerCount-majorityCount {
+		kv.stepDown()
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package kv
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Writes that are queued while the leader steps down or stops are refused instead of blocking their clients
+func TestWritePipelineStepDown(t *testing.T) {
+	address := net.IPv4(10, 0, 0, 1)
+	leader := InitKeyValueStoreWithTransport(true, nil, address, NewMemoryNetwork().NewTransport(address))
+
+	queued := &pendingWrite{logEntries: []*KeyValueLog{CreateSetLog("key", []byte("value"), "", 0, true, false)}, done: make(chan struct{})}
+	leader.writeQueue <- queued
+	leader.setLeader("", Member{})
+	leader.writePipeline()
+	select {
+	case <-queued.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued write was not completed once the pipeline returned")
+	}
+	if queued.results[0].InfoMessage != StatusLeaderUnavailableMessage {
+		t.Fatalf("queued write resulted in %+v", queued.results[0].InfoMessage)
+	}
+
+	if result := leader.queueWrite([]*KeyValueLog{CreateDeleteLog("key", true, false)})[0]; result.InfoMessage != StatusLeaderUnavailableMessage {
+		t.Fatalf("write on a former leader resulted in %+v", result.InfoMessage)
+	}
+
+	leader.setLeader(leader.ID, leader.member())
+	leader.Stop()
+	if result := leader.queueWrite([]*KeyValueLog{CreateDeleteLog("key", true, false)})[0]; result.InfoMessage != StatusLeaderUnavailableMessage {
+		t.Fatalf("write on a stopped leader resulted in %+v", result.InfoMessage)
+	}
+}
+
+// Batches that a majority of the followers does not confirm fail, the leader steps down instead of waiting forever
+func TestWritePipelineLostMajority(t *testing.T) {
+	leader := newFuzzNode(t, true)
+	leader.Followers = make([]Follower, 3)
+	for index := range leader.Followers {
+		leader.Followers[index] = Follower{ID: "unreachable", Member: Member{Address: net.IPv4(10, 0, 0, byte(index+2))}}
+	}
+
+	recorder := fuzzRequest(t, leader.newRouter(true), "POST", "/batch/write", []byte(`[{"key":"a","value":"MQ=="},{"key":"","value":"Mg=="}]`))
+	var response BatchWriteResponseMessage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusServiceUnavailable || response.Results[0].InfoMessage != StatusLeaderUnavailableMessage ||
+		response.Results[1].InfoMessage != StatusEmptyKeyMessage {
+		t.Fatalf("batch without majority responded %d with %+v", recorder.Code, response)
+	}
+	if leader.IsLeader() {
+		t.Fatal("leader without majority did not step down")
+	}
+	if value, ok := leader.LocalDatabase()["a"]; ok {
+		t.Fatalf("leader applied %q without majority", value)
+	}
+}
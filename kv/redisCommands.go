@@ -0,0 +1,464 @@
+package kv
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Write commands build the logs they are applied with, or return an error reply.
+// They are committed on their own or queued as part of a transaction.
+var redisWriteCommands = map[string]func(kv *KeyValueStore, args [][]byte) (*redisWrite, string){
+	"SET":    (*KeyValueStore).redisSet,
+	"DEL":    (*KeyValueStore).redisDel,
+	"INCR":   redisCounter(1, false),
+	"DECR":   redisCounter(-1, false),
+	"INCRBY": redisCounter(1, true),
+	"DECRBY": redisCounter(-1, true),
+}
+
+// Commands that read the database or depend on its current state run immediately
+var redisCommands = map[string]func(kv *KeyValueStore, w redisWriter, args [][]byte){
+	"GET":    (*KeyValueStore).redisGet,
+	"EXISTS": (*KeyValueStore).redisExists,
+	"KEYS":   (*KeyValueStore).redisKeys,
+	"SCAN":   (*KeyValueStore).redisScan,
+	"TTL":    (*KeyValueStore).redisTTL,
+	"EXPIRE": (*KeyValueStore).redisExpire,
+}
+
+func redisArityError(args [][]byte) string {
+	return "ERR wrong number of arguments for '" + strings.ToLower(string(args[0])) + "' command"
+}
+
+//
+// Write
+//
+
+// redisSet sets a key, optionally only if it does not exist (NX) or with a time to live (EX, PX).
+// Keys with a time to live are attached to a lease of their own.
+func (kv *KeyValueStore) redisSet(args [][]byte) (*redisWrite, string) {
+	if len(args) < 3 {
+		return nil, redisArityError(args)
+	}
+	key, value := string(args[1]), args[2]
+	if key == "" {
+		return nil, redisError(StatusEmptyKeyMessage)
+	}
+	if int64(len(value)) > kv.config.MaxValueSize {
+		return nil, redisError(StatusValueTooLargeMessage)
+	}
+
+	ifAbsent := false
+	ttl := int64(0)
+	for index := 3; index < len(args); index++ {
+		switch option := strings.ToUpper(string(args[index])); {
+		case option == "NX" && !ifAbsent:
+			ifAbsent = true
+		case (option == "EX" || option == "PX") && ttl == 0 && index+1 < len(args):
+			index++
+			duration, err := strconv.ParseInt(string(args[index]), 10, 64)
+			if err != nil || duration <= 0 {
+				return nil, "ERR invalid expire time in 'set' command"
+			}
+			// Leases count in seconds
+			if option == "PX" {
+				duration = (duration + 999) / 1000
+			}
+			ttl = duration
+		default:
+			return nil, "ERR syntax error"
+		}
+	}
+
+	logEntries := make([]*KeyValueLog, 0, 2)
+	lease := int64(0)
+	if ttl > 0 {
+		lease = newLeaseID()
+		logEntries = append(logEntries, CreateLeaseGrantLog(lease, ttl, true, false))
+	}
+	if ifAbsent {
+		logEntries = append(logEntries, CreateCompareAndSwapLog(key, nil, value, lease, true, false))
+	} else {
+		logEntries = append(logEntries, CreateSetLog(key, value, "", lease, true, false))
+	}
+
+	return &redisWrite{
+		logEntries: logEntries,
+		reply: func(w redisWriter, results []ApplyResult) {
+			switch result := results[len(results)-1]; result.InfoMessage {
+			case StatusOKMessage:
+				w.simpleString("OK")
+			case StatusCompareFailedMessage:
+				w.null()
+			default:
+				w.error(redisError(result.InfoMessage))
+			}
+		},
+	}, ""
+}
+
+// redisDel deletes all given keys and replies with the number of keys that existed
+func (kv *KeyValueStore) redisDel(args [][]byte) (*redisWrite, string) {
+	if len(args) < 2 {
+		return nil, redisArityError(args)
+	}
+
+	logEntries := make([]*KeyValueLog, len(args)-1)
+	for index, key := range args[1:] {
+		logEntries[index] = CreateDeleteLog(string(key), true, false)
+	}
+
+	return &redisWrite{
+		logEntries: logEntries,
+		reply: func(w redisWriter, results []ApplyResult) {
+			deleted := int64(0)
+			for _, result := range results {
+				if result.InfoMessage == StatusOKMessage {
+					deleted++
+				}
+			}
+			w.integer(deleted)
+		},
+	}, ""
+}
+
+// redisCounter builds INCR and DECR, or INCRBY and DECRBY if withDelta is set
+func redisCounter(sign int64, withDelta bool) func(kv *KeyValueStore, args [][]byte) (*redisWrite, string) {
+	return func(kv *KeyValueStore, args [][]byte) (*redisWrite, string) {
+		if (withDelta && len(args) != 3) || (!withDelta && len(args) != 2) {
+			return nil, redisArityError(args)
+		}
+		key := string(args[1])
+		if key == "" {
+			return nil, redisError(StatusEmptyKeyMessage)
+		}
+
+		delta := int64(1)
+		if withDelta {
+			var err error
+			delta, err = strconv.ParseInt(string(args[2]), 10, 64)
+			if err != nil || delta == math.MinInt64 {
+				return nil, redisError(StatusNotANumberMessage)
+			}
+		}
+
+		return &redisWrite{
+			logEntries: []*KeyValueLog{CreateIncrementLog(key, sign*delta, true, false)},
+			reply: func(w redisWriter, results []ApplyResult) {
+				if results[0].InfoMessage != StatusOKMessage {
+					w.error(redisError(results[0].InfoMessage))
+					return
+				}
+				value, _ := strconv.ParseInt(string(results[0].Value), 10, 64)
+				w.integer(value)
+			},
+		}, ""
+	}
+}
+
+//
+// Read
+//
+
+func (kv *KeyValueStore) redisGet(w redisWriter, args [][]byte) {
+	if len(args) != 2 {
+		w.error(redisArityError(args))
+		return
+	}
+
+	kv.databaseMutex.RLock()
+	value, ok := kv.Database[string(args[1])]
+	kv.databaseMutex.RUnlock()
+	if !ok {
+		w.null()
+		return
+	}
+	w.bulk(value)
+}
+
+// redisExists counts how many of the given keys exist, keys given several times are counted several times
+func (kv *KeyValueStore) redisExists(w redisWriter, args [][]byte) {
+	if len(args) < 2 {
+		w.error(redisArityError(args))
+		return
+	}
+
+	count := int64(0)
+	kv.databaseMutex.RLock()
+	for _, key := range args[1:] {
+		if _, ok := kv.Database[string(key)]; ok {
+			count++
+		}
+	}
+	kv.databaseMutex.RUnlock()
+	w.integer(count)
+}
+
+func (kv *KeyValueStore) redisKeys(w redisWriter, args [][]byte) {
+	if len(args) != 2 {
+		w.error(redisArityError(args))
+		return
+	}
+
+	keys := kv.redisMatchingKeys(string(args[1]))
+	w.array(len(keys))
+	for _, key := range keys {
+		w.bulk([]byte(key))
+	}
+}
+
+// redisScan pages through the sorted keys, the cursor is the number of keys already visited.
+// Keys that are deleted while scanning shift the cursor and may cause later keys to be skipped.
+func (kv *KeyValueStore) redisScan(w redisWriter, args [][]byte) {
+	if len(args) < 2 {
+		w.error(redisArityError(args))
+		return
+	}
+	cursor, err := strconv.Atoi(string(args[1]))
+	if err != nil || cursor < 0 {
+		w.error("ERR invalid cursor")
+		return
+	}
+
+	pattern, count := "*", REDIS_SCAN_COUNT
+	for index := 2; index < len(args); index += 2 {
+		if index+1 >= len(args) {
+			w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[index])) {
+		case "MATCH":
+			pattern = string(args[index+1])
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[index+1]))
+			if err != nil || count <= 0 {
+				w.error("ERR syntax error")
+				return
+			}
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	keys := kv.redisMatchingKeys("*")
+	if cursor > len(keys) {
+		cursor = len(keys)
+	}
+	end := len(keys)
+	if count < end-cursor {
+		end = cursor + count
+	}
+
+	page := make([]string, 0)
+	for index := cursor; index < end; index++ {
+		if matchRedisPattern(pattern, keys[index]) {
+			page = append(page, keys[index])
+		}
+	}
+	nextCursor := end
+	if end >= len(keys) {
+		nextCursor = 0
+	}
+
+	w.array(2)
+	w.bulk([]byte(strconv.Itoa(nextCursor)))
+	w.array(len(page))
+	for _, key := range page {
+		w.bulk([]byte(key))
+	}
+}
+
+// redisMatchingKeys returns all keys matching a glob-style pattern sorted ascending
+func (kv *KeyValueStore) redisMatchingKeys(pattern string) []string {
+	keys := make([]string, 0)
+	kv.databaseMutex.RLock()
+	for key := range kv.Database {
+		if matchRedisPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	kv.databaseMutex.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+//
+// Time To Live
+//
+
+// redisTTL replies with the remaining time to live of a key in seconds,
+// -1 if it does not expire and -2 if it does not exist
+func (kv *KeyValueStore) redisTTL(w redisWriter, args [][]byte) {
+	if len(args) != 2 {
+		w.error(redisArityError(args))
+		return
+	}
+
+	kv.databaseMutex.RLock()
+	_, ok := kv.Database[string(args[1])]
+	lease, hasLease := kv.Leases[kv.KeyLeases[string(args[1])]]
+	kv.databaseMutex.RUnlock()
+	switch {
+	case !ok:
+		w.integer(-2)
+		return
+	case !hasLease:
+		w.integer(-1)
+		return
+	}
+
+	// Leases that are not tracked yet have just been granted
+	kv.leaseMutex.Lock()
+	deadline, ok := kv.leaseDeadlines[lease.ID]
+	kv.leaseMutex.Unlock()
+	if !ok {
+		w.integer(lease.TTL)
+		return
+	}
+	w.integer(int64(math.Max(0, math.Ceil(deadline.Sub(CLOCK.Now()).Seconds()))))
+}
+
+// redisExpire attaches a key to a new lease with the given time to live, keys expire immediately
+// on a time to live of zero or less. The key is set to its current value, unless it changed meanwhile.
+func (kv *KeyValueStore) redisExpire(w redisWriter, args [][]byte) {
+	if len(args) != 3 {
+		w.error(redisArityError(args))
+		return
+	}
+	key := string(args[1])
+	ttl, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		w.error(redisError(StatusNotANumberMessage))
+		return
+	}
+
+	if ttl <= 0 {
+		result := kv.queueWrite([]*KeyValueLog{CreateDeleteLog(key, true, false)})[0]
+		if result.InfoMessage != StatusOKMessage {
+			w.integer(0)
+			return
+		}
+		w.integer(1)
+		return
+	}
+
+	lease := int64(0)
+	for {
+		keyValue, infoMessage := kv.get(key)
+		if infoMessage != StatusOKMessage {
+			w.integer(0)
+			return
+		}
+		if lease == 0 {
+			if lease, infoMessage = kv.grantLease(0, ttl); infoMessage != StatusOKMessage {
+				w.error(redisError(infoMessage))
+				return
+			}
+		}
+
+		// A nil value would expect the key to be absent
+		value := keyValue.Value
+		if value == nil {
+			value = []byte{}
+		}
+		_, infoMessage = kv.compareAndSwap(key, value, value, lease)
+		switch infoMessage {
+		case StatusOKMessage:
+			w.integer(1)
+			return
+		case StatusCompareFailedMessage:
+			continue
+		default:
+			w.error(redisError(infoMessage))
+			return
+		}
+	}
+}
+
+//
+// Patterns
+//
+
+// matchRedisPattern matches s against a glob-style pattern with the wildcards `*` and `?`,
+// character classes like `[a-z]` or `[^abc]` and `\` escaping the next character.
+// A mismatch after a `*` retries with the `*` covering one more character.
+func matchRedisPattern(pattern string, s string) bool {
+	p, i := 0, 0
+	starPattern, starIndex := -1, 0
+	for i < len(s) {
+		if p < len(pattern) && pattern[p] == '*' {
+			p++
+			starPattern, starIndex = p, i
+			continue
+		}
+		if p < len(pattern) {
+			if length, ok := matchRedisCharacter(pattern[p:], s[i]); ok {
+				p, i = p+length, i+1
+				continue
+			}
+		}
+		if starPattern < 0 {
+			return false
+		}
+		starIndex++
+		p, i = starPattern, starIndex
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchRedisCharacter matches c against the start of pattern, which is no `*`,
+// and returns the length of the matching part of the pattern
+func matchRedisCharacter(pattern string, c byte) (int, bool) {
+	switch {
+	case pattern[0] == '?':
+		return 1, true
+	case pattern[0] == '[':
+		return matchRedisClass(pattern, c)
+	case pattern[0] == '\\' && len(pattern) > 1:
+		return 2, pattern[1] == c
+	default:
+		return 1, pattern[0] == c
+	}
+}
+
+// matchRedisClass matches c against the character class at the start of pattern
+// and returns the length of the class including its brackets
+func matchRedisClass(pattern string, c byte) (int, bool) {
+	index := 1
+	negate := index < len(pattern) && pattern[index] == '^'
+	if negate {
+		index++
+	}
+
+	matched := false
+	for index < len(pattern) && pattern[index] != ']' {
+		switch {
+		case pattern[index] == '\\' && index+1 < len(pattern):
+			matched = matched || pattern[index+1] == c
+			index += 2
+		case index+2 < len(pattern) && pattern[index+1] == '-' && pattern[index+2] != ']':
+			low, high := pattern[index], pattern[index+2]
+			if low > high {
+				low, high = high, low
+			}
+			matched = matched || (c >= low && c <= high)
+			index += 3
+		default:
+			matched = matched || pattern[index] == c
+			index++
+		}
+	}
+	if index < len(pattern) {
+		// Include the closing bracket
+		index++
+	}
+	return index, matched != negate
+}
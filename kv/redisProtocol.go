@@ -0,0 +1,173 @@
+package kv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A minimal implementation of the Redis serialization protocol (RESP2). Clients send commands as arrays
+// of bulk strings or as inline commands, replies are written with a redisWriter.
+
+var errProtocol = errors.New("Protocol error")
+
+// readRedisCommand reads the next command and returns its arguments, an empty inline command yields no arguments.
+// The arguments of a command may not exceed maxSize bytes.
+func readRedisCommand(reader *bufio.Reader, maxSize int64) ([][]byte, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		// Inline commands are separated by spaces
+		fields := strings.Fields(line)
+		args := make([][]byte, len(fields))
+		for index, field := range fields {
+			args[index] = []byte(field)
+		}
+		return args, nil
+	}
+
+	count, err := parseRedisLength(line[1:], maxSize)
+	if err != nil || count < 0 {
+		return nil, errProtocol
+	}
+	// The arguments of a command are limited by the maximum request size as a whole
+	args := make([][]byte, 0, min(count, 64))
+	size := int64(0)
+	for index := int64(0); index < count; index++ {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		arg, err := readRedisBulk(reader, line[1:], maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if size += int64(len(arg)); size > maxSize {
+			return nil, errProtocol
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// copyRedisReply copies a single reply, including all nested replies, from reader to writer
+func copyRedisReply(writer *bufio.Writer, reader *bufio.Reader, maxSize int64) error {
+	line, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if len(line) == 0 {
+		return errProtocol
+	}
+	writer.WriteString(line + "\r\n")
+
+	switch line[0] {
+	case '+', '-', ':':
+		return nil
+	case '$':
+		bulk, err := readRedisBulk(reader, line[1:], maxSize)
+		if err != nil || bulk == nil {
+			return err
+		}
+		writer.Write(bulk)
+		writer.WriteString("\r\n")
+		return nil
+	case '*':
+		count, err := parseRedisLength(line[1:], maxSize)
+		if err != nil {
+			return err
+		}
+		for index := int64(0); index < count; index++ {
+			if err := copyRedisReply(writer, reader, maxSize); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errProtocol
+	}
+}
+
+// readLine reads a line terminated by CRLF without its terminator, lines may not exceed
+// the buffer size of the reader. Lines of the memcached protocol are read the same way.
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errProtocol
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// readRedisBulk reads the content of a bulk string of the given length, a negative length is a null bulk string
+func readRedisBulk(reader *bufio.Reader, rawLength string, maxSize int64) ([]byte, error) {
+	length, err := parseRedisLength(rawLength, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, nil
+	}
+
+	bulk := make([]byte, length+2)
+	if _, err := io.ReadFull(reader, bulk); err != nil {
+		return nil, err
+	}
+	if bulk[length] != '\r' || bulk[length+1] != '\n' {
+		return nil, errProtocol
+	}
+	return bulk[:length], nil
+}
+
+// parseRedisLength parses the length of a bulk string or array, which is limited by maxSize
+func parseRedisLength(rawLength string, maxSize int64) (int64, error) {
+	length, err := strconv.ParseInt(rawLength, 10, 64)
+	if err != nil || length < -1 || length > maxSize {
+		return 0, errProtocol
+	}
+	return length, nil
+}
+
+//
+// Replies
+//
+
+type redisWriter struct {
+	*bufio.Writer
+}
+
+func (w redisWriter) simpleString(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func (w redisWriter) error(message string) {
+	w.WriteString("-" + message + "\r\n")
+}
+
+func (w redisWriter) integer(i int64) {
+	w.WriteString(":" + strconv.FormatInt(i, 10) + "\r\n")
+}
+
+func (w redisWriter) bulk(b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func (w redisWriter) null() {
+	w.WriteString("$-1\r\n")
+}
+
+// array writes the header of an array, its count elements have to follow
+func (w redisWriter) array(count int) {
+	w.WriteString("*" + strconv.Itoa(count) + "\r\n")
+}
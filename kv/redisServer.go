@@ -0,0 +1,255 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+)
+
+// The Redis protocol frontend maps a subset of the Redis commands onto the replicated database.
+// Commands run on the leader, followers relay the commands of their clients to the leader.
+// Write commands are translated into logs, so that a transaction can be committed as a single
+// contiguous block of logs. Reads and commands that depend on the current value of a key can
+// therefore not be part of a transaction.
+
+// redisConnection holds the state of a single client connection
+type redisConnection struct {
+	kv     *KeyValueStore
+	reader *bufio.Reader
+	writer redisWriter
+
+	// Write commands queued since MULTI, a dirty transaction failed while queueing
+	multi  bool
+	dirty  bool
+	queued []*redisWrite
+
+	// Followers relay commands over a connection to the leader, which is reopened once the leader changes
+	leader       net.Conn
+	leaderTarget string
+	leaderReader *bufio.Reader
+	leaderWriter redisWriter
+}
+
+// redisWrite is a write command translated into logs, reply responds with the results of its logs
+type redisWrite struct {
+	logEntries []*KeyValueLog
+	reply      func(w redisWriter, results []ApplyResult)
+}
+
+var redisErrors = map[InfoMessage]string{
+	StatusNotANumberMessage:     "ERR value is not an integer or out of range",
+	StatusNumberOverflowMessage: "ERR increment or decrement would overflow",
+}
+
+// serveRedis accepts connections on listener until the node is stopped
+func (kv *KeyValueStore) serveRedis(listener net.Listener) {
+	InfoLogger.Printf("Serving Redis protocol on %s\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if kv.stopped() {
+				return
+			}
+			ErrorLogger.Println(err)
+			continue
+		}
+		go kv.handleRedisConnection(conn)
+	}
+}
+
+func (kv *KeyValueStore) handleRedisConnection(conn net.Conn) {
+	c := &redisConnection{
+		kv:     kv,
+		reader: bufio.NewReaderSize(conn, PROTOCOL_LINE_SIZE),
+		writer: redisWriter{bufio.NewWriter(conn)},
+	}
+	defer conn.Close()
+	defer c.closeLeader()
+
+	for {
+		args, err := readRedisCommand(c.reader, c.kv.config.MaxRequestSize)
+		if err == errProtocol {
+			c.writer.error("ERR Protocol error")
+			c.writer.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		name := strings.ToUpper(string(args[0]))
+		if name == "QUIT" {
+			c.writer.simpleString("OK")
+			c.writer.Flush()
+			return
+		}
+		if c.kv.IsLeader() {
+			c.closeLeader()
+			c.handleCommand(name, args)
+		} else {
+			c.relayCommand(args)
+		}
+
+		// Replies of pipelined commands are sent together
+		if c.reader.Buffered() == 0 {
+			if err := c.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleCommand runs a command on the leader
+func (c *redisConnection) handleCommand(name string, args [][]byte) {
+	switch name {
+	case "PING":
+		if len(args) > 1 {
+			c.writer.bulk(args[1])
+		} else {
+			c.writer.simpleString("PONG")
+		}
+	case "MULTI":
+		if c.multi {
+			c.writer.error("ERR MULTI calls can not be nested")
+			return
+		}
+		c.multi, c.dirty, c.queued = true, false, nil
+		c.writer.simpleString("OK")
+	case "DISCARD":
+		if !c.multi {
+			c.writer.error("ERR DISCARD without MULTI")
+			return
+		}
+		c.multi, c.dirty, c.queued = false, false, nil
+		c.writer.simpleString("OK")
+	case "EXEC":
+		if !c.multi {
+			c.writer.error("ERR EXEC without MULTI")
+			return
+		}
+		c.exec()
+	default:
+		buildWrite, isWrite := redisWriteCommands[name]
+		command, isCommand := redisCommands[name]
+
+		switch {
+		case c.multi && isWrite:
+			write, errorMessage := buildWrite(c.kv, args)
+			if errorMessage != "" {
+				c.dirty = true
+				c.writer.error(errorMessage)
+				return
+			}
+			c.queued = append(c.queued, write)
+			c.writer.simpleString("QUEUED")
+		case c.multi && isCommand:
+			c.dirty = true
+			c.writer.error("ERR Command not allowed inside a transaction")
+		case isWrite:
+			write, errorMessage := buildWrite(c.kv, args)
+			if errorMessage != "" {
+				c.writer.error(errorMessage)
+				return
+			}
+			write.reply(c.writer, c.kv.queueWrite(write.logEntries))
+		case isCommand:
+			command(c.kv, c.writer, args)
+		default:
+			if c.multi {
+				c.dirty = true
+			}
+			c.writer.error("ERR unknown command '" + strings.ToLower(name) + "'")
+		}
+	}
+}
+
+// exec commits the logs of all queued commands as a single block, so no other
+// write and no read can observe only a part of the transaction
+func (c *redisConnection) exec() {
+	queued, dirty := c.queued, c.dirty
+	c.multi, c.dirty, c.queued = false, false, nil
+
+	if dirty {
+		c.writer.error("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+
+	logEntries := make([]*KeyValueLog, 0)
+	for _, write := range queued {
+		logEntries = append(logEntries, write.logEntries...)
+	}
+	var results []ApplyResult
+	if len(logEntries) > 0 {
+		results = c.kv.queueWrite(logEntries)
+	}
+
+	c.writer.array(len(queued))
+	for _, write := range queued {
+		write.reply(c.writer, results[:len(write.logEntries)])
+		results = results[len(write.logEntries):]
+	}
+}
+
+//
+// Relay
+//
+
+// relayCommand sends a command to the leader and passes its reply on to the client
+func (c *redisConnection) relayCommand(args [][]byte) {
+	target := c.kv.leaderMember().RedisURL
+	if c.leader != nil && c.leaderTarget != target {
+		c.closeLeader()
+	}
+	if c.leader == nil {
+		conn, err := c.kv.dialLeader(target)
+		if err != nil {
+			ErrorLogger.Println(err)
+			c.writer.error(redisError(StatusLeaderUnavailableMessage))
+			return
+		}
+		InfoLogger.Println("Relaying Redis connection to leader")
+		c.leader = conn
+		c.leaderTarget = target
+		c.leaderReader = bufio.NewReaderSize(conn, PROTOCOL_LINE_SIZE)
+		c.leaderWriter = redisWriter{bufio.NewWriter(conn)}
+	}
+
+	c.leaderWriter.array(len(args))
+	for _, arg := range args {
+		c.leaderWriter.bulk(arg)
+	}
+
+	// The reply is only passed on once it was read completely
+	var reply bytes.Buffer
+	replyWriter := bufio.NewWriter(&reply)
+	err := c.leaderWriter.Flush()
+	if err == nil {
+		err = copyRedisReply(replyWriter, c.leaderReader, c.kv.config.MaxRequestSize)
+	}
+	if err != nil {
+		ErrorLogger.Println(err)
+		c.closeLeader()
+		c.writer.error(redisError(StatusLeaderUnavailableMessage))
+		return
+	}
+	replyWriter.Flush()
+	c.writer.Write(reply.Bytes())
+}
+
+// closeLeader closes the connection to the leader, transactions started on it are discarded
+func (c *redisConnection) closeLeader() {
+	if c.leader != nil {
+		c.leader.Close()
+		c.leader = nil
+	}
+}
+
+func redisError(infoMessage InfoMessage) string {
+	if message, ok := redisErrors[infoMessage]; ok {
+		return message
+	}
+	return "ERR " + infoMessage.Message
+}
@@ -1,30 +1,78 @@
 package kv
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
-	"os"
 	"reflect"
-	"time"
-
-	"github.com/gorilla/mux"
+	"strconv"
+	"strings"
 )
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
 	RespondJSON(w, http.StatusOK, StatusOKMessage)
 }
 
+// checkClusterHeader refuses the peer messages of nodes of another cluster. Requests without cluster ID
+// are accepted, responses carry the cluster ID of the node so that joining nodes can check it as well.
+func (kv *KeyValueStore) checkClusterHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(CLUSTER_HEADER, kv.config.ClusterID)
+		if clusterID := r.Header.Get(CLUSTER_HEADER); clusterID != "" && clusterID != kv.config.ClusterID {
+			ErrorLogger.Printf("Refused %s of cluster %q\n", r.URL.Path, clusterID)
+			RespondJSON(w, http.StatusConflict, StatusClusterMismatchMessage)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkPeerIdentity refuses peer messages of nodes whose certificate does not match the member known under id
+// and member, or the leader if both are empty
+func (kv *KeyValueStore) checkPeerIdentity(w http.ResponseWriter, r *http.Request, id string, member *Member) bool {
+	return checkPeerAuthorization(w, r, kv.authorizePeer(peerCertificate(r), id, member))
+}
+
+// checkPeerAuthorization refuses the peer message if it was not authorized
+func checkPeerAuthorization(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err != nil {
+		ErrorLogger.Printf("Refused %s: %v\n", r.URL.Path, err)
+		RespondJSON(w, http.StatusForbidden, StatusPeerIdentityMessage)
+		return false
+	}
+	return true
+}
+
+// peerCertificate returns the verified certificate of the peer, or nil if it did not present one
+func peerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return r.TLS.VerifiedChains[0][0]
+	}
+	return nil
+}
+
 func (kv *KeyValueStore) handleRegister(w http.ResponseWriter, r *http.Request) {
-	if !kv.Leader {
+	if !kv.IsLeader() {
 		RespondJSON(w, http.StatusServiceUnavailable, IPMessage{
 			InfoMessage: StatusMovedMessage,
-			IP:          kv.LeaderAddress,
+			IP:          kv.leaderMember().Address,
+			ClientURL:   kv.leaderMember().ClientURL,
 		})
 		return
 	}
 
+	id := r.FormValue("id")
+	if id == "" {
+		RespondJSON(w, http.StatusBadRequest, InfoMessage{
+			Status:  "error",
+			Message: "No node ID provided"})
+		return
+	}
+
 	rawAddress := r.FormValue("ip")
 	if rawAddress == "" {
 		RespondJSON(w, http.StatusBadRequest, InfoMessage{
@@ -41,19 +89,48 @@ func (kv *KeyValueStore) handleRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	member := Member{
+		Address:      address,
+		PeerURL:      r.FormValue("peerURL"),
+		ClientURL:    r.FormValue("clientURL"),
+		GRPCURL:      r.FormValue("grpcURL"),
+		RedisURL:     r.FormValue("redisURL"),
+		MemcachedURL: r.FormValue("memcachedURL"),
+	}
+
 	kv.logMutex.RLock()
 	kv.followerMutex.Lock()
-	kv.Followers = append(
-		kv.Followers,
-		Follower{
-			Address:             address,
-			LastLogHash:         INITIAL_LOG.Hash,
-			LastCommitedLogHash: INITIAL_LOG.Hash,
-		},
-	)
+	// Nodes that restart register again under the same ID, possibly with another address if their certificate allows
+	registeredIndex := -1
+	var registered *Member
+	for index := range kv.Followers {
+		if kv.Followers[index].ID == id {
+			registeredIndex = index
+			registered = &kv.Followers[index].Member
+		}
+	}
+	if !checkPeerAuthorization(w, r, kv.authorizeRegistration(peerCertificate(r), member, registered)) {
+		kv.followerMutex.Unlock()
+		kv.logMutex.RUnlock()
+		return
+	}
+
+	follower := Follower{
+		ID:                  id,
+		Member:              member,
+		LastLogHash:         INITIAL_LOG.Hash,
+		LastCommitedLogHash: INITIAL_LOG.Hash,
+	}
+	if registeredIndex >= 0 {
+		kv.Followers[registeredIndex] = follower
+	} else {
+		kv.Followers = append(kv.Followers, follower)
+	}
 	kv.followerMutex.Unlock()
 	RespondJSON(w, http.StatusOK, RegistrationResponseMessage{
 		InfoMessage: StatusOKMessage,
+		LeaderID:    kv.ID,
+		Leader:      kv.member(),
 		DatabaseLog: kv.DatabaseLog,
 	})
 	jsonContent, _ := json.Marshal(kv.DatabaseLog)
@@ -62,26 +139,38 @@ func (kv *KeyValueStore) handleRegister(w http.ResponseWriter, r *http.Request)
 }
 
 func (kv *KeyValueStore) handleHeartBeat(w http.ResponseWriter, r *http.Request) {
-	if kv.Leader {
-		return
-	}
-
 	heartBeatMessageBytes, _ := ioutil.ReadAll(r.Body)
 	var heartBeatMessage HeartBeatMessage
 	if err := json.Unmarshal(heartBeatMessageBytes, &heartBeatMessage); err != nil {
 		ErrorLogger.Println("Unspecified hearbeat message format")
-		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
+		return
+	}
+	if !kv.checkPeerIdentity(w, r, heartBeatMessage.LeaderID, heartBeatMessage.leader()) {
+		return
+	}
+
+	kv.receiveHeartBeat(heartBeatMessage)
+	RespondJSON(w, http.StatusOK, StatusOKMessage)
+}
+
+// receiveHeartBeat takes over the term, followers and leader of the leader, regardless of the transport it arrived with.
+// Followers that missed the leader update of a new leader learn about it this way.
+func (kv *KeyValueStore) receiveHeartBeat(heartBeatMessage HeartBeatMessage) {
+	if kv.IsLeader() {
 		return
 	}
 
+	kv.followerMutex.Lock()
 	kv.Term = heartBeatMessage.Term
 	if !reflect.DeepEqual(kv.Followers, heartBeatMessage.Followers) {
-		kv.followerMutex.Lock()
 		kv.Followers = heartBeatMessage.Followers
-		kv.followerMutex.Unlock()
 	}
-	kv.lastLeaderHeartBeat = time.Now()
-	RespondJSON(w, http.StatusOK, StatusOKMessage)
+	kv.followerMutex.Unlock()
+	if leader := heartBeatMessage.leader(); heartBeatMessage.LeaderID != "" && leader != nil {
+		kv.setLeader(heartBeatMessage.LeaderID, *leader)
+	}
+	kv.lastLeaderHeartBeat = CLOCK.Now()
 }
 
 //
@@ -89,8 +178,8 @@ func (kv *KeyValueStore) handleHeartBeat(w http.ResponseWriter, r *http.Request)
 //
 
 func (kv *KeyValueStore) handlePoll(w http.ResponseWriter, r *http.Request) {
-	if kv.Leader {
-		RespondJSON(w, http.StatusOK, PollResponseNo)
+	if kv.IsLeader() {
+		RespondJSON(w, http.StatusOK, PollResponseMessage{Yes: false, ID: kv.ID})
 		return
 	}
 
@@ -109,18 +198,40 @@ func (kv *KeyValueStore) handlePoll(w http.ResponseWriter, r *http.Request) {
 	if err := json.Unmarshal([]byte(pollParameters[0]), &pollRequest); err != nil {
 		ErrorLogger.Println(err)
 		ErrorLogger.Println("Unspecified poll request message format")
-		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		RespondJSON(w, http.StatusBadRequest, StatusBadURLParameterMessage)
 		return
 	}
+	if !kv.checkPeerIdentity(w, r, pollRequest.CandidateID, &Member{Address: pollRequest.NewLeaderAddress}) {
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, kv.receivePoll(pollRequest))
+}
+
+// receivePoll votes on a poll of a candidate
+func (kv *KeyValueStore) receivePoll(pollRequest PollRequestMessage) PollResponseMessage {
+	if kv.IsLeader() {
+		return PollResponseMessage{Yes: false, ID: kv.ID}
+	}
 
-	if pollRequest.Term >= kv.nextVoteTerm && pollRequest.LastLogHash == kv.DatabaseLog[kv.findLastCommitedLog()].Hash {
+	kv.logMutex.RLock()
+	lastLogHash := ""
+	lastCommitIndex, err := kv.findLastCommitedLog()
+	if err == nil {
+		lastLogHash = kv.DatabaseLog[lastCommitIndex].Hash
+	}
+	kv.logMutex.RUnlock()
+	if err != nil {
+		ErrorLogger.Println(err)
+	}
+
+	if err == nil && pollRequest.Term >= kv.nextVoteTerm && pollRequest.LastLogHash == lastLogHash {
 		kv.nextVoteTerm = pollRequest.Term + 1
-		InfoLogger.Printf("Vote `Yes` (Poll Term: %d, Candidate: %s, Local Term: %d, Next Vote Term: %d)\n", pollRequest.Term, pollRequest.NewLeaderAddress, kv.Term, kv.nextVoteTerm)
-		RespondJSON(w, http.StatusOK, PollResponseYes)
-	} else {
-		InfoLogger.Printf("Vote `No`  (Poll Term: %d, Candidate: %s, Local Term: %d, Next Vote Term: %d)\n", pollRequest.Term, pollRequest.NewLeaderAddress, kv.Term, kv.nextVoteTerm)
-		RespondJSON(w, http.StatusOK, PollResponseNo)
+		InfoLogger.Printf("Vote `Yes` (Poll Term: %d, Candidate: %s at %s, Local Term: %d, Next Vote Term: %d)\n", pollRequest.Term, pollRequest.CandidateID, pollRequest.NewLeaderAddress, kv.Term, kv.nextVoteTerm)
+		return PollResponseMessage{Yes: true, ID: kv.ID}
 	}
+	InfoLogger.Printf("Vote `No`  (Poll Term: %d, Candidate: %s at %s, Local Term: %d, Next Vote Term: %d)\n", pollRequest.Term, pollRequest.CandidateID, pollRequest.NewLeaderAddress, kv.Term, kv.nextVoteTerm)
+	return PollResponseMessage{Yes: false, ID: kv.ID}
 }
 
 func (kv *KeyValueStore) handleLeaderUpdate(w http.ResponseWriter, r *http.Request) {
@@ -128,23 +239,41 @@ func (kv *KeyValueStore) handleLeaderUpdate(w http.ResponseWriter, r *http.Reque
 	var leaderMessage LeaderUpdateMessage
 	if err := json.Unmarshal(leaderMessageBytes, &leaderMessage); err != nil {
 		ErrorLogger.Println("Unspecified leader update message format")
-		os.Exit(1)
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
+		return
+	}
+	if leader := leaderMessage.member(); !kv.checkPeerIdentity(w, r, leaderMessage.LeaderID, &leader) {
+		return
 	}
 
-	kv.Leader = false
-	kv.LeaderAddress = leaderMessage.Leader
-	kv.Term = leaderMessage.Term
-	kv.lastLeaderHeartBeat = time.Now()
+	if infoMessage := kv.receiveLeaderUpdate(leaderMessage); infoMessage != StatusOKMessage {
+		RespondJSON(w, http.StatusBadRequest, infoMessage)
+		return
+	}
 	RespondJSON(w, http.StatusOK, StatusOKMessage)
+}
+
+// receiveLeaderUpdate follows the new leader, updates without a valid leader address are refused
+func (kv *KeyValueStore) receiveLeaderUpdate(leaderMessage LeaderUpdateMessage) InfoMessage {
+	if len(leaderMessage.Leader) != net.IPv4len && len(leaderMessage.Leader) != net.IPv6len {
+		ErrorLogger.Println("Leader update without leader address")
+		return StatusBadBodyMessage
+	}
 
-	InfoLogger.Printf("Accepted new leader (%s)\n", kv.LeaderAddress.String())
+	kv.setLeader(leaderMessage.LeaderID, leaderMessage.member())
+	kv.Term = leaderMessage.Term
+	kv.lastLeaderHeartBeat = CLOCK.Now()
+
+	InfoLogger.Printf("Accepted new leader (%s at %s)\n", leaderMessage.LeaderID, leaderMessage.Leader.String())
+	return StatusOKMessage
 }
 
 func (kv *KeyValueStore) handleLeaderRequest(w http.ResponseWriter, r *http.Request) {
 	InfoLogger.Println("Returning leader address")
 	RespondJSON(w, http.StatusOK, IPMessage{
 		InfoMessage: StatusOKMessage,
-		IP:          kv.LeaderAddress,
+		IP:          kv.leaderMember().Address,
+		ClientURL:   kv.leaderMember().ClientURL,
 	})
 }
 
@@ -153,17 +282,20 @@ func (kv *KeyValueStore) handleLeaderRequest(w http.ResponseWriter, r *http.Requ
 //
 
 func (kv *KeyValueStore) handleRead(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
+	key, ok := requestKey(r)
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, ReadMessage{InfoMessage: StatusMissingURLParameterMessage})
+		return
+	}
 
-	if kv.Leader {
+	if kv.IsLeader() {
 		kv.databaseMutex.RLock()
 		value, ok := kv.Database[key]
 		kv.databaseMutex.RUnlock()
 		if ok {
 			RespondJSON(w, http.StatusOK, ReadMessage{
 				InfoMessage: StatusOKMessage,
-				Value:       value,
+				Value:       string(value),
 			})
 		} else {
 			RespondJSON(w, http.StatusNotFound, ReadMessage{
@@ -173,7 +305,7 @@ func (kv *KeyValueStore) handleRead(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		InfoLogger.Println("Proxying read request to leader")
-		proxyResp, err := http.Get(GetURL(kv.LeaderAddress, "/read/"+key))
+		proxyResp, err := kv.transport.Get(kv.leaderMember(), r.URL.RequestURI())
 		if err != nil {
 			ErrorLogger.Println(err)
 			RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
@@ -194,45 +326,108 @@ func (kv *KeyValueStore) handleRead(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleRawRead responds with the value itself and the content type it was written with,
+// which keeps binary values intact
+func (kv *KeyValueStore) handleRawRead(w http.ResponseWriter, r *http.Request) {
+	key, ok := requestKey(r)
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, StatusMissingURLParameterMessage)
+		return
+	}
+
+	if kv.IsLeader() {
+		kv.databaseMutex.RLock()
+		value, ok := kv.Database[key]
+		contentType, hasContentType := kv.ContentTypes[key]
+		kv.databaseMutex.RUnlock()
+		if !ok {
+			RespondJSON(w, http.StatusNotFound, StatusValueNotFoundMessage)
+			return
+		}
+		if !hasContentType {
+			contentType = DEFAULT_CONTENT_TYPE
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(value)
+	} else {
+		InfoLogger.Println("Proxying raw read request to leader")
+		proxyResp, err := kv.transport.Get(kv.leaderMember(), r.URL.RequestURI())
+		if err != nil {
+			ErrorLogger.Println(err)
+			RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+			return
+		}
+		defer proxyResp.Body.Close()
+
+		value, _ := ioutil.ReadAll(proxyResp.Body)
+		w.Header().Set("Content-Type", proxyResp.Header.Get("Content-Type"))
+		w.WriteHeader(proxyResp.StatusCode)
+		w.Write(value)
+		InfoLogger.Println("Proxy raw read request finished and successful")
+	}
+}
+
 //
 // Write
 //
 
-func (kv *KeyValueStore) findLastCommitedLog() int {
-	// kv.logMutex.RLock()
+// findLastCommitedLog returns the index of the last committed log, the caller holds logMutex
+func (kv *KeyValueStore) findLastCommitedLog() (int, error) {
 	for i := len(kv.DatabaseLog) - 1; i >= 0; i-- {
 		if kv.DatabaseLog[i].Committed {
-			// kv.logMutex.RUnlock()
-			return i
+			return i, nil
 		}
 	}
 	// Should never happen, since log is always initialized with a commited entry
-	os.Exit(1)
-	return 0
+	return 0, fmt.Errorf("database log of %d entries has no committed log", len(kv.DatabaseLog))
 }
 
 func (kv *KeyValueStore) handleLogAppend(w http.ResponseWriter, r *http.Request) {
+	if !kv.checkPeerIdentity(w, r, "", nil) {
+		return
+	}
+
 	logBytes, _ := ioutil.ReadAll(r.Body)
 	var logMessages AppendEntriesMessage
 	if err := json.Unmarshal(logBytes, &logMessages); err != nil {
 		ErrorLogger.Println("Unspecified key value log message format")
-		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
+		return
+	}
+
+	if infoMessage := kv.receiveLogAppend(logMessages); infoMessage == StatusBadBodyMessage {
+		RespondJSON(w, http.StatusBadRequest, infoMessage)
+		return
+	} else if infoMessage != StatusOKMessage {
+		RespondJSON(w, http.StatusInternalServerError, infoMessage)
 		return
 	}
+	RespondJSON(w, http.StatusOK, StatusOKMessage)
+}
 
+// receiveLogAppend appends the logs following the last committed log of the leader, which is the first given log.
+// Malformed messages are refused with StatusBadBodyMessage before the database log is touched.
+func (kv *KeyValueStore) receiveLogAppend(logMessages AppendEntriesMessage) InfoMessage {
 	if len(logMessages.KeyValueLog) < 2 {
 		ErrorLogger.Println("Not enough log messages provided")
-		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
-		return
-	} else if !logMessages.KeyValueLog[0].Committed {
+		return StatusBadBodyMessage
+	}
+	for _, logMessage := range logMessages.KeyValueLog {
+		if logMessage == nil || logMessage.Hash == "" {
+			ErrorLogger.Println("Log message without hash")
+			return StatusBadBodyMessage
+		}
+	}
+	if !logMessages.KeyValueLog[0].Committed {
 		ErrorLogger.Println("First log message should already be committed")
-		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
-		return
+		return StatusBadBodyMessage
 	}
 
 	// Note: Since the log is append only, it is safe to determine the startIndex here
 	//       and give away the lock afterwards.
-	// kv.logMutex.RLock()
+	kv.logMutex.RLock()
 	startIndex := 0
 	found := false
 	for i := len(kv.DatabaseLog) - 1; i >= 0; i-- {
@@ -241,12 +436,11 @@ func (kv *KeyValueStore) handleLogAppend(w http.ResponseWriter, r *http.Request)
 			found = true
 		}
 	}
-	// kv.logMutex.RUnlock()
+	kv.logMutex.RUnlock()
 
 	if !found {
 		ErrorLogger.Println("Unknown log reference point")
-		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
-		return
+		return StatusInternalServerErrorMessage
 	}
 
 	kv.logMutex.Lock()
@@ -255,27 +449,41 @@ func (kv *KeyValueStore) handleLogAppend(w http.ResponseWriter, r *http.Request)
 			if kv.DatabaseLog[startIndex+index].Hash != logMessage.Hash {
 				kv.logMutex.Unlock()
 				ErrorLogger.Println("Hash does not match")
-				RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
-				return
+				return StatusInternalServerErrorMessage
 			}
 		} else {
+			// The leader may have committed the log since it was sent, it is still only applied once its commit arrives
+			logMessage.Committed = false
 			kv.DatabaseLog = append(kv.DatabaseLog, logMessage)
 		}
 	}
 	kv.logMutex.Unlock()
-	RespondJSON(w, http.StatusOK, StatusOKMessage)
 	InfoLogger.Printf("Appended up to log %s\n", logMessages.KeyValueLog[len(logMessages.KeyValueLog)-1].Hash)
+	return StatusOKMessage
 }
 
 func (kv *KeyValueStore) handleCommit(w http.ResponseWriter, r *http.Request) {
+	if !kv.checkPeerIdentity(w, r, "", nil) {
+		return
+	}
+
 	commitLogBytes, _ := ioutil.ReadAll(r.Body)
 	var commitLogMessage CommitLogMessage
 	if err := json.Unmarshal(commitLogBytes, &commitLogMessage); err != nil {
 		ErrorLogger.Println("Unspecified commit log message format")
-		RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
+		RespondJSON(w, http.StatusBadRequest, StatusBadBodyMessage)
 		return
 	}
 
+	if infoMessage := kv.receiveCommit(commitLogMessage); infoMessage != StatusOKMessage {
+		RespondJSON(w, http.StatusNotFound, infoMessage)
+		return
+	}
+	RespondJSON(w, http.StatusOK, StatusOKMessage)
+}
+
+// receiveCommit applies all logs up to the given log, it fails if the log is not appended yet
+func (kv *KeyValueStore) receiveCommit(commitLogMessage CommitLogMessage) InfoMessage {
 	kv.logMutex.Lock()
 
 	// Determine both the index for the log that is to be committed..
@@ -287,97 +495,68 @@ func (kv *KeyValueStore) handleCommit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if endLogIndex == 0 {
-		RespondJSON(w, http.StatusNotFound, StatusLogNotFoundMessage)
-		return
+	// The commit may overtake the append of the same log, the leader retries it in that case
+	if endLogIndex < 0 {
+		kv.logMutex.Unlock()
+		return StatusLogNotFoundMessage
 	}
 
-	// ..and index for the first uncommited log
+	// ..and index for the first uncommited log. Commits may arrive out of order, logs committed
+	// by a later commit are not applied again.
 	beginLogIndex := 0
-	for ; kv.DatabaseLog[beginLogIndex].Committed && beginLogIndex < endLogIndex; beginLogIndex++ {
+	for ; beginLogIndex <= endLogIndex && kv.DatabaseLog[beginLogIndex].Committed; beginLogIndex++ {
 	}
 
 	InfoLogger.Printf("Committing from %d to %d", beginLogIndex, endLogIndex)
 
 	kv.databaseMutex.Lock()
 	for i := beginLogIndex; i <= endLogIndex; i++ {
-		kv.Database[kv.DatabaseLog[i].Key] = kv.DatabaseLog[i].Value
+		result := kv.applyLog(kv.DatabaseLog[i], int64(i))
 		kv.DatabaseLog[i].Committed = true
+		kv.publishEvents(result.Events)
 	}
 	kv.databaseMutex.Unlock()
 
 	kv.logMutex.Unlock()
 
-	RespondJSON(w, http.StatusOK, StatusOKMessage)
 	InfoLogger.Printf("Commited up to log %s\n", commitLogMessage.LogHash)
+	return StatusOKMessage
 }
 
-func (kv *KeyValueStore) distributeChange(logEntry *KeyValueLog, appendedLogIndex int) {
-	//
-	// Append from last known log
-	//
-
-	InfoLogger.Printf("Appending log %s", logEntry.Hash)
-
-	lastCommitIndex := kv.findLastCommitedLog()
-	appendData := &AppendEntriesMessage{KeyValueLog: kv.DatabaseLog[lastCommitIndex : appendedLogIndex+1]}
-	var appendedCounter uint64 = 0
-	followerCount := kv.Broadcast(
-		"/log/append",
-		appendData,
-		&appendedCounter,
-	)
-
-	majorityCount := uint64(float32(followerCount)*0.5) + 1 // Half plus one
-	for appendedCounter < majorityCount {
-		time.Sleep(100 * time.Microsecond)
-	}
-
-	InfoLogger.Printf("Log %s considered appended", logEntry.Hash)
-
-	//
-	// Commit new log
-	//
-
-	InfoLogger.Printf("Commiting log %s", logEntry.Hash)
-	commitData := &CommitLogMessage{LogHash: logEntry.Hash}
-	var committedCounter uint64 = 0
-	followerCount = kv.Broadcast(
-		"/log/commit",
-		commitData,
-		&committedCounter,
-	)
-
-	majorityCount = uint64(float32(followerCount)*0.5) + 1 // Half plus one
-	for committedCounter < majorityCount {
-		time.Sleep(100 * time.Microsecond)
+func (kv *KeyValueStore) handleWrite(w http.ResponseWriter, r *http.Request) {
+	key, ok := requestKey(r)
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, StatusMissingURLParameterMessage)
+		return
 	}
 
-	kv.databaseMutex.Lock()
-	kv.Database[logEntry.Key] = logEntry.Value
-	kv.databaseMutex.Unlock()
-	logEntry.Committed = true
-	InfoLogger.Printf("Log %s is now considered committed", logEntry.Hash)
-}
-
-func (kv *KeyValueStore) handleWrite(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
+	if kv.IsLeader() {
+		var lease int64 = 0
+		if rawLease := r.URL.Query().Get("lease"); rawLease != "" {
+			var err error
+			lease, err = strconv.ParseInt(rawLease, 10, 64)
+			if err != nil {
+				RespondJSON(w, http.StatusBadRequest, StatusBadURLParameterMessage)
+				return
+			}
+		}
 
-	if kv.Leader {
 		value, _ := ioutil.ReadAll(r.Body)
-		logEntry := CreateKeyValueLog(key, string(value), true, false)
-
-		kv.logMutex.Lock()
-		kv.DatabaseLog = append(kv.DatabaseLog, logEntry)
-		appendedLogIndex := len(kv.DatabaseLog) - 1
-		kv.logMutex.Unlock()
+		if int64(len(value)) > kv.config.MaxValueSize {
+			RespondJSON(w, http.StatusRequestEntityTooLarge, StatusValueTooLargeMessage)
+			return
+		}
+		logEntry := CreateSetLog(key, value, r.Header.Get("Content-Type"), lease, true, false)
 
-		kv.distributeChange(logEntry, appendedLogIndex)
+		result := kv.queueWrite([]*KeyValueLog{logEntry})[0]
+		if result.InfoMessage != StatusOKMessage {
+			RespondJSON(w, writeStatusCode(result.InfoMessage, http.StatusNotFound), result.InfoMessage)
+			return
+		}
 		RespondJSON(w, http.StatusOK, StatusOKMessage)
 		return
 	} else {
-		proxyResp, err := http.Post(GetURL(kv.LeaderAddress, "/write/"+key), "application/json", r.Body)
+		proxyResp, err := kv.transport.Post(kv.leaderMember(), r.URL.RequestURI(), r.Header.Get("Content-Type"), r.Body)
 		if err != nil {
 			ErrorLogger.Println(err)
 			RespondJSON(w, http.StatusInternalServerError, StatusInternalServerErrorMessage)
@@ -397,3 +576,129 @@ func (kv *KeyValueStore) handleWrite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (kv *KeyValueStore) handleDelete(w http.ResponseWriter, r *http.Request) {
+	key, ok := requestKey(r)
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, ReadMessage{InfoMessage: StatusMissingURLParameterMessage})
+		return
+	}
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying delete request to leader")
+		kv.proxyRequest(w, r.URL.RequestURI(), nil)
+		return
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateDeleteLog(key, true, false)})[0]
+	RespondJSON(w, writeStatusCode(result.InfoMessage, http.StatusNotFound), ReadMessage{
+		InfoMessage: result.InfoMessage,
+		Value:       string(result.Value),
+	})
+}
+
+// handleCompareAndSwap responds with the current value if the comparison fails
+func (kv *KeyValueStore) handleCompareAndSwap(w http.ResponseWriter, r *http.Request) {
+	key, ok := requestKey(r)
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, ReadMessage{InfoMessage: StatusMissingURLParameterMessage})
+		return
+	}
+	compareAndSwapBytes, _ := ioutil.ReadAll(r.Body)
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying compare and swap request to leader")
+		kv.proxyRequest(w, r.URL.RequestURI(), compareAndSwapBytes)
+		return
+	}
+
+	var compareAndSwap CompareAndSwapMessage
+	if err := json.Unmarshal(compareAndSwapBytes, &compareAndSwap); err != nil {
+		RespondJSON(w, http.StatusBadRequest, ReadMessage{InfoMessage: StatusBadBodyMessage})
+		return
+	}
+
+	if int64(len(compareAndSwap.Value)) > kv.config.MaxValueSize {
+		RespondJSON(w, http.StatusRequestEntityTooLarge, ReadMessage{InfoMessage: StatusValueTooLargeMessage})
+		return
+	}
+
+	var expected []byte = nil
+	if compareAndSwap.Expected != nil {
+		expected = []byte(*compareAndSwap.Expected)
+	}
+	result := kv.queueWrite([]*KeyValueLog{CreateCompareAndSwapLog(key, expected, []byte(compareAndSwap.Value), compareAndSwap.Lease, true, false)})[0]
+	statusCode := writeStatusCode(result.InfoMessage, http.StatusNotFound)
+	if result.InfoMessage == StatusCompareFailedMessage {
+		statusCode = http.StatusConflict
+	}
+	RespondJSON(w, statusCode, ReadMessage{
+		InfoMessage: result.InfoMessage,
+		Value:       string(result.Value),
+	})
+}
+
+//
+// Increment
+//
+
+func (kv *KeyValueStore) handleIncrement(w http.ResponseWriter, r *http.Request) {
+	kv.handleCounter(w, r, 1)
+}
+
+func (kv *KeyValueStore) handleDecrement(w http.ResponseWriter, r *http.Request) {
+	kv.handleCounter(w, r, -1)
+}
+
+// handleCounter adds the optional integer delta in the body (default 1) times sign to the value of key.
+// The addition is evaluated when the log is applied, so concurrent counter updates never get lost.
+func (kv *KeyValueStore) handleCounter(w http.ResponseWriter, r *http.Request, sign int64) {
+	key, ok := requestKey(r)
+	if !ok {
+		RespondJSON(w, http.StatusBadRequest, ReadMessage{InfoMessage: StatusMissingURLParameterMessage})
+		return
+	}
+	deltaBytes, _ := ioutil.ReadAll(r.Body)
+
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying counter request to leader")
+		kv.proxyRequest(w, r.URL.RequestURI(), deltaBytes)
+		return
+	}
+
+	var delta int64 = 1
+	if rawDelta := strings.TrimSpace(string(deltaBytes)); rawDelta != "" {
+		var err error
+		delta, err = strconv.ParseInt(rawDelta, 10, 64)
+		if err != nil || delta < -math.MaxInt64 {
+			RespondJSON(w, http.StatusBadRequest, ReadMessage{
+				InfoMessage: StatusBadBodyMessage,
+				Value:       "",
+			})
+			return
+		}
+	}
+
+	result := kv.queueWrite([]*KeyValueLog{CreateIncrementLog(key, sign*delta, true, false)})[0]
+	RespondJSON(w, writeStatusCode(result.InfoMessage, http.StatusConflict), ReadMessage{
+		InfoMessage: result.InfoMessage,
+		Value:       string(result.Value),
+	})
+}
+
+//
+// Utils
+//
+
+// writeStatusCode is the status code of a write that resulted in infoMessage. Writes the leader could not commit
+// are unavailable, all other failures respond with failedStatusCode.
+func writeStatusCode(infoMessage InfoMessage, failedStatusCode int) int {
+	switch infoMessage {
+	case StatusOKMessage:
+		return http.StatusOK
+	case StatusLeaderUnavailableMessage:
+		return http.StatusServiceUnavailable
+	default:
+		return failedStatusCode
+	}
+}
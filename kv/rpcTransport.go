@@ -0,0 +1,257 @@
+package kv
+
+import (
+	"context"
+	"crypto/tls"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/peerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Connections to peers that were unreachable are retried at least once per heart beat, so restarted peers are picked up quickly
+func peerConnectParams(retryInterval time.Duration, heartBeatInterval time.Duration) grpc.ConnectParams {
+	return grpc.ConnectParams{
+		Backoff: backoff.Config{
+			BaseDelay:  retryInterval,
+			Multiplier: backoff.DefaultConfig.Multiplier,
+			Jitter:     backoff.DefaultConfig.Jitter,
+			MaxDelay:   heartBeatInterval,
+		},
+	}
+}
+
+// RPCTransport sends peer messages over the gRPC peer service at the peer URLs of the other nodes.
+// Registrations and client requests are still forwarded over HTTP. The peer service is served over
+// mutual TLS with the certificate of PeerTLS if it is set.
+type RPCTransport struct {
+	*HTTPTransport
+
+	// Port of the peer service of nodes without peer URL. The transport listens on it unless PeerListenAddress
+	// is set.
+	PeerPort          string
+	PeerListenAddress string
+	// Calls are cancelled after Timeout
+	Timeout       time.Duration
+	ConnectParams grpc.ConnectParams
+
+	server *grpc.Server
+
+	// Connections to other nodes by their target
+	connections map[string]*grpc.ClientConn
+	mutex       sync.Mutex
+}
+
+// NewRPCTransport returns a transport on the peer port and with the timeouts of config
+func NewRPCTransport(config Config) *RPCTransport {
+	return &RPCTransport{
+		HTTPTransport:     NewHTTPTransport(config),
+		PeerPort:          config.PeerPort,
+		PeerListenAddress: config.ListenPeerAddress,
+		Timeout:           config.PeerTimeout,
+		ConnectParams:     peerConnectParams(config.RetryInterval, config.HeartBeatInterval),
+		connections:       make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (t *RPCTransport) Serve(kv *KeyValueStore, router http.Handler) error {
+	address := t.PeerListenAddress
+	if address == "" {
+		address = t.Host + t.PeerPort
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	var options []grpc.ServerOption
+	if t.PeerTLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(serverTLSConfig(t.PeerTLS, t.PeerTLS, tls.RequireAndVerifyClientCert))))
+	}
+	t.server = kv.newPeerServer(options...)
+	server := t.server
+	t.mutex.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			ErrorLogger.Println(err)
+		}
+	}()
+	return t.HTTPTransport.Serve(kv, router)
+}
+
+func (t *RPCTransport) Close() error {
+	t.mutex.Lock()
+	if t.server != nil {
+		t.server.Stop()
+	}
+	for target, connection := range t.connections {
+		connection.Close()
+		delete(t.connections, target)
+	}
+	t.mutex.Unlock()
+
+	return t.HTTPTransport.Close()
+}
+
+// client returns the connection to the peer service of member, connections are created once and reused
+func (t *RPCTransport) client(member Member) (peerpb.PeerClient, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	target := member.PeerURL
+	if target == "" {
+		target = member.Address.String() + t.PeerPort
+	}
+	connection, ok := t.connections[target]
+	if !ok {
+		var err error
+		connection, err = grpc.NewClient(target,
+			grpc.WithTransportCredentials(t.credentials()),
+			grpc.WithConnectParams(t.ConnectParams),
+			grpc.WithUnaryInterceptor(t.sendClusterID),
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32), grpc.MaxCallSendMsgSize(math.MaxInt32)))
+		if err != nil {
+			return nil, err
+		}
+		t.connections[target] = connection
+	}
+	return peerpb.NewPeerClient(connection), nil
+}
+
+// credentials verify the peer service of other nodes against the CA of PeerTLS and present its certificate
+func (t *RPCTransport) credentials() credentials.TransportCredentials {
+	if t.PeerTLS == nil {
+		return insecure.NewCredentials()
+	}
+	return newReloadingCredentials(func() *tls.Config {
+		return clientTLSConfig("", t.PeerTLS, t.PeerTLS)
+	})
+}
+
+// sendClusterID sends the cluster ID of the embedded HTTP transport along with every call
+func (t *RPCTransport) sendClusterID(ctx context.Context, method string, request, reply interface{}, connection *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, CLUSTER_METADATA, t.ClusterID)
+	return invoker(ctx, method, request, reply, connection, options...)
+}
+
+//
+// Network Administration
+//
+
+func (t *RPCTransport) HeartBeat(member Member, heartBeatMessage HeartBeatMessage) error {
+	client, err := t.client(member)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+	_, err = client.HeartBeat(ctx, &peerpb.HeartBeatRequest{
+		Term:      heartBeatMessage.Term,
+		LeaderId:  heartBeatMessage.LeaderID,
+		Leader:    toPeerFollower(Follower{ID: heartBeatMessage.LeaderID, Member: heartBeatMessage.Leader}),
+		Followers: toPeerFollowers(heartBeatMessage.Followers),
+	})
+	return err
+}
+
+func (t *RPCTransport) Poll(member Member, pollRequest PollRequestMessage) (PollResponseMessage, error) {
+	client, err := t.client(member)
+	if err != nil {
+		return PollResponseNo, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+	response, err := client.Poll(ctx, &peerpb.PollRequest{
+		Term:             pollRequest.Term,
+		CandidateId:      pollRequest.CandidateID,
+		NewLeaderAddress: pollRequest.NewLeaderAddress,
+		LastLogHash:      pollRequest.LastLogHash,
+	})
+	if status.Code(err) == codes.PermissionDenied {
+		return PollResponseNo, nil
+	} else if err != nil {
+		return PollResponseNo, err
+	}
+	return PollResponseMessage{Yes: response.Vote, ID: response.Id}, nil
+}
+
+func (t *RPCTransport) LeaderUpdate(member Member, leaderMessage LeaderUpdateMessage) (InfoMessage, error) {
+	client, err := t.client(member)
+	if err != nil {
+		return StatusInternalServerErrorMessage, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+	_, err = client.LeaderUpdate(ctx, &peerpb.LeaderUpdateRequest{
+		LeaderId:     leaderMessage.LeaderID,
+		Leader:       leaderMessage.Leader,
+		PeerUrl:      leaderMessage.PeerURL,
+		ClientUrl:    leaderMessage.ClientURL,
+		GrpcUrl:      leaderMessage.GRPCURL,
+		RedisUrl:     leaderMessage.RedisURL,
+		MemcachedUrl: leaderMessage.MemcachedURL,
+		Term:         leaderMessage.Term,
+	})
+	return peerInfoMessage(err)
+}
+
+//
+// Replication
+//
+
+func (t *RPCTransport) AppendEntries(member Member, appendData *AppendEntriesMessage) (InfoMessage, error) {
+	client, err := t.client(member)
+	if err != nil {
+		return StatusInternalServerErrorMessage, err
+	}
+	request := &peerpb.AppendEntriesRequest{Entries: make([]*peerpb.LogEntry, len(appendData.KeyValueLog))}
+	for index, logEntry := range appendData.KeyValueLog {
+		request.Entries[index] = toPeerLogEntry(logEntry)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+	_, err = client.AppendEntries(ctx, request)
+	return peerInfoMessage(err)
+}
+
+func (t *RPCTransport) Commit(member Member, commitData *CommitLogMessage) (InfoMessage, error) {
+	client, err := t.client(member)
+	if err != nil {
+		return StatusInternalServerErrorMessage, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+	_, err = client.Commit(ctx, &peerpb.CommitRequest{LogHash: commitData.LogHash})
+	return peerInfoMessage(err)
+}
+
+// peerInfoMessage converts the error of a call into the info message the JSON routes respond with,
+// errors of the connection itself are passed on
+func peerInfoMessage(err error) (InfoMessage, error) {
+	switch status.Code(err) {
+	case codes.OK:
+		return StatusOKMessage, nil
+	case codes.NotFound:
+		return StatusLogNotFoundMessage, nil
+	case codes.InvalidArgument:
+		return StatusBadBodyMessage, nil
+	case codes.FailedPrecondition:
+		return StatusInternalServerErrorMessage, nil
+	case codes.PermissionDenied:
+		return StatusClusterMismatchMessage, nil
+	default:
+		return StatusInternalServerErrorMessage, err
+	}
+}
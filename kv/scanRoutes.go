@@ -0,0 +1,66 @@
+package kv
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// Scan
+//
+
+// handleScan responds with all keys starting with the `prefix` URL parameter and their values, sorted by key.
+// The optional `limit` URL parameter restricts the number of entries.
+func (kv *KeyValueStore) handleScan(w http.ResponseWriter, r *http.Request) {
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying scan request to leader")
+		kv.proxyGetRequest(w, r.URL.RequestURI())
+		return
+	}
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+
+	limit := 0
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 0 {
+			RespondJSON(w, http.StatusBadRequest, ScanMessage{InfoMessage: StatusBadURLParameterMessage})
+			return
+		}
+	}
+
+	keyValues := kv.rangeKeyValues(prefix, limit)
+	entries := make([]ScanEntry, len(keyValues))
+	for index, keyValue := range keyValues {
+		entries[index] = ScanEntry{Key: keyValue.Key, Value: string(keyValue.Value)}
+	}
+
+	RespondJSON(w, http.StatusOK, ScanMessage{
+		InfoMessage: StatusOKMessage,
+		Entries:     entries,
+	})
+}
+
+// rangeKeyValues returns all keys starting with prefix sorted by key, at most limit if limit is positive
+func (kv *KeyValueStore) rangeKeyValues(prefix string, limit int) []KeyValue {
+	kv.databaseMutex.RLock()
+	keyValues := make([]KeyValue, 0)
+	for key, value := range kv.Database {
+		if strings.HasPrefix(key, prefix) {
+			keyValues = append(keyValues, KeyValue{Key: key, Value: value, Lease: kv.KeyLeases[key]})
+		}
+	}
+	kv.databaseMutex.RUnlock()
+
+	sort.Slice(keyValues, func(i, j int) bool {
+		return keyValues[i].Key < keyValues[j].Key
+	})
+	if limit > 0 && len(keyValues) > limit {
+		keyValues = keyValues[:limit]
+	}
+	return keyValues
+}
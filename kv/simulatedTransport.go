@@ -0,0 +1,195 @@
+package kv
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The simulated transport connects the nodes of a simulation. Messages are delayed on CLOCK and
+// handled by the receiving node in the goroutine of the sender, so they never leave the simulation.
+
+// SimulatedNetwork connects the nodes that serve a SimulatedTransport, nodes are addressed by their local address
+type SimulatedNetwork struct {
+	endpoints map[string]*simulatedEndpoint
+	mutex     sync.Mutex
+}
+
+type simulatedEndpoint struct {
+	kv      *KeyValueStore
+	handler http.Handler
+}
+
+func NewSimulatedNetwork() *SimulatedNetwork {
+	return &SimulatedNetwork{endpoints: make(map[string]*simulatedEndpoint)}
+}
+
+func (n *SimulatedNetwork) endpoint(address net.IP) (*simulatedEndpoint, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	endpoint, ok := n.endpoints[address.String()]
+	return endpoint, ok
+}
+
+// latency returns the time a message takes in one direction
+func (n *SimulatedNetwork) latency() time.Duration {
+	return SIMULATED_LATENCY + time.Duration(CLOCK.Int63n(int64(SIMULATED_JITTER)))
+}
+
+// send passes the message to the node at address and returns its reply. Replies of nodes that
+// stopped while the message was on its way are lost.
+func (n *SimulatedNetwork) send(address net.IP, handle func(endpoint *simulatedEndpoint) interface{}) (interface{}, error) {
+	CLOCK.Sleep(n.latency())
+	endpoint, ok := n.endpoint(address)
+	if !ok {
+		return nil, errUnreachable
+	}
+	reply := handle(endpoint)
+
+	CLOCK.Sleep(n.latency())
+	if current, ok := n.endpoint(address); !ok || current != endpoint {
+		return nil, errUnreachable
+	}
+	return reply, nil
+}
+
+// SimulatedTransport is the transport of a single node on a SimulatedNetwork
+type SimulatedTransport struct {
+	network  *SimulatedNetwork
+	address  net.IP
+	endpoint *simulatedEndpoint
+	// Closed transports do not send any messages
+	closed bool
+	mutex  sync.Mutex
+}
+
+func (n *SimulatedNetwork) NewTransport(address net.IP) *SimulatedTransport {
+	return &SimulatedTransport{network: n, address: address}
+}
+
+// Serve makes the node reachable on the network. Unlike other transports, it returns right away.
+func (t *SimulatedTransport) Serve(kv *KeyValueStore, router http.Handler) error {
+	endpoint := &simulatedEndpoint{kv: kv, handler: router}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return http.ErrServerClosed
+	}
+	t.endpoint = endpoint
+	t.network.mutex.Lock()
+	t.network.endpoints[t.address.String()] = endpoint
+	t.network.mutex.Unlock()
+	return nil
+}
+
+// Close makes the node unreachable, messages on their way are lost
+func (t *SimulatedTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.closed = true
+	if t.endpoint != nil {
+		t.network.mutex.Lock()
+		if t.network.endpoints[t.address.String()] == t.endpoint {
+			delete(t.network.endpoints, t.address.String())
+		}
+		t.network.mutex.Unlock()
+		t.endpoint = nil
+	}
+	return nil
+}
+
+func (t *SimulatedTransport) send(address net.IP, handle func(endpoint *simulatedEndpoint) interface{}) (interface{}, error) {
+	t.mutex.Lock()
+	closed := t.closed
+	t.mutex.Unlock()
+	if closed {
+		return nil, errUnreachable
+	}
+	return t.network.send(address, handle)
+}
+
+//
+// Network Administration
+//
+
+func (t *SimulatedTransport) HeartBeat(member Member, heartBeatMessage HeartBeatMessage) error {
+	_, err := t.send(member.Address, func(endpoint *simulatedEndpoint) interface{} {
+		endpoint.kv.receiveHeartBeat(heartBeatMessage)
+		return StatusOKMessage
+	})
+	return err
+}
+
+func (t *SimulatedTransport) Poll(member Member, pollRequest PollRequestMessage) (PollResponseMessage, error) {
+	reply, err := t.send(member.Address, func(endpoint *simulatedEndpoint) interface{} {
+		return endpoint.kv.receivePoll(pollRequest)
+	})
+	if err != nil {
+		return PollResponseNo, err
+	}
+	return reply.(PollResponseMessage), nil
+}
+
+func (t *SimulatedTransport) LeaderUpdate(member Member, leaderMessage LeaderUpdateMessage) (InfoMessage, error) {
+	return t.sendInfoMessage(member.Address, func(endpoint *simulatedEndpoint) interface{} {
+		return endpoint.kv.receiveLeaderUpdate(leaderMessage)
+	})
+}
+
+//
+// Replication
+//
+
+func (t *SimulatedTransport) AppendEntries(member Member, appendData *AppendEntriesMessage) (InfoMessage, error) {
+	logEntries := copyLogs(appendData.KeyValueLog)
+	return t.sendInfoMessage(member.Address, func(endpoint *simulatedEndpoint) interface{} {
+		return endpoint.kv.receiveLogAppend(AppendEntriesMessage{KeyValueLog: logEntries})
+	})
+}
+
+func (t *SimulatedTransport) Commit(member Member, commitData *CommitLogMessage) (InfoMessage, error) {
+	commitLogMessage := *commitData
+	return t.sendInfoMessage(member.Address, func(endpoint *simulatedEndpoint) interface{} {
+		return endpoint.kv.receiveCommit(commitLogMessage)
+	})
+}
+
+func (t *SimulatedTransport) sendInfoMessage(address net.IP, handle func(endpoint *simulatedEndpoint) interface{}) (InfoMessage, error) {
+	reply, err := t.send(address, handle)
+	if err != nil {
+		return StatusInternalServerErrorMessage, err
+	}
+	return reply.(InfoMessage), nil
+}
+
+//
+// HTTP
+//
+
+func (t *SimulatedTransport) Get(member Member, path string) (*http.Response, error) {
+	return t.do(member.Address, "GET", path, "", nil)
+}
+
+func (t *SimulatedTransport) Post(member Member, path string, contentType string, body io.Reader) (*http.Response, error) {
+	return t.do(member.Address, "POST", path, contentType, body)
+}
+
+func (t *SimulatedTransport) do(address net.IP, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	reply, err := t.send(address, func(endpoint *simulatedEndpoint) interface{} {
+		resp, err := serveRequest(endpoint.handler, t.address, address, method, path, contentType, body)
+		return result{resp, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(result).resp, reply.(result).err
+}
@@ -0,0 +1,186 @@
+package kv
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// ApplyResult is the outcome of applying a single log to the database
+type ApplyResult struct {
+	InfoMessage InfoMessage
+	Value       []byte
+	// Events are the changes of keys caused by the log
+	Events []WatchEvent
+	// Txn is the response of an etcd transaction
+	Txn *etcdserverpb.TxnResponse
+}
+
+// keyRevision tracks the revisions a key was created and last modified at,
+// and how often it was modified since it was created
+type keyRevision struct {
+	create  int64
+	mod     int64
+	version int64
+}
+
+// applyLog applies a committed log to the database and returns the resulting value of its key.
+// The revision of a log is its index in the database log.
+// Every node applies the same logs in the same order, so failing operations fail everywhere
+// and leave the database untouched. The caller has to hold the database mutex.
+func (kv *KeyValueStore) applyLog(logEntry *KeyValueLog, revision int64) ApplyResult {
+	switch logEntry.Operation {
+	case OperationIncrement:
+		delta, err := strconv.ParseInt(string(logEntry.Value), 10, 64)
+		if err != nil {
+			return ApplyResult{InfoMessage: StatusBadBodyMessage}
+		}
+
+		// Missing keys are treated as zero
+		var current int64 = 0
+		if value, ok := kv.Database[logEntry.Key]; ok {
+			current, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return ApplyResult{InfoMessage: StatusNotANumberMessage}
+			}
+		}
+
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			return ApplyResult{InfoMessage: StatusNumberOverflowMessage}
+		}
+
+		value := []byte(strconv.FormatInt(current+delta, 10))
+		kv.Database[logEntry.Key] = value
+		delete(kv.ContentTypes, logEntry.Key)
+		return ApplyResult{
+			InfoMessage: StatusOKMessage,
+			Value:       value,
+			Events:      []WatchEvent{kv.modifyKey(logEntry.Key, value, kv.KeyLeases[logEntry.Key], revision)},
+		}
+	case OperationDelete:
+		return kv.applyDelete(logEntry.Key, revision)
+	case OperationCompareAndSwap:
+		if result, ok := kv.compareValue(logEntry); !ok {
+			return result
+		}
+		return kv.applySet(logEntry, revision)
+	case OperationCompareAndDelete:
+		if result, ok := kv.compareValue(logEntry); !ok {
+			return result
+		}
+		return kv.applyDelete(logEntry.Key, revision)
+	case OperationTxn:
+		return kv.applyTxn(logEntry, revision)
+	case OperationLeaseGrant:
+		ttl, err := strconv.ParseInt(string(logEntry.Value), 10, 64)
+		if err != nil {
+			return ApplyResult{InfoMessage: StatusBadBodyMessage}
+		}
+		if _, ok := kv.Leases[logEntry.Lease]; ok {
+			return ApplyResult{InfoMessage: StatusLeaseExistsMessage}
+		}
+
+		kv.Leases[logEntry.Lease] = &Lease{ID: logEntry.Lease, TTL: ttl}
+		return ApplyResult{InfoMessage: StatusOKMessage, Value: logEntry.Value}
+	case OperationLeaseRevoke:
+		if _, ok := kv.Leases[logEntry.Lease]; !ok {
+			return ApplyResult{InfoMessage: StatusLeaseNotFoundMessage}
+		}
+
+		var events []WatchEvent
+		for key, lease := range kv.KeyLeases {
+			if lease == logEntry.Lease {
+				events = append(events, kv.applyDelete(key, revision).Events...)
+			}
+		}
+		delete(kv.Leases, logEntry.Lease)
+		return ApplyResult{InfoMessage: StatusOKMessage, Events: events}
+	default:
+		return kv.applySet(logEntry, revision)
+	}
+}
+
+func (kv *KeyValueStore) applySet(logEntry *KeyValueLog, revision int64) ApplyResult {
+	if logEntry.Lease != 0 {
+		if _, ok := kv.Leases[logEntry.Lease]; !ok {
+			return ApplyResult{InfoMessage: StatusLeaseNotFoundMessage}
+		}
+		kv.KeyLeases[logEntry.Key] = logEntry.Lease
+	} else {
+		delete(kv.KeyLeases, logEntry.Key)
+	}
+
+	if logEntry.ContentType != "" {
+		kv.ContentTypes[logEntry.Key] = logEntry.ContentType
+	} else {
+		delete(kv.ContentTypes, logEntry.Key)
+	}
+
+	kv.Database[logEntry.Key] = logEntry.Value
+	return ApplyResult{
+		InfoMessage: StatusOKMessage,
+		Value:       logEntry.Value,
+		Events:      []WatchEvent{kv.modifyKey(logEntry.Key, logEntry.Value, logEntry.Lease, revision)},
+	}
+}
+
+func (kv *KeyValueStore) applyDelete(key string, revision int64) ApplyResult {
+	value, ok := kv.Database[key]
+	if !ok {
+		return ApplyResult{InfoMessage: StatusValueNotFoundMessage}
+	}
+
+	delete(kv.Database, key)
+	delete(kv.ContentTypes, key)
+	delete(kv.KeyLeases, key)
+	delete(kv.keyRevisions, key)
+	return ApplyResult{
+		InfoMessage: StatusOKMessage,
+		Value:       value,
+		Events:      []WatchEvent{{Type: EventDelete, Key: key, Revision: revision}},
+	}
+}
+
+// modifyKey updates the revisions of a key that was just set and returns the resulting put event
+func (kv *KeyValueStore) modifyKey(key string, value []byte, lease int64, revision int64) WatchEvent {
+	keyRevision, ok := kv.keyRevisions[key]
+	if !ok {
+		keyRevision.create = revision
+	}
+	keyRevision.mod = revision
+	keyRevision.version++
+	kv.keyRevisions[key] = keyRevision
+
+	return WatchEvent{
+		Type:           EventPut,
+		Key:            key,
+		Value:          value,
+		Lease:          lease,
+		Revision:       revision,
+		CreateRevision: keyRevision.create,
+		Version:        keyRevision.version,
+	}
+}
+
+// compareValue checks the expectation of a compare operation, on failure the result holds the current value.
+// Expecting a revision of a missing key fails as not found.
+func (kv *KeyValueStore) compareValue(logEntry *KeyValueLog) (ApplyResult, bool) {
+	value, ok := kv.Database[logEntry.Key]
+	switch {
+	case logEntry.ExpectAbsent:
+		ok = !ok
+	case logEntry.ExpectedRevision != 0 && !ok:
+		return ApplyResult{InfoMessage: StatusValueNotFoundMessage}, false
+	case logEntry.ExpectedRevision != 0:
+		ok = etcdRevision(kv.keyRevisions[logEntry.Key].mod) == logEntry.ExpectedRevision
+	default:
+		ok = ok && bytes.Equal(value, logEntry.Expected)
+	}
+
+	if !ok {
+		return ApplyResult{InfoMessage: StatusCompareFailedMessage, Value: value}, false
+	}
+	return ApplyResult{}, true
+}
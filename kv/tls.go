@@ -0,0 +1,333 @@
+package kv
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// Client endpoints are served over TLS and peer endpoints over mutual TLS if certificates are configured.
+// Certificates and CAs are read from files, which are loaded again on the next handshake once they were
+// modified, so certificates are rotated without restarting the nodes.
+
+// TLSFiles holds a certificate with its key and the CA certificates other nodes are verified against
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	// PEM file of one or more CA certificates, optional
+	CAFile string
+
+	certificate *tls.Certificate
+	authorities []*x509.Certificate
+	// Modification times of the loaded files
+	loaded map[string]time.Time
+	mutex  sync.Mutex
+}
+
+func NewTLSFiles(certFile string, keyFile string, caFile string) *TLSFiles {
+	return &TLSFiles{CertFile: certFile, KeyFile: keyFile, CAFile: caFile, loaded: make(map[string]time.Time)}
+}
+
+// Load loads the files that were modified since they were last loaded
+func (files *TLSFiles) Load() error {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	if files.loaded == nil {
+		files.loaded = make(map[string]time.Time)
+	}
+
+	certTimes, certModified, err := files.modified(files.CertFile, files.KeyFile)
+	if err != nil {
+		return err
+	}
+	caTimes, caModified, err := files.modified(files.CAFile)
+	if err != nil {
+		return err
+	}
+
+	// Files that cannot be loaded, e.g. because only the certificate was replaced so far, are tried again on the next load
+	if certModified {
+		certificate, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return err
+		}
+		files.certificate = &certificate
+		for path, modTime := range certTimes {
+			files.loaded[path] = modTime
+		}
+	}
+	if caModified {
+		authorities, err := loadCertificates(files.CAFile)
+		if err != nil {
+			return err
+		}
+		files.authorities = authorities
+		for path, modTime := range caTimes {
+			files.loaded[path] = modTime
+		}
+	}
+	return nil
+}
+
+// modified returns the modification times of the given paths, and whether one of them changed since it was loaded
+func (files *TLSFiles) modified(paths ...string) (map[string]time.Time, bool, error) {
+	modTimes := make(map[string]time.Time)
+	modified := false
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, false, err
+		}
+		modTimes[path] = info.ModTime()
+		if loaded, ok := files.loaded[path]; !ok || !loaded.Equal(info.ModTime()) {
+			modified = true
+		}
+	}
+	return modTimes, modified, nil
+}
+
+// reload loads modified files before a handshake, the previous certificates are kept while they cannot be loaded
+func (files *TLSFiles) reload() (*tls.Certificate, []*x509.Certificate, error) {
+	err := files.Load()
+
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	if err != nil && files.certificate == nil && files.authorities == nil {
+		return nil, nil, err
+	} else if err != nil {
+		ErrorLogger.Printf("Keeping the previous certificates of %s: %v\n", files.CertFile, err)
+	}
+	return files.certificate, files.authorities, nil
+}
+
+func (files *TLSFiles) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificate, _, err := files.reload()
+	if err == nil && certificate == nil {
+		err = fmt.Errorf("no certificate configured")
+	}
+	return certificate, err
+}
+
+// getClientCertificate presents no certificate if none is configured, the server decides whether it requires one
+func (files *TLSFiles) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	certificate, _, err := files.reload()
+	if certificate == nil {
+		return &tls.Certificate{}, err
+	}
+	return certificate, err
+}
+
+// loadCertificates reads the PEM encoded certificates of path
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certificates []*x509.Certificate
+	for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("%s: no PEM encoded certificates found", path)
+	}
+	return certificates, nil
+}
+
+// certPool returns a pool of the CAs of files, or nil for the system CAs if none of them has a CA file
+func certPool(files ...*TLSFiles) *x509.CertPool {
+	var pool *x509.CertPool
+	for _, file := range files {
+		if file == nil || file.CAFile == "" {
+			continue
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if _, authorities, err := file.reload(); err == nil {
+			for _, authority := range authorities {
+				pool.AddCert(authority)
+			}
+		}
+	}
+	return pool
+}
+
+//
+// TLS Configs
+//
+
+// serverTLSConfig serves the certificate of files. Clients are verified against the CAs of peers with clientAuth,
+// if peers is set.
+func serverTLSConfig(files *TLSFiles, peers *TLSFiles, clientAuth tls.ClientAuthType) *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: files.getCertificate}
+	if peers == nil {
+		return config
+	}
+
+	// The CAs are read again for every connection, a missing pool must not fall back to the system CAs
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		clientCAs := certPool(peers)
+		if clientCAs == nil {
+			clientCAs = x509.NewCertPool()
+		}
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: files.getCertificate,
+			ClientAuth:     clientAuth,
+			ClientCAs:      clientCAs,
+		}, nil
+	}
+	return config
+}
+
+// clientTLSConfig verifies the server serverName against the CAs of authorities and presents the certificate of
+// files, if it is set. gRPC takes the server name from the target if it is empty.
+func clientTLSConfig(serverName string, files *TLSFiles, authorities ...*TLSFiles) *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName, RootCAs: certPool(authorities...)}
+	if files != nil {
+		config.GetClientCertificate = files.getClientCertificate
+	}
+	return config
+}
+
+// reloadingCredentials are gRPC client credentials, whose TLS config is built again for every connection
+type reloadingCredentials struct {
+	credentials.TransportCredentials
+
+	config func() *tls.Config
+}
+
+func newReloadingCredentials(config func() *tls.Config) credentials.TransportCredentials {
+	return reloadingCredentials{TransportCredentials: credentials.NewTLS(config()), config: config}
+}
+
+func (c reloadingCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.config()).ClientHandshake(ctx, authority, conn)
+}
+
+func (c reloadingCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+//
+// Peer Identity
+//
+
+// authorizePeer refuses peers without a certificate that matches both the member the node knows under id and the
+// member they claim to be, or the leader if both are empty. Logs are only sent by the leader, so peers cannot claim
+// the identity of other members with data of their own. All peers are accepted unless peer TLS is configured.
+func (kv *KeyValueStore) authorizePeer(certificate *x509.Certificate, id string, member *Member) error {
+	if kv.config.PeerCertFile == "" {
+		return nil
+	}
+	if certificate == nil {
+		return fmt.Errorf("no verified peer certificate")
+	}
+	if id == "" && member == nil {
+		if err := matchMember(certificate, kv.leaderMember()); err != nil {
+			return fmt.Errorf("certificate of %q does not match the leader: %v", certificate.Subject.CommonName, err)
+		}
+		return nil
+	}
+
+	var address net.IP
+	if member != nil {
+		address = member.Address
+	}
+	known, ok := kv.knownMember(id, address)
+	if !ok {
+		return fmt.Errorf("certificate of %q belongs to unknown member %q at %s", certificate.Subject.CommonName, id, address)
+	}
+	if err := matchMember(certificate, known); err != nil {
+		return fmt.Errorf("certificate of %q does not match member %q: %v", certificate.Subject.CommonName, id, err)
+	}
+	if member != nil {
+		return matchMember(certificate, *member)
+	}
+	return nil
+}
+
+// authorizeRegistration refuses nodes without a certificate that matches the member they register as. Nodes only
+// register again under the ID of registered, if their certificate matches registered as well.
+func (kv *KeyValueStore) authorizeRegistration(certificate *x509.Certificate, member Member, registered *Member) error {
+	if kv.config.PeerCertFile == "" {
+		return nil
+	}
+	if certificate == nil {
+		return fmt.Errorf("no verified peer certificate")
+	}
+	if registered != nil {
+		if err := matchMember(certificate, *registered); err != nil {
+			return fmt.Errorf("certificate of %q does not match the registered member: %v", certificate.Subject.CommonName, err)
+		}
+	}
+	return matchMember(certificate, member)
+}
+
+// knownMember returns the leader or the follower the node knows under id. Initial members have no ID until they
+// voted, they are known by their address instead.
+func (kv *KeyValueStore) knownMember(id string, address net.IP) (Member, bool) {
+	kv.leaderMutex.RLock()
+	leaderID, leader := kv.LeaderID, kv.leader
+	kv.leaderMutex.RUnlock()
+	if id != "" && id == leaderID {
+		return leader, true
+	}
+
+	kv.followerMutex.RLock()
+	defer kv.followerMutex.RUnlock()
+	for _, follower := range kv.Followers {
+		if id != "" && follower.ID == id {
+			return follower.Member, true
+		}
+	}
+	for _, follower := range kv.Followers {
+		if follower.ID == "" && address != nil && follower.Address.Equal(address) {
+			return follower.Member, true
+		}
+	}
+	return Member{}, false
+}
+
+// matchMember returns an error unless certificate is valid for the address of member and the hosts of its URLs
+func matchMember(certificate *x509.Certificate, member Member) error {
+	var hosts []string
+	if member.Address != nil {
+		hosts = append(hosts, member.Address.String())
+	}
+	for _, url := range []string{member.PeerURL, member.ClientURL} {
+		if host, _, err := net.SplitHostPort(url); err == nil && host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("member without address")
+	}
+
+	for _, host := range hosts {
+		if err := certificate.VerifyHostname(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
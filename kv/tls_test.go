@@ -0,0 +1,409 @@
+package kv
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	file        string
+}
+
+var testSerial int64 = 1
+
+// newTestCA generates a self-signed CA and writes its certificate to dir
+func newTestCA(t *testing.T, dir string, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	testSerial++
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &testCA{certificate: certificate, key: key, file: filepath.Join(dir, name+".pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate for addresses and its key to dir, it is valid for both servers and clients
+func (ca *testCA) issue(t *testing.T, dir string, name string, addresses ...net.IP) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  addresses,
+	}
+	testSerial++
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile, certificate
+}
+
+func writePEM(t *testing.T, path string, blockType string, bytes []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSFilesReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile, first := ca.issue(t, dir, "node", net.IPv4(127, 0, 0, 1))
+	files := NewTLSFiles(certFile, keyFile, ca.file)
+	if err := files.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverTLSConfig(files, nil, tls.NoClientCert))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connection.(*tls.Conn).Handshake()
+			connection.Close()
+		}
+	}()
+
+	served := func() *x509.Certificate {
+		connection, err := tls.Dial("tcp", listener.Addr().String(), clientTLSConfig("127.0.0.1", nil, files))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer connection.Close()
+		return connection.ConnectionState().PeerCertificates[0]
+	}
+	if certificate := served(); !certificate.Equal(first) {
+		t.Fatalf("served certificate %v, expected %v", certificate.SerialNumber, first.SerialNumber)
+	}
+
+	// The files are replaced in place, the next handshake serves the new certificate
+	_, _, second := ca.issue(t, dir, "node", net.IPv4(127, 0, 0, 1))
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if certificate := served(); !certificate.Equal(second) {
+		t.Fatalf("served certificate %v after the reload, expected %v", certificate.SerialNumber, second.SerialNumber)
+	}
+
+	// Broken files are not taken over, the previous certificate is served until they are fixed
+	if err := os.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if certificate := served(); !certificate.Equal(second) {
+		t.Fatalf("served certificate %v with a broken key, expected %v", certificate.SerialNumber, second.SerialNumber)
+	}
+}
+
+func TestMatchMember(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	_, _, certificate := ca.issue(t, dir, "node", net.IPv4(10, 0, 0, 1))
+
+	for _, test := range []struct {
+		name   string
+		member Member
+		match  bool
+	}{
+		{"address", Member{Address: net.IPv4(10, 0, 0, 1)}, true},
+		{"address and URLs", Member{Address: net.IPv4(10, 0, 0, 1), PeerURL: "10.0.0.1:8082", ClientURL: "10.0.0.1:8080"}, true},
+		{"other address", Member{Address: net.IPv4(10, 0, 0, 2)}, false},
+		{"other peer URL", Member{Address: net.IPv4(10, 0, 0, 1), PeerURL: "10.0.0.2:8082"}, false},
+		{"no address", Member{}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := matchMember(certificate, test.member); (err == nil) != test.match {
+				t.Fatalf("certificate for 10.0.0.1 matched %+v: %v", test.member, err)
+			}
+		})
+	}
+}
+
+func TestAuthorizePeer(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	_, _, leaderCertificate := ca.issue(t, dir, "leader", net.IPv4(10, 0, 0, 1))
+	_, _, followerCertificate := ca.issue(t, dir, "follower", net.IPv4(10, 0, 0, 2))
+
+	config := DefaultConfig()
+	config.PeerCertFile = "peer.pem"
+	node := InitKeyValueStoreWithConfig(config, false, nil, net.IPv4(10, 0, 0, 3), NewMemoryNetwork().NewTransport(net.IPv4(10, 0, 0, 3)))
+	node.setLeader("leader", Member{Address: net.IPv4(10, 0, 0, 1)})
+	node.Followers = []Follower{{ID: "follower", Member: Member{Address: net.IPv4(10, 0, 0, 2)}}}
+
+	// Logs are only accepted from the leader, other members are accepted for the member known under their ID
+	follower := node.Followers[0].Member
+	if err := node.authorizePeer(leaderCertificate, "", nil); err != nil {
+		t.Fatalf("certificate of the leader was refused: %v", err)
+	}
+	if err := node.authorizePeer(followerCertificate, "", nil); err == nil {
+		t.Fatal("certificate of a follower was accepted for the leader")
+	}
+	if err := node.authorizePeer(followerCertificate, "follower", &follower); err != nil {
+		t.Fatalf("certificate of a follower was refused for itself: %v", err)
+	}
+	if err := node.authorizePeer(followerCertificate, "leader", &follower); err == nil {
+		t.Fatal("certificate of a follower was accepted for the ID of the leader")
+	}
+	if err := node.authorizePeer(leaderCertificate, "follower", &Member{Address: net.IPv4(10, 0, 0, 1)}); err == nil {
+		t.Fatal("certificate of the leader was accepted for the ID of a follower")
+	}
+	if err := node.authorizePeer(followerCertificate, "unknown", &follower); err == nil {
+		t.Fatal("certificate of a follower was accepted for an unknown member")
+	}
+	if err := node.authorizePeer(nil, "", nil); err == nil {
+		t.Fatal("peer without certificate was accepted")
+	}
+
+	// Registered IDs are only taken over with a certificate of the registered member
+	if err := node.authorizeRegistration(followerCertificate, follower, &follower); err != nil {
+		t.Fatalf("registration of a follower was refused for itself: %v", err)
+	}
+	if err := node.authorizeRegistration(leaderCertificate, Member{Address: net.IPv4(10, 0, 0, 1)}, &follower); err == nil {
+		t.Fatal("registration under the ID of a follower was accepted for another certificate")
+	}
+	if err := node.authorizeRegistration(leaderCertificate, Member{Address: net.IPv4(10, 0, 0, 1)}, nil); err != nil {
+		t.Fatalf("registration of a new member was refused: %v", err)
+	}
+}
+
+// Nodes on 127.0.0.1 with certificates of a CA of their own replicate over mutual TLS, nodes whose certificate
+// does not match their address are refused
+func TestMutualTLS(t *testing.T) {
+	for offset, transport := range []string{RPC_PEER_TRANSPORT, HTTP_PEER_TRANSPORT} {
+		t.Run(transport, func(t *testing.T) {
+			dir := t.TempDir()
+			ca := newTestCA(t, dir, "ca")
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: certPool(NewTLSFiles("", "", ca.file))}}}
+
+			start := func(index int, leader bool, addresses ...net.IP) *KeyValueStore {
+				port := 18300 + 100*offset + 10*index
+				config := DefaultConfig()
+				config.PeerTransport = transport
+				config.ListenClientAddress = "127.0.0.1:" + strconv.Itoa(port)
+				config.ListenPeerAddress = "127.0.0.1:" + strconv.Itoa(port+2)
+				config.GRPCPort = ":" + strconv.Itoa(port+1)
+				config.PeerCertFile, config.PeerKeyFile, _ = ca.issue(t, dir, "node-"+strconv.Itoa(index), addresses...)
+				config.PeerCAFile = ca.file
+				if err := config.Validate(); err != nil {
+					t.Fatal(err)
+				}
+
+				node := InitKeyValueStoreWithConfig(config, leader, nil, net.IPv4(127, 0, 0, 1), newPeerTransport(config))
+				if err := node.Serve("127.0.0.1"); err != nil {
+					t.Skip(err)
+				}
+				t.Cleanup(node.Stop)
+
+				// The certificate of the intruder is not valid for its address, so only the listener is awaited
+				for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+					if connection, err := net.Dial("tcp", node.ClientURL); err == nil {
+						connection.Close()
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("node did not start serving at %s", node.ClientURL)
+					}
+				}
+				return node
+			}
+			leader := start(0, true, net.IPv4(127, 0, 0, 1))
+			follower := start(1, false, net.IPv4(127, 0, 0, 1))
+			entry, err := ParseEntry(leader.ClientURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !follower.register(entry) {
+				t.Fatalf("follower could not register with the leader at %s", leader.ClientURL)
+			}
+
+			resp, err := client.Post("https://"+follower.ClientURL+"/write/secure", "text/plain", strings.NewReader("value"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("write on the follower responded %d", resp.StatusCode)
+			}
+			if value := follower.LocalDatabase()["secure"]; string(value) != "value" {
+				t.Fatalf("follower holds %q after the write", value)
+			}
+
+			// The certificate of the intruder is issued by the same CA, but not for the address it claims
+			intruder := start(2, false, net.IPv4(10, 0, 0, 9))
+			if intruder.register(entry) {
+				t.Fatal("node with a certificate for another address registered with the leader")
+			}
+			infoMessage, err := intruder.transport.LeaderUpdate(follower.member(), LeaderUpdateMessage{
+				LeaderID:  intruder.ID,
+				Leader:    intruder.LocalAddress,
+				PeerURL:   intruder.PeerURL,
+				ClientURL: intruder.ClientURL,
+				Term:      follower.Term + 1,
+			})
+			if err == nil && infoMessage == StatusOKMessage {
+				t.Fatal("follower accepted a leader update of a node with a certificate for another address")
+			}
+			if follower.LeaderID != leader.ID {
+				t.Fatalf("follower follows %s instead of %s", follower.LeaderID, leader.ID)
+			}
+
+			// Peer messages without a client certificate are refused
+			resp, err = client.Post("https://"+follower.ClientURL+"/log/commit", "application/json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("commit without client certificate responded %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+// Followers with a certificate for their client endpoints serve Redis and memcached over TLS and relay to the
+// leader over TLS as well
+func TestClientProtocolsTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	clientConfig := clientTLSConfig("127.0.0.1", nil, NewTLSFiles("", "", ca.file))
+
+	start := func(index int, leader bool) *KeyValueStore {
+		port := 18500 + 10*index
+		config := DefaultConfig()
+		config.ListenClientAddress = "127.0.0.1:" + strconv.Itoa(port)
+		config.ListenPeerAddress = "127.0.0.1:" + strconv.Itoa(port+2)
+		config.GRPCPort = ":" + strconv.Itoa(port+1)
+		config.RedisPort = ":" + strconv.Itoa(port+3)
+		config.MemcachedPort = ":" + strconv.Itoa(port+4)
+		config.CertFile, config.KeyFile, _ = ca.issue(t, dir, "node-"+strconv.Itoa(index), net.IPv4(127, 0, 0, 1))
+		config.CAFile = ca.file
+		if err := config.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		node := InitKeyValueStoreWithConfig(config, leader, nil, net.IPv4(127, 0, 0, 1), newPeerTransport(config))
+		if err := node.Serve("127.0.0.1"); err != nil {
+			t.Skip(err)
+		}
+		t.Cleanup(node.Stop)
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if connection, err := tls.Dial("tcp", node.ClientURL, clientConfig); err == nil {
+				connection.Close()
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("node did not start serving at %s", node.ClientURL)
+			}
+		}
+		return node
+	}
+	leader := start(0, true)
+	follower := start(1, false)
+	entry, err := ParseEntry(leader.ClientURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !follower.register(entry) {
+		t.Fatalf("follower could not register with the leader at %s", leader.ClientURL)
+	}
+
+	for _, test := range []struct {
+		protocol string
+		url      string
+		request  string
+		reply    string
+		key      string
+	}{
+		{"redis", follower.RedisURL, "*3\r\n$3\r\nSET\r\n$5\r\nredis\r\n$3\r\ntls\r\n", "+OK\r\n", "redis"},
+		{"memcached", follower.MemcachedURL, "set memcached 0 0 3\r\ntls\r\n", "STORED\r\n", "memcached"},
+	} {
+		connection, err := tls.Dial("tcp", test.url, clientConfig)
+		if err != nil {
+			t.Fatalf("%s over TLS: %v", test.protocol, err)
+		}
+		connection.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := connection.Write([]byte(test.request)); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, len(test.reply))
+		if _, err := io.ReadFull(connection, reply); err != nil || string(reply) != test.reply {
+			t.Fatalf("%s replied %q (%v), expected %q", test.protocol, reply, err, test.reply)
+		}
+		connection.Close()
+
+		if value := leader.LocalDatabase()[test.key]; string(value) != "tls" {
+			t.Fatalf("leader holds %q after the %s write on the follower", value, test.protocol)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Transport delivers the messages between nodes. The consensus code sends every peer message over
+// the transport of its node, which also forwards registrations and client requests to other nodes.
+// The send functions fail if the peer could not be reached, refused messages are reported as info
+// message instead. Network transports reach other nodes at the URLs of their member, the in-memory
+// transports by its address.
+type Transport interface {
+	// Serve receives the messages for kv and serves router until the transport is closed
+	Serve(kv *KeyValueStore, router http.Handler) error
+	Close() error
+
+	HeartBeat(member Member, heartBeatMessage HeartBeatMessage) error
+	Poll(member Member, pollRequest PollRequestMessage) (PollResponseMessage, error)
+	LeaderUpdate(member Member, leaderMessage LeaderUpdateMessage) (InfoMessage, error)
+	AppendEntries(member Member, appendData *AppendEntriesMessage) (InfoMessage, error)
+	Commit(member Member, commitData *CommitLogMessage) (InfoMessage, error)
+
+	// Get and Post send an HTTP request to the HTTP API of member, path includes the query
+	Get(member Member, path string) (*http.Response, error)
+	Post(member Member, path string, contentType string, body io.Reader) (*http.Response, error)
+}
+
+// newPeerTransport returns the network transport configured by PeerTransport, on the configured ports
+func newPeerTransport(config Config) Transport {
+	if config.PeerTransport == HTTP_PEER_TRANSPORT {
+		return NewHTTPTransport(config)
+	}
+	return NewRPCTransport(config)
+}
+
+//
+// HTTP
+//
+
+// HTTPTransport sends peer messages as JSON to the routes of the other nodes, at their client URL
+type HTTPTransport struct {
+	// Host the transport listens on, all interfaces if empty
+	Host string
+	// Port of the HTTP API of nodes without client URL. The transport listens on it unless ListenAddress is set.
+	Port          string
+	ListenAddress string
+	// Sent along with every request in CLUSTER_HEADER
+	ClusterID string
+	// The HTTP API is served over HTTPS with the certificate of TLS, or of PeerTLS if it is not set. Requests to
+	// other nodes present the certificate of PeerTLS, the HTTP API only accepts peer messages of nodes with one.
+	TLS     *TLSFiles
+	PeerTLS *TLSFiles
+
+	server *http.Server
+	client *http.Client
+	mutex  sync.Mutex
+}
+
+// NewHTTPTransport returns a transport on the client port and with the certificates of config
+func NewHTTPTransport(config Config) *HTTPTransport {
+	return &HTTPTransport{
+		Port:          config.Port,
+		ListenAddress: config.ListenClientAddress,
+		ClusterID:     config.ClusterID,
+		TLS:           config.clientTLS(),
+		PeerTLS:       config.peerTLS(),
+	}
+}
+
+func (t *HTTPTransport) Serve(kv *KeyValueStore, router http.Handler) error {
+	t.mutex.Lock()
+	address := t.ListenAddress
+	if address == "" {
+		address = t.Host + t.Port
+	}
+	t.server = &http.Server{Addr: address, Handler: router}
+	if files := t.serverTLS(); files != nil {
+		t.server.TLSConfig = serverTLSConfig(files, t.PeerTLS, tls.VerifyClientCertIfGiven)
+	}
+	server := t.server
+	t.mutex.Unlock()
+
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// serverTLS returns the files the HTTP API is served with, nil if it is served without TLS
+func (t *HTTPTransport) serverTLS() *TLSFiles {
+	if t.TLS != nil {
+		return t.TLS
+	}
+	return t.PeerTLS
+}
+
+func (t *HTTPTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.client != nil {
+		t.client.CloseIdleConnections()
+	}
+	if t.server == nil {
+		return nil
+	}
+	return t.server.Close()
+}
+
+func (t *HTTPTransport) HeartBeat(member Member, heartBeatMessage HeartBeatMessage) error {
+	_, err := t.postJSON(member, "/heart-beat", heartBeatMessage)
+	return err
+}
+
+// Poll passes the poll as URL parameter
+func (t *HTTPTransport) Poll(member Member, pollRequest PollRequestMessage) (PollResponseMessage, error) {
+	jsonValue, _ := json.Marshal(pollRequest)
+	req, err := http.NewRequest("GET", t.url(member, "/poll"), nil)
+	if err != nil {
+		return PollResponseNo, err
+	}
+	q := req.URL.Query()
+	q.Add("poll_parameters", string(jsonValue))
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := t.do(req)
+	if err != nil {
+		return PollResponseNo, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return PollResponseNo, nil
+	}
+
+	bodyBytes, _ := ioutil.ReadAll(resp.Body)
+	var pollResponse PollResponseMessage
+	if err := json.Unmarshal(bodyBytes, &pollResponse); err != nil {
+		return PollResponseNo, err
+	}
+	return pollResponse, nil
+}
+
+func (t *HTTPTransport) LeaderUpdate(member Member, leaderMessage LeaderUpdateMessage) (InfoMessage, error) {
+	return t.postJSON(member, "/leader", leaderMessage)
+}
+
+func (t *HTTPTransport) AppendEntries(member Member, appendData *AppendEntriesMessage) (InfoMessage, error) {
+	return t.postJSON(member, "/log/append", appendData)
+}
+
+func (t *HTTPTransport) Commit(member Member, commitData *CommitLogMessage) (InfoMessage, error) {
+	return t.postJSON(member, "/log/commit", commitData)
+}
+
+func (t *HTTPTransport) Get(member Member, path string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", t.url(member, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.do(req)
+}
+
+func (t *HTTPTransport) Post(member Member, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest("POST", t.url(member, path), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return t.do(req)
+}
+
+// do sends the request along with the cluster ID
+func (t *HTTPTransport) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set(CLUSTER_HEADER, t.ClusterID)
+	return t.httpClient().Do(req)
+}
+
+// httpClient returns the client of the HTTP APIs of other nodes, which are verified against the CAs of TLS and PeerTLS
+func (t *HTTPTransport) httpClient() *http.Client {
+	if t.serverTLS() == nil {
+		return http.DefaultClient
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.client == nil {
+		t.client = &http.Client{Transport: &http.Transport{DialTLSContext: t.dialTLS}}
+	}
+	return t.client
+}
+
+// dialTLS builds the TLS config for every connection, so that reloaded certificates are used
+func (t *HTTPTransport) dialTLS(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &tls.Dialer{Config: clientTLSConfig(host, t.PeerTLS, t.TLS, t.PeerTLS)}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// url returns the URL of path on the HTTP API of member, members without client URL serve it on Port.
+// All nodes serve their HTTP API over HTTPS if this one does.
+func (t *HTTPTransport) url(member Member, path string) string {
+	scheme := "http://"
+	if t.serverTLS() != nil {
+		scheme = "https://"
+	}
+	if member.ClientURL != "" {
+		return scheme + member.ClientURL + path
+	}
+	return scheme + member.Address.String() + t.Port + path
+}
+
+// postJSON responds with the info message of refused messages
+func (t *HTTPTransport) postJSON(member Member, path string, data interface{}) (InfoMessage, error) {
+	jsonValue, _ := json.Marshal(data)
+	resp, err := t.Post(member, path, "application/json", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return StatusInternalServerErrorMessage, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return StatusOKMessage, nil
+	}
+	var infoMessage InfoMessage
+	responseBytes, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(responseBytes, &infoMessage); err != nil {
+		return StatusInternalServerErrorMessage, nil
+	}
+	return infoMessage, nil
+}
@@ -1,17 +1,23 @@
 package kv
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"reflect"
+
+	"github.com/gorilla/mux"
 )
 
-// Get preferred outbound ip of this machine
-func GetOutboundIP() net.IP {
-	conn, err := net.Dial("udp", "leader:8080")
+// Get preferred outbound ip of this machine, towards target
+func GetOutboundIP(target string) net.IP {
+	conn, err := net.Dial("udp", target)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -22,17 +28,96 @@ func GetOutboundIP() net.IP {
 	return localAddr.IP
 }
 
-// Get the IP address of the node with the last byte s
-func GetIPAdress(s byte) net.IP {
-	ipAddress := make(net.IP, len(BASE_IP_ADDRESS))
-	copy(ipAddress, BASE_IP_ADDRESS)
-	ipAddress[len(ipAddress)-1] = s
-	return ipAddress
+// isLocalAddress returns whether address is an address of this machine
+func isLocalAddress(address net.IP) bool {
+	interfaceAddresses, err := net.InterfaceAddrs()
+	if err != nil {
+		ErrorLogger.Println(err)
+		return false
+	}
+	for _, interfaceAddress := range interfaceAddresses {
+		if ipNet, ok := interfaceAddress.(*net.IPNet); ok && ipNet.IP.Equal(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEntry parses the entry node of a network, which is given by its IP address or by the host:port of its HTTP API
+func ParseEntry(entry string) (Member, error) {
+	if address := net.ParseIP(entry); address != nil {
+		return Member{Address: address}, nil
+	}
+	host, _, err := net.SplitHostPort(entry)
+	if err != nil {
+		return Member{}, err
+	}
+	address := net.ParseIP(host)
+	if address == nil {
+		return Member{}, fmt.Errorf("%q is no IP address", host)
+	}
+	return Member{Address: address, ClientURL: entry}, nil
+}
+
+// pathVariable returns the unescaped path variable name, paths are matched in their escaped form
+// so that variables can contain escaped slashes
+func pathVariable(r *http.Request, name string) (string, bool) {
+	value, ok := mux.Vars(r)[name]
+	if !ok {
+		return "", false
+	}
+
+	value, err := url.PathUnescape(value)
+	return value, err == nil
+}
+
+// requestKey returns the key of a client request. Keys are either the escaped remainder of the path,
+// e.g. `/read/services/api/host1`, or the `key` URL parameter, e.g. `/read?key=services%2Fapi%2Fhost1`.
+func requestKey(r *http.Request) (string, bool) {
+	if _, ok := mux.Vars(r)["key"]; ok {
+		return pathVariable(r, "key")
+	}
+
+	keys, ok := r.URL.Query()["key"]
+	if !ok || len(keys) != 1 || keys[0] == "" {
+		return "", false
+	}
+	return keys[0], true
 }
 
-// GetURL returns the url based on an address and the path
-func GetURL(ip net.IP, path string) string {
-	return "http://" + ip.String() + PORT + path
+// KeyPath returns the path of an operation on key, which keeps every byte of the key intact
+func KeyPath(operation string, key string) string {
+	return operation + "?key=" + url.QueryEscape(key)
+}
+
+// limitRequestSize rejects requests with a body larger than maxSize before they are handled,
+// rejections are written by respond
+func limitRequestSize(maxSize int64, respond func(w http.ResponseWriter, statusCode int, infoMessage InfoMessage)) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxSize {
+				respond(w, http.StatusRequestEntityTooLarge, StatusRequestTooLargeMessage)
+				return
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSize+1))
+			if err != nil {
+				respond(w, http.StatusBadRequest, StatusBadBodyMessage)
+				return
+			}
+			if int64(len(body)) > maxSize {
+				respond(w, http.StatusRequestEntityTooLarge, StatusRequestTooLargeMessage)
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func respondInfoMessage(w http.ResponseWriter, statusCode int, infoMessage InfoMessage) {
+	RespondJSON(w, statusCode, infoMessage)
 }
 
 func RespondJSON(w http.ResponseWriter, statusCode int, response interface{}) {
@@ -42,8 +127,9 @@ func RespondJSON(w http.ResponseWriter, statusCode int, response interface{}) {
 		return
 	}
 
-	w.WriteHeader(statusCode)
+	// Headers have to be set before the status code is written
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 	w.Write(payload)
 }
 
@@ -87,6 +173,9 @@ func TestEqualStateResponse(resp *http.Response, expectedStatusCode int, expecte
 		ErrorLogger.Printf("Could not parse response body\n")
 		return false
 	}
+	if actualResponse.KeyValueStore == nil || expectedResponse.KeyValueStore == nil {
+		return actualResponse.KeyValueStore == expectedResponse.KeyValueStore && actualResponse.InfoMessage == expectedResponse.InfoMessage
+	}
 
 	actualDatabaseLog := actualResponse.KeyValueStore.DatabaseLog
 	actualResponse.KeyValueStore.DatabaseLog = nil
@@ -94,6 +183,13 @@ func TestEqualStateResponse(resp *http.Response, expectedStatusCode int, expecte
 	expectedDatabaseLog := expectedResponse.KeyValueStore.DatabaseLog
 	expectedResponse.KeyValueStore.DatabaseLog = nil
 
+	// Empty content types are omitted in the response, so they are compared by content
+	actualContentTypes := actualResponse.KeyValueStore.ContentTypes
+	actualResponse.KeyValueStore.ContentTypes = nil
+
+	expectedContentTypes := expectedResponse.KeyValueStore.ContentTypes
+	expectedResponse.KeyValueStore.ContentTypes = nil
+
 	equal := reflect.DeepEqual(actualResponse, expectedResponse)
 	equal = equal && (len(actualDatabaseLog) == len(expectedDatabaseLog))
 	if equal {
@@ -101,13 +197,20 @@ func TestEqualStateResponse(resp *http.Response, expectedStatusCode int, expecte
 			// Hash, Time cannot be compared, since it was created externally
 			equal = equal &&
 				log.Key == expectedDatabaseLog[index].Key &&
-				log.Value == expectedDatabaseLog[index].Value &&
+				bytes.Equal(log.Value, expectedDatabaseLog[index].Value) &&
 				log.Committed == expectedDatabaseLog[index].Committed
 		}
 	}
 
+	equal = equal && (len(actualContentTypes) == len(expectedContentTypes))
+	for key, contentType := range actualContentTypes {
+		equal = equal && expectedContentTypes[key] == contentType
+	}
+
 	actualResponse.KeyValueStore.DatabaseLog = actualDatabaseLog
 	expectedResponse.KeyValueStore.DatabaseLog = expectedDatabaseLog
+	actualResponse.KeyValueStore.ContentTypes = actualContentTypes
+	expectedResponse.KeyValueStore.ContentTypes = expectedContentTypes
 
 	if !equal {
 		actualJSON, _ := json.Marshal(actualResponse)
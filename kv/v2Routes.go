@@ -0,0 +1,198 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// The v2 client API accepts JSON request bodies only and responds with a V2Response envelope.
+// Failures carry a machine-readable error code next to the HTTP status code, the status
+// messages of the first version are used as the human-readable part.
+
+type v2Error struct {
+	statusCode int
+	code       string
+}
+
+var v2Errors = map[InfoMessage]v2Error{
+	StatusBadBodyMessage:              {http.StatusBadRequest, ErrorCodeBadRequest},
+	StatusUnsupportedMediaTypeMessage: {http.StatusUnsupportedMediaType, ErrorCodeUnsupportedMediaType},
+	StatusRouteNotFoundMessage:        {http.StatusNotFound, ErrorCodeRouteNotFound},
+	StatusMethodNotAllowedMessage:     {http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed},
+	StatusRequestTooLargeMessage:      {http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge},
+	StatusValueTooLargeMessage:        {http.StatusRequestEntityTooLarge, ErrorCodeValueTooLarge},
+	StatusEmptyKeyMessage:             {http.StatusBadRequest, ErrorCodeEmptyKey},
+	StatusValueNotFoundMessage:        {http.StatusNotFound, ErrorCodeKeyNotFound},
+	StatusCompareFailedMessage:        {http.StatusConflict, ErrorCodeCompareFailed},
+	StatusNotANumberMessage:           {http.StatusConflict, ErrorCodeNotANumber},
+	StatusNumberOverflowMessage:       {http.StatusConflict, ErrorCodeNumberOverflow},
+	StatusLeaseNotFoundMessage:        {http.StatusNotFound, ErrorCodeLeaseNotFound},
+	StatusLeaderUnavailableMessage:    {http.StatusServiceUnavailable, ErrorCodeLeaderUnavailable},
+}
+
+//
+// Status
+//
+
+// handleV2Status responds with the header of this node, which lets clients find the leader
+func (kv *KeyValueStore) handleV2Status(w http.ResponseWriter, r *http.Request) {
+	kv.respondV2(w, StatusOKMessage, V2Response{})
+}
+
+//
+// Read
+//
+
+func (kv *KeyValueStore) handleV2Get(w http.ResponseWriter, r *http.Request) {
+	var request V2KeyRequest
+	if !kv.readV2Request(w, r, &request) {
+		return
+	}
+
+	keyValue, infoMessage := kv.get(request.Key)
+	kv.respondV2(w, infoMessage, V2Response{KV: keyValue})
+}
+
+func (kv *KeyValueStore) handleV2Range(w http.ResponseWriter, r *http.Request) {
+	var request V2RangeRequest
+	if !kv.readV2Request(w, r, &request) {
+		return
+	}
+	if request.Limit < 0 {
+		kv.respondV2(w, StatusBadBodyMessage, V2Response{})
+		return
+	}
+
+	kv.respondV2(w, StatusOKMessage, V2Response{KVs: kv.rangeKeyValues(request.Prefix, request.Limit)})
+}
+
+//
+// Write
+//
+
+func (kv *KeyValueStore) handleV2Put(w http.ResponseWriter, r *http.Request) {
+	var request V2PutRequest
+	if !kv.readV2Request(w, r, &request) {
+		return
+	}
+
+	keyValue, infoMessage := kv.put(request.Key, request.Value, request.Lease)
+	kv.respondV2(w, infoMessage, V2Response{KV: keyValue})
+}
+
+// handleV2Delete responds with the deleted value
+func (kv *KeyValueStore) handleV2Delete(w http.ResponseWriter, r *http.Request) {
+	var request V2KeyRequest
+	if !kv.readV2Request(w, r, &request) {
+		return
+	}
+
+	keyValue, infoMessage := kv.remove(request.Key)
+	kv.respondV2(w, infoMessage, V2Response{KV: keyValue})
+}
+
+// handleV2CompareAndSwap responds with the current value if the comparison fails
+func (kv *KeyValueStore) handleV2CompareAndSwap(w http.ResponseWriter, r *http.Request) {
+	var request V2CompareAndSwapRequest
+	if !kv.readV2Request(w, r, &request) {
+		return
+	}
+
+	expected := request.Expected
+	if request.ExpectAbsent {
+		expected = nil
+	} else if expected == nil {
+		expected = []byte{}
+	}
+
+	keyValue, infoMessage := kv.compareAndSwap(request.Key, expected, request.Value, request.Lease)
+	kv.respondV2(w, infoMessage, V2Response{KV: keyValue})
+}
+
+func (kv *KeyValueStore) handleV2Increment(w http.ResponseWriter, r *http.Request) {
+	var request V2IncrementRequest
+	if !kv.readV2Request(w, r, &request) {
+		return
+	}
+
+	var delta int64 = 1
+	if request.Delta != nil {
+		delta = *request.Delta
+	}
+
+	keyValue, infoMessage := kv.increment(request.Key, delta)
+	kv.respondV2(w, infoMessage, V2Response{KV: keyValue})
+}
+
+//
+// Utils
+//
+
+// readV2Request decodes the JSON body of a request into request on the leader and proxies it
+// to the leader on followers. It returns false once the request has been responded to.
+func (kv *KeyValueStore) readV2Request(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+			kv.respondV2Error(w, StatusUnsupportedMediaTypeMessage)
+			return false
+		}
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if !kv.IsLeader() {
+		InfoLogger.Println("Proxying v2 request to leader")
+		kv.proxyV2Request(w, r, body)
+		return false
+	}
+
+	if err := json.Unmarshal(body, request); err != nil {
+		kv.respondV2Error(w, StatusBadBodyMessage)
+		return false
+	}
+	return true
+}
+
+func (kv *KeyValueStore) proxyV2Request(w http.ResponseWriter, r *http.Request, body []byte) {
+	proxyResp, err := kv.transport.Post(kv.leaderMember(), r.URL.RequestURI(), "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		ErrorLogger.Println(err)
+		kv.respondV2Error(w, StatusLeaderUnavailableMessage)
+		return
+	}
+	defer proxyResp.Body.Close()
+
+	// The response of the leader already describes the cluster
+	for _, header := range []string{"Content-Type", REVISION_HEADER, TERM_HEADER, LEADER_HEADER} {
+		w.Header().Set(header, proxyResp.Header.Get(header))
+	}
+	w.WriteHeader(proxyResp.StatusCode)
+	io.Copy(w, proxyResp.Body)
+}
+
+// respondV2 completes the header of response and sends it, the status code and the error follow from infoMessage
+func (kv *KeyValueStore) respondV2(w http.ResponseWriter, infoMessage InfoMessage, response V2Response) {
+	statusCode := http.StatusOK
+	if infoMessage != StatusOKMessage {
+		mapped, ok := v2Errors[infoMessage]
+		if !ok {
+			mapped = v2Error{http.StatusInternalServerError, ErrorCodeInternal}
+		}
+		statusCode = mapped.statusCode
+		response.Error = &ErrorMessage{Code: mapped.code, Message: infoMessage.Message}
+	}
+	response.Header = kv.responseHeader()
+
+	w.Header().Set(REVISION_HEADER, strconv.FormatInt(response.Header.Revision, 10))
+	w.Header().Set(TERM_HEADER, strconv.FormatUint(response.Header.Term, 10))
+	w.Header().Set(LEADER_HEADER, response.Header.Leader.String())
+	RespondJSON(w, statusCode, response)
+}
+
+func (kv *KeyValueStore) respondV2Error(w http.ResponseWriter, infoMessage InfoMessage) {
+	kv.respondV2(w, infoMessage, V2Response{})
+}
@@ -0,0 +1,115 @@
+package kv
+
+import "strings"
+
+// Types of watch events
+const (
+	EventPut    = "put"
+	EventDelete = "delete"
+)
+
+// WatchEvent is a change of a key, which was committed with the log at Revision.
+// CreateRevision and Version describe the key after a put, they are zero for deletes.
+type WatchEvent struct {
+	Type           string
+	Key            string
+	Value          []byte
+	Lease          int64
+	Revision       int64
+	CreateRevision int64
+	Version        int64
+}
+
+// watcher receives the events of all keys it matches, the events channel
+// is closed once the watcher falls behind
+type watcher struct {
+	match  func(key string) bool
+	events chan WatchEvent
+}
+
+// watch registers a watcher on every change of keys starting with prefix committed on this node from now on
+func (kv *KeyValueStore) watch(prefix string) *watcher {
+	return kv.watchKeys(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// watchKeys registers a watcher on every change of keys matched by match committed on this node from now on
+func (kv *KeyValueStore) watchKeys(match func(key string) bool) *watcher {
+	w := &watcher{match: match, events: make(chan WatchEvent, WATCH_BUFFER_SIZE)}
+
+	kv.watchMutex.Lock()
+	kv.watchers[w] = true
+	kv.watchMutex.Unlock()
+	return w
+}
+
+// watchKeysFrom registers a watcher like watchKeys, which first receives the events since revision.
+// It fails if the event history no longer reaches back to revision, and returns the oldest revision it does.
+func (kv *KeyValueStore) watchKeysFrom(match func(key string) bool, revision int64) (*watcher, int64, bool) {
+	kv.watchMutex.Lock()
+	defer kv.watchMutex.Unlock()
+
+	if revision < kv.eventHistoryRevision {
+		return nil, kv.eventHistoryRevision, false
+	}
+
+	w := &watcher{match: match, events: make(chan WatchEvent, WATCH_BUFFER_SIZE)}
+	for _, event := range kv.eventHistory {
+		if event.Revision < revision || !match(event.Key) {
+			continue
+		}
+
+		select {
+		case w.events <- event:
+		default:
+			return nil, kv.eventHistoryRevision, false
+		}
+	}
+	kv.watchers[w] = true
+	return w, kv.eventHistoryRevision, true
+}
+
+func (kv *KeyValueStore) unwatch(w *watcher) {
+	kv.watchMutex.Lock()
+	defer kv.watchMutex.Unlock()
+
+	if kv.watchers[w] {
+		delete(kv.watchers, w)
+		close(w.events)
+	}
+}
+
+// publishEvents passes the events of a committed log to the watchers, without ever blocking the commit
+func (kv *KeyValueStore) publishEvents(events []WatchEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	kv.watchMutex.Lock()
+	defer kv.watchMutex.Unlock()
+
+	kv.eventHistory = append(kv.eventHistory, events...)
+	if overflow := len(kv.eventHistory) - WATCH_HISTORY_SIZE; overflow > 0 {
+		// Events of the oldest remaining revision may be incomplete now
+		kv.eventHistoryRevision = kv.eventHistory[overflow-1].Revision + 1
+		kv.eventHistory = append([]WatchEvent(nil), kv.eventHistory[overflow:]...)
+	}
+
+	for w := range kv.watchers {
+		for _, event := range events {
+			if !w.match(event.Key) {
+				continue
+			}
+
+			select {
+			case w.events <- event:
+			default:
+				InfoLogger.Println("Cancelling watcher that fell behind")
+				delete(kv.watchers, w)
+				close(w.events)
+			}
+			if !kv.watchers[w] {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package linearizability
+
+import (
+	"math"
+	"sort"
+)
+
+// The checker follows the algorithm of Wing & Gong with the memoization of Lowe, like Porcupine: it
+// searches for an order of the operations that respects their real time order and is accepted by
+// the model. Histories are split into independent partitions first, e.g. one per key.
+
+// PENDING is the return time of operations whose response never arrived. They may take effect at
+// any point after their invocation, or not at all.
+const PENDING = math.MaxInt64
+
+// Operation was invoked by a client at Call and responded with Output at Return, times are in
+// nanoseconds since any common start
+type Operation struct {
+	Client int
+	Input  interface{}
+	// Outputs of pending operations are nil
+	Output interface{}
+	Call   int64
+	Return int64
+}
+
+// Model describes the sequential behaviour of the system
+type Model struct {
+	// Partition splits the history into independent histories, all operations are checked at once if nil
+	Partition func(history []Operation) [][]Operation
+	Init      func() interface{}
+	// Step applies the operation to state and reports whether the output is possible in state
+	Step func(state interface{}, input interface{}, output interface{}) (bool, interface{})
+	// Equal compares states, states are compared with == if nil
+	Equal func(a interface{}, b interface{}) bool
+	// Supported reports whether every output of the history could be caused by its operations, e.g. every
+	// read value was written. Counterexamples stay supported, so they do not consist of unexplained reads.
+	Supported func(history []Operation) bool
+
+	DescribeOperation func(input interface{}, output interface{}) string
+	DescribeState     func(state interface{}) string
+}
+
+// Result is linearizable or holds a counterexample, a part of a partition of the history that cannot be
+// linearized and from which no single operation can be removed without making it linearizable or unsupported
+type Result struct {
+	Linearizable   bool
+	Counterexample []Operation
+}
+
+// Check checks whether the history is linearizable with respect to the model. Only the counterexample
+// of the first partition that cannot be linearized is reported.
+func Check(model Model, history []Operation) Result {
+	partitions := [][]Operation{history}
+	if model.Partition != nil {
+		partitions = model.Partition(history)
+	}
+
+	for _, partition := range partitions {
+		if !checkPartition(model, partition) {
+			return Result{Linearizable: false, Counterexample: minimize(model, partition)}
+		}
+	}
+	return Result{Linearizable: true}
+}
+
+// minimize removes operations from the history as long as it cannot be linearized
+func minimize(model Model, history []Operation) []Operation {
+	supported := func(history []Operation) bool { return true }
+	if model.Supported != nil && model.Supported(history) {
+		supported = model.Supported
+	}
+
+	counterexample := append([]Operation(nil), history...)
+	for removed := true; removed; {
+		removed = false
+		for index := 0; index < len(counterexample); index++ {
+			candidate := append(append([]Operation(nil), counterexample[:index]...), counterexample[index+1:]...)
+			if supported(candidate) && !checkPartition(model, candidate) {
+				counterexample = candidate
+				removed = true
+				index--
+			}
+		}
+	}
+	return counterexample
+}
+
+//
+// Search
+//
+
+// entry is the call or the return of an operation in the doubly linked list of all entries
+type entry struct {
+	operation int
+	call      bool
+	// Return entry of a call entry
+	match *entry
+
+	previous *entry
+	next     *entry
+}
+
+// entries returns the head of the list of all calls and returns in real time order. Calls come before
+// returns at the same time, so such operations are considered concurrent.
+func entries(history []Operation) *entry {
+	list := make([]*entry, 0, 2*len(history))
+	times := make(map[*entry]int64, 2*len(history))
+	for index, operation := range history {
+		returnEntry := &entry{operation: index}
+		callEntry := &entry{operation: index, call: true, match: returnEntry}
+		list = append(list, callEntry, returnEntry)
+		times[callEntry] = operation.Call
+		times[returnEntry] = operation.Return
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if times[list[i]] != times[list[j]] {
+			return times[list[i]] < times[list[j]]
+		}
+		return list[i].call && !list[j].call
+	})
+
+	head := &entry{operation: -1}
+	last := head
+	for _, entry := range list {
+		last.next = entry
+		entry.previous = last
+		last = entry
+	}
+	return head
+}
+
+// lift removes the call entry and its return entry from the list
+func lift(call *entry) {
+	call.previous.next = call.next
+	if call.next != nil {
+		call.next.previous = call.previous
+	}
+	match := call.match
+	match.previous.next = match.next
+	if match.next != nil {
+		match.next.previous = match.previous
+	}
+}
+
+// unlift inserts the entries removed by lift again
+func unlift(call *entry) {
+	match := call.match
+	match.previous.next = match
+	if match.next != nil {
+		match.next.previous = match
+	}
+	call.previous.next = call
+	if call.next != nil {
+		call.next.previous = call
+	}
+}
+
+type bitset []uint64
+
+func newBitset(size int) bitset {
+	return make(bitset, (size+63)/64)
+}
+
+func (b bitset) set(index int) bitset {
+	b[index/64] |= 1 << uint(index%64)
+	return b
+}
+
+func (b bitset) clear(index int) bitset {
+	b[index/64] &^= 1 << uint(index%64)
+	return b
+}
+
+func (b bitset) clone() bitset {
+	return append(bitset(nil), b...)
+}
+
+func (b bitset) key() string {
+	key := make([]byte, 8*len(b))
+	for index, word := range b {
+		for shift := 0; shift < 8; shift++ {
+			key[8*index+shift] = byte(word >> uint(8*shift))
+		}
+	}
+	return string(key)
+}
+
+// checkPartition searches depth first for an order in which the model accepts all operations. Combinations
+// of linearized operations and states that were already visited are not searched again.
+func checkPartition(model Model, history []Operation) bool {
+	equal := model.Equal
+	if equal == nil {
+		equal = func(a interface{}, b interface{}) bool { return a == b }
+	}
+
+	type call struct {
+		entry *entry
+		state interface{}
+	}
+	var calls []call
+	visited := make(map[string][]interface{})
+	linearized := newBitset(len(history))
+	state := model.Init()
+
+	head := entries(history)
+	current := head.next
+	for head.next != nil {
+		if current.call {
+			operation := history[current.operation]
+			if ok, newState := model.Step(state, operation.Input, operation.Output); ok {
+				newLinearized := linearized.clone().set(current.operation)
+				key := newLinearized.key()
+				seen := false
+				for _, visitedState := range visited[key] {
+					if equal(visitedState, newState) {
+						seen = true
+						break
+					}
+				}
+				if !seen {
+					visited[key] = append(visited[key], newState)
+					calls = append(calls, call{current, state})
+					state = newState
+					linearized.set(current.operation)
+					lift(current)
+					current = head.next
+					continue
+				}
+			}
+			current = current.next
+		} else {
+			// The operation returned before any remaining operation could be linearized, so backtrack
+			if len(calls) == 0 {
+				return false
+			}
+			top := calls[len(calls)-1]
+			calls = calls[:len(calls)-1]
+			state = top.state
+			linearized.clear(top.entry.operation)
+			unlift(top.entry)
+			current = top.entry.next
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package linearizability
+
+import (
+	"strings"
+	"testing"
+)
+
+func read(client int, key string, call int64, ret int64, value string, found bool) Operation {
+	return Operation{Client: client, Input: KVInput{Operation: KVRead, Key: key}, Output: KVOutput{Value: value, Found: found}, Call: call, Return: ret}
+}
+
+func write(client int, key string, call int64, ret int64, value string) Operation {
+	return Operation{Client: client, Input: KVInput{Operation: KVWrite, Key: key, Value: value}, Output: KVOutput{}, Call: call, Return: ret}
+}
+
+func compareAndSwap(client int, key string, call int64, ret int64, expected *string, value string, swapped bool) Operation {
+	return Operation{Client: client, Input: KVInput{Operation: KVCompareAndSwap, Key: key, Expected: expected, Value: value}, Output: KVOutput{Swapped: swapped}, Call: call, Return: ret}
+}
+
+func pending(operation Operation) Operation {
+	operation.Output = nil
+	operation.Return = PENDING
+	return operation
+}
+
+func value(value string) *string {
+	return &value
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		history      []Operation
+		linearizable bool
+	}{
+		{"sequential", []Operation{
+			read(0, "x", 0, 1, "", false),
+			write(0, "x", 2, 3, "1"),
+			read(1, "x", 4, 5, "1", true),
+		}, true},
+		{"stale read", []Operation{
+			write(0, "x", 0, 1, "1"),
+			write(0, "x", 2, 3, "2"),
+			read(1, "x", 4, 5, "1", true),
+		}, false},
+		// Concurrent writes may take effect in either order
+		{"concurrent writes", []Operation{
+			write(0, "x", 0, 10, "1"),
+			write(1, "x", 1, 9, "2"),
+			read(2, "x", 11, 12, "1", true),
+		}, true},
+		// Once a read observed the new value, later reads must not observe the old one
+		{"new then old", []Operation{
+			write(0, "x", 0, 10, "1"),
+			read(1, "x", 1, 2, "1", true),
+			read(2, "x", 3, 4, "", false),
+		}, false},
+		{"compare and swap", []Operation{
+			compareAndSwap(0, "x", 0, 1, nil, "1", true),
+			compareAndSwap(1, "x", 2, 5, value("1"), "2", true),
+			compareAndSwap(2, "x", 3, 6, value("1"), "3", false),
+			read(0, "x", 7, 8, "2", true),
+		}, true},
+		{"both swapped", []Operation{
+			write(0, "x", 0, 1, "1"),
+			compareAndSwap(1, "x", 2, 5, value("1"), "2", true),
+			compareAndSwap(2, "x", 3, 6, value("1"), "3", true),
+		}, false},
+		// Pending writes may take effect at any time after their call, or never
+		{"pending write", []Operation{
+			pending(write(0, "x", 0, 1, "1")),
+			read(1, "x", 2, 3, "", false),
+			read(1, "x", 4, 5, "1", true),
+		}, true},
+		{"pending write observed before its call", []Operation{
+			read(1, "x", 0, 1, "1", true),
+			pending(write(0, "x", 2, 3, "1")),
+		}, false},
+		// Keys are independent registers
+		{"independent keys", []Operation{
+			write(0, "x", 0, 1, "1"),
+			write(0, "y", 2, 3, "2"),
+			read(1, "y", 4, 5, "2", true),
+			read(1, "x", 6, 7, "1", true),
+		}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Check(KVModel, test.history)
+			if result.Linearizable != test.linearizable {
+				t.Fatalf("history is linearizable: %t, expected %t\n%s", result.Linearizable, test.linearizable, result.Describe(KVModel))
+			}
+		})
+	}
+}
+
+func TestMinimalCounterexample(t *testing.T) {
+	history := []Operation{
+		write(0, "x", 0, 1, "1"),
+		read(1, "x", 2, 3, "1", true),
+		write(2, "x", 4, 5, "2"),
+		read(1, "x", 6, 9, "2", true),
+		write(0, "x", 7, 8, "3"),
+		read(2, "x", 10, 11, "2", true),
+		read(1, "x", 12, 13, "3", true),
+		write(0, "y", 14, 15, "1"),
+	}
+
+	result := Check(KVModel, history)
+	if result.Linearizable {
+		t.Fatal("stale read was not detected")
+	}
+	// The write of "3" completed after the write of "2" and before the read of "2", nothing else is needed to show the violation
+	if len(result.Counterexample) != 3 {
+		t.Fatalf("counterexample is not minimal\n%s", result.Describe(KVModel))
+	}
+	description := result.Describe(KVModel)
+	if !strings.Contains(description, `write(x, "2")`) || !strings.Contains(description, `write(x, "3")`) || !strings.Contains(description, `read(x) -> "2"`) {
+		t.Fatalf("counterexample does not show the stale read\n%s", description)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder()
+	writeID := recorder.Invoke(0, KVInput{Operation: KVWrite, Key: "x", Value: "1"})
+	readID := recorder.Invoke(1, KVInput{Operation: KVRead, Key: "x"})
+	recorder.Return(readID, KVOutput{Value: "1", Found: true})
+
+	history := recorder.History()
+	if history[writeID].Return != PENDING || history[writeID].Output != nil {
+		t.Fatalf("write without response is not pending: %+v", history[writeID])
+	}
+	if history[readID].Return < history[readID].Call {
+		t.Fatalf("read returned before its call: %+v", history[readID])
+	}
+	if result := Check(KVModel, history); !result.Linearizable {
+		t.Fatalf("read of a pending write is not linearizable\n%s", result.Describe(KVModel))
+	}
+}
+
+func TestVisualize(t *testing.T) {
+	var timeline strings.Builder
+	Visualize(&timeline, KVModel, []Operation{
+		pending(write(0, "x", 0, 1, "1")),
+		read(0, "x", 2, 3, "1", true),
+		read(1, "x", 1, 4, "", false),
+	})
+
+	lines := strings.Split(strings.TrimSpace(timeline.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `[write(x, "1") -> ?>`) || !strings.Contains(lines[1], "[read(x) -> <none>") {
+		t.Fatalf("unexpected timeline\n%s", timeline.String())
+	}
+}
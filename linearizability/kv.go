@@ -0,0 +1,154 @@
+package linearizability
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The key value model treats every key as an independent register, which reads, writes and compare and swaps access
+
+type KVOperation int
+
+const (
+	KVRead KVOperation = iota
+	KVWrite
+	KVCompareAndSwap
+)
+
+type KVInput struct {
+	Operation KVOperation
+	Key       string
+	Value     string
+	// Compare and swaps with a nil expected value only succeed if the key does not exist
+	Expected *string
+}
+
+type KVOutput struct {
+	// Read value, reads of keys that do not exist are not found
+	Value string
+	Found bool
+	// Whether a compare and swap replaced the value
+	Swapped bool
+}
+
+// register is the state of a single key
+type register struct {
+	value  string
+	exists bool
+}
+
+var KVModel = Model{
+	Partition: partitionByKey,
+	Init: func() interface{} {
+		return register{}
+	},
+	Step:              stepKV,
+	Supported:         supportedKV,
+	DescribeOperation: describeKVOperation,
+	DescribeState: func(state interface{}) string {
+		if !state.(register).exists {
+			return "<none>"
+		}
+		return fmt.Sprintf("%q", state.(register).value)
+	},
+}
+
+func partitionByKey(history []Operation) [][]Operation {
+	byKey := make(map[string][]Operation)
+	for _, operation := range history {
+		key := operation.Input.(KVInput).Key
+		byKey[key] = append(byKey[key], operation)
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	partitions := make([][]Operation, len(keys))
+	for index, key := range keys {
+		partitions[index] = byKey[key]
+	}
+	return partitions
+}
+
+// stepKV accepts any output of pending operations, their effect only depends on the state
+func stepKV(state interface{}, input interface{}, output interface{}) (bool, interface{}) {
+	current := state.(register)
+	kvInput := input.(KVInput)
+	kvOutput, known := output.(KVOutput)
+
+	switch kvInput.Operation {
+	case KVRead:
+		if !known {
+			return true, current
+		}
+		return kvOutput.Found == current.exists && (!current.exists || kvOutput.Value == current.value), current
+	case KVWrite:
+		return true, register{value: kvInput.Value, exists: true}
+	case KVCompareAndSwap:
+		matches := current.exists && kvInput.Expected != nil && *kvInput.Expected == current.value ||
+			!current.exists && kvInput.Expected == nil
+		if known && kvOutput.Swapped != matches {
+			return false, current
+		}
+		if matches {
+			return true, register{value: kvInput.Value, exists: true}
+		}
+		return true, current
+	}
+	return false, current
+}
+
+// supportedKV checks that every value that was read or compared was written by an operation of the history
+func supportedKV(history []Operation) bool {
+	written := make(map[string]bool)
+	for _, operation := range history {
+		if input := operation.Input.(KVInput); input.Operation != KVRead {
+			written[input.Value] = true
+		}
+	}
+
+	for _, operation := range history {
+		input := operation.Input.(KVInput)
+		output, known := operation.Output.(KVOutput)
+		if input.Operation == KVRead && known && output.Found && !written[output.Value] {
+			return false
+		}
+		if input.Operation == KVCompareAndSwap && known && output.Swapped && input.Expected != nil && !written[*input.Expected] {
+			return false
+		}
+	}
+	return true
+}
+
+func describeKVOperation(input interface{}, output interface{}) string {
+	kvInput := input.(KVInput)
+	kvOutput, known := output.(KVOutput)
+
+	var description string
+	switch kvInput.Operation {
+	case KVRead:
+		description = fmt.Sprintf("read(%s)", kvInput.Key)
+		if known && kvOutput.Found {
+			description += fmt.Sprintf(" -> %q", kvOutput.Value)
+		} else if known {
+			description += " -> <none>"
+		}
+	case KVWrite:
+		description = fmt.Sprintf("write(%s, %q)", kvInput.Key, kvInput.Value)
+	case KVCompareAndSwap:
+		expected := "<none>"
+		if kvInput.Expected != nil {
+			expected = fmt.Sprintf("%q", *kvInput.Expected)
+		}
+		description = fmt.Sprintf("cas(%s, %s, %q)", kvInput.Key, expected, kvInput.Value)
+		if known {
+			description += fmt.Sprintf(" -> %t", kvOutput.Swapped)
+		}
+	}
+	if !known {
+		description += " -> ?"
+	}
+	return description
+}
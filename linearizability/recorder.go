@@ -0,0 +1,47 @@
+package linearizability
+
+import (
+	"sync"
+	"time"
+)
+
+// Recorder records the history of concurrent clients. Operations that are never returned stay pending.
+type Recorder struct {
+	start      time.Time
+	operations []Operation
+	mutex      sync.Mutex
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{start: time.Now()}
+}
+
+// Invoke records the call of an operation and returns its id
+func (r *Recorder) Invoke(client int, input interface{}) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.operations = append(r.operations, Operation{
+		Client: client,
+		Input:  input,
+		Call:   int64(time.Since(r.start)),
+		Return: PENDING,
+	})
+	return len(r.operations) - 1
+}
+
+// Return records the response of the operation with the given id
+func (r *Recorder) Return(id int, output interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.operations[id].Output = output
+	r.operations[id].Return = int64(time.Since(r.start))
+}
+
+func (r *Recorder) History() []Operation {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Operation(nil), r.operations...)
+}
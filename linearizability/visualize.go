@@ -0,0 +1,91 @@
+package linearizability
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Visualize draws the operations on a timeline with one line per client. Times are replaced by
+// their order, so only the overlap of operations is shown:
+//
+//	client 0 |[write(x, "1")]
+//	client 1 |      [read(x) -> "2"    ]
+//	client 2 |          [write(x, "2") -> ?>
+func Visualize(w io.Writer, model Model, operations []Operation) {
+	describe := model.DescribeOperation
+	if describe == nil {
+		describe = func(input interface{}, output interface{}) string { return fmt.Sprintf("%v -> %v", input, output) }
+	}
+	descriptions := make([]string, len(operations))
+	for index, operation := range operations {
+		descriptions[index] = describe(operation.Input, operation.Output)
+	}
+
+	// Every operation is at least as wide as its description
+	times := make([]int64, 0, 2*len(operations))
+	for _, operation := range operations {
+		times = append(times, operation.Call, operation.Return)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	column := make(map[int64]int, len(times))
+	next := 0
+	for _, time := range times {
+		if _, ok := column[time]; ok {
+			continue
+		}
+		column[time] = next
+		for index, operation := range operations {
+			if operation.Return == time && time != PENDING && column[operation.Call]+len(descriptions[index])+2 > column[time] {
+				column[time] = column[operation.Call] + len(descriptions[index]) + 2
+			}
+		}
+		next = column[time] + 2
+	}
+
+	clients := make([]int, 0)
+	byClient := make(map[int][]int)
+	for index, operation := range operations {
+		if _, ok := byClient[operation.Client]; !ok {
+			clients = append(clients, operation.Client)
+		}
+		byClient[operation.Client] = append(byClient[operation.Client], index)
+	}
+	sort.Ints(clients)
+
+	for _, client := range clients {
+		indices := byClient[client]
+		sort.Slice(indices, func(i, j int) bool { return operations[indices[i]].Call < operations[indices[j]].Call })
+
+		var line strings.Builder
+		for _, index := range indices {
+			operation := operations[index]
+			// Pending operations are drawn up to the end of their description, which may overlap the next one
+			if padding := column[operation.Call] - line.Len(); padding > 0 {
+				line.WriteString(strings.Repeat(" ", padding))
+			}
+			if operation.Return == PENDING {
+				line.WriteString("[" + descriptions[index] + ">")
+			} else {
+				width := column[operation.Return] - column[operation.Call]
+				line.WriteString("[" + descriptions[index] + strings.Repeat(" ", width-len(descriptions[index])-2) + "]")
+			}
+		}
+		fmt.Fprintf(w, "client %d |%s\n", client, line.String())
+	}
+}
+
+// Describe returns the visualization of the counterexample, or an empty string for linearizable histories
+func (r Result) Describe(model Model) string {
+	if r.Linearizable {
+		return ""
+	}
+	var description strings.Builder
+	fmt.Fprintln(&description, "history is not linearizable, minimal counterexample:")
+	Visualize(&description, model, r.Counterexample)
+	if model.DescribeState != nil {
+		fmt.Fprintf(&description, "initial state %s\n", model.DescribeState(model.Init()))
+	}
+	return description.String()
+}
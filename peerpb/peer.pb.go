@@ -0,0 +1,928 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: peerpb/peer.proto
+
+// Messages between nodes are versioned by their package, a new version is served next to the old one
+
+package peerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Follower struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Address             []byte                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	LastLogHash         string                 `protobuf:"bytes,2,opt,name=last_log_hash,json=lastLogHash,proto3" json:"last_log_hash,omitempty"`
+	LastCommitedLogHash string                 `protobuf:"bytes,3,opt,name=last_commited_log_hash,json=lastCommitedLogHash,proto3" json:"last_commited_log_hash,omitempty"`
+	// Members are identified by their ID, which is empty for initial members until they voted
+	Id        string `protobuf:"bytes,4,opt,name=id,proto3" json:"id,omitempty"`
+	PeerUrl   string `protobuf:"bytes,5,opt,name=peer_url,json=peerUrl,proto3" json:"peer_url,omitempty"`
+	ClientUrl string `protobuf:"bytes,6,opt,name=client_url,json=clientUrl,proto3" json:"client_url,omitempty"`
+	// URLs of the client protocols, empty if a protocol is not served
+	GrpcUrl       string `protobuf:"bytes,7,opt,name=grpc_url,json=grpcUrl,proto3" json:"grpc_url,omitempty"`
+	RedisUrl      string `protobuf:"bytes,8,opt,name=redis_url,json=redisUrl,proto3" json:"redis_url,omitempty"`
+	MemcachedUrl  string `protobuf:"bytes,9,opt,name=memcached_url,json=memcachedUrl,proto3" json:"memcached_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Follower) Reset() {
+	*x = Follower{}
+	mi := &file_peerpb_peer_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Follower) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Follower) ProtoMessage() {}
+
+func (x *Follower) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Follower.ProtoReflect.Descriptor instead.
+func (*Follower) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Follower) GetAddress() []byte {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *Follower) GetLastLogHash() string {
+	if x != nil {
+		return x.LastLogHash
+	}
+	return ""
+}
+
+func (x *Follower) GetLastCommitedLogHash() string {
+	if x != nil {
+		return x.LastCommitedLogHash
+	}
+	return ""
+}
+
+func (x *Follower) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Follower) GetPeerUrl() string {
+	if x != nil {
+		return x.PeerUrl
+	}
+	return ""
+}
+
+func (x *Follower) GetClientUrl() string {
+	if x != nil {
+		return x.ClientUrl
+	}
+	return ""
+}
+
+func (x *Follower) GetGrpcUrl() string {
+	if x != nil {
+		return x.GrpcUrl
+	}
+	return ""
+}
+
+func (x *Follower) GetRedisUrl() string {
+	if x != nil {
+		return x.RedisUrl
+	}
+	return ""
+}
+
+func (x *Follower) GetMemcachedUrl() string {
+	if x != nil {
+		return x.MemcachedUrl
+	}
+	return ""
+}
+
+type HeartBeatRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Term      uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	Followers []*Follower            `protobuf:"bytes,2,rep,name=followers,proto3" json:"followers,omitempty"`
+	LeaderId  string                 `protobuf:"bytes,3,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
+	// Address and URLs of the leader, its ID is leader_id
+	Leader        *Follower `protobuf:"bytes,4,opt,name=leader,proto3" json:"leader,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartBeatRequest) Reset() {
+	*x = HeartBeatRequest{}
+	mi := &file_peerpb_peer_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartBeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartBeatRequest) ProtoMessage() {}
+
+func (x *HeartBeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartBeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartBeatRequest) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *HeartBeatRequest) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *HeartBeatRequest) GetFollowers() []*Follower {
+	if x != nil {
+		return x.Followers
+	}
+	return nil
+}
+
+func (x *HeartBeatRequest) GetLeaderId() string {
+	if x != nil {
+		return x.LeaderId
+	}
+	return ""
+}
+
+func (x *HeartBeatRequest) GetLeader() *Follower {
+	if x != nil {
+		return x.Leader
+	}
+	return nil
+}
+
+type HeartBeatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartBeatResponse) Reset() {
+	*x = HeartBeatResponse{}
+	mi := &file_peerpb_peer_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartBeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartBeatResponse) ProtoMessage() {}
+
+func (x *HeartBeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartBeatResponse.ProtoReflect.Descriptor instead.
+func (*HeartBeatResponse) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{2}
+}
+
+type PollRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Term             uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	NewLeaderAddress []byte                 `protobuf:"bytes,2,opt,name=new_leader_address,json=newLeaderAddress,proto3" json:"new_leader_address,omitempty"`
+	LastLogHash      string                 `protobuf:"bytes,3,opt,name=last_log_hash,json=lastLogHash,proto3" json:"last_log_hash,omitempty"`
+	CandidateId      string                 `protobuf:"bytes,4,opt,name=candidate_id,json=candidateId,proto3" json:"candidate_id,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *PollRequest) Reset() {
+	*x = PollRequest{}
+	mi := &file_peerpb_peer_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PollRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PollRequest) ProtoMessage() {}
+
+func (x *PollRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PollRequest.ProtoReflect.Descriptor instead.
+func (*PollRequest) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PollRequest) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *PollRequest) GetNewLeaderAddress() []byte {
+	if x != nil {
+		return x.NewLeaderAddress
+	}
+	return nil
+}
+
+func (x *PollRequest) GetLastLogHash() string {
+	if x != nil {
+		return x.LastLogHash
+	}
+	return ""
+}
+
+func (x *PollRequest) GetCandidateId() string {
+	if x != nil {
+		return x.CandidateId
+	}
+	return ""
+}
+
+type PollResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Vote  bool                   `protobuf:"varint,1,opt,name=vote,proto3" json:"vote,omitempty"`
+	// ID of the voter
+	Id            string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PollResponse) Reset() {
+	*x = PollResponse{}
+	mi := &file_peerpb_peer_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PollResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PollResponse) ProtoMessage() {}
+
+func (x *PollResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PollResponse.ProtoReflect.Descriptor instead.
+func (*PollResponse) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PollResponse) GetVote() bool {
+	if x != nil {
+		return x.Vote
+	}
+	return false
+}
+
+func (x *PollResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// LogEntry mirrors a log of the database log, its hash is not recomputed by the receiver.
+// Values are optional to tell empty values apart from logs without a value.
+type LogEntry struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Hash             string                 `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Time             *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Operation        string                 `protobuf:"bytes,3,opt,name=operation,proto3" json:"operation,omitempty"`
+	Key              string                 `protobuf:"bytes,4,opt,name=key,proto3" json:"key,omitempty"`
+	Value            []byte                 `protobuf:"bytes,5,opt,name=value,proto3,oneof" json:"value,omitempty"`
+	Committed        bool                   `protobuf:"varint,6,opt,name=committed,proto3" json:"committed,omitempty"`
+	ContentType      string                 `protobuf:"bytes,7,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Expected         []byte                 `protobuf:"bytes,8,opt,name=expected,proto3" json:"expected,omitempty"`
+	ExpectAbsent     bool                   `protobuf:"varint,9,opt,name=expect_absent,json=expectAbsent,proto3" json:"expect_absent,omitempty"`
+	Lease            int64                  `protobuf:"varint,10,opt,name=lease,proto3" json:"lease,omitempty"`
+	ExpectedRevision int64                  `protobuf:"varint,11,opt,name=expected_revision,json=expectedRevision,proto3" json:"expected_revision,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *LogEntry) Reset() {
+	*x = LogEntry{}
+	mi := &file_peerpb_peer_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEntry) ProtoMessage() {}
+
+func (x *LogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEntry.ProtoReflect.Descriptor instead.
+func (*LogEntry) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *LogEntry) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *LogEntry) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *LogEntry) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *LogEntry) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *LogEntry) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *LogEntry) GetCommitted() bool {
+	if x != nil {
+		return x.Committed
+	}
+	return false
+}
+
+func (x *LogEntry) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *LogEntry) GetExpected() []byte {
+	if x != nil {
+		return x.Expected
+	}
+	return nil
+}
+
+func (x *LogEntry) GetExpectAbsent() bool {
+	if x != nil {
+		return x.ExpectAbsent
+	}
+	return false
+}
+
+func (x *LogEntry) GetLease() int64 {
+	if x != nil {
+		return x.Lease
+	}
+	return 0
+}
+
+func (x *LogEntry) GetExpectedRevision() int64 {
+	if x != nil {
+		return x.ExpectedRevision
+	}
+	return 0
+}
+
+// AppendEntriesRequest holds the last committed log of the leader followed by the logs to append
+type AppendEntriesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*LogEntry            `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendEntriesRequest) Reset() {
+	*x = AppendEntriesRequest{}
+	mi := &file_peerpb_peer_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendEntriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendEntriesRequest) ProtoMessage() {}
+
+func (x *AppendEntriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendEntriesRequest.ProtoReflect.Descriptor instead.
+func (*AppendEntriesRequest) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AppendEntriesRequest) GetEntries() []*LogEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type AppendEntriesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendEntriesResponse) Reset() {
+	*x = AppendEntriesResponse{}
+	mi := &file_peerpb_peer_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendEntriesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendEntriesResponse) ProtoMessage() {}
+
+func (x *AppendEntriesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendEntriesResponse.ProtoReflect.Descriptor instead.
+func (*AppendEntriesResponse) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{7}
+}
+
+type CommitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LogHash       string                 `protobuf:"bytes,1,opt,name=log_hash,json=logHash,proto3" json:"log_hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitRequest) Reset() {
+	*x = CommitRequest{}
+	mi := &file_peerpb_peer_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitRequest) ProtoMessage() {}
+
+func (x *CommitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitRequest.ProtoReflect.Descriptor instead.
+func (*CommitRequest) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CommitRequest) GetLogHash() string {
+	if x != nil {
+		return x.LogHash
+	}
+	return ""
+}
+
+type CommitResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitResponse) Reset() {
+	*x = CommitResponse{}
+	mi := &file_peerpb_peer_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitResponse) ProtoMessage() {}
+
+func (x *CommitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitResponse.ProtoReflect.Descriptor instead.
+func (*CommitResponse) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{9}
+}
+
+type LeaderUpdateRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Leader   []byte                 `protobuf:"bytes,1,opt,name=leader,proto3" json:"leader,omitempty"`
+	Term     uint64                 `protobuf:"varint,2,opt,name=term,proto3" json:"term,omitempty"`
+	LeaderId string                 `protobuf:"bytes,3,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
+	// URLs the leader is reached at
+	PeerUrl       string `protobuf:"bytes,4,opt,name=peer_url,json=peerUrl,proto3" json:"peer_url,omitempty"`
+	ClientUrl     string `protobuf:"bytes,5,opt,name=client_url,json=clientUrl,proto3" json:"client_url,omitempty"`
+	GrpcUrl       string `protobuf:"bytes,6,opt,name=grpc_url,json=grpcUrl,proto3" json:"grpc_url,omitempty"`
+	RedisUrl      string `protobuf:"bytes,7,opt,name=redis_url,json=redisUrl,proto3" json:"redis_url,omitempty"`
+	MemcachedUrl  string `protobuf:"bytes,8,opt,name=memcached_url,json=memcachedUrl,proto3" json:"memcached_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaderUpdateRequest) Reset() {
+	*x = LeaderUpdateRequest{}
+	mi := &file_peerpb_peer_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaderUpdateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaderUpdateRequest) ProtoMessage() {}
+
+func (x *LeaderUpdateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaderUpdateRequest.ProtoReflect.Descriptor instead.
+func (*LeaderUpdateRequest) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *LeaderUpdateRequest) GetLeader() []byte {
+	if x != nil {
+		return x.Leader
+	}
+	return nil
+}
+
+func (x *LeaderUpdateRequest) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *LeaderUpdateRequest) GetLeaderId() string {
+	if x != nil {
+		return x.LeaderId
+	}
+	return ""
+}
+
+func (x *LeaderUpdateRequest) GetPeerUrl() string {
+	if x != nil {
+		return x.PeerUrl
+	}
+	return ""
+}
+
+func (x *LeaderUpdateRequest) GetClientUrl() string {
+	if x != nil {
+		return x.ClientUrl
+	}
+	return ""
+}
+
+func (x *LeaderUpdateRequest) GetGrpcUrl() string {
+	if x != nil {
+		return x.GrpcUrl
+	}
+	return ""
+}
+
+func (x *LeaderUpdateRequest) GetRedisUrl() string {
+	if x != nil {
+		return x.RedisUrl
+	}
+	return ""
+}
+
+func (x *LeaderUpdateRequest) GetMemcachedUrl() string {
+	if x != nil {
+		return x.MemcachedUrl
+	}
+	return ""
+}
+
+type LeaderUpdateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaderUpdateResponse) Reset() {
+	*x = LeaderUpdateResponse{}
+	mi := &file_peerpb_peer_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaderUpdateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaderUpdateResponse) ProtoMessage() {}
+
+func (x *LeaderUpdateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_peerpb_peer_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaderUpdateResponse.ProtoReflect.Descriptor instead.
+func (*LeaderUpdateResponse) Descriptor() ([]byte, []int) {
+	return file_peerpb_peer_proto_rawDescGZIP(), []int{11}
+}
+
+var File_peerpb_peer_proto protoreflect.FileDescriptor
+
+const file_peerpb_peer_proto_rawDesc = "" +
+	"\n" +
+	"\x11peerpb/peer.proto\x12\apeer.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa4\x02\n" +
+	"\bFollower\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\fR\aaddress\x12\"\n" +
+	"\rlast_log_hash\x18\x02 \x01(\tR\vlastLogHash\x123\n" +
+	"\x16last_commited_log_hash\x18\x03 \x01(\tR\x13lastCommitedLogHash\x12\x0e\n" +
+	"\x02id\x18\x04 \x01(\tR\x02id\x12\x19\n" +
+	"\bpeer_url\x18\x05 \x01(\tR\apeerUrl\x12\x1d\n" +
+	"\n" +
+	"client_url\x18\x06 \x01(\tR\tclientUrl\x12\x19\n" +
+	"\bgrpc_url\x18\a \x01(\tR\agrpcUrl\x12\x1b\n" +
+	"\tredis_url\x18\b \x01(\tR\bredisUrl\x12#\n" +
+	"\rmemcached_url\x18\t \x01(\tR\fmemcachedUrl\"\x9f\x01\n" +
+	"\x10HeartBeatRequest\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term\x12/\n" +
+	"\tfollowers\x18\x02 \x03(\v2\x11.peer.v1.FollowerR\tfollowers\x12\x1b\n" +
+	"\tleader_id\x18\x03 \x01(\tR\bleaderId\x12)\n" +
+	"\x06leader\x18\x04 \x01(\v2\x11.peer.v1.FollowerR\x06leader\"\x13\n" +
+	"\x11HeartBeatResponse\"\x96\x01\n" +
+	"\vPollRequest\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term\x12,\n" +
+	"\x12new_leader_address\x18\x02 \x01(\fR\x10newLeaderAddress\x12\"\n" +
+	"\rlast_log_hash\x18\x03 \x01(\tR\vlastLogHash\x12!\n" +
+	"\fcandidate_id\x18\x04 \x01(\tR\vcandidateId\"2\n" +
+	"\fPollResponse\x12\x12\n" +
+	"\x04vote\x18\x01 \x01(\bR\x04vote\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\"\xe8\x02\n" +
+	"\bLogEntry\x12\x12\n" +
+	"\x04hash\x18\x01 \x01(\tR\x04hash\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1c\n" +
+	"\toperation\x18\x03 \x01(\tR\toperation\x12\x10\n" +
+	"\x03key\x18\x04 \x01(\tR\x03key\x12\x19\n" +
+	"\x05value\x18\x05 \x01(\fH\x00R\x05value\x88\x01\x01\x12\x1c\n" +
+	"\tcommitted\x18\x06 \x01(\bR\tcommitted\x12!\n" +
+	"\fcontent_type\x18\a \x01(\tR\vcontentType\x12\x1a\n" +
+	"\bexpected\x18\b \x01(\fR\bexpected\x12#\n" +
+	"\rexpect_absent\x18\t \x01(\bR\fexpectAbsent\x12\x14\n" +
+	"\x05lease\x18\n" +
+	" \x01(\x03R\x05lease\x12+\n" +
+	"\x11expected_revision\x18\v \x01(\x03R\x10expectedRevisionB\b\n" +
+	"\x06_value\"C\n" +
+	"\x14AppendEntriesRequest\x12+\n" +
+	"\aentries\x18\x01 \x03(\v2\x11.peer.v1.LogEntryR\aentries\"\x17\n" +
+	"\x15AppendEntriesResponse\"*\n" +
+	"\rCommitRequest\x12\x19\n" +
+	"\blog_hash\x18\x01 \x01(\tR\alogHash\"\x10\n" +
+	"\x0eCommitResponse\"\xf5\x01\n" +
+	"\x13LeaderUpdateRequest\x12\x16\n" +
+	"\x06leader\x18\x01 \x01(\fR\x06leader\x12\x12\n" +
+	"\x04term\x18\x02 \x01(\x04R\x04term\x12\x1b\n" +
+	"\tleader_id\x18\x03 \x01(\tR\bleaderId\x12\x19\n" +
+	"\bpeer_url\x18\x04 \x01(\tR\apeerUrl\x12\x1d\n" +
+	"\n" +
+	"client_url\x18\x05 \x01(\tR\tclientUrl\x12\x19\n" +
+	"\bgrpc_url\x18\x06 \x01(\tR\agrpcUrl\x12\x1b\n" +
+	"\tredis_url\x18\a \x01(\tR\bredisUrl\x12#\n" +
+	"\rmemcached_url\x18\b \x01(\tR\fmemcachedUrl\"\x16\n" +
+	"\x14LeaderUpdateResponse2\xd7\x02\n" +
+	"\x04Peer\x12B\n" +
+	"\tHeartBeat\x12\x19.peer.v1.HeartBeatRequest\x1a\x1a.peer.v1.HeartBeatResponse\x123\n" +
+	"\x04Poll\x12\x14.peer.v1.PollRequest\x1a\x15.peer.v1.PollResponse\x12N\n" +
+	"\rAppendEntries\x12\x1d.peer.v1.AppendEntriesRequest\x1a\x1e.peer.v1.AppendEntriesResponse\x129\n" +
+	"\x06Commit\x12\x16.peer.v1.CommitRequest\x1a\x17.peer.v1.CommitResponse\x12K\n" +
+	"\fLeaderUpdate\x12\x1c.peer.v1.LeaderUpdateRequest\x1a\x1d.peer.v1.LeaderUpdateResponseB<Z:github.com/Jonas-Heinrich/toy-distributed-key-value/peerpbb\x06proto3"
+
+var (
+	file_peerpb_peer_proto_rawDescOnce sync.Once
+	file_peerpb_peer_proto_rawDescData []byte
+)
+
+func file_peerpb_peer_proto_rawDescGZIP() []byte {
+	file_peerpb_peer_proto_rawDescOnce.Do(func() {
+		file_peerpb_peer_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_peerpb_peer_proto_rawDesc), len(file_peerpb_peer_proto_rawDesc)))
+	})
+	return file_peerpb_peer_proto_rawDescData
+}
+
+var file_peerpb_peer_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_peerpb_peer_proto_goTypes = []any{
+	(*Follower)(nil),              // 0: peer.v1.Follower
+	(*HeartBeatRequest)(nil),      // 1: peer.v1.HeartBeatRequest
+	(*HeartBeatResponse)(nil),     // 2: peer.v1.HeartBeatResponse
+	(*PollRequest)(nil),           // 3: peer.v1.PollRequest
+	(*PollResponse)(nil),          // 4: peer.v1.PollResponse
+	(*LogEntry)(nil),              // 5: peer.v1.LogEntry
+	(*AppendEntriesRequest)(nil),  // 6: peer.v1.AppendEntriesRequest
+	(*AppendEntriesResponse)(nil), // 7: peer.v1.AppendEntriesResponse
+	(*CommitRequest)(nil),         // 8: peer.v1.CommitRequest
+	(*CommitResponse)(nil),        // 9: peer.v1.CommitResponse
+	(*LeaderUpdateRequest)(nil),   // 10: peer.v1.LeaderUpdateRequest
+	(*LeaderUpdateResponse)(nil),  // 11: peer.v1.LeaderUpdateResponse
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+}
+var file_peerpb_peer_proto_depIdxs = []int32{
+	0,  // 0: peer.v1.HeartBeatRequest.followers:type_name -> peer.v1.Follower
+	0,  // 1: peer.v1.HeartBeatRequest.leader:type_name -> peer.v1.Follower
+	12, // 2: peer.v1.LogEntry.time:type_name -> google.protobuf.Timestamp
+	5,  // 3: peer.v1.AppendEntriesRequest.entries:type_name -> peer.v1.LogEntry
+	1,  // 4: peer.v1.Peer.HeartBeat:input_type -> peer.v1.HeartBeatRequest
+	3,  // 5: peer.v1.Peer.Poll:input_type -> peer.v1.PollRequest
+	6,  // 6: peer.v1.Peer.AppendEntries:input_type -> peer.v1.AppendEntriesRequest
+	8,  // 7: peer.v1.Peer.Commit:input_type -> peer.v1.CommitRequest
+	10, // 8: peer.v1.Peer.LeaderUpdate:input_type -> peer.v1.LeaderUpdateRequest
+	2,  // 9: peer.v1.Peer.HeartBeat:output_type -> peer.v1.HeartBeatResponse
+	4,  // 10: peer.v1.Peer.Poll:output_type -> peer.v1.PollResponse
+	7,  // 11: peer.v1.Peer.AppendEntries:output_type -> peer.v1.AppendEntriesResponse
+	9,  // 12: peer.v1.Peer.Commit:output_type -> peer.v1.CommitResponse
+	11, // 13: peer.v1.Peer.LeaderUpdate:output_type -> peer.v1.LeaderUpdateResponse
+	9,  // [9:14] is the sub-list for method output_type
+	4,  // [4:9] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_peerpb_peer_proto_init() }
+func file_peerpb_peer_proto_init() {
+	if File_peerpb_peer_proto != nil {
+		return
+	}
+	file_peerpb_peer_proto_msgTypes[5].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_peerpb_peer_proto_rawDesc), len(file_peerpb_peer_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_peerpb_peer_proto_goTypes,
+		DependencyIndexes: file_peerpb_peer_proto_depIdxs,
+		MessageInfos:      file_peerpb_peer_proto_msgTypes,
+	}.Build()
+	File_peerpb_peer_proto = out.File
+	file_peerpb_peer_proto_goTypes = nil
+	file_peerpb_peer_proto_depIdxs = nil
+}
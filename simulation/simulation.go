@@ -0,0 +1,469 @@
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/linearizability"
+)
+
+// A simulation runs all nodes of a cluster on a simulated clock and network. Only one goroutine of
+// the simulation runs at a time and all random numbers are drawn from sources seeded with the seed
+// of the simulation, so running the same seed again replays every message and every election.
+
+// The simulation observes the nodes and checks its invariants once per STEP
+const STEP = 10 * time.Millisecond
+
+// Nodes learn about each other within JOIN_TIMEOUT after they joined
+const JOIN_TIMEOUT = 10 * kv.MAX_ELECTION_TIMEOUT
+
+// Random scenarios pick their client requests from SCENARIO_KEYS keys
+const SCENARIO_KEYS = 5
+
+// Simulations replace the clock of all nodes in the process, so only one of them runs at a time
+var running sync.Mutex
+
+type Simulation struct {
+	Seed int64
+
+	clock   *kv.SimulatedClock
+	network *kv.SimulatedNetwork
+	// Sends the client requests, it is never partitioned
+	client *kv.SimulatedTransport
+	// Scenarios draw from their own source, so they do not change with the random numbers the nodes draw
+	random *rand.Rand
+
+	addresses []net.IP
+	// Killed nodes are nil
+	nodes  []*kv.KeyValueStore
+	faults []*kv.FaultTransport
+	// Nodes keep their ID across restarts, like they would in their data directory
+	ids []string
+
+	trace      []string
+	violations []string
+	// Violations are only reported when they are first observed
+	reported map[string]bool
+	// Last observed state of every node, changes are traced
+	states []string
+	// Leader of every observed term
+	leaders map[uint64]int
+	history []linearizability.Operation
+
+	closeOnce sync.Once
+}
+
+// New starts a simulated cluster of size nodes, node 0 is the initial leader. The simulation has to be closed.
+func New(seed int64, size int) (*Simulation, error) {
+	running.Lock()
+	clock := kv.NewSimulatedClock(seed)
+	kv.CLOCK = clock
+
+	network := kv.NewSimulatedNetwork()
+	s := &Simulation{
+		Seed:      seed,
+		clock:     clock,
+		network:   network,
+		client:    network.NewTransport(net.IPv4(10, 0, 255, 254)),
+		random:    rand.New(rand.NewSource(seed)),
+		addresses: make([]net.IP, size),
+		nodes:     make([]*kv.KeyValueStore, size),
+		ids:       make([]string, size),
+		faults:    make([]*kv.FaultTransport, size),
+		states:    make([]string, size),
+		leaders:   make(map[uint64]int),
+		reported:  make(map[string]bool),
+	}
+	for index := range s.addresses {
+		s.addresses[index] = net.IPv4(10, 0, 0, byte(index+1))
+	}
+
+	for index := range s.nodes {
+		s.start(index, index == 0, s.addresses[0])
+		s.Run(STEP)
+	}
+	// Followers only elect a new leader among the followers they heard of with the heart beat
+	for waited := time.Duration(0); !s.joined(); waited += STEP {
+		if waited > JOIN_TIMEOUT {
+			s.Close()
+			return nil, fmt.Errorf("simulation %d: followers did not learn about each other", seed)
+		}
+		s.Run(STEP)
+	}
+	return s, nil
+}
+
+// start runs the node at index, followers join the cluster at entryAddress in the background. Restarted
+// nodes keep the faults of their links.
+func (s *Simulation) start(index int, leader bool, entryAddress net.IP) {
+	faults := kv.NewFaultTransport(s.network.NewTransport(s.addresses[index]))
+	if s.faults[index] != nil {
+		for address, linkFaults := range s.faults[index].LinkFaults() {
+			faults.SetLinkFaults(net.ParseIP(address), linkFaults)
+		}
+	}
+	config := kv.DefaultConfig()
+	config.NodeID = s.ids[index]
+	node := kv.InitKeyValueStoreWithConfig(config, leader, entryAddress, s.addresses[index], faults)
+	s.ids[index] = node.ID
+	s.nodes[index] = node
+	s.faults[index] = faults
+
+	s.clock.Go(func() {
+		if err := node.Join(entryAddress); err != nil {
+			s.tracef("node %d could not join: %v", index, err)
+		}
+	})
+}
+
+func (s *Simulation) joined() bool {
+	for _, node := range s.nodes {
+		if node == nil || len(node.Followers) != len(s.nodes)-1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Close kills all nodes and releases the clock. Goroutines that still wait on the simulated clock are never woken up.
+func (s *Simulation) Close() {
+	s.closeOnce.Do(func() {
+		for index := range s.nodes {
+			if s.nodes[index] != nil {
+				s.nodes[index].Stop()
+			}
+		}
+		kv.CLOCK = kv.SystemClock{}
+		running.Unlock()
+	})
+}
+
+func (s *Simulation) Size() int {
+	return len(s.nodes)
+}
+
+// Node returns the node at index, or nil if it was killed. Nodes may only be inspected between runs.
+func (s *Simulation) Node(index int) *kv.KeyValueStore {
+	return s.nodes[index]
+}
+
+// Elapsed returns the simulated time since the start of the simulation
+func (s *Simulation) Elapsed() time.Duration {
+	return s.clock.Now().Sub(kv.SIMULATION_EPOCH)
+}
+
+// Run runs the simulation for d, the nodes are observed after every STEP
+func (s *Simulation) Run(d time.Duration) {
+	for end := s.Elapsed() + d; s.Elapsed() < end; {
+		step := STEP
+		if remaining := end - s.Elapsed(); remaining < step {
+			step = remaining
+		}
+		s.clock.Run(step)
+		s.observe()
+	}
+}
+
+//
+// Faults
+//
+
+// Kill stops the node at index without notifying the other nodes
+func (s *Simulation) Kill(index int) {
+	if s.nodes[index] == nil {
+		return
+	}
+	s.tracef("kill node %d", index)
+	s.nodes[index].Stop()
+	s.nodes[index] = nil
+}
+
+// Restart replaces the node at index by a new node with an empty state, which joins the cluster over the node at entry
+func (s *Simulation) Restart(index int, entry int) {
+	s.Kill(index)
+	s.tracef("restart node %d over node %d", index, entry)
+	s.start(index, false, s.addresses[entry])
+}
+
+// Partition splits the cluster into the given groups of node indices, nodes without a group reach every node
+func (s *Simulation) Partition(groups ...[]int) {
+	s.tracef("partition %v", groups)
+	for group, indices := range groups {
+		for other, otherIndices := range groups {
+			if group == other {
+				continue
+			}
+			for _, index := range indices {
+				for _, otherIndex := range otherIndices {
+					s.faults[index].Block(s.addresses[otherIndex])
+				}
+			}
+		}
+	}
+}
+
+// Heal removes all faults between the nodes
+func (s *Simulation) Heal() {
+	s.tracef("heal")
+	for _, faults := range s.faults {
+		faults.Heal()
+	}
+}
+
+//
+// Client Requests
+//
+
+// Write sets key to value over the node at index. The request runs in the background, its result is traced.
+func (s *Simulation) Write(index int, key string, value string) {
+	s.request(index, linearizability.KVInput{Operation: linearizability.KVWrite, Key: key, Value: value}, func() (*http.Response, error) {
+		return s.client.Post(kv.Member{Address: s.addresses[index]}, "/write/"+url.PathEscape(key), "text/plain", strings.NewReader(value))
+	})
+}
+
+// CompareAndSwap sets key to value over the node at index, if its value is expected or it does not exist for a nil expected value
+func (s *Simulation) CompareAndSwap(index int, key string, expected *string, value string) {
+	body, _ := json.Marshal(kv.CompareAndSwapMessage{Expected: expected, Value: value})
+	s.request(index, linearizability.KVInput{Operation: linearizability.KVCompareAndSwap, Key: key, Value: value, Expected: expected}, func() (*http.Response, error) {
+		return s.client.Post(kv.Member{Address: s.addresses[index]}, "/cas/"+url.PathEscape(key), "application/json", bytes.NewBuffer(body))
+	})
+}
+
+// Read reads key over the node at index
+func (s *Simulation) Read(index int, key string) {
+	s.request(index, linearizability.KVInput{Operation: linearizability.KVRead, Key: key}, func() (*http.Response, error) {
+		return s.client.Get(kv.Member{Address: s.addresses[index]}, "/raw/"+url.PathEscape(key))
+	})
+}
+
+// request records the request in the history of the clients. Requests without a definite response stay pending,
+// they might have taken effect anyway.
+func (s *Simulation) request(index int, input linearizability.KVInput, send func() (*http.Response, error)) {
+	id := len(s.history)
+	s.history = append(s.history, linearizability.Operation{
+		Client: id,
+		Input:  input,
+		Call:   int64(s.Elapsed()),
+		Return: linearizability.PENDING,
+	})
+	s.clock.Go(func() {
+		description := describeInput(input)
+
+		resp, err := send()
+		if err != nil {
+			s.tracef("%s over node %d failed: %v", description, index, err)
+			return
+		}
+		defer resp.Body.Close()
+		responseBytes, _ := ioutil.ReadAll(resp.Body)
+
+		var output linearizability.KVOutput
+		switch {
+		case resp.StatusCode == http.StatusOK && input.Operation == linearizability.KVRead:
+			output = linearizability.KVOutput{Value: string(responseBytes), Found: true}
+		case resp.StatusCode == http.StatusOK:
+			output = linearizability.KVOutput{Swapped: true}
+		case resp.StatusCode == http.StatusNotFound && input.Operation == linearizability.KVRead:
+			output = linearizability.KVOutput{Found: false}
+		case resp.StatusCode == http.StatusConflict && input.Operation == linearizability.KVCompareAndSwap:
+			output = linearizability.KVOutput{Swapped: false}
+		default:
+			s.tracef("%s over node %d failed with %d", description, index, resp.StatusCode)
+			return
+		}
+		s.history[id].Output = output
+		s.history[id].Return = int64(s.Elapsed())
+		s.tracef("%s over node %d", linearizability.KVModel.DescribeOperation(input, output), index)
+	})
+}
+
+// describeInput describes an operation without its output
+func describeInput(input linearizability.KVInput) string {
+	return strings.TrimSuffix(linearizability.KVModel.DescribeOperation(input, nil), " -> ?")
+}
+
+//
+// Scenarios
+//
+
+// RunRandom runs the simulation for d with random client requests, crashes, restarts and partitions
+func (s *Simulation) RunRandom(d time.Duration) {
+	for end := s.Elapsed() + d; s.Elapsed() < end; {
+		s.randomStep()
+		s.Run(STEP)
+	}
+}
+
+func (s *Simulation) randomStep() {
+	alive := make([]int, 0, len(s.nodes))
+	killed := make([]int, 0, len(s.nodes))
+	for index, node := range s.nodes {
+		if node != nil {
+			alive = append(alive, index)
+		} else {
+			killed = append(killed, index)
+		}
+	}
+
+	switch dice := s.random.Float64(); {
+	case dice < 0.05:
+		node := alive[s.random.Intn(len(alive))]
+		key := fmt.Sprintf("key-%d", s.random.Intn(SCENARIO_KEYS))
+		value := fmt.Sprintf("%d", len(s.history))
+		switch s.random.Intn(3) {
+		case 0:
+			s.Write(node, key, value)
+		case 1:
+			var expected *string
+			if s.random.Intn(2) == 0 {
+				previous := fmt.Sprintf("%d", s.random.Intn(len(s.history)+1))
+				expected = &previous
+			}
+			s.CompareAndSwap(node, key, expected, value)
+		default:
+			s.Read(node, key)
+		}
+	case dice < 0.051 && len(alive) > len(s.nodes)/2+1:
+		s.Kill(alive[s.random.Intn(len(alive))])
+	case dice < 0.054 && len(killed) > 0:
+		s.Restart(killed[s.random.Intn(len(killed))], alive[s.random.Intn(len(alive))])
+	case dice < 0.055:
+		s.Heal()
+		isolated := s.random.Intn(len(s.nodes))
+		others := make([]int, 0, len(s.nodes)-1)
+		for index := range s.nodes {
+			if index != isolated {
+				others = append(others, index)
+			}
+		}
+		s.Partition([]int{isolated}, others)
+	case dice < 0.058:
+		s.Heal()
+	}
+}
+
+//
+// Observation
+//
+
+func (s *Simulation) tracef(format string, args ...interface{}) {
+	s.trace = append(s.trace, fmt.Sprintf("%10.6fs ", s.Elapsed().Seconds())+fmt.Sprintf(format, args...))
+}
+
+func (s *Simulation) violationf(format string, args ...interface{}) {
+	violation := fmt.Sprintf(format, args...)
+	if s.reported[violation] {
+		return
+	}
+	s.reported[violation] = true
+	s.tracef("violation: %s", violation)
+	s.violations = append(s.violations, fmt.Sprintf("%s %s", s.Elapsed(), violation))
+}
+
+// observe traces the changes of the nodes and checks that no term has two leaders and that the
+// committed logs of all nodes agree
+func (s *Simulation) observe() {
+	for index, node := range s.nodes {
+		state := "killed"
+		if node != nil && node.IsLeader() {
+			state = fmt.Sprintf("leader in term %d", node.Term)
+		} else if node != nil {
+			state = fmt.Sprintf("follower of %s in term %d", node.LeaderAddress, node.Term)
+		}
+		if state != s.states[index] {
+			s.states[index] = state
+			s.tracef("node %d is %s", index, state)
+		}
+
+		if node == nil || !node.IsLeader() {
+			continue
+		}
+		if leader, ok := s.leaders[node.Term]; ok && leader != index {
+			s.violationf("nodes %d and %d are leaders in term %d", leader, index, node.Term)
+		}
+		s.leaders[node.Term] = index
+	}
+
+	for index, node := range s.nodes {
+		for other := index + 1; other < len(s.nodes); other++ {
+			if node == nil || s.nodes[other] == nil {
+				continue
+			}
+			logs, otherLogs := committedLogs(node), committedLogs(s.nodes[other])
+			for logIndex := 0; logIndex < len(logs) && logIndex < len(otherLogs); logIndex++ {
+				if logs[logIndex] != otherLogs[logIndex] {
+					s.violationf("nodes %d and %d committed different logs at index %d", index, other, logIndex)
+					break
+				}
+			}
+		}
+	}
+}
+
+// committedLogs returns the hashes of the committed logs at the start of the database log of node
+func committedLogs(node *kv.KeyValueStore) []string {
+	hashes := make([]string, 0, len(node.DatabaseLog))
+	for _, logEntry := range node.DatabaseLog {
+		if !logEntry.Committed {
+			break
+		}
+		hashes = append(hashes, logEntry.Hash)
+	}
+	return hashes
+}
+
+// Trace returns everything the simulation observed, which is the same for every run of the same seed
+func (s *Simulation) Trace() []string {
+	return append([]string(nil), s.trace...)
+}
+
+// Violations returns the violated invariants, including a history of the clients that is not linearizable
+func (s *Simulation) Violations() []string {
+	violations := append([]string(nil), s.violations...)
+
+	// Reads without a response do not change the state, leaving them out speeds up the check
+	history := make([]linearizability.Operation, 0, len(s.history))
+	for _, operation := range s.history {
+		if operation.Return != linearizability.PENDING || operation.Input.(linearizability.KVInput).Operation != linearizability.KVRead {
+			history = append(history, operation)
+		}
+	}
+	if result := linearizability.Check(linearizability.KVModel, history); !result.Linearizable {
+		violations = append(violations, result.Describe(linearizability.KVModel))
+	}
+	return violations
+}
+
+// Databases returns the databases of all running nodes, with their keys in order
+func (s *Simulation) Databases() []string {
+	databases := make([]string, 0, len(s.nodes))
+	for index, node := range s.nodes {
+		if node == nil {
+			continue
+		}
+		database := node.LocalDatabase()
+		keys := make([]string, 0, len(database))
+		for key := range database {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var description strings.Builder
+		fmt.Fprintf(&description, "node %d:", index)
+		for _, key := range keys {
+			fmt.Fprintf(&description, " %s=%q", key, database[key])
+		}
+		databases = append(databases, description.String())
+	}
+	return databases
+}
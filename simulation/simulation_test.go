@@ -0,0 +1,108 @@
+package simulation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const SIMULATION_DURATION = 20 * time.Second
+
+// simulate runs a random scenario for the seed, the simulation has to be closed before the next one starts
+func simulate(t *testing.T, seed int64) *Simulation {
+	t.Helper()
+
+	s, err := New(seed, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RunRandom(SIMULATION_DURATION)
+	s.Heal()
+	s.Run(5 * time.Second)
+	return s
+}
+
+// replay runs the seed again and compares everything that was observed
+func replay(t *testing.T, seed int64) {
+	s := simulate(t, seed)
+	trace, databases, violations := s.Trace(), s.Databases(), s.Violations()
+	s.Close()
+	replayed := simulate(t, seed)
+	defer replayed.Close()
+
+	replayedTrace := replayed.Trace()
+	for index := 0; index < len(trace) && index < len(replayedTrace); index++ {
+		if trace[index] != replayedTrace[index] {
+			t.Fatalf("replay of seed %d diverged at event %d:\n%s\n%s", seed, index, trace[index], replayedTrace[index])
+		}
+	}
+	if len(trace) != len(replayedTrace) {
+		t.Fatalf("replay of seed %d has %d instead of %d events", seed, len(replayedTrace), len(trace))
+	}
+	if !reflect.DeepEqual(databases, replayed.Databases()) {
+		t.Fatalf("replay of seed %d ended with different databases:\n%s\n%s", seed, strings.Join(databases, "\n"), strings.Join(replayed.Databases(), "\n"))
+	}
+	if !reflect.DeepEqual(violations, replayed.Violations()) {
+		t.Fatalf("replay of seed %d violated different invariants:\n%s\n%s", seed, strings.Join(violations, "\n"), strings.Join(replayed.Violations(), "\n"))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		replay(t, seed)
+	}
+}
+
+func TestSeeds(t *testing.T) {
+	s := simulate(t, 1)
+	trace := s.Trace()
+	s.Close()
+	other := simulate(t, 2)
+	defer other.Close()
+
+	if reflect.DeepEqual(trace, other.Trace()) {
+		t.Fatal("different seeds produced the same trace")
+	}
+}
+
+func TestLeaderFailover(t *testing.T) {
+	s, err := New(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Write(1, "key", "before")
+	s.Run(time.Second)
+	s.Kill(0)
+	s.Run(5 * time.Second)
+
+	leader := -1
+	for index := 1; index < s.Size(); index++ {
+		if s.Node(index).Leader {
+			leader = index
+		}
+	}
+	if leader == -1 {
+		t.Fatalf("no leader was elected\n%s", strings.Join(s.Trace(), "\n"))
+	}
+	// Followers forward the write to the new leader
+	follower := 1
+	if leader == follower {
+		follower = 2
+	}
+	s.Write(follower, "key", "after")
+	s.Run(time.Second)
+
+	databases := s.Databases()
+	for _, database := range databases {
+		if !strings.HasSuffix(database, ` key="after"`) {
+			t.Fatalf("write after failover did not reach all nodes:\n%s", strings.Join(databases, "\n"))
+		}
+	}
+	if violations := s.Violations(); len(violations) > 0 {
+		t.Fatalf("failover violated invariants:\n%s\n\ntrace:\n%s", strings.Join(violations, "\n"), strings.Join(s.Trace(), "\n"))
+	}
+}
@@ -0,0 +1,173 @@
+package kvtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+func (f *fixture) testBatchWrite(address net.IP, entries []kv.BatchWriteEntry) bool {
+	entriesBytes, _ := json.Marshal(entries)
+	resp, err := http.Post(nodeURL(address, "/batch/write"), "application/json", bytes.NewBuffer(entriesBytes))
+	if err != nil {
+		fmt.Println("\tBatch write request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	responseBytes, _ := ioutil.ReadAll(resp.Body)
+	var response kv.BatchWriteResponseMessage
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		fmt.Println("\tBatch write message format unknown")
+		return false
+	}
+
+	if resp.StatusCode != http.StatusOK || response.InfoMessage != kv.StatusOKMessage || len(response.Results) != len(entries) {
+		fmt.Printf("\tBatch write returned unexpected response (%d, %s)\n", resp.StatusCode, response.InfoMessage)
+		return false
+	}
+
+	for index, entry := range entries {
+		if response.Results[index].Key != entry.Key || response.Results[index].InfoMessage != kv.StatusOKMessage {
+			fmt.Printf("\tBatch write result for `%s` is unexpected (%s)\n", entry.Key, response.Results[index].InfoMessage)
+			return false
+		}
+		f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(entry.Key, entry.Value, true, true))
+		f.database[entry.Key] = entry.Value
+		delete(f.contentTypes, entry.Key)
+	}
+
+	if !f.testLeaderState(f.followers) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		return false
+	}
+
+	if !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		return false
+	}
+
+	return true
+}
+
+func (f *fixture) testBatchRead(address net.IP, keys []string) bool {
+	keysBytes, _ := json.Marshal(keys)
+	resp, err := http.Post(nodeURL(address, "/batch/read"), "application/json", bytes.NewBuffer(keysBytes))
+	if err != nil {
+		fmt.Println("\tBatch read request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	responseBytes, _ := ioutil.ReadAll(resp.Body)
+	var response kv.BatchReadResponseMessage
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		fmt.Println("\tBatch read message format unknown")
+		return false
+	}
+
+	if resp.StatusCode != http.StatusOK || response.InfoMessage != kv.StatusOKMessage || len(response.Results) != len(keys) {
+		fmt.Printf("\tBatch read returned unexpected response (%d, %s)\n", resp.StatusCode, response.InfoMessage)
+		return false
+	}
+
+	for index, key := range keys {
+		expectedResult := kv.BatchReadResult{
+			Key:         key,
+			InfoMessage: kv.StatusValueNotFoundMessage,
+		}
+		if value, ok := f.database[key]; ok {
+			expectedResult.InfoMessage = kv.StatusOKMessage
+			expectedResult.Value = value
+		}
+
+		result := response.Results[index]
+		if result.Key != expectedResult.Key || result.InfoMessage != expectedResult.InfoMessage || !bytes.Equal(result.Value, expectedResult.Value) {
+			fmt.Printf("\tBatch read result for `%s` is unexpected (%s, %q)\n", key, result.InfoMessage, result.Value)
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestDirectBatchWrite(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestDirectBatchWrite`..")
+	f := newCluster(t)
+
+	if !f.testBatchWrite(f.leaderAddress, []kv.BatchWriteEntry{
+		{Key: "b1", Value: []byte("v1")},
+		{Key: "b2", Value: []byte("v2")},
+		{Key: "b3", Value: []byte("v3")},
+	}) {
+		fmt.Println("\tBatch write request failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tBatch write completed successfully!")
+}
+
+func TestIndirectBatchWrite(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestIndirectBatchWrite`..")
+	f := newCluster(t)
+
+	if !f.testBatchWrite(f.followers[0].Address, []kv.BatchWriteEntry{
+		{Key: "b4", Value: []byte("v4")},
+		{Key: "b1", Value: []byte("v5")},
+	}) {
+		fmt.Println("\tBatch write request failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tBatch write completed successfully!")
+}
+
+func TestDirectBatchRead(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestDirectBatchRead`..")
+	f := newCluster(t)
+
+	if !f.testBatchWrite(f.leaderAddress, []kv.BatchWriteEntry{{Key: "b1", Value: []byte("v1")}, {Key: "b2", Value: []byte("v2")}}) {
+		fmt.Println("\tBatch write request failed")
+		t.Fail()
+		return
+	}
+
+	if !f.testBatchRead(f.leaderAddress, []string{"b1", "whatever", "b2", "initial"}) {
+		fmt.Println("\tBatch read request failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tBatch read completed successfully!")
+}
+
+func TestIndirectBatchRead(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestIndirectBatchRead`..")
+	f := newCluster(t)
+
+	if !f.testBatchWrite(f.leaderAddress, []kv.BatchWriteEntry{{Key: "b3", Value: []byte("v3")}, {Key: "b4", Value: []byte("v4")}}) {
+		fmt.Println("\tBatch write request failed")
+		t.Fail()
+		return
+	}
+
+	if !f.testBatchRead(f.followers[0].Address, []string{"b4", "b3", "whatever"}) {
+		fmt.Println("\tBatch read request failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tBatch read completed successfully!")
+}
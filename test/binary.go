@@ -0,0 +1,186 @@
+package kvtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+func (f *fixture) testRawWrite(address net.IP, key string, value []byte, contentType string) bool {
+	resp, err := http.Post(nodeURL(address, "/write/"+key), contentType, bytes.NewBuffer(value))
+	if err != nil {
+		fmt.Println("\tWrite request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	if !kv.TestEqualMessageResponse(resp, http.StatusOK, kv.StatusOKMessage) {
+		fmt.Println("\tWrite failed")
+		return false
+	}
+
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(key, value, true, true))
+	f.database[key] = value
+	f.contentTypes[key] = contentType
+
+	if !f.testLeaderState(f.followers) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		return false
+	}
+
+	if !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		return false
+	}
+
+	return true
+}
+
+func (f *fixture) testRawRead(address net.IP, key string) bool {
+	resp, err := http.Get(nodeURL(address, "/raw/"+key))
+	if err != nil {
+		fmt.Println("\tRaw read request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	value, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(value, f.database[key]) {
+		fmt.Printf("\tRaw read returned unexpected value (%d, %d bytes)\n", resp.StatusCode, len(value))
+		return false
+	}
+	contentType, ok := f.contentTypes[key]
+	if !ok {
+		contentType = kv.DEFAULT_CONTENT_TYPE
+	}
+	if resp.Header.Get("Content-Type") != contentType {
+		fmt.Printf("\tRaw read returned unexpected content type `%s`\n", resp.Header.Get("Content-Type"))
+		return false
+	}
+	return true
+}
+
+func testTooLarge(address net.IP, path string, body []byte, expectedResponse kv.InfoMessage) bool {
+	resp, err := http.Post(nodeURL(address, path), "application/octet-stream", bytes.NewBuffer(body))
+	if err != nil {
+		fmt.Println("\tRequest failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	return kv.TestEqualMessageResponse(resp, http.StatusRequestEntityTooLarge, expectedResponse)
+}
+
+func TestBinaryValue(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestBinaryValue`..")
+	f := newCluster(t)
+
+	// Invalid UTF-8 would be replaced if values were encoded as strings
+	value := []byte{0x00, 0xff, 0xfe, 0x80, 'k', 'v', 0xc3, 0x28, 0x00}
+	if !f.testRawWrite(f.followers[0].Address, "binary", value, "application/octet-stream") {
+		fmt.Println("\tBinary write failed")
+		t.Fail()
+		return
+	}
+
+	if !f.testRawRead(f.leaderAddress, "binary") || !f.testRawRead(f.followers[1].Address, "binary") {
+		fmt.Println("\tBinary read failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tBinary value completed successfully!")
+}
+
+func TestBinaryBatchValue(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestBinaryBatchValue`..")
+	f := newCluster(t)
+
+	if !f.testBatchWrite(f.followers[0].Address, []kv.BatchWriteEntry{
+		{Key: "binary1", Value: []byte{0x00, 0xff, 0xfe, 0x80}},
+		{Key: "binary2", Value: []byte{0xc3, 0x28, 'k', 'v', 0x00}},
+	}) {
+		fmt.Println("\tBinary batch write failed")
+		t.Fail()
+		return
+	}
+
+	if !f.testBatchRead(f.followers[1].Address, []string{"binary1", "binary2"}) || !f.testRawRead(f.leaderAddress, "binary1") {
+		fmt.Println("\tBinary batch read failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tBinary batch value completed successfully!")
+}
+
+func TestContentTypePassthrough(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestContentTypePassthrough`..")
+	f := newCluster(t)
+
+	if !f.testRawWrite(f.leaderAddress, "image", []byte("\x89PNG\r\n\x1a\n"), "image/png") {
+		fmt.Println("\tWrite failed")
+		t.Fail()
+		return
+	}
+
+	if !f.testRawRead(f.followers[0].Address, "image") {
+		fmt.Println("\tContent type was not passed through")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tContent type passed through successfully!")
+}
+
+func TestLargeValue(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestLargeValue`..")
+	f := newCluster(t)
+
+	value := make([]byte, kv.MAX_VALUE_SIZE)
+	rand.Read(value)
+	if !f.testRawWrite(f.followers[0].Address, "large", value, "application/octet-stream") || !f.testRawRead(f.followers[1].Address, "large") {
+		fmt.Println("\tLarge value failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tLarge value completed successfully!")
+}
+
+func TestValueTooLarge(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestValueTooLarge`..")
+	f := newCluster(t)
+
+	if !testTooLarge(f.leaderAddress, "/write/huge", make([]byte, kv.MAX_VALUE_SIZE+1), kv.StatusValueTooLargeMessage) ||
+		!testTooLarge(f.followers[0].Address, "/write/huge", make([]byte, kv.MAX_VALUE_SIZE+1), kv.StatusValueTooLargeMessage) {
+		fmt.Println("\tValue was not rejected")
+		t.Fail()
+		return
+	}
+
+	if !testTooLarge(f.followers[0].Address, "/batch/write", make([]byte, kv.MAX_REQUEST_SIZE+1), kv.StatusRequestTooLargeMessage) {
+		fmt.Println("\tRequest was not rejected")
+		t.Fail()
+		return
+	}
+
+	if !f.testLeaderState(f.followers) || !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tStates do not match expectations")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tToo large values rejected successfully!")
+}
@@ -0,0 +1,389 @@
+package kvtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/concurrency"
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+func testPost(address net.IP, path string, body []byte, expectedStatusCode int, response interface{}) bool {
+	resp, err := http.Post(nodeURL(address, path), "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		fmt.Printf("\tRequest to %s failed\n", path)
+		return false
+	}
+	defer resp.Body.Close()
+
+	responseBytes, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(responseBytes, response); err != nil {
+		fmt.Printf("\tResponse format of %s unknown\n", path)
+		return false
+	}
+
+	if resp.StatusCode != expectedStatusCode {
+		fmt.Printf("\tRequest to %s returned unexpected status code (%d)\n", path, resp.StatusCode)
+		return false
+	}
+	return true
+}
+
+func testGrantLease(address net.IP, ttl int64) (int64, bool) {
+	var leaseMessage kv.LeaseMessage
+	if !testPost(address, "/lease/grant", []byte(strconv.FormatInt(ttl, 10)), http.StatusOK, &leaseMessage) ||
+		leaseMessage.InfoMessage != kv.StatusOKMessage || leaseMessage.TTL != ttl {
+		fmt.Println("\tLease could not be granted")
+		return 0, false
+	}
+	return leaseMessage.ID, true
+}
+
+func testLeasedWrite(address net.IP, key string, value string, lease int64) bool {
+	var infoMessage kv.InfoMessage
+	return testPost(address, "/write/"+key+"?lease="+strconv.FormatInt(lease, 10), []byte(value), http.StatusOK, &infoMessage) &&
+		infoMessage == kv.StatusOKMessage
+}
+
+// testStateAfterConcurrency checks all nodes, after every lease used by a test ended
+func (f *fixture) testStateAfterConcurrency() bool {
+	// Revoking the leases appends logs of their own, which are adopted once the leader committed them
+	if !f.eventually(func() bool { return f.testAdoptLeaderState() && f.leaderStateEqual(f.followers) }) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		return false
+	}
+
+	if !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		return false
+	}
+	return true
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestCompareAndSwap`..")
+	f := newCluster(t)
+
+	var readMessage kv.ReadMessage
+	createBytes, _ := json.Marshal(kv.CompareAndSwapMessage{Expected: nil, Value: "v1"})
+	if !testPost(f.followers[0].Address, "/cas/swapped", createBytes, http.StatusOK, &readMessage) || readMessage.Value != "v1" {
+		fmt.Println("\tCreating compare and swap failed")
+		t.Fail()
+		return
+	}
+
+	if !testPost(f.leaderAddress, "/cas/swapped", createBytes, http.StatusConflict, &readMessage) ||
+		readMessage.InfoMessage != kv.StatusCompareFailedMessage || readMessage.Value != "v1" {
+		fmt.Println("\tCreating an existing key did not fail")
+		t.Fail()
+		return
+	}
+
+	expected := "v1"
+	swapBytes, _ := json.Marshal(kv.CompareAndSwapMessage{Expected: &expected, Value: "v2"})
+	if !testPost(f.leaderAddress, "/cas/swapped", swapBytes, http.StatusOK, &readMessage) || readMessage.Value != "v2" {
+		fmt.Println("\tCompare and swap failed")
+		t.Fail()
+		return
+	}
+
+	if !testPost(f.followers[0].Address, "/delete/swapped", nil, http.StatusOK, &readMessage) || readMessage.Value != "v2" {
+		fmt.Println("\tDelete failed")
+		t.Fail()
+		return
+	}
+
+	if !testPost(f.leaderAddress, "/delete/swapped", nil, http.StatusNotFound, &readMessage) ||
+		readMessage.InfoMessage != kv.StatusValueNotFoundMessage {
+		fmt.Println("\tDeleting a missing key did not fail")
+		t.Fail()
+		return
+	}
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tCompare and swap completed successfully!")
+}
+
+func TestLeaseRevoke(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestLeaseRevoke`..")
+	f := newCluster(t)
+
+	lease, ok := testGrantLease(f.followers[0].Address, 10)
+	if !ok || !testLeasedWrite(f.followers[0].Address, "leased", "value", lease) || !testRead(f.leaderAddress, "leased", "value", true) {
+		fmt.Println("\tLeased write failed")
+		t.Fail()
+		return
+	}
+
+	var leaseMessage kv.LeaseMessage
+	if !testPost(f.followers[1].Address, "/lease/revoke/"+strconv.FormatInt(lease, 10), nil, http.StatusOK, &leaseMessage) {
+		fmt.Println("\tLease could not be revoked")
+		t.Fail()
+		return
+	}
+
+	if !testRead(f.followers[0].Address, "leased", "", false) {
+		fmt.Println("\tLeased key still exists")
+		t.Fail()
+		return
+	}
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tLease revoked successfully!")
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestLeaseExpiry`..")
+	f := newCluster(t)
+
+	lease, ok := testGrantLease(f.leaderAddress, 1)
+	if !ok || !testLeasedWrite(f.leaderAddress, "expiring", "value", lease) {
+		fmt.Println("\tLeased write failed")
+		t.Fail()
+		return
+	}
+
+	// Keep the lease alive for a bit longer than its time to live
+	for i := 0; i < 3; i++ {
+		time.Sleep(500 * time.Millisecond)
+		var leaseMessage kv.LeaseMessage
+		if !testPost(f.followers[0].Address, "/lease/keep-alive/"+strconv.FormatInt(lease, 10), nil, http.StatusOK, &leaseMessage) {
+			fmt.Println("\tLease could not be kept alive")
+			t.Fail()
+			return
+		}
+	}
+
+	if !testRead(f.leaderAddress, "expiring", "value", true) {
+		fmt.Println("\tLeased key expired too early")
+		t.Fail()
+		return
+	}
+
+	if !f.eventually(func() bool { return testRead(f.leaderAddress, "expiring", "", false) }) {
+		fmt.Println("\tLeased key did not expire")
+		t.Fail()
+		return
+	}
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tLease expired successfully!")
+}
+
+func TestMutex(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestMutex`..")
+	f := newCluster(t)
+
+	session1, err := concurrency.NewSession(f.leader.ClientURL, 5)
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	session2, err := concurrency.NewSession(f.followers[0].ClientURL, 5)
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+
+	mutex1 := concurrency.NewMutex(session1, "mutex")
+	mutex2 := concurrency.NewMutex(session2, "mutex")
+
+	if err := mutex1.Lock(context.Background()); err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	if err := mutex2.TryLock(); err != concurrency.ErrLocked {
+		fmt.Println("\tMutex was locked twice")
+		t.Fail()
+		return
+	}
+	if holder, err := mutex2.Holder(); err != nil || holder != session1.Owner() {
+		fmt.Printf("\tUnexpected mutex holder `%s`\n", holder)
+		t.Fail()
+		return
+	}
+
+	// Waiting sessions get the lock as soon as it is released
+	locked := make(chan error)
+	go func() {
+		locked <- mutex2.Lock(context.Background())
+	}()
+	if err := mutex1.Unlock(); err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	if err := <-locked; err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	if err := mutex1.Unlock(); err != concurrency.ErrNotHeld {
+		fmt.Println("\tMutex was unlocked by a session not holding it")
+		t.Fail()
+		return
+	}
+
+	// Ending the session releases the lock
+	if err := session2.Close(); err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	if holder, err := mutex1.Holder(); err != nil || holder != "" {
+		fmt.Printf("\tUnexpected mutex holder `%s`\n", holder)
+		t.Fail()
+		return
+	}
+	session1.Close()
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tMutex completed successfully!")
+}
+
+func TestMutexHolderCrash(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestMutexHolderCrash`..")
+	f := newCluster(t)
+
+	// A crashed holder is a lease that is not kept alive
+	lease, ok := testGrantLease(f.leaderAddress, 1)
+	if !ok {
+		t.Fail()
+		return
+	}
+	lockRequestBytes, _ := json.Marshal(kv.LockRequestMessage{Owner: "crashed", Lease: lease})
+	var lockMessage kv.LockMessage
+	if !testPost(f.followers[0].Address, "/lock/crash", lockRequestBytes, http.StatusOK, &lockMessage) || lockMessage.Owner != "crashed" {
+		fmt.Println("\tMutex could not be locked")
+		t.Fail()
+		return
+	}
+
+	session, err := concurrency.NewSession(f.followers[1].ClientURL, 5)
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	defer session.Close()
+
+	mutex := concurrency.NewMutex(session, "crash")
+	if err := mutex.TryLock(); err != concurrency.ErrLocked {
+		fmt.Println("\tMutex was locked twice")
+		t.Fail()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mutex.Lock(ctx); err != nil {
+		fmt.Println("\tMutex was not released after the holder crashed")
+		t.Fail()
+		return
+	}
+	if err := mutex.Unlock(); err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tMutex released successfully!")
+}
+
+func TestElection(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestElection`..")
+	f := newCluster(t)
+
+	session1, err := concurrency.NewSession(f.followers[0].ClientURL, 5)
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	session2, err := concurrency.NewSession(f.followers[1].ClientURL, 5)
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+
+	election1 := concurrency.NewElection(session1, "election")
+	election2 := concurrency.NewElection(session2, "election")
+
+	if err := election1.Campaign(context.Background()); err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+
+	elected := make(chan error)
+	go func() {
+		elected <- election2.Campaign(context.Background())
+	}()
+
+	time.Sleep(2 * concurrency.RETRY_INTERVAL)
+	if leader, err := election2.Leader(); err != nil || leader != session1.Owner() {
+		fmt.Printf("\tUnexpected election leader `%s`\n", leader)
+		t.Fail()
+		return
+	}
+
+	if err := election1.Resign(); err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	if err := <-elected; err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	if leader, err := election1.Leader(); err != nil || leader != session2.Owner() {
+		fmt.Printf("\tUnexpected election leader `%s`\n", leader)
+		t.Fail()
+		return
+	}
+
+	session1.Close()
+	session2.Close()
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tElection completed successfully!")
+}
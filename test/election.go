@@ -7,21 +7,20 @@ import (
 	"net/http"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
 )
 
 func TestLeaderElection(t *testing.T) {
+	t.Parallel()
 	kv.InfoLogger.Println("Running test `TestLeaderElection`..")
-
-	// Wait for any info passed in heartbeat to propagate
-	time.Sleep(kv.LEADER_HEART_BEAT_TIMEOUT)
+	f := newCluster(t)
+	oldLeader := f.leaderAddress
 
 	// Kill current leader node
-	resp, err := http.Post(kv.GetURL(leaderAddress, "/dev/kill"), "application/json", nil)
+	resp, err := http.Post(nodeURL(f.leaderAddress, "/dev/kill"), "application/json", nil)
 	if err != nil {
-		// Expected error since the container exits right away
+		// Expected error since the node stops right away
 		if !strings.Contains(err.Error(), "EOF") {
 			kv.ErrorLogger.Println(err)
 			t.Fail()
@@ -31,49 +30,44 @@ func TestLeaderElection(t *testing.T) {
 		defer resp.Body.Close()
 	}
 
-	// Wait for poll to finish
-	time.Sleep(kv.MAX_ELECTION_TIMEOUT)
-	// Wait for first heartbeat to finish (followers correct)
-	time.Sleep(kv.LEADER_HEART_BEAT_TIMEOUT)
-
-	// Get new Leader
-	resp, err = http.Get(kv.GetURL(followers[0].Address, "/leader"))
-	if err != nil {
-		kv.ErrorLogger.Println(err)
-		return
-	}
-	defer resp.Body.Close()
+	// Wait for the followers to elect a new leader
 	var ipMessage kv.IPMessage
-	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	if err := json.Unmarshal(bodyBytes, &ipMessage); err != nil {
-		fmt.Printf("Could not parse response body\n")
-		return
-	}
-	if resp.StatusCode != http.StatusOK || ipMessage.InfoMessage != kv.StatusOKMessage {
-		fmt.Printf("Leader request does not return expected result")
+	if !f.eventually(func() bool {
+		resp, err := http.Get(nodeURL(f.followers[0].Address, "/leader"))
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return json.Unmarshal(bodyBytes, &ipMessage) == nil && resp.StatusCode == http.StatusOK &&
+			ipMessage.InfoMessage == kv.StatusOKMessage && !ipMessage.IP.Equal(oldLeader)
+	}) {
+		fmt.Println("\tNo new leader was elected")
+		t.Fail()
 		return
 	}
 
-	leaderAddress = ipMessage.IP
+	f.leaderAddress = ipMessage.IP
 	var oldFollower int
-	for index, follower := range followers {
-		if follower.Address.Equal(leaderAddress) {
+	for index, follower := range f.followers {
+		if follower.Address.Equal(f.leaderAddress) {
 			oldFollower = index
 		}
 	}
+	f.leader = f.followers[oldFollower]
 	// Unordered remove of old follower
-	followers[oldFollower] = followers[len(followers)-1]
-	followers = followers[:len(followers)-1]
+	f.followers[oldFollower] = f.followers[len(f.followers)-1]
+	f.followers = f.followers[:len(f.followers)-1]
 
-	term++
+	f.term++
 
-	if !testLeaderState(followers) {
+	if !f.testLeaderState(f.followers) {
 		kv.ErrorLogger.Println("\tLeader state does not match expectations")
 		t.Fail()
 		return
 	}
 
-	if !testFollowerStates(followers) {
+	if !f.testFollowerStates(f.followers) {
 		kv.ErrorLogger.Println("\tFollower states do not match expectations")
 		t.Fail()
 		return
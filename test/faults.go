@@ -0,0 +1,124 @@
+package kvtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+func testPostDev(address net.IP, path string, request interface{}) bool {
+	requestBytes, _ := json.Marshal(request)
+	resp, err := http.Post(nodeURL(address, path), "application/json", bytes.NewBuffer(requestBytes))
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	return kv.TestEqualMessageResponse(resp, http.StatusOK, kv.StatusOKMessage)
+}
+
+func testLinkFaults(address net.IP, expectedLinks map[string]kv.LinkFaults) bool {
+	resp, err := http.Get(nodeURL(address, "/dev/faults"))
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	var linkFaultsMessage kv.LinkFaultsMessage
+	responseBytes, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(responseBytes, &linkFaultsMessage); err != nil {
+		kv.ErrorLogger.Println("\tLink faults message format unknown")
+		return false
+	}
+	if resp.StatusCode != http.StatusOK || len(linkFaultsMessage.Links) != len(expectedLinks) {
+		kv.ErrorLogger.Printf("\tUnexpected link faults %v\n", linkFaultsMessage.Links)
+		return false
+	}
+	for address, faults := range expectedLinks {
+		if linkFaultsMessage.Links[address] != faults {
+			kv.ErrorLogger.Printf("\tUnexpected link faults %v\n", linkFaultsMessage.Links)
+			return false
+		}
+	}
+	return true
+}
+
+func TestFaultInjection(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestFaultInjection`..")
+	f := newCluster(t)
+
+	partitioned := f.followers[0].Address
+	delayed := kv.LinkFaults{Delay: 10 * time.Millisecond, Jitter: time.Millisecond}
+	if !testPostDev(f.leaderAddress, "/dev/faults", kv.LinkFaultsRequestMessage{Address: partitioned, Faults: delayed}) ||
+		!testLinkFaults(f.leaderAddress, map[string]kv.LinkFaults{partitioned.String(): delayed}) {
+		fmt.Println("\tLink faults were not set")
+		t.Fail()
+		return
+	}
+
+	// The leader no longer sends messages to the partitioned follower, but still reaches a majority
+	blocked := delayed
+	blocked.Blocked = true
+	if !testPostDev(f.leaderAddress, "/dev/partition", kv.PartitionRequestMessage{Addresses: []net.IP{partitioned}}) ||
+		!testLinkFaults(f.leaderAddress, map[string]kv.LinkFaults{partitioned.String(): blocked}) {
+		fmt.Println("\tFollower was not partitioned")
+		t.Fail()
+		return
+	}
+
+	resp, err := http.Post(nodeURL(f.leaderAddress, "/write/faults"), "text/plain", bytes.NewBufferString("partitioned"))
+	if err != nil {
+		kv.ErrorLogger.Println(err)
+		t.Fail()
+		return
+	}
+	defer resp.Body.Close()
+	if !kv.TestEqualMessageResponse(resp, http.StatusOK, kv.StatusOKMessage) {
+		fmt.Println("\tWrite during partition failed")
+		t.Fail()
+		return
+	}
+	// Once the connected followers received the write, the partitioned one would have received it too
+	if !f.eventually(func() bool {
+		for _, follower := range f.followers[1:] {
+			if state, ok := testState(follower.Address); !ok || state.KeyValueStore.Database["faults"] == nil {
+				return false
+			}
+		}
+		return true
+	}) {
+		fmt.Println("\tConnected followers did not receive the write")
+		t.Fail()
+		return
+	}
+
+	state, ok := testState(partitioned)
+	if !ok {
+		kv.ErrorLogger.Println("\tState could not be read")
+		t.Fail()
+		return
+	}
+	if _, ok := state.KeyValueStore.Database["faults"]; ok {
+		fmt.Println("\tPartitioned follower received the write")
+		t.Fail()
+		return
+	}
+
+	if !testPostDev(f.leaderAddress, "/dev/heal", nil) || !testLinkFaults(f.leaderAddress, map[string]kv.LinkFaults{}) {
+		fmt.Println("\tPartition was not healed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tFaults injected successfully!")
+}
@@ -0,0 +1,217 @@
+package kvtest
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+// Every test starts nodes of its own in the test process, like `kv run` would outside of release mode.
+// The nodes of a test listen on loopback addresses of their own, so tests run in any order and in
+// parallel. The fixture of a test also keeps the state the test expects on its nodes.
+
+// Number of followers of every fixture, the network entry tests need at least four
+const FOLLOWER_COUNT = 4
+
+// Fixtures that are not set up within STARTUP_TIMEOUT fail the test
+const STARTUP_TIMEOUT = 5 * time.Second
+
+// Fixtures get loopback addresses of their own. Their nodes are reached at the URLs they advertise, which
+// are kept by their address.
+var fixtureCount = 0
+var fixtureMembers = map[string]kv.Member{}
+var fixtureMutex sync.Mutex
+
+// Transport of the messages between the nodes under test, set by `kv test --peer-transport`
+var PeerTransport = kv.DEFAULT_PEER_TRANSPORT
+
+type fixture struct {
+	t     *testing.T
+	nodes []*kv.KeyValueStore
+
+	leaderAddress net.IP
+	// Member entry of the leader, which holds its ID and URLs like the entries of the followers
+	leader kv.Follower
+	// All followers, whether they registered with the leader or not
+	followers []kv.Follower
+
+	// Expected state of the nodes
+	term         uint64
+	database     map[string][]byte
+	contentTypes map[string]string
+	databaseLog  []*kv.KeyValueLog
+	// Revisions in responses never decrease
+	lastRevision int64
+}
+
+// newFixture starts a leader and FOLLOWER_COUNT followers, which did not register with the leader yet.
+// The nodes are stopped once the test finished.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	fixtureMutex.Lock()
+	fixtureCount++
+	fixtureIndex := fixtureCount
+	fixtureMutex.Unlock()
+
+	f := &fixture{
+		t:            t,
+		database:     map[string][]byte{"initial": []byte("value")},
+		contentTypes: map[string]string{},
+		databaseLog:  []*kv.KeyValueLog{kv.INITIAL_LOG},
+	}
+	t.Cleanup(f.stop)
+
+	for index := 0; index <= FOLLOWER_COUNT; index++ {
+		address := net.IPv4(127, 2, byte(fixtureIndex), byte(index+1))
+		node := f.start(address, index == 0)
+		member := kv.Follower{
+			ID:                  node.ID,
+			Member:              nodeMember(address),
+			LastLogHash:         kv.INITIAL_LOG.Hash,
+			LastCommitedLogHash: kv.INITIAL_LOG.Hash,
+		}
+
+		if index == 0 {
+			f.leaderAddress = address
+			f.leader = member
+		} else {
+			f.followers = append(f.followers, member)
+		}
+	}
+	return f
+}
+
+// newCluster starts a fixture whose followers all registered with the leader
+func newCluster(t *testing.T) *fixture {
+	t.Helper()
+
+	f := newFixture(t)
+	if !f.testRegister(f.followers) {
+		t.Fatal("followers could not register with the leader")
+	}
+	if !f.testLeaderState(f.followers) || !f.testFollowerStates(f.followers) {
+		t.Fatal("cluster did not reach its initial state")
+	}
+	return f
+}
+
+// start runs a node on address that serves all protocols, with the configured peer transport
+func (f *fixture) start(address net.IP, leader bool) *kv.KeyValueStore {
+	f.t.Helper()
+
+	config := kv.DefaultConfig()
+	config.PeerTransport = PeerTransport
+	config.RedisPort = REDIS_PORT
+	config.MemcachedPort = MEMCACHED_PORT
+
+	var transport kv.Transport
+	if config.PeerTransport == kv.HTTP_PEER_TRANSPORT {
+		httpTransport := kv.NewHTTPTransport(config)
+		httpTransport.Host = address.String()
+		transport = httpTransport
+	} else {
+		rpcTransport := kv.NewRPCTransport(config)
+		rpcTransport.Host = address.String()
+		transport = rpcTransport
+	}
+
+	node := kv.InitKeyValueStoreWithConfig(config, leader, nil, address, kv.NewFaultTransport(transport))
+	f.nodes = append(f.nodes, node)
+	fixtureMutex.Lock()
+	fixtureMembers[address.String()] = kv.Member{
+		Address:      address,
+		PeerURL:      node.PeerURL,
+		ClientURL:    node.ClientURL,
+		GRPCURL:      node.GRPCURL,
+		RedisURL:     node.RedisURL,
+		MemcachedURL: node.MemcachedURL,
+	}
+	fixtureMutex.Unlock()
+	if err := node.Serve(address.String()); err != nil {
+		f.t.Fatalf("could not start node %s: %v", address, err)
+	}
+
+	f.waitFor("node "+address.String()+" did not start serving", func() bool {
+		resp, err := http.Get(nodeURL(address, "/status"))
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	})
+	return node
+}
+
+// nodeMember returns where the node at address is reached
+func nodeMember(address net.IP) kv.Member {
+	fixtureMutex.Lock()
+	defer fixtureMutex.Unlock()
+	return fixtureMembers[address.String()]
+}
+
+// nodeURL returns the URL of path on the HTTP API of the node at address
+func nodeURL(address net.IP, path string) string {
+	return "http://" + nodeMember(address).ClientURL + path
+}
+
+// member returns the member entry of the node at address
+func (f *fixture) member(address net.IP) kv.Follower {
+	for _, follower := range f.followers {
+		if follower.Address.Equal(address) {
+			return follower
+		}
+	}
+	return f.leader
+}
+
+// testRegister registers the followers with the leader one by one, and waits until they learned about each other
+// with the heart beats of the leader
+func (f *fixture) testRegister(followers []kv.Follower) bool {
+	f.t.Helper()
+
+	for _, follower := range followers {
+		if !testNetworkEntry(follower.Address, f.leaderAddress) {
+			return false
+		}
+	}
+	f.waitFor("followers did not learn about each other", func() bool {
+		for _, follower := range followers {
+			if state, ok := testState(follower.Address); !ok || len(state.KeyValueStore.Followers) != len(followers) {
+				return false
+			}
+		}
+		return true
+	})
+	return true
+}
+
+// waitFor fails the test with message if condition does not hold within STARTUP_TIMEOUT
+func (f *fixture) waitFor(message string, condition func() bool) {
+	f.t.Helper()
+
+	if !f.eventually(condition) {
+		f.t.Fatal(message)
+	}
+}
+
+// eventually polls condition until it holds, and returns false if it does not hold within STARTUP_TIMEOUT
+func (f *fixture) eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(STARTUP_TIMEOUT); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+	return true
+}
+
+// stop stops all nodes, including the ones a test killed already
+func (f *fixture) stop() {
+	for _, node := range f.nodes {
+		node.Stop()
+	}
+}
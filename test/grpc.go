@@ -0,0 +1,302 @@
+package kvtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kvpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const grpcTimeout = 5 * time.Second
+
+// grpcClient connects to the gRPC API of address, the connection has to be closed by the caller
+func grpcClient(address net.IP) (kvpb.KVClient, *grpc.ClientConn) {
+	connection, err := grpc.NewClient(nodeMember(address).GRPCURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		kv.ErrorLogger.Fatal(err)
+	}
+	return kvpb.NewKVClient(connection), connection
+}
+
+func (f *fixture) testGRPCHeader(header *kvpb.ResponseHeader) bool {
+	if header == nil || header.Leader != f.leaderAddress.String() || header.Revision < f.lastRevision {
+		fmt.Printf("\tgRPC response has unexpected header (%v)\n", header)
+		return false
+	}
+	f.lastRevision = header.Revision
+	return true
+}
+
+func (f *fixture) testGRPCPut(address net.IP, key string, value []byte) bool {
+	client, connection := grpcClient(address)
+	defer connection.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	revision := f.lastRevision
+	response, err := client.Put(ctx, &kvpb.PutRequest{Key: key, Value: value})
+	if err != nil || !f.testGRPCHeader(response.Header) || response.Kv.Key != key || !bytes.Equal(response.Kv.Value, value) {
+		fmt.Printf("\tPut of `%s` failed (%v)\n", key, err)
+		return false
+	}
+	if response.Header.Revision <= revision {
+		fmt.Println("\tPut did not increase the revision")
+		return false
+	}
+
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(key, value, true, true))
+	f.database[key] = value
+	delete(f.contentTypes, key)
+	return true
+}
+
+func (f *fixture) testGRPCGet(address net.IP, key string) bool {
+	client, connection := grpcClient(address)
+	defer connection.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	response, err := client.Get(ctx, &kvpb.GetRequest{Key: key})
+	if err != nil || !f.testGRPCHeader(response.Header) || response.Kv.Key != key || !bytes.Equal(response.Kv.Value, f.database[key]) {
+		fmt.Printf("\tGet of `%s` failed (%v)\n", key, err)
+		return false
+	}
+	return true
+}
+
+func testGRPCCode(err error, expectedCode codes.Code) bool {
+	if status.Code(err) != expectedCode {
+		fmt.Printf("\tgRPC request returned unexpected error (%v), expected %s\n", err, expectedCode)
+		return false
+	}
+	return true
+}
+
+func TestGRPCStatus(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestGRPCStatus`..")
+	f := newCluster(t)
+
+	for _, address := range []net.IP{f.leaderAddress, f.followers[0].Address} {
+		client, connection := grpcClient(address)
+		ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+		response, err := client.Status(ctx, &kvpb.StatusRequest{})
+		cancel()
+		connection.Close()
+
+		if err != nil || !f.testGRPCHeader(response.Header) || response.Address != address.String() ||
+			response.Leader != address.Equal(f.leaderAddress) {
+			fmt.Printf("\tStatus of %s failed (%v)\n", address, err)
+			t.Fail()
+			return
+		}
+		if response.Leader && len(response.Followers) != len(f.followers) {
+			fmt.Printf("\tLeader reported %d followers, expected %d\n", len(response.Followers), len(f.followers))
+			t.Fail()
+			return
+		}
+	}
+
+	fmt.Println("\tStatus completed successfully!")
+}
+
+func TestGRPCPutGet(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestGRPCPutGet`..")
+	f := newCluster(t)
+
+	if !f.testGRPCPut(f.leaderAddress, "grpc/a", []byte("value a")) ||
+		!f.testGRPCPut(f.followers[0].Address, "grpc/b", []byte{0x00, 0xff, 'b'}) {
+		t.Fail()
+		return
+	}
+
+	if !f.testGRPCGet(f.leaderAddress, "grpc/b") || !f.testGRPCGet(f.followers[1].Address, "grpc/a") ||
+		!f.testV2Get(f.followers[0].Address, "grpc/a") {
+		t.Fail()
+		return
+	}
+
+	client, connection := grpcClient(f.followers[0].Address)
+	defer connection.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	_, err := client.Get(ctx, &kvpb.GetRequest{Key: "grpc/missing"})
+	if !testGRPCCode(err, codes.NotFound) {
+		t.Fail()
+		return
+	}
+	_, err = client.Put(ctx, &kvpb.PutRequest{Value: []byte("value")})
+	if !testGRPCCode(err, codes.InvalidArgument) {
+		t.Fail()
+		return
+	}
+
+	if !f.testV2State() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tPut and get completed successfully!")
+}
+
+func TestGRPCRange(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestGRPCRange`..")
+	f := newCluster(t)
+
+	if !f.testGRPCPut(f.leaderAddress, "grpc/a", []byte("value a")) || !f.testGRPCPut(f.leaderAddress, "grpc/b", []byte{0x00, 0xff, 'b'}) {
+		t.Fail()
+		return
+	}
+
+	client, connection := grpcClient(f.followers[0].Address)
+	defer connection.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	response, err := client.Range(ctx, &kvpb.RangeRequest{Prefix: "grpc/"})
+	if err != nil || !f.testGRPCHeader(response.Header) || len(response.Kvs) != 2 ||
+		response.Kvs[0].Key != "grpc/a" || response.Kvs[1].Key != "grpc/b" || !bytes.Equal(response.Kvs[1].Value, f.database["grpc/b"]) {
+		fmt.Printf("\tRange failed (%v)\n", err)
+		t.Fail()
+		return
+	}
+
+	response, err = client.Range(ctx, &kvpb.RangeRequest{Prefix: "grpc/", Limit: 1})
+	if err != nil || len(response.Kvs) != 1 || response.Kvs[0].Key != "grpc/a" {
+		fmt.Printf("\tLimited range failed (%v)\n", err)
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tRange completed successfully!")
+}
+
+func TestGRPCDelete(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestGRPCDelete`..")
+	f := newCluster(t)
+
+	if !f.testGRPCPut(f.leaderAddress, "grpc/b", []byte{0x00, 0xff, 'b'}) {
+		t.Fail()
+		return
+	}
+
+	client, connection := grpcClient(f.followers[1].Address)
+	defer connection.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	response, err := client.Delete(ctx, &kvpb.DeleteRequest{Key: "grpc/b"})
+	if err != nil || !f.testGRPCHeader(response.Header) || !bytes.Equal(response.PrevKv.Value, f.database["grpc/b"]) {
+		fmt.Printf("\tDelete failed (%v)\n", err)
+		t.Fail()
+		return
+	}
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog("grpc/b", nil, true, true))
+	delete(f.database, "grpc/b")
+
+	_, err = client.Delete(ctx, &kvpb.DeleteRequest{Key: "grpc/b"})
+	if !testGRPCCode(err, codes.NotFound) {
+		t.Fail()
+		return
+	}
+	// Failing deletes are logged as well
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog("grpc/b", nil, true, true))
+
+	if !f.testV2State() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tDelete completed successfully!")
+}
+
+func TestGRPCWatch(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestGRPCWatch`..")
+	f := newCluster(t)
+
+	// Watch on a follower, while writing to the leader
+	client, connection := grpcClient(f.followers[0].Address)
+	defer connection.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &kvpb.WatchRequest{Prefix: "grpc/watch/"})
+	if err != nil {
+		fmt.Printf("\tWatch failed (%v)\n", err)
+		t.Fail()
+		return
+	}
+	if response, err := stream.Recv(); err != nil || len(response.Events) != 0 {
+		fmt.Printf("\tWatch was not confirmed (%v)\n", err)
+		t.Fail()
+		return
+	}
+
+	if !f.testGRPCPut(f.leaderAddress, "grpc/watch/a", []byte("a")) ||
+		!f.testGRPCPut(f.leaderAddress, "grpc/unwatched", []byte("b")) ||
+		!f.testV2Put(f.leaderAddress, "grpc/watch/a", []byte("c")) {
+		t.Fail()
+		return
+	}
+
+	leaderClient, leaderConnection := grpcClient(f.leaderAddress)
+	defer leaderConnection.Close()
+	if _, err := leaderClient.Delete(ctx, &kvpb.DeleteRequest{Key: "grpc/watch/a"}); err != nil {
+		fmt.Printf("\tDelete failed (%v)\n", err)
+		t.Fail()
+		return
+	}
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog("grpc/watch/a", nil, true, true))
+	delete(f.database, "grpc/watch/a")
+
+	expectedEvents := []*kvpb.Event{
+		{Type: kvpb.Event_PUT, Kv: &kvpb.KeyValue{Key: "grpc/watch/a", Value: []byte("a")}},
+		{Type: kvpb.Event_PUT, Kv: &kvpb.KeyValue{Key: "grpc/watch/a", Value: []byte("c")}},
+		{Type: kvpb.Event_DELETE, Kv: &kvpb.KeyValue{Key: "grpc/watch/a"}},
+	}
+	events := make([]*kvpb.Event, 0)
+	for len(events) < len(expectedEvents) {
+		response, err := stream.Recv()
+		if err != nil {
+			fmt.Printf("\tWatch ended after %d events (%v)\n", len(events), err)
+			t.Fail()
+			return
+		}
+		events = append(events, response.Events...)
+	}
+
+	revision := int64(0)
+	for index, event := range events {
+		expected := expectedEvents[index]
+		if event.Type != expected.Type || event.Kv.Key != expected.Kv.Key || !bytes.Equal(event.Kv.Value, expected.Kv.Value) ||
+			event.Revision <= revision {
+			fmt.Printf("\tWatch event %d is unexpected (%v)\n", index, event)
+			t.Fail()
+			return
+		}
+		revision = event.Revision
+	}
+
+	if !f.testV2State() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tWatch completed successfully!")
+}
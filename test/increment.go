@@ -0,0 +1,113 @@
+package kvtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+func (f *fixture) testCounter(address net.IP, path string, key string, delta string, expectedStatusCode int, expectedResponse kv.ReadMessage, expectedLogDelta int64) bool {
+	resp, err := http.Post(nodeURL(address, path+key), "text", bytes.NewBuffer([]byte(delta)))
+	if err != nil {
+		fmt.Println("\tCounter request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	readMessageBytes, _ := ioutil.ReadAll(resp.Body)
+	var readMessage kv.ReadMessage
+	if err := json.Unmarshal(readMessageBytes, &readMessage); err != nil {
+		fmt.Println("\tRead message format unknown")
+		return false
+	}
+
+	if resp.StatusCode != expectedStatusCode || readMessage != expectedResponse {
+		fmt.Printf("\tCounter request returned unexpected response (%d, %s, %s)\n", resp.StatusCode, readMessage.InfoMessage, readMessage.Value)
+		return false
+	}
+
+	// Failing increments are committed nonetheless, they just do not change the database
+	f.databaseLog = append(f.databaseLog, kv.CreateIncrementLog(key, expectedLogDelta, true, true))
+	if readMessage.InfoMessage == kv.StatusOKMessage {
+		f.database[key] = []byte(readMessage.Value)
+		delete(f.contentTypes, key)
+	}
+
+	if !f.testLeaderState(f.followers) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		return false
+	}
+
+	if !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		return false
+	}
+
+	return true
+}
+
+func TestDirectIncrement(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestDirectIncrement`..")
+	f := newCluster(t)
+
+	if !f.testCounter(f.leaderAddress, "/increment/", "counter", "", http.StatusOK, kv.ReadMessage{
+		InfoMessage: kv.StatusOKMessage,
+		Value:       "1",
+	}, 1) {
+		fmt.Println("\tIncrement request failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tIncrement completed successfully!")
+}
+
+func TestIndirectIncrement(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestIndirectIncrement`..")
+	f := newCluster(t)
+
+	if !f.testCounter(f.followers[0].Address, "/increment/", "counter", "5", http.StatusOK, kv.ReadMessage{
+		InfoMessage: kv.StatusOKMessage,
+		Value:       "5",
+	}, 5) {
+		fmt.Println("\tIncrement request failed")
+		t.Fail()
+		return
+	}
+
+	if !f.testCounter(f.followers[0].Address, "/decrement/", "counter", "10", http.StatusOK, kv.ReadMessage{
+		InfoMessage: kv.StatusOKMessage,
+		Value:       "-5",
+	}, -10) {
+		fmt.Println("\tDecrement request failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tIncrement completed successfully!")
+}
+
+func TestIncrementNotANumber(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestIncrementNotANumber`..")
+	f := newCluster(t)
+
+	if !f.testCounter(f.leaderAddress, "/increment/", "initial", "", http.StatusConflict, kv.ReadMessage{
+		InfoMessage: kv.StatusNotANumberMessage,
+		Value:       "",
+	}, 1) {
+		fmt.Println("\tIncrement request did not fail as expected")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tIncrement failed as expected!")
+}
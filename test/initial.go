@@ -4,82 +4,72 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"os"
-	"strings"
 	"testing"
 
 	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
 )
 
-var term uint64 = 0
-var database = map[string]string{"initial": "value"}
-var databaseLog []*kv.KeyValueLog = []*kv.KeyValueLog{kv.INITIAL_LOG}
-var followers []kv.Follower
-var leaderAddress net.IP
-
 func TestStatus(t *testing.T) {
-	// Note: This test exists on failure, since the other tests depend on it
+	t.Parallel()
 	fmt.Println("Running test `TestStatus`..")
+	f := newFixture(t)
+
+	addresses := []net.IP{f.leaderAddress}
+	for _, follower := range f.followers {
+		addresses = append(addresses, follower.Address)
+	}
 
-	var i byte
-	for i = 2; true; i++ {
-		ipAddress := kv.GetIPAdress(i)
-		resp, err := http.Get(kv.GetURL(ipAddress, "/status"))
+	for _, address := range addresses {
+		resp, err := http.Get(nodeURL(address, "/status"))
 		if err != nil {
 			kv.ErrorLogger.Println(err)
-			// Expected error when no more replicas can be found
-			if i > 2 && strings.Contains(err.Error(), "connect: connection refused") {
-				break
-			} else {
-				kv.ErrorLogger.Println(err)
-				t.Fail()
-				os.Exit(1)
-			}
+			t.Fail()
+			return
 		}
 		defer resp.Body.Close()
 
 		if !kv.TestEqualMessageResponse(resp, http.StatusOK, kv.StatusOKMessage) {
-			fmt.Printf("\tStatus does not return expected answer for %s\n", ipAddress.String())
+			fmt.Printf("\tStatus does not return expected answer for %s\n", address.String())
 			t.Fail()
-			os.Exit(1)
-		} else {
-			if i == 2 {
-				leaderAddress = ipAddress
-			} else {
-				followers = append(followers, kv.Follower{
-					Address:             ipAddress,
-					LastLogHash:         kv.INITIAL_LOG.Hash,
-					LastCommitedLogHash: kv.INITIAL_LOG.Hash,
-				})
-			}
+			return
 		}
 	}
-	fmt.Println("\tAll containers are up and running!")
+	fmt.Println("\tAll nodes are up and running!")
 }
 
 func TestInitialState(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestInitialState`..")
+	f := newFixture(t)
 
-	if !testLeaderState(make([]kv.Follower, 0)) {
+	if !f.testLeaderState(make([]kv.Follower, 0)) {
 		kv.ErrorLogger.Println("\tLeader state does not match expectations")
 		t.Fail()
 		return
 	}
 
-	for _, follower := range followers {
+	for _, follower := range f.followers {
 		if !testKVStateEqual(follower.Address,
 			kv.StateMessage{
 				InfoMessage: kv.StatusOKMessage,
-				KeyValueStore: kv.KeyValueStore{
-					Term:          term,
+				KeyValueStore: &kv.KeyValueStore{
+					ID:            f.member(follower.Address).ID,
+					Term:          f.term,
 					Leader:        false,
+					LeaderID:      "",
 					LeaderAddress: nil,
 					Followers:     make([]kv.Follower, 0),
 					LocalAddress:  follower.Address,
+					PeerURL:       f.member(follower.Address).PeerURL,
+					ClientURL:     f.member(follower.Address).ClientURL,
+					GRPCURL:       f.member(follower.Address).GRPCURL,
+					RedisURL:      f.member(follower.Address).RedisURL,
+					MemcachedURL:  f.member(follower.Address).MemcachedURL,
 
-					Initialized: false,
-					Database:    database,
-					DatabaseLog: databaseLog,
+					Initialized:  false,
+					Database:     f.database,
+					DatabaseLog:  f.databaseLog,
+					ContentTypes: f.contentTypes,
 				}}) {
 			kv.ErrorLogger.Println("\tFollower states do not match expectations")
 			t.Fail()
@@ -87,7 +77,7 @@ func TestInitialState(t *testing.T) {
 		}
 	}
 
-	fmt.Println("\tAll containers have their expected initial state!")
+	fmt.Println("\tAll nodes have their expected initial state!")
 
 	fmt.Printf(`
 	Test Configuration Information
@@ -96,6 +86,6 @@ func TestInitialState(t *testing.T) {
 	Leader IP Address: %s
 	Follower States:   %s
 `,
-		leaderAddress.String(),
-		followers)
+		f.leaderAddress.String(),
+		f.followers)
 }
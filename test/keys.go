@@ -0,0 +1,207 @@
+package kvtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+// Keys that only work if every byte, including slashes, survives the path
+var hierarchicalKeys = []string{
+	"services/api/host1",
+	"services/api/host2",
+	"services/db/host1",
+	"/leading//double/slash/",
+	"../dots/./",
+	"spaces and ?query=&#fragment%",
+	"unicode/schlüssel",
+}
+
+// testKeyWrite writes value to key via path, which is either the escaped path or the key URL parameter form
+func (f *fixture) testKeyWrite(address net.IP, path string, key string, value string) bool {
+	resp, err := http.Post(nodeURL(address, path), "text", bytes.NewBuffer([]byte(value)))
+	if err != nil {
+		fmt.Println("\tWrite request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	if !kv.TestEqualMessageResponse(resp, http.StatusOK, kv.StatusOKMessage) {
+		fmt.Printf("\tWrite of `%s` failed\n", key)
+		return false
+	}
+
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(key, []byte(value), true, true))
+	f.database[key] = []byte(value)
+	f.contentTypes[key] = "text"
+	return true
+}
+
+func (f *fixture) testKeyRead(address net.IP, path string, key string) bool {
+	resp, err := http.Get(nodeURL(address, path))
+	if err != nil {
+		fmt.Println("\tRead request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	readMessageBytes, _ := ioutil.ReadAll(resp.Body)
+	var readMessage kv.ReadMessage
+	if err := json.Unmarshal(readMessageBytes, &readMessage); err != nil {
+		fmt.Println("\tRead message format unknown")
+		return false
+	}
+
+	if resp.StatusCode != http.StatusOK || readMessage.InfoMessage != kv.StatusOKMessage || readMessage.Value != string(f.database[key]) {
+		fmt.Printf("\tRead of `%s` returned unexpected response (%d, %s)\n", key, resp.StatusCode, readMessage.InfoMessage)
+		return false
+	}
+	return true
+}
+
+func (f *fixture) testScan(address net.IP, prefix string, limit int, expectedKeys []string) bool {
+	resp, err := http.Get(nodeURL(address, fmt.Sprintf("/scan?prefix=%s&limit=%d", url.QueryEscape(prefix), limit)))
+	if err != nil {
+		fmt.Println("\tScan request failed")
+		return false
+	}
+	defer resp.Body.Close()
+
+	scanMessageBytes, _ := ioutil.ReadAll(resp.Body)
+	var scanMessage kv.ScanMessage
+	if err := json.Unmarshal(scanMessageBytes, &scanMessage); err != nil {
+		fmt.Println("\tScan message format unknown")
+		return false
+	}
+
+	if resp.StatusCode != http.StatusOK || scanMessage.InfoMessage != kv.StatusOKMessage || len(scanMessage.Entries) != len(expectedKeys) {
+		fmt.Printf("\tScan of `%s` returned unexpected response (%d, %s, %d entries)\n", prefix, resp.StatusCode, scanMessage.InfoMessage, len(scanMessage.Entries))
+		return false
+	}
+
+	for index, key := range expectedKeys {
+		if scanMessage.Entries[index] != (kv.ScanEntry{Key: key, Value: string(f.database[key])}) {
+			fmt.Printf("\tScan entry `%s` is unexpected, expected `%s`\n", scanMessage.Entries[index].Key, key)
+			return false
+		}
+	}
+	return true
+}
+
+func TestHierarchicalKeys(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestHierarchicalKeys`..")
+	f := newCluster(t)
+
+	for index, key := range hierarchicalKeys {
+		// Alternate between both forms and between leader and follower
+		path := "/write/" + url.PathEscape(key)
+		address := f.leaderAddress
+		if index%2 == 1 {
+			path = kv.KeyPath("/write", key)
+			address = f.followers[0].Address
+		}
+
+		if !f.testKeyWrite(address, path, key, fmt.Sprintf("v%d", index)) {
+			t.Fail()
+			return
+		}
+	}
+
+	// Unescaped slashes in the path are part of the key as well
+	if !f.testKeyRead(f.followers[1].Address, "/read/services/api/host1", "services/api/host1") {
+		t.Fail()
+		return
+	}
+
+	for _, key := range hierarchicalKeys {
+		if !f.testKeyRead(f.leaderAddress, "/read/"+url.PathEscape(key), key) ||
+			!f.testKeyRead(f.followers[0].Address, kv.KeyPath("/read", key), key) {
+			t.Fail()
+			return
+		}
+	}
+
+	if !f.testLeaderState(f.followers) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		t.Fail()
+		return
+	}
+
+	if !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tHierarchical keys completed successfully!")
+}
+
+func TestHierarchicalDelete(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestHierarchicalDelete`..")
+	f := newCluster(t)
+
+	key := "services/db/host1"
+	if !f.testKeyWrite(f.leaderAddress, kv.KeyPath("/write", key), key, "value") {
+		t.Fail()
+		return
+	}
+
+	var readMessage kv.ReadMessage
+	if !testPost(f.followers[0].Address, kv.KeyPath("/delete", key), nil, http.StatusOK, &readMessage) ||
+		readMessage.Value != string(f.database[key]) {
+		fmt.Println("\tDelete failed")
+		t.Fail()
+		return
+	}
+	delete(f.database, key)
+	delete(f.contentTypes, key)
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(key, nil, true, true))
+
+	if !testPost(f.leaderAddress, "/delete/"+url.PathEscape(key), nil, http.StatusNotFound, &readMessage) {
+		fmt.Println("\tDeleted key was found")
+		t.Fail()
+		return
+	}
+	// Failing deletes are logged as well, they just do not change the database
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(key, nil, true, true))
+
+	if !f.testLeaderState(f.followers) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tHierarchical delete completed successfully!")
+}
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestScan`..")
+	f := newCluster(t)
+
+	for index, key := range []string{"services/api/host1", "services/api/host2"} {
+		if !f.testKeyWrite(f.leaderAddress, kv.KeyPath("/write", key), key, fmt.Sprintf("v%d", index)) {
+			t.Fail()
+			return
+		}
+	}
+
+	if !f.testScan(f.leaderAddress, "services/", 0, []string{"services/api/host1", "services/api/host2"}) ||
+		!f.testScan(f.followers[0].Address, "services/api/", 1, []string{"services/api/host1"}) ||
+		!f.testScan(f.followers[1].Address, "services/none/", 0, []string{}) {
+		fmt.Println("\tScan failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tScan completed successfully!")
+}
@@ -0,0 +1,173 @@
+package kvtest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The nodes under test serve the memcached protocol on MEMCACHED_PORT
+const MEMCACHED_PORT = ":11211"
+
+type memcachedClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newMemcachedClient(address net.IP) (*memcachedClient, bool) {
+	conn, err := net.DialTimeout("tcp", nodeMember(address).MemcachedURL, 5*time.Second)
+	if err != nil {
+		fmt.Printf("\tCould not connect to the memcached port of %s (%v)\n", address, err)
+		return nil, false
+	}
+	return &memcachedClient{conn: conn, reader: bufio.NewReader(conn)}, true
+}
+
+// do sends a request and returns the given number of reply lines
+func (c *memcachedClient) do(request string, lines int) string {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write([]byte(request)); err != nil {
+		return err.Error()
+	}
+
+	reply := ""
+	for index := 0; index < lines; index++ {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return reply + err.Error()
+		}
+		reply += line
+	}
+	return reply
+}
+
+// expect sends a request and compares its reply
+func (c *memcachedClient) expect(request string, expected string) bool {
+	if reply := c.do(request, strings.Count(expected, "\n")); reply != expected {
+		fmt.Printf("\t%q replied %q, expected %q\n", request, reply, expected)
+		return false
+	}
+	return true
+}
+
+func TestMemcachedCommands(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestMemcachedCommands`..")
+	f := newCluster(t)
+
+	follower, ok := newMemcachedClient(f.followers[0].Address)
+	if !ok {
+		t.Fail()
+		return
+	}
+	defer follower.conn.Close()
+	leader, ok := newMemcachedClient(f.leaderAddress)
+	if !ok {
+		t.Fail()
+		return
+	}
+	defer leader.conn.Close()
+
+	if !follower.expect("set mc/a 5 0 5\r\nhello\r\n", "STORED\r\n") ||
+		!leader.expect("get mc/a mc/missing\r\n", "VALUE mc/a 5 5\r\nhello\r\nEND\r\n") ||
+		!follower.expect("add mc/a 0 0 1\r\nx\r\n", "NOT_STORED\r\n") ||
+		!follower.expect("add mc/b 0 0 2\r\n10\r\n", "STORED\r\n") ||
+		!follower.expect("replace mc/missing 0 0 1\r\nx\r\n", "NOT_STORED\r\n") ||
+		!follower.expect("replace mc/b 3 0 2\r\n20\r\n", "STORED\r\n") ||
+		!follower.expect("incr mc/b 5\r\n", "25\r\n") ||
+		!follower.expect("decr mc/b 100\r\n", "0\r\n") ||
+		!follower.expect("incr mc/a 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n") ||
+		!follower.expect("incr mc/missing 1\r\n", "NOT_FOUND\r\n") ||
+		!follower.expect("get mc/b\r\n", "VALUE mc/b 3 1\r\n0\r\nEND\r\n") ||
+		!follower.expect("delete mc/a\r\n", "DELETED\r\n") ||
+		!follower.expect("delete mc/a\r\n", "NOT_FOUND\r\n") ||
+		!follower.expect("set mc/quiet 0 0 5 noreply\r\nquiet\r\nget mc/quiet\r\n", "VALUE mc/quiet 0 5\r\nquiet\r\nEND\r\n") ||
+		!follower.expect("unknown\r\n", "ERROR\r\n") ||
+		!follower.expect("version\r\n", "VERSION 1.6.0\r\n") {
+		t.Fail()
+		return
+	}
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tCommands completed successfully!")
+}
+
+func TestMemcachedCas(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestMemcachedCas`..")
+	f := newCluster(t)
+
+	client, ok := newMemcachedClient(f.followers[1].Address)
+	if !ok {
+		t.Fail()
+		return
+	}
+	defer client.conn.Close()
+	if !client.expect("set mc/b 0 0 1\r\n0\r\n", "STORED\r\n") {
+		t.Fail()
+		return
+	}
+
+	// VALUE <key> <flags> <bytes> <cas unique>
+	reply := client.do("gets mc/b\r\n", 3)
+	fields := strings.Fields(reply)
+	if len(fields) != 7 || fields[0] != "VALUE" || fields[6] != "END" {
+		fmt.Printf("\tgets replied %q\n", reply)
+		t.Fail()
+		return
+	}
+	unique, _ := strconv.ParseInt(fields[4], 10, 64)
+	if unique <= 0 {
+		fmt.Printf("\tgets replied cas unique %s\n", fields[4])
+		t.Fail()
+		return
+	}
+	token := strconv.FormatInt(unique, 10)
+	staleToken := strconv.FormatInt(unique-1, 10)
+
+	if !client.expect("cas mc/b 0 0 1 "+staleToken+"\r\n1\r\n", "EXISTS\r\n") ||
+		!client.expect("cas mc/b 0 0 1 "+token+"\r\n1\r\n", "STORED\r\n") ||
+		!client.expect("cas mc/b 0 0 1 "+token+"\r\n2\r\n", "EXISTS\r\n") ||
+		!client.expect("cas mc/missing 0 0 1 "+token+"\r\n1\r\n", "NOT_FOUND\r\n") ||
+		!client.expect("get mc/b\r\n", "VALUE mc/b 0 1\r\n1\r\nEND\r\n") {
+		t.Fail()
+		return
+	}
+
+	// Modifications increase the cas unique
+	reply = client.do("gets mc/b\r\n", 3)
+	fields = strings.Fields(reply)
+	if len(fields) != 7 {
+		fmt.Printf("\tgets replied %q after cas\n", reply)
+		t.Fail()
+		return
+	}
+	if modifiedUnique, _ := strconv.ParseInt(fields[4], 10, 64); modifiedUnique <= unique {
+		fmt.Printf("\tgets replied %q after cas\n", reply)
+		t.Fail()
+		return
+	}
+
+	// Items expire with their lease
+	if !client.expect("set mc/expiring 0 1 1\r\nx\r\n", "STORED\r\n") ||
+		!client.expect("get mc/expiring\r\n", "VALUE mc/expiring 0 1\r\nx\r\nEND\r\n") {
+		t.Fail()
+		return
+	}
+	if !f.eventually(func() bool { return testRead(f.leaderAddress, "mc/expiring", "", false) }) ||
+		!client.expect("get mc/expiring\r\n", "END\r\n") ||
+		!f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tCas completed successfully!")
+}
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"net/url"
 	"testing"
-	"time"
 
 	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
 )
@@ -14,7 +13,8 @@ import (
 func testNetworkEntry(externalAddress net.IP, entryAddress net.IP) bool {
 	form := url.Values{}
 	form.Add("ip", entryAddress.String())
-	resp, err := http.PostForm(kv.GetURL(externalAddress, "/dev/register"), form)
+	form.Add("url", nodeMember(entryAddress).ClientURL)
+	resp, err := http.PostForm(nodeURL(externalAddress, "/dev/register"), form)
 	if err != nil {
 		kv.ErrorLogger.Println(err)
 		return false
@@ -29,10 +29,12 @@ func testNetworkEntry(externalAddress net.IP, entryAddress net.IP) bool {
 }
 
 func TestDirectNetworkEntry(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestDirectNetworkEntry`..")
+	f := newFixture(t)
 
-	externalAddress := followers[0].Address
-	entryAddress := leaderAddress
+	externalAddress := f.followers[0].Address
+	entryAddress := f.leaderAddress
 
 	if !testNetworkEntry(externalAddress, entryAddress) {
 		kv.ErrorLogger.Println("\tRegistration failed")
@@ -40,41 +42,13 @@ func TestDirectNetworkEntry(t *testing.T) {
 		return
 	}
 
-	time.Sleep(kv.MAX_ELECTION_TIMEOUT)
-
-	// Test Leader State
-	if !testKVStateEqual(leaderAddress, kv.StateMessage{
-		InfoMessage: kv.StatusOKMessage,
-		KeyValueStore: kv.KeyValueStore{
-			Term:          term,
-			Leader:        true,
-			LeaderAddress: leaderAddress,
-			Followers:     followers[:1],
-			LocalAddress:  leaderAddress,
-
-			Initialized: true,
-			Database:    database,
-			DatabaseLog: databaseLog,
-		}}) {
+	if !f.testLeaderState(f.followers[:1]) {
 		kv.ErrorLogger.Println("\tLeader state does not match expectations")
 		t.Fail()
 		return
 	}
 
-	// Test Follower State
-	if !testKVStateEqual(externalAddress, kv.StateMessage{
-		InfoMessage: kv.StatusOKMessage,
-		KeyValueStore: kv.KeyValueStore{
-			Term:          term,
-			Leader:        false,
-			LeaderAddress: leaderAddress,
-			Followers:     followers[:1],
-			LocalAddress:  externalAddress,
-
-			Initialized: false,
-			Database:    database,
-			DatabaseLog: databaseLog,
-		}}) {
+	if !f.testFollowerStates(f.followers[:1]) {
 		kv.ErrorLogger.Println("\tFollower state does not match expectations")
 		t.Fail()
 		return
@@ -84,10 +58,17 @@ func TestDirectNetworkEntry(t *testing.T) {
 }
 
 func TestIndirectNetworkEntry(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestIndirectNetworkEntry`..")
+	f := newFixture(t)
+	if !f.testRegister(f.followers[:1]) {
+		kv.ErrorLogger.Println("\tRegistration failed")
+		t.Fail()
+		return
+	}
 
-	externalAddress := followers[1].Address
-	entryAddress := followers[0].Address
+	externalAddress := f.followers[1].Address
+	entryAddress := f.followers[0].Address
 
 	if !testNetworkEntry(externalAddress, entryAddress) {
 		kv.ErrorLogger.Println("\tRegistration failed")
@@ -95,73 +76,52 @@ func TestIndirectNetworkEntry(t *testing.T) {
 		return
 	}
 
-	time.Sleep(kv.MAX_ELECTION_TIMEOUT)
-
-	// Test Leader State
-	if !testKVStateEqual(leaderAddress, kv.StateMessage{
-		InfoMessage: kv.StatusOKMessage,
-		KeyValueStore: kv.KeyValueStore{
-			Term:          term,
-			Leader:        true,
-			LeaderAddress: leaderAddress,
-			Followers:     followers[:2],
-			LocalAddress:  leaderAddress,
-
-			Initialized: true,
-			Database:    database,
-			DatabaseLog: databaseLog,
-		}}) {
+	// The entry node forwards the registration to the leader
+	if !f.testLeaderState(f.followers[:2]) {
 		kv.ErrorLogger.Println("\tLeader state does not match expectations")
 		t.Fail()
 		return
 	}
 
-	// Test State of current followers
-	for _, followerAddress := range []net.IP{entryAddress, externalAddress} {
-		if !testKVStateEqual(followerAddress, kv.StateMessage{
-			InfoMessage: kv.StatusOKMessage,
-			KeyValueStore: kv.KeyValueStore{
-				Term:          term,
-				Leader:        false,
-				LeaderAddress: leaderAddress,
-				Followers:     followers[:2],
-				LocalAddress:  followerAddress,
-
-				Initialized: false,
-				Database:    database,
-				DatabaseLog: databaseLog,
-			}}) {
-			kv.ErrorLogger.Println("\tFollower states do not match expectations")
-			t.Fail()
-			return
-		}
+	if !f.testFollowerStates(f.followers[:2]) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		t.Fail()
+		return
 	}
 
 	kv.InfoLogger.Println("\tNode entered successfully!")
 }
 
 func TestNetworkEntryLogReplication(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestNetworkEntryLogReplication`..")
+	f := newFixture(t)
+	if !f.testRegister(f.followers[:2]) {
+		kv.ErrorLogger.Println("\tRegistration failed")
+		t.Fail()
+		return
+	}
 
-	testWriteFollowers(followers[:2], leaderAddress, "log", "replication")
-	time.Sleep(kv.LEADER_HEART_BEAT_TIMEOUT)
+	if !f.testWriteFollowers(f.followers[:2], f.leaderAddress, "log", "replication") {
+		kv.ErrorLogger.Println("\tWrite failed")
+		t.Fail()
+		return
+	}
 
-	follower := followers[2]
-	if !testNetworkEntry(follower.Address, leaderAddress) {
+	follower := f.followers[2]
+	if !testNetworkEntry(follower.Address, f.leaderAddress) {
 		kv.ErrorLogger.Println("\tRegistration failed")
 		t.Fail()
 		return
 	}
 
-	time.Sleep(kv.LEADER_HEART_BEAT_TIMEOUT)
-
-	if !testLeaderState(followers[:3]) {
+	if !f.testLeaderState(f.followers[:3]) {
 		kv.ErrorLogger.Println("\tLeader state does not match expectations")
 		t.Fail()
 		return
 	}
 
-	if !testFollowerStates(followers[:3]) {
+	if !f.testFollowerStates(f.followers[:3]) {
 		kv.ErrorLogger.Println("\tFollower states do not match expectations")
 		t.Fail()
 		return
@@ -171,26 +131,31 @@ func TestNetworkEntryLogReplication(t *testing.T) {
 }
 
 func TestRemainingNetworkEntry(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestRemainingNetworkEntry`..")
+	f := newFixture(t)
+	if !f.testRegister(f.followers[:3]) {
+		kv.ErrorLogger.Println("\tRegistration failed")
+		t.Fail()
+		return
+	}
 
 	// Register remaining followers directly
-	for _, follower := range followers[3:] {
-		if !testNetworkEntry(follower.Address, leaderAddress) {
+	for _, follower := range f.followers[3:] {
+		if !testNetworkEntry(follower.Address, f.leaderAddress) {
 			kv.ErrorLogger.Println("\tRegistration failed")
 			t.Fail()
 			return
 		}
 	}
 
-	time.Sleep(kv.LEADER_HEART_BEAT_TIMEOUT)
-
-	if !testLeaderState(followers) {
+	if !f.testLeaderState(f.followers) {
 		kv.ErrorLogger.Println("\tLeader state does not match expectations")
 		t.Fail()
 		return
 	}
 
-	if !testFollowerStates(followers) {
+	if !f.testFollowerStates(f.followers) {
 		kv.ErrorLogger.Println("\tFollower states do not match expectations")
 		t.Fail()
 		return
@@ -12,7 +12,7 @@ import (
 )
 
 func testRead(address net.IP, key string, expectedValue_ string, expectFind bool) bool {
-	resp, err := http.Get(kv.GetURL(address, "/read/"+key))
+	resp, err := http.Get(nodeURL(address, "/read/"+key))
 	if err != nil {
 		fmt.Println("\tRead request failed")
 		return false
@@ -55,9 +55,11 @@ func testRead(address net.IP, key string, expectedValue_ string, expectFind bool
 }
 
 func TestInitialDirectRead(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestInitialDirectRead`..")
+	f := newCluster(t)
 
-	if !testRead(leaderAddress, "initial", "value", true) {
+	if !testRead(f.leaderAddress, "initial", "value", true) {
 		fmt.Println("\tRead request failed")
 		t.Fail()
 		return
@@ -67,9 +69,11 @@ func TestInitialDirectRead(t *testing.T) {
 }
 
 func TestInitialIndirectRead(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestInitialIndirectRead`..")
+	f := newCluster(t)
 
-	if !testRead(followers[0].Address, "initial", "value", true) {
+	if !testRead(f.followers[0].Address, "initial", "value", true) {
 		fmt.Println("\tRead request failed")
 		t.Fail()
 		return
@@ -79,9 +83,11 @@ func TestInitialIndirectRead(t *testing.T) {
 }
 
 func TestInitialDirectReadNotFound(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestInitialDirectReadNotFound`..")
+	f := newCluster(t)
 
-	if !testRead(leaderAddress, "whatever", "", false) {
+	if !testRead(f.leaderAddress, "whatever", "", false) {
 		fmt.Println("\tRead request failed")
 		t.Fail()
 		return
@@ -91,9 +97,11 @@ func TestInitialDirectReadNotFound(t *testing.T) {
 }
 
 func TestInitialIndirectReadNotFound(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestInitialIndirectReadNotFound`..")
+	f := newCluster(t)
 
-	if !testRead(followers[0].Address, "whatever", "", false) {
+	if !testRead(f.followers[0].Address, "whatever", "", false) {
 		fmt.Println("\tRead request failed")
 		t.Fail()
 		return
@@ -0,0 +1,262 @@
+package kvtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The nodes under test serve the Redis protocol on REDIS_PORT
+const REDIS_PORT = ":6379"
+
+// redisClient sends commands over a single connection, so transactions span several commands
+type redisClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is the reply to a failed command
+type redisError string
+
+func newRedisClient(address net.IP) (*redisClient, bool) {
+	conn, err := net.DialTimeout("tcp", nodeMember(address).RedisURL, 5*time.Second)
+	if err != nil {
+		fmt.Printf("\tCould not connect to the Redis port of %s (%v)\n", address, err)
+		return nil, false
+	}
+	return &redisClient{conn: conn, reader: bufio.NewReader(conn)}, true
+}
+
+// do sends a command and returns its reply, which is a string, an int64, nil, a redisError or a slice of replies
+func (c *redisClient) do(args ...string) interface{} {
+	command := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		command += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write([]byte(command)); err != nil {
+		return redisError(err.Error())
+	}
+	return c.readReply()
+}
+
+func (c *redisClient) readReply() interface{} {
+	line, err := c.reader.ReadString('\n')
+	if err != nil || len(line) < 3 {
+		return redisError(fmt.Sprintf("reply could not be read (%v)", err))
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return redisError(line[1:])
+	case ':':
+		integer, _ := strconv.ParseInt(line[1:], 10, 64)
+		return integer
+	case '$':
+		length, _ := strconv.Atoi(line[1:])
+		if length < 0 {
+			return nil
+		}
+		bulk := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, bulk); err != nil {
+			return redisError(err.Error())
+		}
+		return string(bulk[:length])
+	case '*':
+		count, _ := strconv.Atoi(line[1:])
+		replies := make([]interface{}, count)
+		for index := range replies {
+			replies[index] = c.readReply()
+		}
+		return replies
+	default:
+		return redisError("unknown reply " + line)
+	}
+}
+
+// expect sends a command and compares its reply
+func (c *redisClient) expect(expected interface{}, args ...string) bool {
+	reply := c.do(args...)
+	if !reflect.DeepEqual(reply, expected) {
+		fmt.Printf("\t%v replied %#v, expected %#v\n", args, reply, expected)
+		return false
+	}
+	return true
+}
+
+func TestRedisCommands(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestRedisCommands`..")
+	f := newCluster(t)
+
+	follower, ok := newRedisClient(f.followers[0].Address)
+	if !ok {
+		t.Fail()
+		return
+	}
+	defer follower.conn.Close()
+	leader, ok := newRedisClient(f.leaderAddress)
+	if !ok {
+		t.Fail()
+		return
+	}
+	defer leader.conn.Close()
+
+	if !follower.expect("PONG", "PING") ||
+		!follower.expect("OK", "SET", "redis/a", "1") ||
+		!leader.expect("1", "GET", "redis/a") ||
+		!follower.expect(int64(2), "INCR", "redis/a") ||
+		!leader.expect(int64(7), "INCRBY", "redis/a", "5") ||
+		!follower.expect(int64(6), "DECR", "redis/a") ||
+		!follower.expect("OK", "SET", "redis/b", "x", "NX") ||
+		!follower.expect(nil, "SET", "redis/b", "y", "NX") ||
+		!follower.expect("x", "GET", "redis/b") ||
+		!follower.expect(nil, "GET", "redis/missing") ||
+		!follower.expect(int64(2), "EXISTS", "redis/a", "redis/b", "redis/missing") ||
+		!follower.expect([]interface{}{"redis/a", "redis/b"}, "KEYS", "redis/*") ||
+		!follower.expect([]interface{}{"redis/b"}, "KEYS", "redis/[b-z]") ||
+		!follower.expect([]interface{}{"0", []interface{}{"redis/a", "redis/b"}}, "SCAN", "0", "MATCH", "redis/?", "COUNT", "1000") ||
+		!follower.expect(redisError("ERR value is not an integer or out of range"), "INCR", "redis/b") ||
+		!follower.expect(int64(1), "DEL", "redis/b", "redis/missing") ||
+		!follower.expect(redisError("ERR unknown command 'unknown'"), "UNKNOWN") {
+		t.Fail()
+		return
+	}
+
+	// SCAN visits every key exactly once
+	scanned := make(map[string]int)
+	for cursor := "0"; ; {
+		reply, ok := follower.do("SCAN", cursor, "COUNT", "3").([]interface{})
+		if !ok || len(reply) != 2 {
+			fmt.Printf("\tSCAN replied %#v\n", reply)
+			t.Fail()
+			return
+		}
+		for _, key := range reply[1].([]interface{}) {
+			scanned[key.(string)]++
+		}
+		if cursor = reply[0].(string); cursor == "0" {
+			break
+		}
+	}
+	if !f.testAdoptLeaderState() || len(scanned) != len(f.database) {
+		fmt.Printf("\tSCAN returned %d keys, expected %d\n", len(scanned), len(f.database))
+		t.Fail()
+		return
+	}
+	for key, count := range scanned {
+		if _, ok := f.database[key]; !ok || count != 1 {
+			fmt.Printf("\tSCAN returned `%s` %d times\n", key, count)
+			t.Fail()
+			return
+		}
+	}
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tCommands completed successfully!")
+}
+
+func TestRedisExpire(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestRedisExpire`..")
+	f := newCluster(t)
+
+	client, ok := newRedisClient(f.followers[1].Address)
+	if !ok {
+		t.Fail()
+		return
+	}
+	defer client.conn.Close()
+
+	if !client.expect("OK", "SET", "redis/ttl", "value", "EX", "1") ||
+		!client.expect(int64(1), "TTL", "redis/ttl") ||
+		!client.expect("OK", "SET", "redis/persistent", "value") ||
+		!client.expect(int64(-1), "TTL", "redis/persistent") ||
+		!client.expect(int64(-2), "TTL", "redis/missing") ||
+		!client.expect(int64(1), "EXPIRE", "redis/persistent", "1") ||
+		!client.expect(int64(0), "EXPIRE", "redis/missing", "1") ||
+		!client.expect(int64(1), "TTL", "redis/persistent") ||
+		!client.expect("OK", "SET", "redis/deleted", "value") ||
+		!client.expect(int64(1), "EXPIRE", "redis/deleted", "0") ||
+		!client.expect(int64(0), "EXISTS", "redis/deleted") {
+		t.Fail()
+		return
+	}
+
+	// Wait for the leases to expire
+	if !f.eventually(func() bool { return client.expect(int64(0), "EXISTS", "redis/ttl", "redis/persistent") }) ||
+		!f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tExpire completed successfully!")
+}
+
+func TestRedisTransaction(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestRedisTransaction`..")
+	f := newCluster(t)
+
+	// Transactions are relayed to the leader as a whole
+	client, ok := newRedisClient(f.followers[0].Address)
+	if !ok {
+		t.Fail()
+		return
+	}
+	defer client.conn.Close()
+
+	if !client.expect("OK", "SET", "redis/a", "1") ||
+		!client.expect("OK", "MULTI") ||
+		!client.expect("QUEUED", "SET", "redis/counter", "1") ||
+		!client.expect("QUEUED", "INCRBY", "redis/counter", "2") ||
+		!client.expect("QUEUED", "DEL", "redis/a") ||
+		!client.expect([]interface{}{"OK", int64(3), int64(1)}, "EXEC") ||
+		!client.expect("3", "GET", "redis/counter") {
+		t.Fail()
+		return
+	}
+
+	// Reads cannot be queued and abort the transaction
+	if !client.expect("OK", "MULTI") ||
+		!client.expect("QUEUED", "SET", "redis/counter", "4") ||
+		!client.expect(redisError("ERR Command not allowed inside a transaction"), "GET", "redis/counter") ||
+		!client.expect(redisError("EXECABORT Transaction discarded because of previous errors."), "EXEC") ||
+		!client.expect("OK", "MULTI") ||
+		!client.expect("QUEUED", "SET", "redis/counter", "5") ||
+		!client.expect("OK", "DISCARD") ||
+		!client.expect("3", "GET", "redis/counter") ||
+		!client.expect(redisError("ERR EXEC without MULTI"), "EXEC") {
+		t.Fail()
+		return
+	}
+
+	// Failing commands do not roll back the transaction
+	if !client.expect("OK", "MULTI") ||
+		!client.expect("QUEUED", "SET", "redis/text", "text") ||
+		!client.expect("QUEUED", "INCR", "redis/text") ||
+		!client.expect("QUEUED", "INCR", "redis/counter") ||
+		!client.expect([]interface{}{"OK", redisError("ERR value is not an integer or out of range"), int64(4)}, "EXEC") {
+		t.Fail()
+		return
+	}
+
+	if !f.testStateAfterConcurrency() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tTransaction completed successfully!")
+}
@@ -0,0 +1,89 @@
+package kvtest
+
+import "testing"
+
+// Tests lists all integration tests, which are run by `kv test` and by TestIntegration. Every test starts
+// nodes of its own, so the tests do not depend on each other and run in any order.
+var Tests = []testing.InternalTest{
+	// Setup
+	{"TestTesting", TestTesting},
+	{"TestStatus", TestStatus},
+	{"TestInitialState", TestInitialState},
+
+	// Network Entry
+	{"TestDirectNetworkEntry", TestDirectNetworkEntry},
+	{"TestIndirectNetworkEntry", TestIndirectNetworkEntry},
+	{"TestNetworkEntryLogReplication", TestNetworkEntryLogReplication},
+	{"TestRemainingNetworkEntry", TestRemainingNetworkEntry},
+
+	// Leader Election
+	{"TestLeaderElection", TestLeaderElection},
+
+	// Read
+	{"TestInitialDirectRead", TestInitialDirectRead},
+	{"TestInitialIndirectRead", TestInitialIndirectRead},
+	{"TestInitialDirectReadNotFound", TestInitialDirectReadNotFound},
+	{"TestInitialIndirectReadNotFound", TestInitialIndirectReadNotFound},
+
+	// Write
+	{"TestDirectWrite", TestDirectWrite},
+	{"TestIndirectWrite", TestIndirectWrite},
+	{"TestConcurrentWrite", TestConcurrentWrite},
+
+	// Keys
+	{"TestHierarchicalKeys", TestHierarchicalKeys},
+	{"TestHierarchicalDelete", TestHierarchicalDelete},
+	{"TestScan", TestScan},
+
+	// V2
+	{"TestV2Status", TestV2Status},
+	{"TestV2PutGet", TestV2PutGet},
+	{"TestV2Range", TestV2Range},
+	{"TestV2Errors", TestV2Errors},
+	{"TestV2Delete", TestV2Delete},
+
+	// gRPC
+	{"TestGRPCStatus", TestGRPCStatus},
+	{"TestGRPCPutGet", TestGRPCPutGet},
+	{"TestGRPCRange", TestGRPCRange},
+	{"TestGRPCDelete", TestGRPCDelete},
+	{"TestGRPCWatch", TestGRPCWatch},
+
+	// Binary
+	{"TestBinaryValue", TestBinaryValue},
+	{"TestBinaryBatchValue", TestBinaryBatchValue},
+	{"TestContentTypePassthrough", TestContentTypePassthrough},
+	{"TestLargeValue", TestLargeValue},
+	{"TestValueTooLarge", TestValueTooLarge},
+
+	// Increment
+	{"TestDirectIncrement", TestDirectIncrement},
+	{"TestIndirectIncrement", TestIndirectIncrement},
+	{"TestIncrementNotANumber", TestIncrementNotANumber},
+
+	// Batch
+	{"TestDirectBatchWrite", TestDirectBatchWrite},
+	{"TestIndirectBatchWrite", TestIndirectBatchWrite},
+	{"TestDirectBatchRead", TestDirectBatchRead},
+	{"TestIndirectBatchRead", TestIndirectBatchRead},
+
+	// Redis
+	{"TestRedisCommands", TestRedisCommands},
+	{"TestRedisExpire", TestRedisExpire},
+	{"TestRedisTransaction", TestRedisTransaction},
+
+	// Memcached
+	{"TestMemcachedCommands", TestMemcachedCommands},
+	{"TestMemcachedCas", TestMemcachedCas},
+
+	// Concurrency
+	{"TestCompareAndSwap", TestCompareAndSwap},
+	{"TestLeaseRevoke", TestLeaseRevoke},
+	{"TestLeaseExpiry", TestLeaseExpiry},
+	{"TestMutex", TestMutex},
+	{"TestMutexHolderCrash", TestMutexHolderCrash},
+	{"TestElection", TestElection},
+
+	// Faults
+	{"TestFaultInjection", TestFaultInjection},
+}
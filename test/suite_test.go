@@ -0,0 +1,14 @@
+package kvtest
+
+import "testing"
+
+// TestIntegration runs the integration tests with `go test`, single tests are selected with e.g. `-run Integration/TestDirectWrite$`
+func TestIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration tests start several nodes per test")
+	}
+
+	for _, test := range Tests {
+		t.Run(test.Name, test.F)
+	}
+}
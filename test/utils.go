@@ -1,6 +1,8 @@
 package kvtest
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net"
 	"net/http"
 
@@ -8,7 +10,7 @@ import (
 )
 
 func testKVStateEqual(address net.IP, expectedState kv.StateMessage) bool {
-	resp, err := http.Get(kv.GetURL(address, "/dev/state"))
+	resp, err := http.Get(nodeURL(address, "/dev/state"))
 	if err != nil {
 		kv.ErrorLogger.Println(err)
 		return false
@@ -18,44 +20,110 @@ func testKVStateEqual(address net.IP, expectedState kv.StateMessage) bool {
 	return kv.TestEqualStateResponse(resp, http.StatusOK, expectedState)
 }
 
+// testState returns the state of the node at address
+func testState(address net.IP) (kv.StateMessage, bool) {
+	var state kv.StateMessage
+	resp, err := http.Get(nodeURL(address, "/dev/state"))
+	if err != nil {
+		return state, false
+	}
+	defer resp.Body.Close()
+
+	stateBytes, _ := ioutil.ReadAll(resp.Body)
+	return state, json.Unmarshal(stateBytes, &state) == nil
+}
+
 //
 // Test State
 //
 
-func testLeaderState(followers []kv.Follower) bool {
-	return testKVStateEqual(leaderAddress,
+// testAdoptLeaderState extends the expected database log by all logs the leader appended since,
+// and takes over its database. This is needed whenever the leader decides the order of logs.
+func (f *fixture) testAdoptLeaderState() bool {
+	state, ok := testState(f.leaderAddress)
+	if !ok {
+		kv.ErrorLogger.Println("\tState could not be read")
+		return false
+	}
+
+	leaderLog := state.KeyValueStore.DatabaseLog
+	if len(leaderLog) < len(f.databaseLog) {
+		kv.ErrorLogger.Printf("\tLeader log is shorter than expected (%d)\n", len(leaderLog))
+		return false
+	}
+	for _, logEntry := range leaderLog[len(f.databaseLog):] {
+		f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(logEntry.Key, logEntry.Value, true, true))
+	}
+	f.database = state.KeyValueStore.Database
+	f.contentTypes = state.KeyValueStore.ContentTypes
+	if f.contentTypes == nil {
+		f.contentTypes = map[string]string{}
+	}
+
+	return true
+}
+
+// testLeaderState waits until the leader holds the expected state, at most for STARTUP_TIMEOUT. Like the state of
+// the followers, it changes with the messages the nodes exchange after a request returned.
+func (f *fixture) testLeaderState(followers []kv.Follower) bool {
+	return f.eventually(func() bool { return f.leaderStateEqual(followers) })
+}
+
+func (f *fixture) leaderStateEqual(followers []kv.Follower) bool {
+	return testKVStateEqual(f.leaderAddress,
 		kv.StateMessage{
 			InfoMessage: kv.StatusOKMessage,
-			KeyValueStore: kv.KeyValueStore{
-				Term:          term,
+			KeyValueStore: &kv.KeyValueStore{
+				ID:            f.member(f.leaderAddress).ID,
+				Term:          f.term,
 				Leader:        true,
-				LeaderAddress: leaderAddress,
+				LeaderID:      f.leader.ID,
+				LeaderAddress: f.leaderAddress,
 				Followers:     followers,
-				LocalAddress:  leaderAddress,
+				LocalAddress:  f.leaderAddress,
+				PeerURL:       f.member(f.leaderAddress).PeerURL,
+				ClientURL:     f.member(f.leaderAddress).ClientURL,
+				GRPCURL:       f.member(f.leaderAddress).GRPCURL,
+				RedisURL:      f.member(f.leaderAddress).RedisURL,
+				MemcachedURL:  f.member(f.leaderAddress).MemcachedURL,
 
-				Initialized: true,
-				Database:    database,
-				DatabaseLog: databaseLog,
+				Initialized:  true,
+				Database:     f.database,
+				DatabaseLog:  f.databaseLog,
+				ContentTypes: f.contentTypes,
 			},
 		},
 	)
 }
 
-func testFollowerStates(followers []kv.Follower) bool {
+// testFollowerStates waits until the followers hold the expected state, at most for STARTUP_TIMEOUT
+func (f *fixture) testFollowerStates(followers []kv.Follower) bool {
+	return f.eventually(func() bool { return f.followerStatesEqual(followers) })
+}
+
+func (f *fixture) followerStatesEqual(followers []kv.Follower) bool {
 	for _, follower := range followers {
 		if !testKVStateEqual(follower.Address,
 			kv.StateMessage{
 				InfoMessage: kv.StatusOKMessage,
-				KeyValueStore: kv.KeyValueStore{
-					Term:          term,
+				KeyValueStore: &kv.KeyValueStore{
+					ID:            f.member(follower.Address).ID,
+					Term:          f.term,
 					Leader:        false,
-					LeaderAddress: leaderAddress,
+					LeaderID:      f.leader.ID,
+					LeaderAddress: f.leaderAddress,
 					Followers:     followers,
 					LocalAddress:  follower.Address,
+					PeerURL:       f.member(follower.Address).PeerURL,
+					ClientURL:     f.member(follower.Address).ClientURL,
+					GRPCURL:       f.member(follower.Address).GRPCURL,
+					RedisURL:      f.member(follower.Address).RedisURL,
+					MemcachedURL:  f.member(follower.Address).MemcachedURL,
 
-					Initialized: false,
-					Database:    database,
-					DatabaseLog: databaseLog,
+					Initialized:  false,
+					Database:     f.database,
+					DatabaseLog:  f.databaseLog,
+					ContentTypes: f.contentTypes,
 				}}) {
 			kv.ErrorLogger.Println("\tFollower states do not match expectations")
 			return false
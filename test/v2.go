@@ -0,0 +1,264 @@
+package kvtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
+)
+
+// testV2Request sends request to a v2 route and checks the status code as well as the response header
+func (f *fixture) testV2Request(address net.IP, method string, path string, contentType string, request interface{}, expectedStatusCode int, response *kv.V2Response) bool {
+	var body []byte
+	if rawRequest, ok := request.(string); ok {
+		body = []byte(rawRequest)
+	} else {
+		body, _ = json.Marshal(request)
+	}
+
+	req, _ := http.NewRequest(method, nodeURL(address, path), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("\tRequest to %s failed\n", path)
+		return false
+	}
+	defer resp.Body.Close()
+
+	responseBytes, _ := ioutil.ReadAll(resp.Body)
+	*response = kv.V2Response{}
+	if err := json.Unmarshal(responseBytes, response); err != nil {
+		fmt.Printf("\tResponse format of %s unknown\n", path)
+		return false
+	}
+
+	if resp.StatusCode != expectedStatusCode {
+		fmt.Printf("\tRequest to %s returned unexpected status code (%d, %v)\n", path, resp.StatusCode, response.Error)
+		return false
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		fmt.Printf("\tRequest to %s returned unexpected content type `%s`\n", path, resp.Header.Get("Content-Type"))
+		return false
+	}
+
+	header := response.Header
+	if !header.Leader.Equal(f.leaderAddress) || header.Revision < f.lastRevision ||
+		resp.Header.Get(kv.REVISION_HEADER) != strconv.FormatInt(header.Revision, 10) ||
+		resp.Header.Get(kv.TERM_HEADER) != strconv.FormatUint(header.Term, 10) ||
+		resp.Header.Get(kv.LEADER_HEADER) != header.Leader.String() {
+		fmt.Printf("\tRequest to %s returned unexpected header (%d, %d, %s)\n", path, header.Revision, header.Term, header.Leader)
+		return false
+	}
+	f.lastRevision = header.Revision
+	return true
+}
+
+func (f *fixture) testV2Error(address net.IP, method string, path string, contentType string, request interface{}, expectedStatusCode int, expectedCode string) bool {
+	var response kv.V2Response
+	if !f.testV2Request(address, method, path, contentType, request, expectedStatusCode, &response) {
+		return false
+	}
+	if response.Error == nil || response.Error.Code != expectedCode {
+		fmt.Printf("\tRequest to %s returned unexpected error (%v), expected %s\n", path, response.Error, expectedCode)
+		return false
+	}
+	return true
+}
+
+func (f *fixture) testV2Put(address net.IP, key string, value []byte) bool {
+	var response kv.V2Response
+	revision := f.lastRevision
+	if !f.testV2Request(address, "POST", "/v2/kv/put", "application/json", kv.V2PutRequest{Key: key, Value: value}, http.StatusOK, &response) ||
+		response.KV == nil || response.KV.Key != key || !bytes.Equal(response.KV.Value, value) {
+		fmt.Println("\tPut failed")
+		return false
+	}
+	if response.Header.Revision <= revision {
+		fmt.Println("\tPut did not increase the revision")
+		return false
+	}
+
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(key, value, true, true))
+	f.database[key] = value
+	delete(f.contentTypes, key)
+	return true
+}
+
+func (f *fixture) testV2Get(address net.IP, key string) bool {
+	var response kv.V2Response
+	if !f.testV2Request(address, "POST", "/v2/kv/get", "", kv.V2KeyRequest{Key: key}, http.StatusOK, &response) ||
+		response.Error != nil || response.KV == nil || response.KV.Key != key || !bytes.Equal(response.KV.Value, f.database[key]) {
+		fmt.Printf("\tGet of `%s` failed\n", key)
+		return false
+	}
+	return true
+}
+
+func (f *fixture) testV2State() bool {
+	if !f.testLeaderState(f.followers) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		return false
+	}
+
+	if !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		return false
+	}
+	return true
+}
+
+func TestV2Status(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestV2Status`..")
+	f := newCluster(t)
+
+	var response kv.V2Response
+	if !f.testV2Request(f.leaderAddress, "GET", "/v2/status", "", "", http.StatusOK, &response) ||
+		!f.testV2Request(f.followers[0].Address, "GET", "/v2/status", "", "", http.StatusOK, &response) {
+		fmt.Println("\tStatus failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tStatus completed successfully!")
+}
+
+func TestV2PutGet(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestV2PutGet`..")
+	f := newCluster(t)
+
+	if !f.testV2Put(f.leaderAddress, "v2/a", []byte("value a")) ||
+		!f.testV2Put(f.followers[0].Address, "v2/b", []byte{0x00, 0xff, 'b'}) {
+		t.Fail()
+		return
+	}
+
+	if !f.testV2Get(f.leaderAddress, "v2/b") || !f.testV2Get(f.followers[1].Address, "v2/a") {
+		t.Fail()
+		return
+	}
+
+	if !f.testV2State() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tPut and get completed successfully!")
+}
+
+func TestV2Range(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestV2Range`..")
+	f := newCluster(t)
+
+	if !f.testV2Put(f.leaderAddress, "v2/a", []byte("value a")) || !f.testV2Put(f.leaderAddress, "v2/b", []byte{0x00, 0xff, 'b'}) {
+		t.Fail()
+		return
+	}
+
+	var response kv.V2Response
+	if !f.testV2Request(f.followers[0].Address, "POST", "/v2/kv/range", "application/json", kv.V2RangeRequest{Prefix: "v2/"}, http.StatusOK, &response) ||
+		len(response.KVs) != 2 || response.KVs[0].Key != "v2/a" || response.KVs[1].Key != "v2/b" ||
+		!bytes.Equal(response.KVs[1].Value, f.database["v2/b"]) {
+		fmt.Println("\tRange failed")
+		t.Fail()
+		return
+	}
+
+	if !f.testV2Request(f.leaderAddress, "POST", "/v2/kv/range", "application/json", kv.V2RangeRequest{Prefix: "v2/", Limit: 1}, http.StatusOK, &response) ||
+		len(response.KVs) != 1 || response.KVs[0].Key != "v2/a" {
+		fmt.Println("\tLimited range failed")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tRange completed successfully!")
+}
+
+func TestV2Errors(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestV2Errors`..")
+	f := newCluster(t)
+
+	if !f.testV2Put(f.leaderAddress, "v2/a", []byte("value a")) {
+		t.Fail()
+		return
+	}
+
+	for _, address := range []net.IP{f.leaderAddress, f.followers[0].Address} {
+		if !f.testV2Error(address, "POST", "/v2/kv/get", "application/json", kv.V2KeyRequest{Key: "v2/missing"}, http.StatusNotFound, kv.ErrorCodeKeyNotFound) ||
+			!f.testV2Error(address, "POST", "/v2/kv/get", "application/json", kv.V2KeyRequest{}, http.StatusBadRequest, kv.ErrorCodeEmptyKey) ||
+			!f.testV2Error(address, "POST", "/v2/kv/put", "application/json", "{malformed", http.StatusBadRequest, kv.ErrorCodeBadRequest) ||
+			!f.testV2Error(address, "POST", "/v2/kv/put", "text/plain", "value", http.StatusUnsupportedMediaType, kv.ErrorCodeUnsupportedMediaType) ||
+			!f.testV2Error(address, "POST", "/v2/kv/unknown", "application/json", "{}", http.StatusNotFound, kv.ErrorCodeRouteNotFound) ||
+			!f.testV2Error(address, "GET", "/v2/kv/put", "", "", http.StatusMethodNotAllowed, kv.ErrorCodeMethodNotAllowed) {
+			t.Fail()
+			return
+		}
+	}
+
+	// Failing writes are logged, but leave the database untouched
+	var response kv.V2Response
+	if !f.testV2Request(f.followers[0].Address, "POST", "/v2/kv/cas", "application/json",
+		kv.V2CompareAndSwapRequest{Key: "v2/a", ExpectAbsent: true, Value: []byte("other")}, http.StatusConflict, &response) ||
+		response.Error == nil || response.Error.Code != kv.ErrorCodeCompareFailed ||
+		response.KV == nil || !bytes.Equal(response.KV.Value, f.database["v2/a"]) {
+		fmt.Println("\tCompare and swap did not fail as expected")
+		t.Fail()
+		return
+	}
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog("v2/a", []byte("other"), true, true))
+
+	if !f.testV2Error(f.leaderAddress, "POST", "/v2/kv/increment", "application/json", kv.V2IncrementRequest{Key: "v2/a"}, http.StatusConflict, kv.ErrorCodeNotANumber) {
+		t.Fail()
+		return
+	}
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog("v2/a", []byte("1"), true, true))
+
+	if !f.testV2State() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tErrors completed successfully!")
+}
+
+func TestV2Delete(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestV2Delete`..")
+	f := newCluster(t)
+
+	if !f.testV2Put(f.leaderAddress, "v2/b", []byte{0x00, 0xff, 'b'}) {
+		t.Fail()
+		return
+	}
+
+	var response kv.V2Response
+	if !f.testV2Request(f.followers[1].Address, "POST", "/v2/kv/delete", "application/json", kv.V2KeyRequest{Key: "v2/b"}, http.StatusOK, &response) ||
+		response.KV == nil || !bytes.Equal(response.KV.Value, f.database["v2/b"]) {
+		fmt.Println("\tDelete failed")
+		t.Fail()
+		return
+	}
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog("v2/b", nil, true, true))
+	delete(f.database, "v2/b")
+
+	if !f.testV2Error(f.leaderAddress, "POST", "/v2/kv/get", "application/json", kv.V2KeyRequest{Key: "v2/b"}, http.StatusNotFound, kv.ErrorCodeKeyNotFound) {
+		t.Fail()
+		return
+	}
+
+	if !f.testV2State() {
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tDelete completed successfully!")
+}
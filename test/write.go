@@ -5,18 +5,19 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
-	"time"
 
 	"github.com/Jonas-Heinrich/toy-distributed-key-value/kv"
 )
 
-func testWrite(address net.IP, key string, value string) bool {
-	return testWriteFollowers(followers, address, key, value)
+func (f *fixture) testWrite(address net.IP, key string, value string) bool {
+	return f.testWriteFollowers(f.followers, address, key, value)
 }
 
-func testWriteFollowers(followers []kv.Follower, address net.IP, key string, value string) bool {
-	resp, err := http.Post(kv.GetURL(address, "/write/"+key), "text", bytes.NewBuffer([]byte(value)))
+func (f *fixture) testWriteFollowers(followers []kv.Follower, address net.IP, key string, value string) bool {
+	resp, err := http.Post(nodeURL(address, "/write/"+key), "text", bytes.NewBuffer([]byte(value)))
 	if err != nil {
 		fmt.Println("\tWrite request failed")
 		return false
@@ -29,19 +30,17 @@ func testWriteFollowers(followers []kv.Follower, address net.IP, key string, val
 		return false
 	}
 
-	databaseLog = append(databaseLog, kv.CreateKeyValueLog(key, value, true, true))
-	database[key] = value
+	f.databaseLog = append(f.databaseLog, kv.CreateKeyValueLog(key, []byte(value), true, true))
+	f.database[key] = []byte(value)
+	f.contentTypes[key] = "text"
 
-	if !testLeaderState(followers) {
+	if !f.testLeaderState(followers) {
 		kv.ErrorLogger.Println("\tLeader state does not match expectations")
 		return false
 	}
 
-	// Wait for changes to fully propagate to every follower
-	time.Sleep(kv.LEADER_HEART_BEAT_TIMEOUT)
-
 	// Check follower state
-	if !testFollowerStates(followers) {
+	if !f.testFollowerStates(followers) {
 		kv.ErrorLogger.Println("\tFollower states do not match expectations")
 		return false
 	}
@@ -50,9 +49,11 @@ func testWriteFollowers(followers []kv.Follower, address net.IP, key string, val
 }
 
 func TestDirectWrite(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestDirectWrite`..")
+	f := newCluster(t)
 
-	if !testWrite(leaderAddress, "k1", "v1") {
+	if !f.testWrite(f.leaderAddress, "k1", "v1") {
 		fmt.Println("\tWrite request failed")
 		t.Fail()
 		return
@@ -62,9 +63,11 @@ func TestDirectWrite(t *testing.T) {
 }
 
 func TestIndirectWrite(t *testing.T) {
+	t.Parallel()
 	fmt.Println("Running test `TestIndirectWrite`..")
+	f := newCluster(t)
 
-	if !testWrite(leaderAddress, "k2", "v2") {
+	if !f.testWrite(f.leaderAddress, "k2", "v2") {
 		fmt.Println("\tWrite request failed")
 		t.Fail()
 		return
@@ -72,3 +75,63 @@ func TestIndirectWrite(t *testing.T) {
 
 	fmt.Println("\tWrite completed successfully!")
 }
+
+func TestConcurrentWrite(t *testing.T) {
+	t.Parallel()
+	fmt.Println("Running test `TestConcurrentWrite`..")
+	f := newCluster(t)
+
+	const writeCount = 50
+
+	// Send all writes at once, half of them through followers
+	var waitGroup sync.WaitGroup
+	var failed uint64 = 0
+	for i := 0; i < writeCount; i++ {
+		address := f.leaderAddress
+		if i%2 == 1 {
+			address = f.followers[i%len(f.followers)].Address
+		}
+
+		waitGroup.Add(1)
+		go func(address net.IP, key string, value string) {
+			defer waitGroup.Done()
+
+			resp, err := http.Post(nodeURL(address, "/write/"+key), "text", bytes.NewBuffer([]byte(value)))
+			if err == nil {
+				defer resp.Body.Close()
+			}
+			if err != nil || !kv.TestEqualMessageResponse(resp, http.StatusOK, kv.StatusOKMessage) {
+				atomic.AddUint64(&failed, 1)
+			}
+		}(address, fmt.Sprintf("c%d", i), fmt.Sprintf("v%d", i))
+	}
+	waitGroup.Wait()
+
+	if failed > 0 {
+		fmt.Printf("\t%d concurrent writes failed\n", failed)
+		t.Fail()
+		return
+	}
+
+	// The order of concurrent writes is decided by the leader, so adopt it for the expected log
+	expectedLogLength := len(f.databaseLog) + writeCount
+	if !f.testAdoptLeaderState() || len(f.databaseLog) != expectedLogLength {
+		fmt.Printf("\tLeader log has unexpected length (%d)\n", len(f.databaseLog))
+		t.Fail()
+		return
+	}
+
+	if !f.testLeaderState(f.followers) {
+		kv.ErrorLogger.Println("\tLeader state does not match expectations")
+		t.Fail()
+		return
+	}
+
+	if !f.testFollowerStates(f.followers) {
+		kv.ErrorLogger.Println("\tFollower states do not match expectations")
+		t.Fail()
+		return
+	}
+
+	fmt.Println("\tConcurrent writes completed successfully!")
+}